@@ -47,6 +47,7 @@ import (
 	httpSwagger "github.com/swaggo/http-swagger"
 
 	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -135,7 +136,7 @@ func initEnv() {
 
 func main() {
 	var flagReinitDB, flagInit, flagServer, flagSyncLDAP, flagGops, flagMigrateDB, flagDev, flagVersion, flagLogDateTime bool
-	var flagNewUser, flagDelUser, flagGenJWT, flagConfigFile, flagImportJob, flagLogLevel string
+	var flagNewUser, flagDelUser, flagGenJWT, flagConfigFile, flagImportJob, flagLogLevel, flagBackup, flagRestore string
 	flag.BoolVar(&flagInit, "init", false, "Setup var directory, initialize swlite database file, config.json and .env")
 	flag.BoolVar(&flagReinitDB, "init-db", false, "Go through job-archive and re-initialize the 'job', 'tag', and 'jobtag' tables (all running jobs will be lost!)")
 	flag.BoolVar(&flagSyncLDAP, "sync-ldap", false, "Sync the 'user' table with ldap")
@@ -150,6 +151,8 @@ func main() {
 	flag.StringVar(&flagDelUser, "del-user", "", "Remove user by `username`")
 	flag.StringVar(&flagGenJWT, "jwt", "", "Generate and print a JWT for the user specified by its `username`")
 	flag.StringVar(&flagImportJob, "import-job", "", "Import a job. Argument format: `<path-to-meta.json>:<path-to-data.json>,...`")
+	flag.StringVar(&flagBackup, "backup", "", "Write a snapshot of the database to `file`, can be used while a server is running")
+	flag.StringVar(&flagRestore, "restore", "", "Replace the database with the snapshot in `file` and exit (the server must be stopped)")
 	flag.StringVar(&flagLogLevel, "loglevel", "warn", "Sets the logging level: `[debug,info,warn (default),err,fatal,crit]`")
 	flag.Parse()
 
@@ -205,9 +208,24 @@ func main() {
 		os.Exit(0)
 	}
 
+	if flagRestore != "" {
+		if err := repository.Restore(config.Keys.DBDriver, config.Keys.DB, flagRestore); err != nil {
+			log.Fatalf("restoring database failed: %v", err)
+		}
+		log.Infof("Restored database from %s", flagRestore)
+		os.Exit(0)
+	}
+
 	repository.Connect(config.Keys.DBDriver, config.Keys.DB)
 	db := repository.GetConnection()
 
+	if flagBackup != "" {
+		if err := repository.Backup(flagBackup); err != nil {
+			log.Fatalf("database backup failed: %v", err)
+		}
+		log.Infof("Wrote database backup to %s", flagBackup)
+	}
+
 	var authentication *auth.Authentication
 	if !config.Keys.DisableAuthentication {
 		var err error
@@ -226,17 +244,26 @@ func main() {
 			}
 
 			ur := repository.GetUserRepository()
-			if err := ur.AddUser(&schema.User{
+			user := &schema.User{
 				Username: parts[0], Projects: make([]string, 0), Password: parts[2], Roles: strings.Split(parts[1], ","),
-			}); err != nil {
+			}
+			if err := ur.AddUser(user); err != nil {
 				log.Fatalf("adding '%s' user authentication failed: %v", parts[0], err)
 			}
+			repository.GetAuditRepository().Record(context.Background(), repository.AuditUserCreate,
+				repository.AuditUserTarget(user.Username), nil, repository.NewAuditUser(user))
 		}
 		if flagDelUser != "" {
 			ur := repository.GetUserRepository()
+			var before *repository.AuditUser
+			if user, err := ur.GetUser(flagDelUser); err == nil {
+				before = repository.NewAuditUser(user)
+			}
 			if err := ur.DelUser(flagDelUser); err != nil {
 				log.Fatalf("deleting user failed: %v", err)
 			}
+			repository.GetAuditRepository().Record(context.Background(), repository.AuditUserDelete,
+				repository.AuditUserTarget(flagDelUser), before, nil)
 		}
 
 		if flagSyncLDAP {
@@ -265,6 +292,8 @@ func main() {
 			if err != nil {
 				log.Fatalf("failed to provide JWT to user '%s': %v", user.Username, err)
 			}
+			repository.GetAuditRepository().Record(context.Background(), repository.AuditJWTGenerate,
+				repository.AuditUserTarget(user.Username), nil, nil)
 
 			fmt.Printf("MAIN > JWT for '%s': %s\n", user.Username, jwt)
 		}
@@ -298,6 +327,12 @@ func main() {
 
 	// Setup the http.Handler/Router used by the server
 	jobRepo := repository.GetJobRepository()
+	if err := jobRepo.InitRollups(); err != nil {
+		log.Fatalf("building rollups failed: %v", err)
+	}
+	if err := repository.GetNodeRepository().SyncNodes(archive.Clusters); err != nil {
+		log.Errorf("registering nodes failed: %v", err)
+	}
 	resolver := &graph.Resolver{DB: db.DB, Repo: jobRepo}
 	graphQLEndpoint := handler.NewDefaultServer(generated.NewExecutableSchema(generated.Config{Resolvers: resolver}))
 	if os.Getenv("DEBUG") != "1" {
@@ -535,6 +570,13 @@ func main() {
 		})
 	}
 
+	log.Info("Register rollup rebuild service")
+
+	s.Every(1).Day().At("3:30").Do(func() {
+		jobRepo.RefreshRollups()
+		runtime.GC()
+	})
+
 	var cfg struct {
 		Compression int              `json:"compression"`
 		Retention   schema.Retention `json:"retention"`
@@ -559,11 +601,13 @@ func main() {
 			archive.GetHandle().CleanUp(jobs)
 
 			if cfg.Retention.IncludeDB {
-				cnt, err := jobRepo.DeleteJobsBefore(startTime)
+				cnt, err := jobRepo.PurgeJobsBefore(startTime)
 				if err != nil {
 					log.Errorf("Error while deleting retention jobs from db: %s", err.Error())
 				} else {
 					log.Infof("Retention: Removed %d jobs from db", cnt)
+					repository.GetAuditRepository().Record(context.Background(), repository.AuditJobDeleteBefore, "job/*",
+						nil, map[string]int64{"startTimeBefore": startTime, "count": int64(cnt)})
 				}
 				if err = jobRepo.Optimize(); err != nil {
 					log.Errorf("Error occured in db optimization: %s", err.Error())
@@ -582,11 +626,13 @@ func main() {
 			archive.GetHandle().Move(jobs, cfg.Retention.Location)
 
 			if cfg.Retention.IncludeDB {
-				cnt, err := jobRepo.DeleteJobsBefore(startTime)
+				cnt, err := jobRepo.PurgeJobsBefore(startTime)
 				if err != nil {
 					log.Errorf("Error while deleting retention jobs from db: %v", err)
 				} else {
 					log.Infof("Retention: Removed %d jobs from db", cnt)
+					repository.GetAuditRepository().Record(context.Background(), repository.AuditJobDeleteBefore, "job/*",
+						nil, map[string]int64{"startTimeBefore": startTime, "count": int64(cnt)})
 				}
 				if err = jobRepo.Optimize(); err != nil {
 					log.Errorf("Error occured in db optimization: %v", err)
@@ -595,6 +641,74 @@ func main() {
 		})
 	}
 
+	log.Info("Register trash purge service")
+
+	s.Every(1).Day().At("4:15").Do(func() {
+		deletedBefore := time.Now().Unix() - int64(config.Keys.TrashGracePeriod*24*3600)
+		jobs, err := jobRepo.FindTrashedBefore(deletedBefore)
+		if err != nil {
+			log.Warnf("Error while looking for trashed jobs: %s", err.Error())
+			return
+		}
+		if len(jobs) == 0 {
+			return
+		}
+
+		// Only jobs still in the trash are removed, restored ones keep their data
+		ids, err := jobRepo.PurgeJobs(jobs)
+		if err != nil {
+			log.Errorf("Error while purging trashed jobs from db: %s", err.Error())
+			return
+		}
+		purged := make(map[int64]bool, len(ids))
+		for _, id := range ids {
+			purged[id] = true
+		}
+		cleanup := make([]*schema.Job, 0, len(ids))
+		for _, job := range jobs {
+			if purged[job.ID] {
+				cleanup = append(cleanup, job)
+			}
+		}
+		archive.GetHandle().CleanUp(cleanup)
+
+		log.Infof("Trash: Purged %d jobs", len(ids))
+		repository.GetAuditRepository().Record(context.Background(), repository.AuditJobPurge, "job/*",
+			nil, map[string]int64{"deletedBefore": deletedBefore, "count": int64(len(ids))})
+	})
+
+	if config.Keys.AuditRetention > 0 {
+		log.Info("Register audit log retention service")
+
+		s.Every(1).Day().At("4:30").Do(func() {
+			ts := time.Now().Unix() - int64(config.Keys.AuditRetention*24*3600)
+			cnt, err := repository.GetAuditRepository().DeleteBefore(ts)
+			if err != nil {
+				log.Errorf("Error while deleting audit log entries: %v", err)
+			} else {
+				log.Infof("Audit log retention: Removed %d entries", cnt)
+			}
+		})
+	}
+
+	if config.Keys.DBBackup != nil {
+		interval, err := time.ParseDuration(config.Keys.DBBackup.Interval)
+		if err != nil || interval <= 0 {
+			log.Fatalf("invalid database backup interval '%s'", config.Keys.DBBackup.Interval)
+		}
+
+		log.Info("Register database backup service")
+
+		s.Every(interval).WaitForSchedule().Do(func() {
+			file, err := repository.RotateBackups(config.Keys.DBBackup.Directory, config.Keys.DBBackup.Keep)
+			if err != nil {
+				log.Errorf("Error while writing database backup: %v", err)
+			} else {
+				log.Infof("Database backup: Wrote %s", file)
+			}
+		})
+	}
+
 	if cfg.Compression > 0 {
 		log.Info("Register compression service")
 
@@ -9,6 +9,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -213,7 +214,9 @@ func TestRestApi(t *testing.T) {
 		"exclusive":        1,
 		"monitoringStatus": 1,
 		"smt":              1,
-		"tags":             [{ "type": "testTagType", "name": "testTagName" }],
+		"energy":           1000,
+		"tags":             [{ "type": "testTagType", "name": "testTagName" },
+		                     { "type": "testTagType", "name": "testProjectTag", "scope": "project", "owner": "otherproj" }],
 		"resources": [
 			{
 				"hostname": "host123",
@@ -264,20 +267,66 @@ func TestRestApi(t *testing.T) {
 			job.Exclusive != 1 ||
 			job.MonitoringStatus != 1 ||
 			job.SMT != 1 ||
+			job.Energy != 0 ||
 			!reflect.DeepEqual(job.Resources, []*schema.Resource{{Hostname: "host123", HWThreads: []int{0, 1, 2, 3, 4, 5, 6, 7}}}) ||
 			job.StartTime.Unix() != 123456789 {
 			t.Fatalf("unexpected job properties: %#v", job)
 		}
 
-		if len(job.Tags) != 1 || job.Tags[0].Type != "testTagType" || job.Tags[0].Name != "testTagName" {
+		if len(job.Tags) != 2 || job.Tags[0].Type != "testTagType" || job.Tags[0].Name != "testTagName" {
 			t.Fatalf("unexpected tags: %#v", job.Tags)
 		}
+		if _, exists := restapi.JobRepository.TagId("testTagType", "testProjectTag", schema.TagScopeProject, "testproj"); !exists {
+			t.Fatalf("project tag not owned by the project of the job")
+		}
 
 		dbid = res.DBID
 	}); !ok {
 		return
 	}
 
+	if ok := t.Run("StartAndStopStep", func(t *testing.T) {
+		for _, body := range []string{
+			`{"jobId": 123, "cluster": "testcluster", "startTime": 123456789, "step": {"stepId": "0", "name": "lmp", "startTime": 123456909}}`,
+			`{"jobId": 123, "cluster": "testcluster", "startTime": 123456789, "step": {"stepId": "1", "startTime": 123456909}}`,
+		} {
+			req := httptest.NewRequest(http.MethodPost, "/api/jobs/start_job/", bytes.NewBuffer([]byte(body)))
+			recorder := httptest.NewRecorder()
+			r.ServeHTTP(recorder, req)
+			if recorder.Result().StatusCode != http.StatusCreated {
+				t.Fatal(recorder.Result().Status, recorder.Body.String())
+			}
+		}
+
+		body := `{"jobId": 123, "cluster": "testcluster", "startTime": 123456789, "jobState": "completed", "stopTime": 123457089, "step": {"stepId": "0", "exitCode": 0}}`
+		req := httptest.NewRequest(http.MethodPost, "/api/jobs/stop_job/", bytes.NewBuffer([]byte(body)))
+		recorder := httptest.NewRecorder()
+		r.ServeHTTP(recorder, req)
+		if recorder.Result().StatusCode != http.StatusOK {
+			t.Fatal(recorder.Result().Status, recorder.Body.String())
+		}
+
+		steps, err := restapi.JobRepository.GetSteps(dbid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(steps) != 2 || steps[0].State != schema.JobStateCompleted || steps[0].ExitCode == nil ||
+			steps[1].State != schema.JobStateRunning || len(steps[1].Resources) != 1 {
+			t.Fatalf("unexpected steps: %#v", steps)
+		}
+
+		// Samples 2 to 5 of the test data
+		stats, err := restapi.Resolver.JobStep().Statistics(context.Background(), steps[0], []string{"load_one"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(stats) != 1 || stats[0].Min != 0.1 || stats[0].Max != 0.2 || math.Abs(stats[0].Avg-0.175) > 1e-9 {
+			t.Fatalf("unexpected step statistics: %#v", stats)
+		}
+	}); !ok {
+		return
+	}
+
 	const stopJobBody string = `{
         "jobId":     123,
 		"startTime": 123456789,
@@ -312,6 +361,14 @@ func TestRestApi(t *testing.T) {
 			t.Fatalf("unexpected job properties: %#v", job)
 		}
 
+		step, err := restapi.JobRepository.GetStep(dbid, "1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if step.State != schema.JobStateCompleted || step.StopTime == nil || step.StopTime.Unix() != 123457789 {
+			t.Fatalf("expected running step to be stopped with the job: %#v", step)
+		}
+
 		job.MetaData, err = restapi.JobRepository.FetchMetadata(job)
 		if err != nil {
 			t.Fatal(err)
@@ -327,7 +384,7 @@ func TestRestApi(t *testing.T) {
 	}
 
 	t.Run("CheckArchive", func(t *testing.T) {
-		data, err := metricdata.LoadData(stoppedJob, []string{"load_one"}, []schema.MetricScope{schema.MetricScopeNode}, context.Background())
+		data, err := metricdata.LoadData(stoppedJob, []string{"load_one"}, []schema.MetricScope{schema.MetricScopeNode}, nil, context.Background())
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -337,6 +394,71 @@ func TestRestApi(t *testing.T) {
 		}
 	})
 
+	t.Run("UpdateJob", func(t *testing.T) {
+		body := `{"walltime": 7200, "partition": "long", "metaData": {"jobName": "lmp"},
+			"resources": [{"hostname": "host123", "hwthreads": [0, 1, 2, 3]}]}`
+		req := httptest.NewRequest(http.MethodPatch, fmt.Sprintf("/api/jobs/%d", dbid), bytes.NewBuffer([]byte(body)))
+		recorder := httptest.NewRecorder()
+
+		r.ServeHTTP(recorder, req)
+		response := recorder.Result()
+		if response.StatusCode != http.StatusOK {
+			t.Fatal(response.Status, recorder.Body.String())
+		}
+
+		job, err := restapi.JobRepository.FindById(dbid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		job.MetaData, err = restapi.JobRepository.FetchMetadata(job)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Walltime != 7200 || job.Partition != "long" || job.NumHWThreads != 4 ||
+			!reflect.DeepEqual(job.MetaData, map[string]string{"jobScript": "blablabla...", "jobName": "lmp"}) {
+			t.Fatalf("unexpected job properties: %#v", job)
+		}
+
+		jobMeta, err := archive.GetHandle().LoadJobMeta(job)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if jobMeta.Walltime != 7200 || jobMeta.Partition != "long" || jobMeta.NumHWThreads != 4 ||
+			jobMeta.MetaData["jobName"] != "lmp" {
+			t.Fatalf("unexpected archived job properties: %#v", jobMeta)
+		}
+
+		// Only whitelisted fields may be changed, and only to valid values
+		for _, body := range []string{`{"user": "other"}`, `{"walltime": -1, "metaData": {"jobName": "other"}}`} {
+			req = httptest.NewRequest(http.MethodPatch, fmt.Sprintf("/api/jobs/%d", dbid), bytes.NewBuffer([]byte(body)))
+			recorder = httptest.NewRecorder()
+			r.ServeHTTP(recorder, req)
+			if recorder.Result().StatusCode != http.StatusBadRequest {
+				t.Fatal(recorder.Result().Status, recorder.Body.String())
+			}
+		}
+		if metaData, err := restapi.JobRepository.FetchMetadata(&schema.Job{ID: dbid}); err != nil || metaData["jobName"] != "lmp" {
+			t.Fatalf("metadata changed by rejected update: %v", metaData)
+		}
+	})
+
+	t.Run("MetaDataRange", func(t *testing.T) {
+		for query, status := range map[string]int{
+			"meta-data-range=temp:-10--1":   http.StatusOK,
+			"meta-data-range=temp:1e-3-2e2": http.StatusOK,
+			"meta-data-range=temp:-5":       http.StatusBadRequest,
+		} {
+			req := httptest.NewRequest(http.MethodGet, "/api/jobs/?"+query, nil)
+			req = req.WithContext(context.WithValue(req.Context(), repository.ContextUserKey,
+				&schema.User{Username: "api", Roles: []string{schema.GetRoleString(schema.RoleApi)}}))
+			recorder := httptest.NewRecorder()
+			r.ServeHTTP(recorder, req)
+			if recorder.Result().StatusCode != status {
+				t.Errorf("%s: %s %s", query, recorder.Result().Status, recorder.Body.String())
+			}
+		}
+	})
+
 	t.Run("CheckDoubleStart", func(t *testing.T) {
 		// Starting a job with the same jobId and cluster should only be allowed if the startTime is far appart!
 		body := strings.Replace(startJobBody, `"startTime": 123456789`, `"startTime": 123456790`, -1)
@@ -351,6 +473,20 @@ func TestRestApi(t *testing.T) {
 		}
 	})
 
+	t.Run("CheckInvalidTagScope", func(t *testing.T) {
+		body := strings.Replace(startJobBody, `"scope": "project"`, `"scope": "everyone"`, -1)
+		body = strings.Replace(body, `"jobId":            123,`, `"jobId":            124,`, -1)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/jobs/start_job/", bytes.NewBuffer([]byte(body)))
+		recorder := httptest.NewRecorder()
+
+		r.ServeHTTP(recorder, req)
+		response := recorder.Result()
+		if response.StatusCode != http.StatusBadRequest {
+			t.Fatal(response.Status, recorder.Body.String())
+		}
+	})
+
 	const startJobBodyFailed string = `{
         "jobId":            12345,
 		"user":             "testuser",
@@ -1259,6 +1259,17 @@ const docTemplate = `{
                     "minimum": 0,
                     "example": 1
                 },
+                "flopsAnyAvg": {
+                    "description": "Deprecated: Use footprint 'flops_any_avg', will be removed in the next release",
+                    "type": "number"
+                },
+                "footprint": {
+                    "description": "Footprint statistics of job, keyed by '\u003cmetric\u003e_\u003cstat\u003e'",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "number"
+                    }
+                },
                 "id": {
                     "description": "The unique identifier of a job in the database",
                     "type": "integer"
@@ -1285,6 +1296,18 @@ const docTemplate = `{
                     ],
                     "example": "completed"
                 },
+                "loadAvg": {
+                    "description": "Deprecated: Use footprint 'cpu_load_avg', will be removed in the next release",
+                    "type": "number"
+                },
+                "memBwAvg": {
+                    "description": "Deprecated: Use footprint 'mem_bw_avg', will be removed in the next release",
+                    "type": "number"
+                },
+                "memUsedMax": {
+                    "description": "Deprecated: Use footprint 'mem_used_max', will be removed in the next release",
+                    "type": "number"
+                },
                 "metaData": {
                     "description": "Additional information about the job",
                     "type": "object",
@@ -70,11 +70,24 @@ func (api *RestApi) MountRoutes(r *mux.Router) {
 
 	r.HandleFunc("/jobs/", api.getJobs).Methods(http.MethodGet)
 	r.HandleFunc("/jobs/{id}", api.getJobById).Methods(http.MethodPost)
+	r.HandleFunc("/jobs/{id}", api.updateJob).Methods(http.MethodPatch)
 	r.HandleFunc("/jobs/tag_job/{id}", api.tagJob).Methods(http.MethodPost, http.MethodPatch)
+	r.HandleFunc("/jobs/array_job/{cluster}/{id}", api.getArrayJob).Methods(http.MethodGet)
+	r.HandleFunc("/jobs/annotations/{id}", api.getJobAnnotations).Methods(http.MethodGet)
+	r.HandleFunc("/jobs/annotate_job/{id}", api.annotateJob).Methods(http.MethodPost)
+	r.HandleFunc("/jobs/delete_annotation/{id}", api.deleteAnnotation).Methods(http.MethodDelete)
 	r.HandleFunc("/jobs/metrics/{id}", api.getJobMetrics).Methods(http.MethodGet)
 	r.HandleFunc("/jobs/delete_job/", api.deleteJobByRequest).Methods(http.MethodDelete)
 	r.HandleFunc("/jobs/delete_job/{id}", api.deleteJobById).Methods(http.MethodDelete)
 	r.HandleFunc("/jobs/delete_job_before/{ts}", api.deleteJobBefore).Methods(http.MethodDelete)
+	r.HandleFunc("/jobs/restore_job/{id}", api.restoreJobById).Methods(http.MethodPost)
+	r.HandleFunc("/jobs/restore_job_before/{ts}", api.restoreJobBefore).Methods(http.MethodPost)
+
+	r.HandleFunc("/nodestate/", api.updateNodeStates).Methods(http.MethodPost, http.MethodPut)
+	r.HandleFunc("/reservations/", api.getReservations).Methods(http.MethodGet)
+	r.HandleFunc("/reservations/", api.saveReservation).Methods(http.MethodPost, http.MethodPut)
+	r.HandleFunc("/reservations/{id}", api.saveReservation).Methods(http.MethodPost, http.MethodPut)
+	r.HandleFunc("/reservations/{id}", api.deleteReservation).Methods(http.MethodDelete)
 
 	if api.MachineStateDir != "" {
 		r.HandleFunc("/machine_state/{cluster}/{host}", api.getMachineState).Methods(http.MethodGet)
@@ -89,9 +102,18 @@ func (api *RestApi) MountRoutes(r *mux.Router) {
 		r.HandleFunc("/users/", api.deleteUser).Methods(http.MethodDelete)
 		r.HandleFunc("/user/{id}", api.updateUser).Methods(http.MethodPost)
 		r.HandleFunc("/configuration/", api.updateConfiguration).Methods(http.MethodPost)
+		r.HandleFunc("/audit/", api.getAuditLog).Methods(http.MethodGet)
+		r.HandleFunc("/sql-stats/", api.getQueryStats).Methods(http.MethodGet)
+		r.HandleFunc("/sql-stats/", api.resetQueryStats).Methods(http.MethodDelete)
 	}
 }
 
+// StartJobApiRequest model
+type StartJobApiRequest struct {
+	schema.JobMeta
+	Step *StepApiRequest `json:"step"` // Step to add to the running job given by jobId, cluster and startTime instead of starting a job
+}
+
 // StartJobApiResponse model
 type StartJobApiResponse struct {
 	// Database ID of new job
@@ -103,6 +125,26 @@ type DeleteJobApiResponse struct {
 	Message string `json:"msg"`
 }
 
+// RestoreJobApiResponse model
+type RestoreJobApiResponse struct {
+	Message string `json:"msg"`
+}
+
+// DeleteAnnotationApiResponse model
+type DeleteAnnotationApiResponse struct {
+	Message string `json:"msg"`
+}
+
+// UpdateNodeStatesApiResponse model
+type UpdateNodeStatesApiResponse struct {
+	Message string `json:"msg"`
+}
+
+// DeleteReservationApiResponse model
+type DeleteReservationApiResponse struct {
+	Message string `json:"msg"`
+}
+
 // UpdateUserApiResponse model
 type UpdateUserApiResponse struct {
 	Message string `json:"msg"`
@@ -116,6 +158,32 @@ type StopJobApiRequest struct {
 	JobId     *int64          `json:"jobId" example:"123000"`                           // Cluster Job ID of job
 	Cluster   *string         `json:"cluster" example:"fritz"`                          // Cluster of job
 	StartTime *int64          `json:"startTime" example:"1649723812"`                   // Start Time of job as epoch
+	Step      *StepApiRequest `json:"step"`                                             // Step to stop instead of the job, stopTime and jobState apply to the step
+}
+
+// StepApiRequest model
+type StepApiRequest struct {
+	StepId    string             `json:"stepId" validate:"required" example:"0"` // Scheduler id of the step
+	Name      string             `json:"name" example:"lmp"`                     // Name of the step, only used when starting the step
+	StartTime int64              `json:"startTime" example:"1649723900"`         // Start Time of step as epoch, only used when starting the step
+	Resources []*schema.Resource `json:"resources"`                              // Resources of the step, all resources of the job if empty
+	ExitCode  *int               `json:"exitCode" example:"0"`                   // Exit code of step, only used when stopping the step
+}
+
+// UpdateJobApiRequest model
+type UpdateJobApiRequest struct {
+	Walltime   *int64             `json:"walltime" example:"86400"`       // Requested walltime of job in seconds
+	Partition  *string            `json:"partition" example:"main"`       // Partition of job
+	ArrayJobId *int64             `json:"arrayJobId" example:"123000"`    // Array job id of job
+	Resources  []*schema.Resource `json:"resources"`                      // Corrected resources of job
+	MetaData   map[string]string  `json:"metaData" example:"jobName:lmp"` // Metadata keys to add or overwrite
+}
+
+// UpdateNodeStatesApiRequest model
+type UpdateNodeStatesApiRequest struct {
+	Cluster string                        `json:"cluster" validate:"required" example:"fritz"` // Cluster of the nodes
+	Time    *int64                        `json:"time" example:"1649723812"`                   // Time of the report as epoch, now if empty
+	Nodes   []*repository.NodeStateReport `json:"nodes" validate:"required"`                   // Reported node states
 }
 
 // DeleteJobApiRequest model
@@ -127,9 +195,33 @@ type DeleteJobApiRequest struct {
 
 // GetJobsApiResponse model
 type GetJobsApiResponse struct {
-	Jobs  []*schema.JobMeta `json:"jobs"`  // Array of jobs
-	Items int               `json:"items"` // Number of jobs returned
-	Page  int               `json:"page"`  // Page id returned
+	Jobs       []*schema.JobMeta `json:"jobs"`                 // Array of jobs
+	Items      int               `json:"items"`                // Number of jobs returned
+	Page       int               `json:"page"`                 // Page id returned
+	NextCursor string            `json:"nextCursor,omitempty"` // Cursor of the next page, if paging by cursor and there are more jobs
+}
+
+// GetArrayJobApiResponse model
+type GetArrayJobApiResponse struct {
+	*model.ArrayJob
+	TotalWalltime  int     `json:"totalWalltime"`  // Sum of the durations of all members in hours
+	TotalNodeHours int     `json:"totalNodeHours"` // Sum of the node hours of all members
+	TotalCoreHours int     `json:"totalCoreHours"` // Sum of the core hours of all members
+	TotalAccHours  int     `json:"totalAccHours"`  // Sum of the accelerator hours of all members
+	FailedTasks    []int64 `json:"failedTasks"`    // Database IDs of the members that failed, timed out or ran out of memory
+}
+
+// GetAuditLogApiResponse model
+type GetAuditLogApiResponse struct {
+	Entries []*repository.AuditEntry `json:"entries"` // Array of audit entries
+	Items   int                      `json:"items"`   // Number of entries returned
+	Page    int                      `json:"page"`    // Page id returned
+}
+
+// GetQueryStatsApiResponse model
+type GetQueryStatsApiResponse struct {
+	Buckets []float64                `json:"buckets"` // Upper bounds of the latency histogram buckets in milliseconds
+	Queries []*repository.QueryStats `json:"queries"` // Statistics per statement
 }
 
 // ErrorResponse model
@@ -185,6 +277,18 @@ func decode(r io.Reader, val interface{}) error {
 	return dec.Decode(val)
 }
 
+// Splits a range like '-10-1e-3' at the first '-' following a digit or a dot,
+// so that both bounds may be negative or have negative exponents.
+func splitRange(rng string) (string, string, bool) {
+	for i := 1; i < len(rng); i++ {
+		if rng[i] == '-' && (rng[i-1] >= '0' && rng[i-1] <= '9' || rng[i-1] == '.') {
+			return rng[:i], rng[i+1:], true
+		}
+	}
+
+	return "", "", false
+}
+
 func securedCheck(r *http.Request) error {
 	user := repository.GetUserFromContext(r.Context())
 	if user == nil {
@@ -234,7 +338,10 @@ func securedCheck(r *http.Request) error {
 // @param       start-time     query    string            false "Syntax: '$from-$to', as unix epoch timestamps in seconds"
 // @param       items-per-page query    int               false "Items per page (Default: 25)"
 // @param       page           query    int               false "Page Number (Default: 1)"
+// @param       cursor         query    string            false "Page by cursor instead of page number, empty for the first page, then the nextCursor of the previous response"
 // @param       with-metadata  query    bool              false "Include metadata (e.g. jobScript) in response"
+// @param       meta-data      query    string            false "Syntax: '$key:$value' for jobs with the metadata value, '$key' for jobs with the metadata key set. Can be repeated."
+// @param       meta-data-range query   string            false "Syntax: '$key:$from-$to' for jobs with a numeric metadata value in the range, bounds may be negative like 'temp:-10-1e2'. Can be repeated."
 // @success     200            {object} api.GetJobsApiResponse  "Job array and page info"
 // @failure     400            {object} api.ErrorResponse       "Bad Request"
 // @failure     401   		   {object} api.ErrorResponse       "Unauthorized"
@@ -252,6 +359,7 @@ func (api *RestApi) getJobs(rw http.ResponseWriter, r *http.Request) {
 	}
 
 	withMetadata := false
+	var cursor *string
 	filter := &model.JobFilter{}
 	page := &model.PageRequest{ItemsPerPage: 25, Page: 1}
 	order := &model.OrderByInput{Field: "startTime", Order: model.SortDirectionEnumDesc}
@@ -303,8 +411,43 @@ func (api *RestApi) getJobs(rw http.ResponseWriter, r *http.Request) {
 				return
 			}
 			page.ItemsPerPage = x
+		case "cursor":
+			cursor = &vals[0]
 		case "with-metadata":
 			withMetadata = true
+		case "meta-data":
+			for _, v := range vals {
+				key, value, found := strings.Cut(v, ":")
+				f := &model.MetaDataFilter{Key: key}
+				if found {
+					f.Value = &model.StringInput{Eq: &value}
+				} else {
+					exists := true
+					f.Exists = &exists
+				}
+				filter.MetaData = append(filter.MetaData, f)
+			}
+		case "meta-data-range":
+			for _, v := range vals {
+				key, rng, _ := strings.Cut(v, ":")
+				lower, upper, ok := splitRange(rng)
+				if !ok {
+					handleError(fmt.Errorf("invalid query parameter value: meta-data-range"),
+						http.StatusBadRequest, rw)
+					return
+				}
+				from, err := strconv.ParseFloat(lower, 64)
+				if err != nil {
+					handleError(err, http.StatusBadRequest, rw)
+					return
+				}
+				to, err := strconv.ParseFloat(upper, 64)
+				if err != nil {
+					handleError(err, http.StatusBadRequest, rw)
+					return
+				}
+				filter.MetaData = append(filter.MetaData, &model.MetaDataFilter{Key: key, Range: &model.FloatRange{From: from, To: to}})
+			}
 		default:
 			handleError(fmt.Errorf("invalid query parameter: %s", key),
 				http.StatusBadRequest, rw)
@@ -312,8 +455,18 @@ func (api *RestApi) getJobs(rw http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	jobs, err := api.JobRepository.QueryJobs(r.Context(), []*model.JobFilter{filter}, page, order)
-	if err != nil {
+	var jobs []*schema.Job
+	var nextCursor string
+	var err error
+	if cursor != nil {
+		jobs, nextCursor, err = api.JobRepository.QueryJobsCursor(r.Context(), []*model.JobFilter{filter}, page.ItemsPerPage, order, *cursor)
+	} else {
+		jobs, err = api.JobRepository.QueryJobs(r.Context(), []*model.JobFilter{filter}, page, order)
+	}
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		handleError(err, http.StatusBadRequest, rw)
+		return
+	} else if err != nil {
 		handleError(err, http.StatusInternalServerError, rw)
 		return
 	}
@@ -333,7 +486,7 @@ func (api *RestApi) getJobs(rw http.ResponseWriter, r *http.Request) {
 			StartTime: job.StartTime.Unix(),
 		}
 
-		res.Tags, err = api.JobRepository.GetTags(&job.ID)
+		res.Tags, err = api.JobRepository.GetTags(repository.GetUserFromContext(r.Context()), &job.ID)
 		if err != nil {
 			handleError(err, http.StatusInternalServerError, rw)
 			return
@@ -358,9 +511,10 @@ func (api *RestApi) getJobs(rw http.ResponseWriter, r *http.Request) {
 	defer bw.Flush()
 
 	payload := GetJobsApiResponse{
-		Jobs:  results,
-		Items: page.ItemsPerPage,
-		Page:  page.Page,
+		Jobs:       results,
+		Items:      page.ItemsPerPage,
+		Page:       page.Page,
+		NextCursor: nextCursor,
 	}
 
 	if err := json.NewEncoder(bw).Encode(payload); err != nil {
@@ -431,7 +585,7 @@ func (api *RestApi) getJobById(rw http.ResponseWriter, r *http.Request) {
 		scopes = []schema.MetricScope{"node"}
 	}
 
-	data, err := metricdata.LoadData(job, metrics, scopes, r.Context())
+	data, err := metricdata.LoadData(job, metrics, scopes, nil, r.Context())
 	if err != nil {
 		log.Warn("Error while loading job data")
 		return
@@ -469,6 +623,7 @@ func (api *RestApi) getJobById(rw http.ResponseWriter, r *http.Request) {
 // @tags Job add and modify
 // @description Adds tag(s) to a job specified by DB ID. Name and Type of Tag(s) can be chosen freely.
 // @description If tagged job is already finished: Tag will be written directly to respective archive files.
+// @description Tags added here are global tags, visible to everyone who can see the job.
 // @accept      json
 // @produce     json
 // @param       id      path     int                  true "Job Database ID"
@@ -500,7 +655,7 @@ func (api *RestApi) tagJob(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	job.Tags, err = api.JobRepository.GetTags(&job.ID)
+	job.Tags, err = api.JobRepository.GetTags(repository.GetUserFromContext(r.Context()), &job.ID)
 	if err != nil {
 		http.Error(rw, err.Error(), http.StatusInternalServerError)
 		return
@@ -513,16 +668,19 @@ func (api *RestApi) tagJob(rw http.ResponseWriter, r *http.Request) {
 	}
 
 	for _, tag := range req {
-		tagId, err := api.JobRepository.AddTagOrCreate(job.ID, tag.Type, tag.Name)
+		tagId, err := api.JobRepository.AddTagOrCreate(job.ID, tag.Type, tag.Name, schema.TagScopeGlobal, "")
 		if err != nil {
 			http.Error(rw, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		repository.GetAuditRepository().Record(r.Context(), repository.AuditTagAdd, repository.AuditJobTarget(job.ID),
+			nil, &schema.Tag{ID: tagId, Type: tag.Type, Name: tag.Name, Scope: schema.TagScopeGlobal})
 
 		job.Tags = append(job.Tags, &schema.Tag{
-			ID:   tagId,
-			Type: tag.Type,
-			Name: tag.Name,
+			ID:    tagId,
+			Type:  tag.Type,
+			Name:  tag.Name,
+			Scope: schema.TagScopeGlobal,
 		})
 	}
 
@@ -531,15 +689,261 @@ func (api *RestApi) tagJob(rw http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(rw).Encode(job)
 }
 
+// updateJob godoc
+// @summary     Updates fields and metadata of a job
+// @tags Job add and modify
+// @description Changes the walltime, partition, array job id or resources of a job specified by DB ID and adds or
+// @description overwrites metadata keys, for example after `scontrol update`. Fields not present are not changed.
+// @description The `meta.json` of archived jobs is updated as well.
+// @accept      json
+// @produce     json
+// @param       id      path     int                     true "Job Database ID"
+// @param       request body     api.UpdateJobApiRequest true "Fields to change"
+// @success     200     {object} schema.Job                   "Updated job"
+// @failure     400     {object} api.ErrorResponse            "Bad Request"
+// @failure     401     {object} api.ErrorResponse            "Unauthorized"
+// @failure     403     {object} api.ErrorResponse            "Forbidden"
+// @failure     404     {object} api.ErrorResponse            "Job does not exist"
+// @failure     500     {object} api.ErrorResponse            "Internal Server Error"
+// @security    ApiKeyAuth
+// @router      /jobs/{id} [patch]
+func (api *RestApi) updateJob(rw http.ResponseWriter, r *http.Request) {
+	if user := repository.GetUserFromContext(r.Context()); user != nil &&
+		!user.HasRole(schema.RoleApi) {
+
+		handleError(fmt.Errorf("missing role: %v", schema.GetRoleString(schema.RoleApi)), http.StatusForbidden, rw)
+		return
+	}
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		handleError(fmt.Errorf("parsing job id failed: %w", err), http.StatusBadRequest, rw)
+		return
+	}
+
+	var req UpdateJobApiRequest
+	if err := decode(r.Body, &req); err != nil {
+		handleError(fmt.Errorf("parsing request body failed: %w", err), http.StatusBadRequest, rw)
+		return
+	}
+
+	job, err := api.JobRepository.FindById(id)
+	if err == sql.ErrNoRows {
+		handleError(fmt.Errorf("job %d not found", id), http.StatusNotFound, rw)
+		return
+	} else if err != nil {
+		handleError(err, http.StatusInternalServerError, rw)
+		return
+	}
+
+	if err := api.JobRepository.UpdateJob(job, &repository.JobUpdate{
+		Walltime:   req.Walltime,
+		Partition:  req.Partition,
+		ArrayJobId: req.ArrayJobId,
+		Resources:  req.Resources,
+		MetaData:   req.MetaData,
+	}); errors.Is(err, repository.ErrInvalidJobUpdate) {
+		handleError(err, http.StatusBadRequest, rw)
+		return
+	} else if err != nil {
+		handleError(fmt.Errorf("updating job failed: %w", err), http.StatusInternalServerError, rw)
+		return
+	}
+	repository.GetAuditRepository().Record(r.Context(), repository.AuditJobUpdate, repository.AuditJobTarget(id), nil, req)
+
+	rw.Header().Add("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+	json.NewEncoder(rw).Encode(job)
+}
+
+// getArrayJob godoc
+// @summary     Get the summary of an array job
+// @tags Job query
+// @description Get the number of members per job state, the aggregated statistics and footprint distribution and
+// @description the failed members of an array job. Only members visible to the requesting user are included.
+// @produce     json
+// @param       cluster path     string                     true "Cluster of the array job"
+// @param       id      path     int                        true "Array Job ID"
+// @success     200     {object} api.GetArrayJobApiResponse      "Array job summary"
+// @failure     400     {object} api.ErrorResponse               "Bad Request"
+// @failure     401     {object} api.ErrorResponse               "Unauthorized"
+// @failure     404     {object} api.ErrorResponse               "Array job does not exist"
+// @failure     500     {object} api.ErrorResponse               "Internal Server Error"
+// @security    ApiKeyAuth
+// @router      /jobs/array_job/{cluster}/{id} [get]
+func (api *RestApi) getArrayJob(rw http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		handleError(fmt.Errorf("parsing array job id failed: %w", err), http.StatusBadRequest, rw)
+		return
+	}
+
+	arrayJob, err := api.JobRepository.FindArrayJob(r.Context(), id, mux.Vars(r)["cluster"])
+	if errors.Is(err, sql.ErrNoRows) {
+		handleError(fmt.Errorf("array job %d does not exist", id), http.StatusNotFound, rw)
+		return
+	} else if err != nil {
+		handleError(err, http.StatusInternalServerError, rw)
+		return
+	}
+
+	stats, err := api.JobRepository.JobsStats(r.Context(), arrayJob.Filter())
+	if err != nil {
+		handleError(err, http.StatusInternalServerError, rw)
+		return
+	}
+
+	filter := arrayJob.Filter()
+	filter[0].State = repository.FailedJobStates
+	failed, err := api.JobRepository.QueryJobs(r.Context(), filter, nil,
+		&model.OrderByInput{Field: "startTime", Order: model.SortDirectionEnumAsc})
+	if err != nil {
+		handleError(err, http.StatusInternalServerError, rw)
+		return
+	}
+
+	res := GetArrayJobApiResponse{ArrayJob: arrayJob, FailedTasks: make([]int64, 0, len(failed))}
+	if len(stats) != 0 {
+		res.TotalWalltime = stats[0].TotalWalltime
+		res.TotalNodeHours = stats[0].TotalNodeHours
+		res.TotalCoreHours = stats[0].TotalCoreHours
+		res.TotalAccHours = stats[0].TotalAccHours
+	}
+	for _, job := range failed {
+		res.FailedTasks = append(res.FailedTasks, job.ID)
+	}
+
+	rw.Header().Add("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(res)
+}
+
+// getJobAnnotations godoc
+// @summary     Lists the annotations of a job
+// @tags Job query
+// @description Get the annotations of a job specified by DB ID, oldest first.
+// @description Only annotations visible to the requesting user are returned: private ones of the user, project ones
+// @description and support ones if the user owns the job or is admin or support staff.
+// @produce     json
+// @param       id      path     int                  true "Job Database ID"
+// @success     200     {array}  model.Annotation          "Annotations of the job"
+// @failure     400     {object} api.ErrorResponse         "Bad Request"
+// @failure     401     {object} api.ErrorResponse         "Unauthorized"
+// @failure     500     {object} api.ErrorResponse         "Internal Server Error"
+// @security    ApiKeyAuth
+// @router      /jobs/annotations/{id} [get]
+func (api *RestApi) getJobAnnotations(rw http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		handleError(fmt.Errorf("parsing job id failed: %w", err), http.StatusBadRequest, rw)
+		return
+	}
+
+	annotations, err := api.JobRepository.GetAnnotations(r.Context(), id)
+	if err != nil {
+		handleError(err, http.StatusInternalServerError, rw)
+		return
+	}
+
+	rw.Header().Add("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(annotations)
+}
+
+// annotateJob godoc
+// @summary     Adds an annotation to a job
+// @tags Job add and modify
+// @description Adds an annotation by the requesting user to a job specified by DB ID. The job has to be visible to the user.
+// @description The annotation can be anchored to a metric and a time range. Visibility defaults to PROJECT.
+// @accept      json
+// @produce     json
+// @param       id      path     int                  true "Job Database ID"
+// @param       request body     model.AnnotationInput true "Annotation to add"
+// @success     201     {object} model.Annotation          "The new annotation"
+// @failure     400     {object} api.ErrorResponse         "Bad Request"
+// @failure     401     {object} api.ErrorResponse         "Unauthorized"
+// @failure     404     {object} api.ErrorResponse         "Job does not exist"
+// @failure     500     {object} api.ErrorResponse         "Internal Server Error"
+// @security    ApiKeyAuth
+// @router      /jobs/annotate_job/{id} [post]
+func (api *RestApi) annotateJob(rw http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		handleError(fmt.Errorf("parsing job id failed: %w", err), http.StatusBadRequest, rw)
+		return
+	}
+
+	var req model.AnnotationInput
+	if err := decode(r.Body, &req); err != nil {
+		handleError(fmt.Errorf("parsing request body failed: %w", err), http.StatusBadRequest, rw)
+		return
+	}
+
+	annotation, err := api.JobRepository.AddAnnotation(r.Context(), id, &req)
+	if err == sql.ErrNoRows {
+		handleError(fmt.Errorf("job %d not found", id), http.StatusNotFound, rw)
+		return
+	} else if err != nil {
+		handleError(err, http.StatusBadRequest, rw)
+		return
+	}
+	repository.GetAuditRepository().Record(r.Context(), repository.AuditAnnotationAdd, repository.AuditJobTarget(id), nil, annotation)
+
+	rw.Header().Add("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusCreated)
+	json.NewEncoder(rw).Encode(annotation)
+}
+
+// deleteAnnotation godoc
+// @summary     Removes an annotation
+// @tags Job remove
+// @description Removes the annotation specified by its ID. Only the author and admins may delete annotations.
+// @produce     json
+// @param       id      path     int                  true "Annotation ID"
+// @success     200     {object} api.DeleteAnnotationApiResponse "Success message"
+// @failure     400     {object} api.ErrorResponse         "Bad Request"
+// @failure     401     {object} api.ErrorResponse         "Unauthorized"
+// @failure     403     {object} api.ErrorResponse         "Forbidden"
+// @failure     404     {object} api.ErrorResponse         "Annotation does not exist"
+// @failure     500     {object} api.ErrorResponse         "Internal Server Error"
+// @security    ApiKeyAuth
+// @router      /jobs/delete_annotation/{id} [delete]
+func (api *RestApi) deleteAnnotation(rw http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		handleError(fmt.Errorf("parsing annotation id failed: %w", err), http.StatusBadRequest, rw)
+		return
+	}
+
+	annotation, err := api.JobRepository.DeleteAnnotation(r.Context(), id)
+	if err == sql.ErrNoRows {
+		handleError(fmt.Errorf("annotation %d not found", id), http.StatusNotFound, rw)
+		return
+	} else if err == repository.ErrAnnotationForbidden {
+		handleError(err, http.StatusForbidden, rw)
+		return
+	} else if err != nil {
+		handleError(err, http.StatusInternalServerError, rw)
+		return
+	}
+	repository.GetAuditRepository().Record(r.Context(), repository.AuditAnnotationDelete, repository.AuditJobTarget(annotation.JobID), annotation, nil)
+
+	rw.Header().Add("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+	json.NewEncoder(rw).Encode(DeleteAnnotationApiResponse{
+		Message: fmt.Sprintf("Deleted annotation %d", id),
+	})
+}
+
 // startJob godoc
 // @summary     Adds a new job as "running"
 // @tags Job add and modify
 // @description Job specified in request body will be saved to database as "running" with new DB ID.
 // @description Job specifications follow the 'JobMeta' scheme, API will fail to execute if requirements are not met.
+// @description If the request contains a step, only jobId, cluster and startTime are used to find the running job and the
+// @description step is added to the job instead. The step id has to be unique within the job.
 // @accept      json
 // @produce     json
-// @param       request body     schema.JobMeta          true "Job to add"
-// @success     201     {object} api.StartJobApiResponse      "Job added successfully"
+// @param       request body     api.StartJobApiRequest   true "Job or step to add"
+// @success     201     {object} api.StartJobApiResponse      "Job added successfully, or the new step if a step was added"
 // @failure     400     {object} api.ErrorResponse            "Bad Request"
 // @failure     401     {object} api.ErrorResponse            "Unauthorized"
 // @failure     403     {object} api.ErrorResponse            "Forbidden"
@@ -555,19 +959,39 @@ func (api *RestApi) startJob(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	req := schema.JobMeta{BaseJob: schema.JobDefaults}
+	req := StartJobApiRequest{JobMeta: schema.JobMeta{BaseJob: schema.JobDefaults}}
 	if err := decode(r.Body, &req); err != nil {
 		handleError(fmt.Errorf("parsing request body failed: %w", err), http.StatusBadRequest, rw)
 		return
 	}
+	if req.Step != nil {
+		api.startStep(rw, &req)
+		return
+	}
 
 	if req.State == "" {
 		req.State = schema.JobStateRunning
 	}
+	// The energy is computed from the metric data when the job is archived
+	req.Energy = 0
 	if err := importer.SanityChecks(&req.BaseJob); err != nil {
 		handleError(err, http.StatusBadRequest, rw)
 		return
 	}
+	for _, tag := range req.Tags {
+		// Scoped tags always belong to the project or user of the job
+		switch tag.Scope {
+		case "", schema.TagScopeGlobal:
+			tag.Owner = ""
+		case schema.TagScopeProject:
+			tag.Owner = req.Project
+		case schema.TagScopePrivate:
+			tag.Owner = req.User
+		default:
+			handleError(fmt.Errorf("invalid scope '%s' of tag %s:%s", tag.Scope, tag.Type, tag.Name), http.StatusBadRequest, rw)
+			return
+		}
+	}
 
 	// aquire lock to avoid race condition between API calls
 	var unlockOnce sync.Once
@@ -588,16 +1012,18 @@ func (api *RestApi) startJob(rw http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	id, err := api.JobRepository.Start(&req)
+	id, err := api.JobRepository.Start(&req.JobMeta)
 	if err != nil {
 		handleError(fmt.Errorf("insert into database failed: %w", err), http.StatusInternalServerError, rw)
 		return
 	}
 	// unlock here, adding Tags can be async
 	unlockOnce.Do(api.RepositoryMutex.Unlock)
+	repository.GetAuditRepository().Record(r.Context(), repository.AuditJobStart, repository.AuditJobTarget(id),
+		nil, repository.NewAuditJob(&req.BaseJob, req.StartTime))
 
 	for _, tag := range req.Tags {
-		if _, err := api.JobRepository.AddTagOrCreate(id, tag.Type, tag.Name); err != nil {
+		if _, err := api.JobRepository.AddTagOrCreate(id, tag.Type, tag.Name, tag.Scope, tag.Owner); err != nil {
 			http.Error(rw, err.Error(), http.StatusInternalServerError)
 			handleError(fmt.Errorf("adding tag to new job %d failed: %w", id, err), http.StatusInternalServerError, rw)
 			return
@@ -617,6 +1043,7 @@ func (api *RestApi) startJob(rw http.ResponseWriter, r *http.Request) {
 // @tags Job add and modify
 // @description Job to stop is specified by database ID. Only stopTime and final state are required in request body.
 // @description Returns full job resource information according to 'JobMeta' scheme.
+// @description If the request contains a step, the step is stopped instead of the job and returned.
 // @accept      json
 // @produce     json
 // @param       id      path     int                   true "Database ID of Job"
@@ -666,7 +1093,7 @@ func (api *RestApi) stopJobById(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	api.checkAndHandleStopJob(rw, job, req)
+	api.checkAndHandleStopJob(rw, r, job, req)
 }
 
 // stopJobByRequest godoc
@@ -674,6 +1101,7 @@ func (api *RestApi) stopJobById(rw http.ResponseWriter, r *http.Request) {
 // @tags Job add and modify
 // @description Job to stop is specified by request body. All fields are required in this case.
 // @description Returns full job resource information according to 'JobMeta' scheme.
+// @description If the request contains a step, the step is stopped instead of the job and returned.
 // @produce     json
 // @param       request body     api.StopJobApiRequest true "All fields required"
 // @success     200     {object} schema.JobMeta             "Success message"
@@ -715,13 +1143,291 @@ func (api *RestApi) stopJobByRequest(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	api.checkAndHandleStopJob(rw, job, req)
+	api.checkAndHandleStopJob(rw, r, job, req)
+}
+
+// Adds the step of the request to the running job given by jobId, cluster
+// and startTime of the request.
+func (api *RestApi) startStep(rw http.ResponseWriter, req *StartJobApiRequest) {
+	var cluster *string
+	if req.Cluster != "" {
+		cluster = &req.Cluster
+	}
+	var startTime *int64
+	if req.StartTime != 0 {
+		startTime = &req.StartTime
+	}
+
+	job, err := api.JobRepository.Find(&req.JobID, cluster, startTime)
+	if err != nil {
+		handleError(fmt.Errorf("finding job failed: %w", err), http.StatusUnprocessableEntity, rw)
+		return
+	}
+	if job.State != schema.JobStateRunning {
+		handleError(errors.New("steps can only be added to running jobs"), http.StatusBadRequest, rw)
+		return
+	}
+
+	step, err := api.JobRepository.StartStep(job, &model.JobStep{
+		StepID:    req.Step.StepId,
+		Name:      req.Step.Name,
+		StartTime: time.Unix(req.Step.StartTime, 0),
+		Resources: req.Step.Resources,
+	})
+	if err != nil {
+		handleError(fmt.Errorf("adding step failed: %w", err), http.StatusBadRequest, rw)
+		return
+	}
+
+	log.Printf("new step (id: %d): job=%d, stepId=%s", step.ID, job.ID, step.StepID)
+	rw.Header().Add("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusCreated)
+	json.NewEncoder(rw).Encode(step)
+}
+
+// Marks the step of the request as stopped. The stop time and state of the
+// request apply to the step, the job keeps running.
+func (api *RestApi) stopStep(rw http.ResponseWriter, job *schema.Job, req StopJobApiRequest) {
+	if req.State != "" && !req.State.Valid() {
+		handleError(fmt.Errorf("invalid step state: %#v", req.State), http.StatusBadRequest, rw)
+		return
+	} else if req.State == "" {
+		req.State = schema.JobStateCompleted
+	}
+
+	step, err := api.JobRepository.StopStep(job.ID, req.Step.StepId, req.StopTime, req.State, req.Step.ExitCode)
+	if errors.Is(err, sql.ErrNoRows) {
+		handleError(fmt.Errorf("step '%s' of job %d does not exist", req.Step.StepId, job.ID), http.StatusNotFound, rw)
+		return
+	} else if errors.Is(err, repository.ErrStepNotRunning) {
+		handleError(err, http.StatusUnprocessableEntity, rw)
+		return
+	} else if err != nil {
+		handleError(fmt.Errorf("stopping step failed: %w", err), http.StatusBadRequest, rw)
+		return
+	}
+
+	rw.Header().Add("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+	json.NewEncoder(rw).Encode(step)
+}
+
+// updateNodeStates godoc
+// @summary     Records the states of nodes
+// @tags Nodes
+// @description Records the states of nodes of a cluster as reported by the resource manager.
+// @description Valid states are idle, allocated, mixed, down, drain and maintenance. Changes are added to the
+// @description state history. Nodes missing in the node registry are added if they belong to a subcluster.
+// @accept      json
+// @produce     json
+// @param       request body     api.UpdateNodeStatesApiRequest true "Node states"
+// @success     200     {object} api.UpdateNodeStatesApiResponse     "Success message"
+// @failure     400     {object} api.ErrorResponse                   "Bad Request"
+// @failure     401     {object} api.ErrorResponse                   "Unauthorized"
+// @failure     403     {object} api.ErrorResponse                   "Forbidden"
+// @failure     500     {object} api.ErrorResponse                   "Internal Server Error"
+// @security    ApiKeyAuth
+// @router      /nodestate/ [post]
+func (api *RestApi) updateNodeStates(rw http.ResponseWriter, r *http.Request) {
+	if user := repository.GetUserFromContext(r.Context()); user != nil &&
+		!user.HasRole(schema.RoleApi) {
+
+		handleError(fmt.Errorf("missing role: %v", schema.GetRoleString(schema.RoleApi)), http.StatusForbidden, rw)
+		return
+	}
+
+	req := UpdateNodeStatesApiRequest{}
+	if err := decode(r.Body, &req); err != nil {
+		handleError(fmt.Errorf("parsing request body failed: %w", err), http.StatusBadRequest, rw)
+		return
+	}
+	if archive.GetCluster(req.Cluster) == nil {
+		handleError(fmt.Errorf("unknown cluster: %s", req.Cluster), http.StatusBadRequest, rw)
+		return
+	}
+
+	t := time.Now()
+	if req.Time != nil {
+		t = time.Unix(*req.Time, 0)
+	}
+	if err := repository.GetNodeRepository().UpdateNodeStates(req.Cluster, req.Nodes, t); err != nil {
+		handleError(fmt.Errorf("updating node states failed: %w", err), http.StatusBadRequest, rw)
+		return
+	}
+
+	rw.Header().Add("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+	json.NewEncoder(rw).Encode(UpdateNodeStatesApiResponse{
+		Message: fmt.Sprintf("Recorded states of %d nodes", len(req.Nodes)),
+	})
+}
+
+// getReservations godoc
+// @summary     Lists maintenance windows and reservations
+// @tags Nodes
+// @description Get the maintenance windows and reservations overlapping a time range, ordered by start time.
+// @produce     json
+// @param       cluster query    string false "Cluster name"
+// @param       from    query    int    false "Unix epoch timestamp in seconds of the begin of the time range"
+// @param       to      query    int    false "Unix epoch timestamp in seconds of the end of the time range"
+// @success     200     {array}  model.Reservation  "Reservations"
+// @failure     400     {object} api.ErrorResponse  "Bad Request"
+// @failure     401     {object} api.ErrorResponse  "Unauthorized"
+// @failure     500     {object} api.ErrorResponse  "Internal Server Error"
+// @security    ApiKeyAuth
+// @router      /reservations/ [get]
+func (api *RestApi) getReservations(rw http.ResponseWriter, r *http.Request) {
+	var cluster *string
+	var from, to *time.Time
+	for key, vals := range r.URL.Query() {
+		switch key {
+		case "cluster":
+			cluster = &vals[0]
+		case "from", "to":
+			ts, err := strconv.ParseInt(vals[0], 10, 64)
+			if err != nil {
+				handleError(fmt.Errorf("invalid query parameter value: %s", key), http.StatusBadRequest, rw)
+				return
+			}
+			t := time.Unix(ts, 0)
+			if key == "from" {
+				from = &t
+			} else {
+				to = &t
+			}
+		default:
+			handleError(fmt.Errorf("invalid query parameter: %s", key), http.StatusBadRequest, rw)
+			return
+		}
+	}
+
+	reservations, err := repository.GetNodeRepository().GetReservations(cluster, from, to)
+	if err != nil {
+		handleError(err, http.StatusInternalServerError, rw)
+		return
+	}
+
+	rw.Header().Add("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(reservations)
+}
+
+// saveReservation godoc
+// @summary     Adds or changes a maintenance window or reservation
+// @tags Nodes
+// @description Adds a maintenance window or reservation of nodes of a cluster, or replaces the one specified by ID.
+// @description Nodes are given as node list like 'f[0101-0120],g01'. Reserved nodes not used by jobs do not count
+// @description as available in utilization statistics.
+// @accept      json
+// @produce     json
+// @param       id      path     int                    false "Reservation ID"
+// @param       request body     model.ReservationInput true  "Reservation"
+// @success     200     {object} model.Reservation      "The changed reservation"
+// @success     201     {object} model.Reservation      "The new reservation"
+// @failure     400     {object} api.ErrorResponse      "Bad Request"
+// @failure     401     {object} api.ErrorResponse      "Unauthorized"
+// @failure     403     {object} api.ErrorResponse      "Forbidden"
+// @failure     404     {object} api.ErrorResponse      "Reservation does not exist"
+// @failure     500     {object} api.ErrorResponse      "Internal Server Error"
+// @security    ApiKeyAuth
+// @router      /reservations/ [post]
+// @router      /reservations/{id} [post]
+func (api *RestApi) saveReservation(rw http.ResponseWriter, r *http.Request) {
+	if user := repository.GetUserFromContext(r.Context()); user != nil &&
+		!user.HasRole(schema.RoleApi) {
+
+		handleError(fmt.Errorf("missing role: %v", schema.GetRoleString(schema.RoleApi)), http.StatusForbidden, rw)
+		return
+	}
+
+	var id *int64
+	if raw, ok := mux.Vars(r)["id"]; ok {
+		i, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			handleError(fmt.Errorf("parsing reservation id failed: %w", err), http.StatusBadRequest, rw)
+			return
+		}
+		id = &i
+	}
+
+	var req model.ReservationInput
+	if err := decode(r.Body, &req); err != nil {
+		handleError(fmt.Errorf("parsing request body failed: %w", err), http.StatusBadRequest, rw)
+		return
+	}
+	if archive.GetCluster(req.Cluster) == nil {
+		handleError(fmt.Errorf("unknown cluster: %s", req.Cluster), http.StatusBadRequest, rw)
+		return
+	}
+
+	reservation, err := repository.GetNodeRepository().SaveReservation(r.Context(), id, &req)
+	if err == sql.ErrNoRows {
+		handleError(fmt.Errorf("reservation %d not found", *id), http.StatusNotFound, rw)
+		return
+	} else if err != nil {
+		handleError(err, http.StatusBadRequest, rw)
+		return
+	}
+	repository.GetAuditRepository().Record(r.Context(), repository.AuditReservationSave, repository.AuditReservationTarget(reservation.ID), nil, reservation)
+
+	rw.Header().Add("Content-Type", "application/json")
+	if id == nil {
+		rw.WriteHeader(http.StatusCreated)
+	} else {
+		rw.WriteHeader(http.StatusOK)
+	}
+	json.NewEncoder(rw).Encode(reservation)
+}
+
+// deleteReservation godoc
+// @summary     Removes a maintenance window or reservation
+// @tags Nodes
+// @description Removes the maintenance window or reservation specified by ID.
+// @produce     json
+// @param       id      path     int                  true "Reservation ID"
+// @success     200     {object} api.DeleteReservationApiResponse "Success message"
+// @failure     400     {object} api.ErrorResponse    "Bad Request"
+// @failure     401     {object} api.ErrorResponse    "Unauthorized"
+// @failure     403     {object} api.ErrorResponse    "Forbidden"
+// @failure     404     {object} api.ErrorResponse    "Reservation does not exist"
+// @failure     500     {object} api.ErrorResponse    "Internal Server Error"
+// @security    ApiKeyAuth
+// @router      /reservations/{id} [delete]
+func (api *RestApi) deleteReservation(rw http.ResponseWriter, r *http.Request) {
+	if user := repository.GetUserFromContext(r.Context()); user != nil &&
+		!user.HasRole(schema.RoleApi) {
+
+		handleError(fmt.Errorf("missing role: %v", schema.GetRoleString(schema.RoleApi)), http.StatusForbidden, rw)
+		return
+	}
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		handleError(fmt.Errorf("parsing reservation id failed: %w", err), http.StatusBadRequest, rw)
+		return
+	}
+
+	reservation, err := repository.GetNodeRepository().DeleteReservation(id)
+	if err == sql.ErrNoRows {
+		handleError(fmt.Errorf("reservation %d not found", id), http.StatusNotFound, rw)
+		return
+	} else if err != nil {
+		handleError(err, http.StatusInternalServerError, rw)
+		return
+	}
+	repository.GetAuditRepository().Record(r.Context(), repository.AuditReservationDelete, repository.AuditReservationTarget(id), reservation, nil)
+
+	rw.Header().Add("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+	json.NewEncoder(rw).Encode(DeleteReservationApiResponse{
+		Message: fmt.Sprintf("Deleted reservation %d", id),
+	})
 }
 
 // deleteJobById godoc
-// @summary     Remove a job from the sql database
+// @summary     Move a job to the trash
 // @tags Job remove
-// @description Job to remove is specified by database ID. This will not remove the job from the job archive.
+// @description Job to remove is specified by database ID. The job is hidden and can be restored until it is purged
+// @description together with its job archive data after the configured trash grace period.
 // @produce     json
 // @param       id      path     int                   true "Database ID of Job"
 // @success     200     {object} api.DeleteJobApiResponse     "Success message"
@@ -749,7 +1455,14 @@ func (api *RestApi) deleteJobById(rw http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		err = api.JobRepository.DeleteJobById(id)
+		var before *repository.AuditJob
+		if job, e := api.JobRepository.FindById(id); e == nil {
+			before = repository.NewAuditJob(&job.BaseJob, job.StartTimeUnix)
+		}
+
+		if err = api.JobRepository.DeleteJobById(id); err == nil {
+			repository.GetAuditRepository().Record(r.Context(), repository.AuditJobDelete, repository.AuditJobTarget(id), before, nil)
+		}
 	} else {
 		handleError(errors.New("the parameter 'id' is required"), http.StatusBadRequest, rw)
 		return
@@ -766,9 +1479,10 @@ func (api *RestApi) deleteJobById(rw http.ResponseWriter, r *http.Request) {
 }
 
 // deleteJobByRequest godoc
-// @summary     Remove a job from the sql database
+// @summary     Move a job to the trash
 // @tags Job remove
 // @description Job to delete is specified by request body. All fields are required in this case.
+// @description The job can be restored until it is purged after the configured trash grace period.
 // @accept      json
 // @produce     json
 // @param       request body     api.DeleteJobApiRequest true "All fields required"
@@ -815,6 +1529,8 @@ func (api *RestApi) deleteJobByRequest(rw http.ResponseWriter, r *http.Request)
 		handleError(fmt.Errorf("deleting job failed: %w", err), http.StatusUnprocessableEntity, rw)
 		return
 	}
+	repository.GetAuditRepository().Record(r.Context(), repository.AuditJobDelete, repository.AuditJobTarget(job.ID),
+		repository.NewAuditJob(&job.BaseJob, job.StartTimeUnix), nil)
 
 	rw.Header().Add("Content-Type", "application/json")
 	rw.WriteHeader(http.StatusOK)
@@ -824,9 +1540,10 @@ func (api *RestApi) deleteJobByRequest(rw http.ResponseWriter, r *http.Request)
 }
 
 // deleteJobBefore godoc
-// @summary     Remove a job from the sql database
+// @summary     Move jobs to the trash
 // @tags Job remove
-// @description Remove all jobs with start time before timestamp. The jobs will not be removed from the job archive.
+// @description Move all jobs with start time before timestamp to the trash. The jobs can be restored until they are
+// @description purged together with their job archive data after the configured trash grace period.
 // @produce     json
 // @param       ts      path     int                   true "Unix epoch timestamp"
 // @success     200     {object} api.DeleteJobApiResponse     "Success message"
@@ -855,7 +1572,10 @@ func (api *RestApi) deleteJobBefore(rw http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		cnt, err = api.JobRepository.DeleteJobsBefore(ts)
+		if cnt, err = api.JobRepository.DeleteJobsBefore(ts); err == nil {
+			repository.GetAuditRepository().Record(r.Context(), repository.AuditJobDeleteBefore, "job/*",
+				nil, map[string]int64{"startTimeBefore": ts, "count": int64(cnt)})
+		}
 	} else {
 		handleError(errors.New("the parameter 'ts' is required"), http.StatusBadRequest, rw)
 		return
@@ -872,7 +1592,92 @@ func (api *RestApi) deleteJobBefore(rw http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func (api *RestApi) checkAndHandleStopJob(rw http.ResponseWriter, job *schema.Job, req StopJobApiRequest) {
+// restoreJobById godoc
+// @summary     Restore a job from the trash
+// @tags Job remove
+// @description Job to restore is specified by database ID. Only jobs which have not been purged yet can be restored.
+// @produce     json
+// @param       id      path     int                   true "Database ID of Job"
+// @success     200     {object} api.RestoreJobApiResponse    "Success message"
+// @failure     400     {object} api.ErrorResponse          "Bad Request"
+// @failure     401     {object} api.ErrorResponse          "Unauthorized"
+// @failure     403     {object} api.ErrorResponse          "Forbidden"
+// @failure     404     {object} api.ErrorResponse          "Resource not found"
+// @failure     422     {object} api.ErrorResponse          "Unprocessable Entity: restoring job failed: sql: no rows in result set"
+// @failure     500     {object} api.ErrorResponse          "Internal Server Error"
+// @security    ApiKeyAuth
+// @router      /jobs/restore_job/{id} [post]
+func (api *RestApi) restoreJobById(rw http.ResponseWriter, r *http.Request) {
+	if user := repository.GetUserFromContext(r.Context()); user != nil && !user.HasRole(schema.RoleApi) {
+		handleError(fmt.Errorf("missing role: %v", schema.GetRoleString(schema.RoleApi)), http.StatusForbidden, rw)
+		return
+	}
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		handleError(fmt.Errorf("integer expected in path for id: %w", err), http.StatusBadRequest, rw)
+		return
+	}
+
+	if err := api.JobRepository.RestoreJobById(id); err != nil {
+		handleError(fmt.Errorf("restoring job failed: %w", err), http.StatusUnprocessableEntity, rw)
+		return
+	}
+	repository.GetAuditRepository().Record(r.Context(), repository.AuditJobRestore, repository.AuditJobTarget(id), nil, nil)
+
+	rw.Header().Add("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+	json.NewEncoder(rw).Encode(RestoreJobApiResponse{
+		Message: fmt.Sprintf("Successfully restored job %d", id),
+	})
+}
+
+// restoreJobBefore godoc
+// @summary     Restore jobs from the trash
+// @tags Job remove
+// @description Restore all trashed jobs with start time before timestamp. Only jobs which have not been purged yet can be restored.
+// @produce     json
+// @param       ts      path     int                   true "Unix epoch timestamp"
+// @success     200     {object} api.RestoreJobApiResponse    "Success message"
+// @failure     400     {object} api.ErrorResponse          "Bad Request"
+// @failure     401     {object} api.ErrorResponse          "Unauthorized"
+// @failure     403     {object} api.ErrorResponse          "Forbidden"
+// @failure     422     {object} api.ErrorResponse          "Unprocessable Entity"
+// @failure     500     {object} api.ErrorResponse          "Internal Server Error"
+// @security    ApiKeyAuth
+// @router      /jobs/restore_job_before/{ts} [post]
+func (api *RestApi) restoreJobBefore(rw http.ResponseWriter, r *http.Request) {
+	if user := repository.GetUserFromContext(r.Context()); user != nil && !user.HasRole(schema.RoleApi) {
+		handleError(fmt.Errorf("missing role: %v", schema.GetRoleString(schema.RoleApi)), http.StatusForbidden, rw)
+		return
+	}
+
+	ts, err := strconv.ParseInt(mux.Vars(r)["ts"], 10, 64)
+	if err != nil {
+		handleError(fmt.Errorf("integer expected in path for ts: %w", err), http.StatusBadRequest, rw)
+		return
+	}
+
+	cnt, err := api.JobRepository.RestoreJobsBefore(ts)
+	if err != nil {
+		handleError(fmt.Errorf("restoring jobs failed: %w", err), http.StatusUnprocessableEntity, rw)
+		return
+	}
+	repository.GetAuditRepository().Record(r.Context(), repository.AuditJobRestoreBefore, "job/*",
+		nil, map[string]int64{"startTimeBefore": ts, "count": int64(cnt)})
+
+	rw.Header().Add("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+	json.NewEncoder(rw).Encode(RestoreJobApiResponse{
+		Message: fmt.Sprintf("Successfully restored %d jobs", cnt),
+	})
+}
+
+func (api *RestApi) checkAndHandleStopJob(rw http.ResponseWriter, r *http.Request, job *schema.Job, req StopJobApiRequest) {
+	if req.Step != nil {
+		api.stopStep(rw, job, req)
+		return
+	}
 
 	// Sanity checks
 	if job == nil || job.StartTime.Unix() >= req.StopTime || job.State != schema.JobStateRunning {
@@ -888,12 +1693,19 @@ func (api *RestApi) checkAndHandleStopJob(rw http.ResponseWriter, job *schema.Jo
 	}
 
 	// Mark job as stopped in the database (update state and duration)
+	before := repository.NewAuditJob(&job.BaseJob, job.StartTimeUnix)
 	job.Duration = int32(req.StopTime - job.StartTime.Unix())
 	job.State = req.State
 	if err := api.JobRepository.Stop(job.ID, job.Duration, job.State, job.MonitoringStatus); err != nil {
 		handleError(fmt.Errorf("marking job as stopped failed: %w", err), http.StatusInternalServerError, rw)
 		return
 	}
+	if err := api.JobRepository.StopRunningSteps(job.ID, req.StopTime, job.State); err != nil {
+		handleError(fmt.Errorf("marking steps as stopped failed: %w", err), http.StatusInternalServerError, rw)
+		return
+	}
+	repository.GetAuditRepository().Record(r.Context(), repository.AuditJobStop, repository.AuditJobTarget(job.ID),
+		before, repository.NewAuditJob(&job.BaseJob, job.StartTimeUnix))
 
 	log.Printf("archiving job... (dbid: %d): cluster=%s, jobId=%d, user=%s, startTime=%s", job.ID, job.Cluster, job.JobID, job.User, job.StartTime)
 
@@ -925,6 +1737,15 @@ func (api *RestApi) getJobMetrics(rw http.ResponseWriter, r *http.Request) {
 		}
 		scopes = append(scopes, s)
 	}
+	var percentiles []int
+	for _, percentile := range r.URL.Query()["percentile"] {
+		p, err := strconv.Atoi(percentile)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
+			return
+		}
+		percentiles = append(percentiles, p)
+	}
 
 	rw.Header().Add("Content-Type", "application/json")
 	rw.WriteHeader(http.StatusOK)
@@ -938,7 +1759,7 @@ func (api *RestApi) getJobMetrics(rw http.ResponseWriter, r *http.Request) {
 		} `json:"error"`
 	}
 
-	data, err := api.Resolver.Query().JobMetrics(r.Context(), id, metrics, scopes)
+	data, err := api.Resolver.Query().JobMetrics(r.Context(), id, metrics, scopes, percentiles)
 	if err != nil {
 		json.NewEncoder(rw).Encode(Respone{
 			Error: &struct {
@@ -1009,16 +1830,19 @@ func (api *RestApi) createUser(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := repository.GetUserRepository().AddUser(&schema.User{
+	user := &schema.User{
 		Username: username,
 		Name:     name,
 		Password: password,
 		Email:    email,
 		Projects: []string{project},
-		Roles:    []string{role}}); err != nil {
+		Roles:    []string{role}}
+	if err := repository.GetUserRepository().AddUser(user); err != nil {
 		http.Error(rw, err.Error(), http.StatusUnprocessableEntity)
 		return
 	}
+	repository.GetAuditRepository().Record(r.Context(), repository.AuditUserCreate, repository.AuditUserTarget(username),
+		nil, repository.NewAuditUser(user))
 
 	rw.Write([]byte(fmt.Sprintf("User %v successfully created!\n", username)))
 }
@@ -1052,10 +1876,16 @@ func (api *RestApi) deleteUser(rw http.ResponseWriter, r *http.Request) {
 	}
 
 	username := r.FormValue("username")
+	var before *repository.AuditUser
+	if user, err := repository.GetUserRepository().GetUser(username); err == nil {
+		before = repository.NewAuditUser(user)
+	}
+
 	if err := repository.GetUserRepository().DelUser(username); err != nil {
 		http.Error(rw, err.Error(), http.StatusUnprocessableEntity)
 		return
 	}
+	repository.GetAuditRepository().Record(r.Context(), repository.AuditUserDelete, repository.AuditUserTarget(username), before, nil)
 
 	rw.WriteHeader(http.StatusOK)
 }
@@ -1135,30 +1965,47 @@ func (api *RestApi) updateUser(rw http.ResponseWriter, r *http.Request) {
 	newproj := r.FormValue("add-project")
 	delproj := r.FormValue("remove-project")
 
+	username := mux.Vars(r)["id"]
+	var before *repository.AuditUser
+	if user, err := repository.GetUserRepository().GetUser(username); err == nil {
+		before = repository.NewAuditUser(user)
+	}
+	audit := func(action string) {
+		var after *repository.AuditUser
+		if user, err := repository.GetUserRepository().GetUser(username); err == nil {
+			after = repository.NewAuditUser(user)
+		}
+		repository.GetAuditRepository().Record(r.Context(), action, repository.AuditUserTarget(username), before, after)
+	}
+
 	// TODO: Handle anything but roles...
 	if newrole != "" {
-		if err := repository.GetUserRepository().AddRole(r.Context(), mux.Vars(r)["id"], newrole); err != nil {
+		if err := repository.GetUserRepository().AddRole(r.Context(), username, newrole); err != nil {
 			http.Error(rw, err.Error(), http.StatusUnprocessableEntity)
 			return
 		}
+		audit(repository.AuditUserAddRole)
 		rw.Write([]byte("Add Role Success"))
 	} else if delrole != "" {
-		if err := repository.GetUserRepository().RemoveRole(r.Context(), mux.Vars(r)["id"], delrole); err != nil {
+		if err := repository.GetUserRepository().RemoveRole(r.Context(), username, delrole); err != nil {
 			http.Error(rw, err.Error(), http.StatusUnprocessableEntity)
 			return
 		}
+		audit(repository.AuditUserRemoveRole)
 		rw.Write([]byte("Remove Role Success"))
 	} else if newproj != "" {
-		if err := repository.GetUserRepository().AddProject(r.Context(), mux.Vars(r)["id"], newproj); err != nil {
+		if err := repository.GetUserRepository().AddProject(r.Context(), username, newproj); err != nil {
 			http.Error(rw, err.Error(), http.StatusUnprocessableEntity)
 			return
 		}
+		audit(repository.AuditUserAddProject)
 		rw.Write([]byte("Add Project Success"))
 	} else if delproj != "" {
-		if err := repository.GetUserRepository().RemoveProject(r.Context(), mux.Vars(r)["id"], delproj); err != nil {
+		if err := repository.GetUserRepository().RemoveProject(r.Context(), username, delproj); err != nil {
 			http.Error(rw, err.Error(), http.StatusUnprocessableEntity)
 			return
 		}
+		audit(repository.AuditUserRemoveProject)
 		rw.Write([]byte("Remove Project Success"))
 	} else {
 		http.Error(rw, "Not Add or Del [role|project]?", http.StatusInternalServerError)
@@ -1194,6 +2041,7 @@ func (api *RestApi) getJWT(rw http.ResponseWriter, r *http.Request) {
 		http.Error(rw, err.Error(), http.StatusUnprocessableEntity)
 		return
 	}
+	repository.GetAuditRepository().Record(r.Context(), repository.AuditJWTGenerate, repository.AuditUserTarget(username), nil, nil)
 
 	rw.WriteHeader(http.StatusOK)
 	rw.Write([]byte(jwt))
@@ -1227,11 +2075,173 @@ func (api *RestApi) updateConfiguration(rw http.ResponseWriter, r *http.Request)
 
 	fmt.Printf("REST > KEY: %#v\nVALUE: %#v\n", key, value)
 
-	if err := repository.GetUserCfgRepo().UpdateConfig(key, value, repository.GetUserFromContext(r.Context())); err != nil {
+	user := repository.GetUserFromContext(r.Context())
+	var before interface{}
+	if uiconfig, err := repository.GetUserCfgRepo().GetUIConfig(user); err == nil {
+		before = map[string]interface{}{key: uiconfig[key]}
+	}
+
+	if err := repository.GetUserCfgRepo().UpdateConfig(key, value, user); err != nil {
 		http.Error(rw, err.Error(), http.StatusUnprocessableEntity)
 		return
 	}
+	var after interface{} = value
+	if json.Valid([]byte(value)) {
+		after = json.RawMessage(value)
+	}
+	repository.GetAuditRepository().Record(r.Context(), repository.AuditConfigUpdate, repository.AuditConfigTarget(user),
+		before, map[string]interface{}{key: after})
+
+	rw.Write([]byte("success"))
+}
+
+// getAuditLog godoc
+// @summary     Lists audit log entries
+// @tags Audit
+// @description Get a list of audit log entries of state-changing operations. Filters can be applied using query parameters.
+// @description Number of results can be limited by page. Results are sorted by descending time.
+// @description Only accessible by admins from IPs registered with apiAllowedIPs configuration option.
+// @produce     json
+// @param       actor          query    string false "Username of the actor, 'system' for operations without a user"
+// @param       action         query    string false "Action, e.g. 'job.delete' or 'user.add_role'"
+// @param       target         query    string false "Target, e.g. 'job/42' or 'user/alice'"
+// @param       from           query    int    false "Unix epoch timestamp in seconds of the oldest entry"
+// @param       to             query    int    false "Unix epoch timestamp in seconds of the newest entry"
+// @param       items-per-page query    int    false "Items per page (Default: 100)"
+// @param       page           query    int    false "Page Number (Default: 1)"
+// @success     200            {object} api.GetAuditLogApiResponse "Audit entries and page info"
+// @failure     400            {object} api.ErrorResponse          "Bad Request"
+// @failure     401            {object} api.ErrorResponse          "Unauthorized"
+// @failure     403            {object} api.ErrorResponse          "Forbidden"
+// @failure     500            {object} api.ErrorResponse          "Internal Server Error"
+// @security    ApiKeyAuth
+// @router      /audit/ [get]
+func (api *RestApi) getAuditLog(rw http.ResponseWriter, r *http.Request) {
+	if err := securedCheck(r); err != nil {
+		handleError(err, http.StatusForbidden, rw)
+		return
+	}
+
+	if user := repository.GetUserFromContext(r.Context()); !user.HasRole(schema.RoleAdmin) {
+		handleError(fmt.Errorf("only admins are allowed to read the audit log"), http.StatusForbidden, rw)
+		return
+	}
+
+	filter := &repository.AuditFilter{}
+	page := &model.PageRequest{ItemsPerPage: 100, Page: 1}
+	for key, vals := range r.URL.Query() {
+		switch key {
+		case "actor":
+			filter.Actor = &vals[0]
+		case "action":
+			filter.Action = &vals[0]
+		case "target":
+			filter.Target = &vals[0]
+		case "from", "to":
+			ts, err := strconv.ParseInt(vals[0], 10, 64)
+			if err != nil {
+				handleError(err, http.StatusBadRequest, rw)
+				return
+			}
+			if key == "from" {
+				filter.From = &ts
+			} else {
+				filter.To = &ts
+			}
+		case "page":
+			x, err := strconv.Atoi(vals[0])
+			if err != nil || x < 1 {
+				handleError(fmt.Errorf("invalid query parameter value: page"), http.StatusBadRequest, rw)
+				return
+			}
+			page.Page = x
+		case "items-per-page":
+			x, err := strconv.Atoi(vals[0])
+			if err != nil || x < 1 {
+				handleError(fmt.Errorf("invalid query parameter value: items-per-page"), http.StatusBadRequest, rw)
+				return
+			}
+			page.ItemsPerPage = x
+		default:
+			handleError(fmt.Errorf("invalid query parameter: %s", key),
+				http.StatusBadRequest, rw)
+			return
+		}
+	}
+
+	entries, err := repository.GetAuditRepository().Query(filter, page)
+	if err != nil {
+		handleError(err, http.StatusInternalServerError, rw)
+		return
+	}
 
+	rw.Header().Add("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(GetAuditLogApiResponse{
+		Entries: entries,
+		Items:   len(entries),
+		Page:    page.Page,
+	})
+}
+
+// getQueryStats godoc
+// @summary     Lists SQL statement statistics
+// @tags SQL
+// @description Get the number of executions and the latency histogram of every SQL statement since the start or the last reset.
+// @description Statements are sorted by descending total latency. Statistics are only collected if 'db-slow-query-threshold' is set or the log level is debug.
+// @description Only accessible by admins from IPs registered with apiAllowedIPs configuration option.
+// @produce     json
+// @success     200            {object} api.GetQueryStatsApiResponse "Statement statistics"
+// @failure     401            {object} api.ErrorResponse            "Unauthorized"
+// @failure     403            {object} api.ErrorResponse            "Forbidden"
+// @security    ApiKeyAuth
+// @router      /sql-stats/ [get]
+func (api *RestApi) getQueryStats(rw http.ResponseWriter, r *http.Request) {
+	if err := securedCheck(r); err != nil {
+		handleError(err, http.StatusForbidden, rw)
+		return
+	}
+
+	if user := repository.GetUserFromContext(r.Context()); !user.HasRole(schema.RoleAdmin) {
+		handleError(fmt.Errorf("only admins are allowed to read the SQL statistics"), http.StatusForbidden, rw)
+		return
+	}
+
+	buckets := make([]float64, len(repository.QueryLatencyBuckets))
+	for i, b := range repository.QueryLatencyBuckets {
+		buckets[i] = float64(b) / float64(time.Millisecond)
+	}
+
+	rw.Header().Add("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(GetQueryStatsApiResponse{
+		Buckets: buckets,
+		Queries: repository.GetQueryStats(),
+	})
+}
+
+// resetQueryStats godoc
+// @summary     Resets SQL statement statistics
+// @tags SQL
+// @description Clear the SQL statement statistics, e.g. to compare latencies before and after adding an index.
+// @description Only accessible by admins from IPs registered with apiAllowedIPs configuration option.
+// @produce     plain
+// @success     200            {string} string          "Success Response"
+// @failure     401            {object} api.ErrorResponse "Unauthorized"
+// @failure     403            {object} api.ErrorResponse "Forbidden"
+// @security    ApiKeyAuth
+// @router      /sql-stats/ [delete]
+func (api *RestApi) resetQueryStats(rw http.ResponseWriter, r *http.Request) {
+	if err := securedCheck(r); err != nil {
+		handleError(err, http.StatusForbidden, rw)
+		return
+	}
+
+	if user := repository.GetUserFromContext(r.Context()); !user.HasRole(schema.RoleAdmin) {
+		handleError(fmt.Errorf("only admins are allowed to reset the SQL statistics"), http.StatusForbidden, rw)
+		return
+	}
+
+	repository.ResetQueryStats()
+	rw.WriteHeader(http.StatusOK)
 	rw.Write([]byte("success"))
 }
 
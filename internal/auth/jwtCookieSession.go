@@ -202,6 +202,9 @@ func (ja *JWTCookieSessionAuthenticator) Login(
 		if jc.SyncUserOnLogin {
 			if err := repository.GetUserRepository().AddUser(user); err != nil {
 				log.Errorf("Error while adding user '%s' to DB", user.Username)
+			} else {
+				repository.GetAuditRepository().Record(r.Context(), repository.AuditUserCreate,
+					repository.AuditUserTarget(user.Username), nil, repository.NewAuditUser(user))
 			}
 		}
 	}
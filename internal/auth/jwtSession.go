@@ -141,6 +141,9 @@ func (ja *JWTSessionAuthenticator) Login(
 		if config.Keys.JwtConfig.SyncUserOnLogin {
 			if err := repository.GetUserRepository().AddUser(user); err != nil {
 				log.Errorf("Error while adding user '%s' to DB", user.Username)
+			} else {
+				repository.GetAuditRepository().Record(r.Context(), repository.AuditUserCreate,
+					repository.AuditUserTarget(user.Username), nil, repository.NewAuditUser(user))
 			}
 		}
 	}
@@ -5,6 +5,7 @@
 package auth
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
@@ -127,6 +128,8 @@ func (la *LdapAuthenticator) CanLogin(
 				log.Errorf("User '%s' LDAP: Insert into DB failed", username)
 				return nil, false
 			}
+			repository.GetAuditRepository().Record(r.Context(), repository.AuditUserCreate,
+				repository.AuditUserTarget(username), nil, repository.NewAuditUser(user))
 
 			return user, true
 		}
@@ -209,7 +212,14 @@ func (la *LdapAuthenticator) Sync() error {
 
 	for username, where := range users {
 		if where == IN_DB && lc.SyncDelOldUsers {
-			ur.DelUser(username)
+			var before *repository.AuditUser
+			if user, err := ur.GetUser(username); err == nil {
+				before = repository.NewAuditUser(user)
+			}
+			if err := ur.DelUser(username); err == nil {
+				repository.GetAuditRepository().Record(context.Background(), repository.AuditUserDelete,
+					repository.AuditUserTarget(username), before, nil)
+			}
 			log.Debugf("sync: remove %v (does not show up in LDAP anymore)", username)
 		} else if where == IN_LDAP {
 			name := newnames[username]
@@ -231,6 +241,8 @@ func (la *LdapAuthenticator) Sync() error {
 				log.Errorf("User '%s' LDAP: Insert into DB failed", username)
 				return err
 			}
+			repository.GetAuditRepository().Record(context.Background(), repository.AuditUserCreate,
+				repository.AuditUserTarget(username), nil, repository.NewAuditUser(user))
 		}
 	}
 
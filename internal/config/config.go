@@ -25,6 +25,8 @@ var Keys schema.ProgramConfig = schema.ProgramConfig{
 	SessionMaxAge:             "168h",
 	StopJobsExceedingWalltime: 0,
 	ShortRunningJobsDuration:  5 * 60,
+	TrashGracePeriod:          7,
+	GrantWarningThresholds:    []float64{0.8, 1.0},
 	UiDefaults: map[string]interface{}{
 		"analysis_view_histogramMetrics":         []string{"flops_any", "mem_bw", "mem_used"},
 		"analysis_view_scatterPlotMetrics":       [][]string{{"flops_any", "mem_bw"}, {"flops_any", "cpu_load"}, {"cpu_load", "mem_bw"}},
@@ -3,3 +3,174 @@
 // Use of this source code is governed by a MIT-style
 // license that can be found in the LICENSE file.
 package model
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ClusterCockpit/cc-backend/pkg/schema"
+)
+
+// A comment on a job, optionally anchored to a metric and a time range.
+type Annotation struct {
+	ID         int64                `json:"id"`
+	JobID      int64                `json:"jobId"` // Database id of the job
+	Time       time.Time            `json:"time"`
+	Author     string               `json:"author"`
+	Visibility AnnotationVisibility `json:"visibility"`
+	Body       string               `json:"body"`
+	Metric     *string              `json:"metric,omitempty"`
+	From       *time.Time           `json:"from,omitempty"`
+	To         *time.Time           `json:"to,omitempty"`
+}
+
+// A named, persisted set of job filters with ordering and selected metrics.
+type SavedView struct {
+	ID      int64          `json:"id"`
+	Name    string         `json:"name"`
+	Owner   string         `json:"owner"`
+	Scope   SavedViewScope `json:"scope"`
+	Project string         `json:"project"` // Project the view is shared with, empty if not PROJECT
+	Filter  []*JobFilter   `json:"filter"`
+	Order   *OrderByInput  `json:"order,omitempty"`
+	Metrics []string       `json:"metrics,omitempty"`
+	Time    time.Time      `json:"time"` // Last change
+}
+
+// Summary of the members of an array job visible to the user.
+type ArrayJob struct {
+	ArrayJobID int64                    `json:"arrayJobId"`
+	Cluster    string                   `json:"cluster"`
+	NumTasks   int                      `json:"numTasks"`
+	StartTime  time.Time                `json:"startTime"` // Start of the first member
+	States     []*Count                 `json:"states"`    // Number of members per job state
+	Footprint  []*FootprintDistribution `json:"footprint"`
+}
+
+// Filter returns the job filter matching the members of the array job.
+func (a *ArrayJob) Filter() []*JobFilter {
+	id := int(a.ArrayJobID)
+	return []*JobFilter{{ArrayJobID: &id, Cluster: &StringInput{Eq: &a.Cluster}}}
+}
+
+// A step of a job, e.g. one srun invocation within a Slurm allocation.
+type JobStep struct {
+	ID        int64              `json:"id"`
+	JobID     int64              `json:"jobId"`  // Database id of the job
+	StepID    string             `json:"stepId"` // Scheduler id of the step, e.g. '0' or 'batch'
+	Name      string             `json:"name"`
+	State     schema.JobState    `json:"state"`
+	StartTime time.Time          `json:"startTime"`
+	StopTime  *time.Time         `json:"stopTime,omitempty"` // Nil while running
+	ExitCode  *int               `json:"exitCode,omitempty"`
+	Resources []*schema.Resource `json:"resources"`
+}
+
+// A node of a cluster with its last reported state.
+type Node struct {
+	ID         int64            `json:"id"`
+	Hostname   string           `json:"hostname"`
+	Cluster    string           `json:"cluster"`
+	SubCluster string           `json:"subCluster"`
+	State      schema.NodeState `json:"state"`
+	Reason     string           `json:"reason"`
+	Since      *time.Time       `json:"since,omitempty"` // Last state change, nil if no state was reported
+}
+
+// A reported change of the state of a node.
+type NodeStateChange struct {
+	Hostname string           `json:"hostname"`
+	State    schema.NodeState `json:"state"`
+	Reason   string           `json:"reason"`
+	Time     time.Time        `json:"time"`
+}
+
+// A maintenance window or reservation of nodes of a cluster.
+type Reservation struct {
+	ID          int64           `json:"id"`
+	Cluster     string          `json:"cluster"`
+	Nodes       string          `json:"nodes"` // Node list like 'f[0101-0120],g01'
+	Type        ReservationType `json:"type"`
+	Description string          `json:"description"`
+	From        time.Time       `json:"from"`
+	To          time.Time       `json:"to"`
+	Author      string          `json:"author"`
+}
+
+// A project with grants of compute resources.
+type Project struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// A grant of compute resources to a project for a period.
+type ProjectGrant struct {
+	ID       int64         `json:"id"`
+	Project  string        `json:"project"`
+	Cluster  *string       `json:"cluster,omitempty"` // Nil if the grant is valid on all clusters
+	Resource GrantResource `json:"resource"`
+	Amount   float64       `json:"amount"`
+	From     time.Time     `json:"from"`
+	To       time.Time     `json:"to"`
+	Consumed float64       `json:"consumed"` // Consumption of jobs within the grant period
+}
+
+// Statistics of the jobs matching the filters, of a single group if grouped.
+type JobsStatistics struct {
+	ID             string               `json:"id"`
+	Name           string               `json:"name"`
+	TotalJobs      int                  `json:"totalJobs"`
+	RunningJobs    int                  `json:"runningJobs"`
+	ShortJobs      int                  `json:"shortJobs"`
+	TotalWalltime  int                  `json:"totalWalltime"`
+	TotalNodes     int                  `json:"totalNodes"`
+	TotalNodeHours int                  `json:"totalNodeHours"`
+	TotalCores     int                  `json:"totalCores"`
+	TotalCoreHours int                  `json:"totalCoreHours"`
+	TotalAccs      int                  `json:"totalAccs"`
+	TotalAccHours  int                  `json:"totalAccHours"`
+	TotalEnergy    float64              `json:"totalEnergy"`
+	HistDuration   []*HistoPoint        `json:"histDuration"`
+	HistNumNodes   []*HistoPoint        `json:"histNumNodes"`
+	HistNumCores   []*HistoPoint        `json:"histNumCores"`
+	HistNumAccs    []*HistoPoint        `json:"histNumAccs"`
+	HistMetrics    []*MetricHistoPoints `json:"histMetrics"`
+
+	// Filters matching the jobs of the statistics, including the group if
+	// grouped. Used to compute the quantiles on demand.
+	Filters []*JobFilter `json:"-"`
+	// Shared by the statistics of all groups, nil if not grouped.
+	Groups *StatisticsGroups `json:"-"`
+}
+
+// The groups of grouped statistics. The quantiles are computed for all groups
+// at once when they are requested for the first group.
+type StatisticsGroups struct {
+	Filter  []*JobFilter
+	GroupBy *Aggregate
+
+	mu        sync.Mutex
+	quantiles map[string]map[string][]*float64
+}
+
+// Quantiles returns the quantiles of all groups by group id for the arguments
+// identified by `key`. They are computed by `compute` once per key.
+func (g *StatisticsGroups) Quantiles(key string, compute func() (map[string][]*float64, error)) (map[string][]*float64, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if quantiles, ok := g.quantiles[key]; ok {
+		return quantiles, nil
+	}
+	quantiles, err := compute()
+	if err != nil {
+		return nil, err
+	}
+	if g.quantiles == nil {
+		g.quantiles = make(map[string]map[string][]*float64)
+	}
+	g.quantiles[key] = quantiles
+
+	return quantiles, nil
+}
@@ -11,6 +11,25 @@ import (
 	"github.com/ClusterCockpit/cc-backend/pkg/schema"
 )
 
+type AnnotationInput struct {
+	Body       string                `json:"body"`
+	Visibility *AnnotationVisibility `json:"visibility,omitempty"`
+	Metric     *string               `json:"metric,omitempty"`
+	From       *time.Time            `json:"from,omitempty"`
+	To         *time.Time            `json:"to,omitempty"`
+}
+
+type ArchivedMetricScopes struct {
+	Metric string               `json:"metric"`
+	Scopes []schema.MetricScope `json:"scopes"`
+}
+
+type BurnDownPoint struct {
+	Time      time.Time `json:"time"`
+	Consumed  float64   `json:"consumed"`
+	Remaining float64   `json:"remaining"`
+}
+
 type Count struct {
 	Name  string `json:"name"`
 	Count int    `json:"count"`
@@ -21,6 +40,27 @@ type FloatRange struct {
 	To   float64 `json:"to"`
 }
 
+type FootprintDistribution struct {
+	Metric string  `json:"metric"`
+	Stat   string  `json:"stat"`
+	Count  int     `json:"count"`
+	Min    float64 `json:"min"`
+	Avg    float64 `json:"avg"`
+	Max    float64 `json:"max"`
+}
+
+type FootprintFilter struct {
+	Metric string      `json:"metric"`
+	Stat   string      `json:"stat"`
+	Range  *FloatRange `json:"range"`
+}
+
+type FootprintValue struct {
+	Metric string  `json:"metric"`
+	Stat   string  `json:"stat"`
+	Value  float64 `json:"value"`
+}
+
 type Footprints struct {
 	TimeWeights *TimeWeights        `json:"timeWeights"`
 	Metrics     []*MetricFootprints `json:"metrics"`
@@ -37,27 +77,31 @@ type IntRangeOutput struct {
 }
 
 type JobFilter struct {
-	Tags            []string          `json:"tags,omitempty"`
-	JobID           *StringInput      `json:"jobId,omitempty"`
-	ArrayJobID      *int              `json:"arrayJobId,omitempty"`
-	User            *StringInput      `json:"user,omitempty"`
-	Project         *StringInput      `json:"project,omitempty"`
-	JobName         *StringInput      `json:"jobName,omitempty"`
-	Cluster         *StringInput      `json:"cluster,omitempty"`
-	Partition       *StringInput      `json:"partition,omitempty"`
-	Duration        *schema.IntRange  `json:"duration,omitempty"`
-	MinRunningFor   *int              `json:"minRunningFor,omitempty"`
-	NumNodes        *schema.IntRange  `json:"numNodes,omitempty"`
-	NumAccelerators *schema.IntRange  `json:"numAccelerators,omitempty"`
-	NumHWThreads    *schema.IntRange  `json:"numHWThreads,omitempty"`
-	StartTime       *schema.TimeRange `json:"startTime,omitempty"`
-	State           []schema.JobState `json:"state,omitempty"`
-	FlopsAnyAvg     *FloatRange       `json:"flopsAnyAvg,omitempty"`
-	MemBwAvg        *FloatRange       `json:"memBwAvg,omitempty"`
-	LoadAvg         *FloatRange       `json:"loadAvg,omitempty"`
-	MemUsedMax      *FloatRange       `json:"memUsedMax,omitempty"`
-	Exclusive       *int              `json:"exclusive,omitempty"`
-	Node            *StringInput      `json:"node,omitempty"`
+	Tags            []string           `json:"tags,omitempty"`
+	JobID           *StringInput       `json:"jobId,omitempty"`
+	ArrayJobID      *int               `json:"arrayJobId,omitempty"`
+	User            *StringInput       `json:"user,omitempty"`
+	Project         *StringInput       `json:"project,omitempty"`
+	JobName         *StringInput       `json:"jobName,omitempty"`
+	Cluster         *StringInput       `json:"cluster,omitempty"`
+	Partition       *StringInput       `json:"partition,omitempty"`
+	Duration        *schema.IntRange   `json:"duration,omitempty"`
+	MinRunningFor   *int               `json:"minRunningFor,omitempty"`
+	NumNodes        *schema.IntRange   `json:"numNodes,omitempty"`
+	NumAccelerators *schema.IntRange   `json:"numAccelerators,omitempty"`
+	NumHWThreads    *schema.IntRange   `json:"numHWThreads,omitempty"`
+	StartTime       *schema.TimeRange  `json:"startTime,omitempty"`
+	State           []schema.JobState  `json:"state,omitempty"`
+	FlopsAnyAvg     *FloatRange        `json:"flopsAnyAvg,omitempty"`
+	MemBwAvg        *FloatRange        `json:"memBwAvg,omitempty"`
+	LoadAvg         *FloatRange        `json:"loadAvg,omitempty"`
+	MemUsedMax      *FloatRange        `json:"memUsedMax,omitempty"`
+	Footprint       []*FootprintFilter `json:"footprint,omitempty"`
+	Energy          *FloatRange        `json:"energy,omitempty"`
+	FullText        *string            `json:"fullText,omitempty"`
+	MetaData        []*MetaDataFilter  `json:"metaData,omitempty"`
+	Exclusive       *int               `json:"exclusive,omitempty"`
+	Node            *StringInput       `json:"node,omitempty"`
 }
 
 type JobLink struct {
@@ -78,30 +122,18 @@ type JobMetricWithName struct {
 }
 
 type JobResultList struct {
-	Items  []*schema.Job `json:"items"`
-	Offset *int          `json:"offset,omitempty"`
-	Limit  *int          `json:"limit,omitempty"`
-	Count  *int          `json:"count,omitempty"`
-}
-
-type JobsStatistics struct {
-	ID             string               `json:"id"`
-	Name           string               `json:"name"`
-	TotalJobs      int                  `json:"totalJobs"`
-	RunningJobs    int                  `json:"runningJobs"`
-	ShortJobs      int                  `json:"shortJobs"`
-	TotalWalltime  int                  `json:"totalWalltime"`
-	TotalNodes     int                  `json:"totalNodes"`
-	TotalNodeHours int                  `json:"totalNodeHours"`
-	TotalCores     int                  `json:"totalCores"`
-	TotalCoreHours int                  `json:"totalCoreHours"`
-	TotalAccs      int                  `json:"totalAccs"`
-	TotalAccHours  int                  `json:"totalAccHours"`
-	HistDuration   []*HistoPoint        `json:"histDuration"`
-	HistNumNodes   []*HistoPoint        `json:"histNumNodes"`
-	HistNumCores   []*HistoPoint        `json:"histNumCores"`
-	HistNumAccs    []*HistoPoint        `json:"histNumAccs"`
-	HistMetrics    []*MetricHistoPoints `json:"histMetrics"`
+	Items      []*schema.Job `json:"items"`
+	Offset     *int          `json:"offset,omitempty"`
+	Limit      *int          `json:"limit,omitempty"`
+	Count      *int          `json:"count,omitempty"`
+	NextCursor *string       `json:"nextCursor,omitempty"`
+}
+
+type MetaDataFilter struct {
+	Key    string       `json:"key"`
+	Value  *StringInput `json:"value,omitempty"`
+	Range  *FloatRange  `json:"range,omitempty"`
+	Exists *bool        `json:"exists,omitempty"`
 }
 
 type MetricFootprints struct {
@@ -123,13 +155,20 @@ type MetricHistoPoints struct {
 }
 
 type NodeMetrics struct {
-	Host       string               `json:"host"`
-	SubCluster string               `json:"subCluster"`
-	Metrics    []*JobMetricWithName `json:"metrics"`
+	Host         string               `json:"host"`
+	SubCluster   string               `json:"subCluster"`
+	Metrics      []*JobMetricWithName `json:"metrics"`
+	Reservations []*Reservation       `json:"reservations"`
+}
+
+type NodeStatesCount struct {
+	SubCluster string   `json:"subCluster"`
+	States     []*Count `json:"states"`
 }
 
 type OrderByInput struct {
 	Field string            `json:"field"`
+	Type  *OrderByType      `json:"type,omitempty"`
 	Order SortDirectionEnum `json:"order"`
 }
 
@@ -138,6 +177,45 @@ type PageRequest struct {
 	Page         int `json:"page"`
 }
 
+type PercentileSeries struct {
+	Percentile int            `json:"percentile"`
+	Data       []schema.Float `json:"data"`
+}
+
+type ProjectGrantInput struct {
+	Cluster  *string       `json:"cluster,omitempty"`
+	Resource GrantResource `json:"resource"`
+	Amount   float64       `json:"amount"`
+	From     time.Time     `json:"from"`
+	To       time.Time     `json:"to"`
+}
+
+type ReservationInput struct {
+	Cluster     string          `json:"cluster"`
+	Nodes       string          `json:"nodes"`
+	Type        ReservationType `json:"type"`
+	Description *string         `json:"description,omitempty"`
+	From        time.Time       `json:"from"`
+	To          time.Time       `json:"to"`
+}
+
+type SavedViewInput struct {
+	Name    string          `json:"name"`
+	Filter  []*JobFilter    `json:"filter"`
+	Order   *OrderByInput   `json:"order,omitempty"`
+	Metrics []string        `json:"metrics,omitempty"`
+	Scope   *SavedViewScope `json:"scope,omitempty"`
+	Project *string         `json:"project,omitempty"`
+}
+
+type StepMetricStatistics struct {
+	Name string       `json:"name"`
+	Unit *schema.Unit `json:"unit"`
+	Avg  float64      `json:"avg"`
+	Min  float64      `json:"min"`
+	Max  float64      `json:"max"`
+}
+
 type StringInput struct {
 	Eq         *string  `json:"eq,omitempty"`
 	Neq        *string  `json:"neq,omitempty"`
@@ -147,6 +225,15 @@ type StringInput struct {
 	In         []string `json:"in,omitempty"`
 }
 
+type SubClusterUtilization struct {
+	SubCluster           string  `json:"subCluster"`
+	NodeHours            float64 `json:"nodeHours"`
+	AllocatedNodeHours   float64 `json:"allocatedNodeHours"`
+	MaintenanceNodeHours float64 `json:"maintenanceNodeHours"`
+	ReservedNodeHours    float64 `json:"reservedNodeHours"`
+	Utilization          float64 `json:"utilization"`
+}
+
 type TimeRangeOutput struct {
 	From time.Time `json:"from"`
 	To   time.Time `json:"to"`
@@ -207,6 +294,219 @@ func (e Aggregate) MarshalGQL(w io.Writer) {
 	fmt.Fprint(w, strconv.Quote(e.String()))
 }
 
+type AnnotationVisibility string
+
+const (
+	AnnotationVisibilityPrivate AnnotationVisibility = "PRIVATE"
+	AnnotationVisibilityProject AnnotationVisibility = "PROJECT"
+	AnnotationVisibilitySupport AnnotationVisibility = "SUPPORT"
+)
+
+var AllAnnotationVisibility = []AnnotationVisibility{
+	AnnotationVisibilityPrivate,
+	AnnotationVisibilityProject,
+	AnnotationVisibilitySupport,
+}
+
+func (e AnnotationVisibility) IsValid() bool {
+	switch e {
+	case AnnotationVisibilityPrivate, AnnotationVisibilityProject, AnnotationVisibilitySupport:
+		return true
+	}
+	return false
+}
+
+func (e AnnotationVisibility) String() string {
+	return string(e)
+}
+
+func (e *AnnotationVisibility) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = AnnotationVisibility(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid AnnotationVisibility", str)
+	}
+	return nil
+}
+
+func (e AnnotationVisibility) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type GrantResource string
+
+const (
+	GrantResourceNodeHours GrantResource = "NODE_HOURS"
+	GrantResourceCoreHours GrantResource = "CORE_HOURS"
+	GrantResourceAccHours  GrantResource = "ACC_HOURS"
+)
+
+var AllGrantResource = []GrantResource{
+	GrantResourceNodeHours,
+	GrantResourceCoreHours,
+	GrantResourceAccHours,
+}
+
+func (e GrantResource) IsValid() bool {
+	switch e {
+	case GrantResourceNodeHours, GrantResourceCoreHours, GrantResourceAccHours:
+		return true
+	}
+	return false
+}
+
+func (e GrantResource) String() string {
+	return string(e)
+}
+
+func (e *GrantResource) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = GrantResource(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid GrantResource", str)
+	}
+	return nil
+}
+
+func (e GrantResource) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type OrderByType string
+
+const (
+	OrderByTypeColumn    OrderByType = "COLUMN"
+	OrderByTypeFootprint OrderByType = "FOOTPRINT"
+	OrderByTypeRank      OrderByType = "RANK"
+)
+
+var AllOrderByType = []OrderByType{
+	OrderByTypeColumn,
+	OrderByTypeFootprint,
+	OrderByTypeRank,
+}
+
+func (e OrderByType) IsValid() bool {
+	switch e {
+	case OrderByTypeColumn, OrderByTypeFootprint, OrderByTypeRank:
+		return true
+	}
+	return false
+}
+
+func (e OrderByType) String() string {
+	return string(e)
+}
+
+func (e *OrderByType) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = OrderByType(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid OrderByType", str)
+	}
+	return nil
+}
+
+func (e OrderByType) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type ReservationType string
+
+const (
+	ReservationTypeMaintenance ReservationType = "MAINTENANCE"
+	ReservationTypeReservation ReservationType = "RESERVATION"
+)
+
+var AllReservationType = []ReservationType{
+	ReservationTypeMaintenance,
+	ReservationTypeReservation,
+}
+
+func (e ReservationType) IsValid() bool {
+	switch e {
+	case ReservationTypeMaintenance, ReservationTypeReservation:
+		return true
+	}
+	return false
+}
+
+func (e ReservationType) String() string {
+	return string(e)
+}
+
+func (e *ReservationType) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ReservationType(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ReservationType", str)
+	}
+	return nil
+}
+
+func (e ReservationType) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type SavedViewScope string
+
+const (
+	SavedViewScopePrivate SavedViewScope = "PRIVATE"
+	SavedViewScopeProject SavedViewScope = "PROJECT"
+	SavedViewScopeGlobal  SavedViewScope = "GLOBAL"
+)
+
+var AllSavedViewScope = []SavedViewScope{
+	SavedViewScopePrivate,
+	SavedViewScopeProject,
+	SavedViewScopeGlobal,
+}
+
+func (e SavedViewScope) IsValid() bool {
+	switch e {
+	case SavedViewScopePrivate, SavedViewScopeProject, SavedViewScopeGlobal:
+		return true
+	}
+	return false
+}
+
+func (e SavedViewScope) String() string {
+	return string(e)
+}
+
+func (e *SavedViewScope) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = SavedViewScope(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid SavedViewScope", str)
+	}
+	return nil
+}
+
+func (e SavedViewScope) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
 type SortByAggregate string
 
 const (
@@ -6,28 +6,63 @@ package graph
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
 	"strconv"
 	"time"
 
+	"github.com/ClusterCockpit/cc-backend/internal/config"
 	"github.com/ClusterCockpit/cc-backend/internal/graph/generated"
 	"github.com/ClusterCockpit/cc-backend/internal/graph/model"
 	"github.com/ClusterCockpit/cc-backend/internal/metricdata"
 	"github.com/ClusterCockpit/cc-backend/internal/repository"
+	"github.com/ClusterCockpit/cc-backend/internal/util"
 	"github.com/ClusterCockpit/cc-backend/pkg/archive"
 	"github.com/ClusterCockpit/cc-backend/pkg/log"
 	"github.com/ClusterCockpit/cc-backend/pkg/schema"
 )
 
+// Statistics is the resolver for the statistics field.
+func (r *arrayJobResolver) Statistics(ctx context.Context, obj *model.ArrayJob) (*model.JobsStatistics, error) {
+	stats, err := r.Query().JobsStatistics(ctx, obj.Filter(), nil, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(stats) == 0 {
+		return &model.JobsStatistics{Filters: obj.Filter()}, nil
+	}
+
+	return stats[0], nil
+}
+
+// FailedTasks is the resolver for the failedTasks field.
+func (r *arrayJobResolver) FailedTasks(ctx context.Context, obj *model.ArrayJob) ([]*schema.Job, error) {
+	filter := obj.Filter()
+	filter[0].State = repository.FailedJobStates
+	return r.Repo.QueryJobs(ctx, filter, nil, &model.OrderByInput{Field: "startTime", Order: model.SortDirectionEnumAsc})
+}
+
+// Members is the resolver for the members field.
+func (r *arrayJobResolver) Members(ctx context.Context, obj *model.ArrayJob, page *model.PageRequest, order *model.OrderByInput, cursor *string) (*model.JobResultList, error) {
+	return r.Query().Jobs(ctx, obj.Filter(), page, order, cursor)
+}
+
 // Partitions is the resolver for the partitions field.
 func (r *clusterResolver) Partitions(ctx context.Context, obj *schema.Cluster) ([]string, error) {
 	return r.Repo.Partitions(obj.Name)
 }
 
+// Footprint is the resolver for the footprint field.
+func (r *clusterResolver) Footprint(ctx context.Context, obj *schema.Cluster) ([]*schema.FootprintMetric, error) {
+	return repository.FootprintMetrics(obj.Name), nil
+}
+
 // Tags is the resolver for the tags field.
 func (r *jobResolver) Tags(ctx context.Context, obj *schema.Job) ([]*schema.Tag, error) {
-	return r.Repo.GetTags(&obj.ID)
+	return r.Repo.GetTags(repository.GetUserFromContext(ctx), &obj.ID)
 }
 
 // ConcurrentJobs is the resolver for the concurrentJobs field.
@@ -43,6 +78,65 @@ func (r *jobResolver) ConcurrentJobs(ctx context.Context, obj *schema.Job) (*mod
 	return nil, nil
 }
 
+// Annotations is the resolver for the annotations field.
+func (r *jobResolver) Annotations(ctx context.Context, obj *schema.Job) ([]*model.Annotation, error) {
+	return r.Repo.GetAnnotations(ctx, obj.ID)
+}
+
+// ArrayJob is the resolver for the arrayJob field.
+func (r *jobResolver) ArrayJob(ctx context.Context, obj *schema.Job) (*model.ArrayJob, error) {
+	if obj.ArrayJobId == 0 {
+		return nil, nil
+	}
+
+	return r.Query().ArrayJob(ctx, int(obj.ArrayJobId), obj.Cluster)
+}
+
+// Steps is the resolver for the steps field.
+func (r *jobResolver) Steps(ctx context.Context, obj *schema.Job) ([]*model.JobStep, error) {
+	return r.Repo.GetSteps(obj.ID)
+}
+
+// Reservations is the resolver for the reservations field.
+func (r *jobResolver) Reservations(ctx context.Context, obj *schema.Job) ([]*model.Reservation, error) {
+	return repository.GetNodeRepository().GetJobReservations(obj)
+}
+
+// MemUsedMax is the resolver for the memUsedMax field.
+func (r *jobResolver) MemUsedMax(ctx context.Context, obj *schema.Job) (*float64, error) {
+	return footprintValue(obj, "mem_used_max"), nil
+}
+
+// FlopsAnyAvg is the resolver for the flopsAnyAvg field.
+func (r *jobResolver) FlopsAnyAvg(ctx context.Context, obj *schema.Job) (*float64, error) {
+	return footprintValue(obj, "flops_any_avg"), nil
+}
+
+// MemBwAvg is the resolver for the memBwAvg field.
+func (r *jobResolver) MemBwAvg(ctx context.Context, obj *schema.Job) (*float64, error) {
+	return footprintValue(obj, "mem_bw_avg"), nil
+}
+
+// LoadAvg is the resolver for the loadAvg field.
+func (r *jobResolver) LoadAvg(ctx context.Context, obj *schema.Job) (*float64, error) {
+	return footprintValue(obj, "cpu_load_avg"), nil
+}
+
+// Footprint is the resolver for the footprint field.
+func (r *jobResolver) Footprint(ctx context.Context, obj *schema.Job) ([]*model.FootprintValue, error) {
+	if obj.Footprint == nil {
+		return nil, nil
+	}
+
+	res := make([]*model.FootprintValue, 0, len(obj.Footprint))
+	for _, fm := range repository.FootprintMetrics(obj.Cluster) {
+		if value, ok := obj.Footprint[repository.FootprintKey(fm.Metric, fm.Stat)]; ok {
+			res = append(res, &model.FootprintValue{Metric: fm.Metric, Stat: fm.Stat, Value: value})
+		}
+	}
+	return res, nil
+}
+
 // MetaData is the resolver for the metaData field.
 func (r *jobResolver) MetaData(ctx context.Context, obj *schema.Job) (interface{}, error) {
 	return r.Repo.FetchMetadata(obj)
@@ -53,20 +147,172 @@ func (r *jobResolver) UserData(ctx context.Context, obj *schema.Job) (*model.Use
 	return repository.GetUserRepository().FetchUserInCtx(ctx, obj.User)
 }
 
+// ArchivedScopes is the resolver for the archivedScopes field.
+func (r *jobResolver) ArchivedScopes(ctx context.Context, obj *schema.Job) ([]*model.ArchivedMetricScopes, error) {
+	// Reading the meta file of every job of a list is too expensive
+	if !isSingleJobField(ctx) || obj.MonitoringStatus != schema.MonitoringStatusArchivingSuccessful {
+		return nil, nil
+	}
+
+	scopes, err := archive.GetArchivedScopes(obj)
+	if err != nil {
+		log.Warn("Error while loading archived scopes")
+		return nil, err
+	}
+
+	metrics := make([]string, 0, len(scopes))
+	for metric := range scopes {
+		metrics = append(metrics, metric)
+	}
+	sort.Strings(metrics)
+
+	res := make([]*model.ArchivedMetricScopes, 0, len(metrics))
+	for _, metric := range metrics {
+		res = append(res, &model.ArchivedMetricScopes{
+			Metric: metric,
+			Scopes: scopes[metric],
+		})
+	}
+
+	return res, nil
+}
+
+// Statistics is the resolver for the statistics field.
+func (r *jobStepResolver) Statistics(ctx context.Context, obj *model.JobStep, metrics []string) ([]*model.StepMetricStatistics, error) {
+	job, err := r.Query().Job(ctx, strconv.FormatInt(obj.JobID, 10))
+	if err != nil {
+		log.Warn("Error while querying job for step statistics")
+		return nil, err
+	}
+
+	data, err := metricdata.LoadData(job, metrics, []schema.MetricScope{schema.MetricScopeNode}, nil, ctx)
+	if err != nil {
+		log.Warn("Error while loading job data")
+		return nil, err
+	}
+
+	var to int64
+	if obj.StopTime != nil {
+		to = obj.StopTime.Unix()
+	}
+	hosts := make([]string, 0, len(obj.Resources))
+	for _, res := range obj.Resources {
+		hosts = append(hosts, res.Hostname)
+	}
+
+	res := make([]*model.StepMetricStatistics, 0, len(data))
+	for name, stats := range metricdata.StepStatistics(job, data, obj.StartTime.Unix(), to, hosts) {
+		unit := stats.Unit
+		res = append(res, &model.StepMetricStatistics{Name: name, Unit: &unit, Avg: stats.Avg, Min: stats.Min, Max: stats.Max})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+
+	return res, nil
+}
+
+// Quantiles is the resolver for the quantiles field.
+func (r *jobsStatisticsResolver) Quantiles(ctx context.Context, obj *model.JobsStatistics, field string, typeArg *model.OrderByType, ps []float64) ([]*float64, error) {
+	if obj.Groups == nil {
+		return r.Repo.JobsQuantiles(ctx, obj.Filters, field, typeArg, ps)
+	}
+
+	// The quantiles of all groups are fetched by the first group
+	key := fmt.Sprintf("%s/%v", field, ps)
+	if typeArg != nil {
+		key += "/" + typeArg.String()
+	}
+	groups, err := obj.Groups.Quantiles(key, func() (map[string][]*float64, error) {
+		return r.Repo.JobsQuantilesGrouped(ctx, obj.Groups.Filter, obj.Groups.GroupBy, field, typeArg, ps)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if quantiles, ok := groups[obj.ID]; ok {
+		return quantiles, nil
+	}
+	return make([]*float64, len(ps)), nil
+}
+
 // CreateTag is the resolver for the createTag field.
-func (r *mutationResolver) CreateTag(ctx context.Context, typeArg string, name string) (*schema.Tag, error) {
-	id, err := r.Repo.CreateTag(typeArg, name)
+func (r *mutationResolver) CreateTag(ctx context.Context, typeArg string, name string, scope *schema.TagScope, project *string) (*schema.Tag, error) {
+	user := repository.GetUserFromContext(ctx)
+	if scope == nil {
+		defaultScope := schema.TagScopePrivate
+		if user == nil || user.HasRole(schema.RoleAdmin) {
+			defaultScope = schema.TagScopeGlobal
+		}
+		scope = &defaultScope
+	}
+
+	owner := ""
+	switch *scope {
+	case schema.TagScopeGlobal:
+		if user != nil && !user.HasRole(schema.RoleAdmin) {
+			return nil, errors.New("only admins are allowed to create global tags")
+		}
+	case schema.TagScopeProject:
+		if project == nil || *project == "" {
+			return nil, errors.New("project tags require a project")
+		}
+		if user != nil {
+			ok, err := r.Repo.HasProjectAccess(user, *project)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				return nil, fmt.Errorf("not allowed to create tags for project '%s'", *project)
+			}
+		}
+		owner = *project
+	case schema.TagScopePrivate:
+		if user == nil {
+			return nil, errors.New("private tags require a user")
+		}
+		owner = user.Username
+	}
+
+	id, err := r.Repo.CreateTag(typeArg, name, *scope, owner)
 	if err != nil {
 		log.Warn("Error while creating tag")
 		return nil, err
 	}
 
-	return &schema.Tag{ID: id, Type: typeArg, Name: name}, nil
+	tag := &schema.Tag{ID: id, Type: typeArg, Name: name, Scope: *scope, Owner: owner}
+	repository.GetAuditRepository().Record(ctx, repository.AuditTagCreate, repository.AuditTagTarget(id), nil, tag)
+	return tag, nil
 }
 
 // DeleteTag is the resolver for the deleteTag field.
 func (r *mutationResolver) DeleteTag(ctx context.Context, id string) (string, error) {
-	panic(fmt.Errorf("not implemented: DeleteTag - deleteTag"))
+	tid, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		log.Warn("Error while parsing tag id")
+		return "", err
+	}
+
+	tag, err := r.Repo.GetTag(tid)
+	if err != nil {
+		log.Warn("Error while fetching tag")
+		return "", err
+	}
+
+	// Admins may delete all tags, owners their private tags and managers the tags of their projects
+	if user := repository.GetUserFromContext(ctx); user != nil && !user.HasRole(schema.RoleAdmin) {
+		switch {
+		case tag.Scope == schema.TagScopePrivate && tag.Owner == user.Username:
+		case tag.Scope == schema.TagScopeProject && user.HasRole(schema.RoleManager) && util.Contains(user.Projects, tag.Owner):
+		default:
+			return "", errors.New("not allowed to delete this tag")
+		}
+	}
+
+	if err := r.Repo.DeleteTag(tid); err != nil {
+		log.Warn("Error while deleting tag")
+		return "", err
+	}
+
+	repository.GetAuditRepository().Record(ctx, repository.AuditTagDelete, repository.AuditTagTarget(tid), tag, nil)
+	return id, nil
 }
 
 // AddTagsToJob is the resolver for the addTagsToJob field.
@@ -77,7 +323,7 @@ func (r *mutationResolver) AddTagsToJob(ctx context.Context, job string, tagIds
 		return nil, err
 	}
 
-	tags := []*schema.Tag{}
+	user := repository.GetUserFromContext(ctx)
 	for _, tagId := range tagIds {
 		tid, err := strconv.ParseInt(tagId, 10, 64)
 		if err != nil {
@@ -85,13 +331,21 @@ func (r *mutationResolver) AddTagsToJob(ctx context.Context, job string, tagIds
 			return nil, err
 		}
 
-		if tags, err = r.Repo.AddTag(jid, tid); err != nil {
+		if visible, err := r.Repo.TagVisible(user, tid); err != nil {
+			return nil, err
+		} else if !visible {
+			return nil, fmt.Errorf("tag %d not found", tid)
+		}
+
+		if _, err = r.Repo.AddTag(jid, tid); err != nil {
 			log.Warn("Error while adding tag")
 			return nil, err
 		}
+		repository.GetAuditRepository().Record(ctx, repository.AuditTagAdd, repository.AuditJobTarget(jid),
+			nil, map[string]int64{"tagId": tid})
 	}
 
-	return tags, nil
+	return r.Repo.GetTags(user, &jid)
 }
 
 // RemoveTagsFromJob is the resolver for the removeTagsFromJob field.
@@ -102,7 +356,7 @@ func (r *mutationResolver) RemoveTagsFromJob(ctx context.Context, job string, ta
 		return nil, err
 	}
 
-	tags := []*schema.Tag{}
+	user := repository.GetUserFromContext(ctx)
 	for _, tagId := range tagIds {
 		tid, err := strconv.ParseInt(tagId, 10, 64)
 		if err != nil {
@@ -110,25 +364,276 @@ func (r *mutationResolver) RemoveTagsFromJob(ctx context.Context, job string, ta
 			return nil, err
 		}
 
-		if tags, err = r.Repo.RemoveTag(jid, tid); err != nil {
+		if visible, err := r.Repo.TagVisible(user, tid); err != nil {
+			return nil, err
+		} else if !visible {
+			return nil, fmt.Errorf("tag %d not found", tid)
+		}
+
+		if _, err = r.Repo.RemoveTag(jid, tid); err != nil {
 			log.Warn("Error while removing tag")
 			return nil, err
 		}
+		repository.GetAuditRepository().Record(ctx, repository.AuditTagRemove, repository.AuditJobTarget(jid),
+			map[string]int64{"tagId": tid}, nil)
+	}
+
+	return r.Repo.GetTags(user, &jid)
+}
+
+// AddAnnotation is the resolver for the addAnnotation field.
+func (r *mutationResolver) AddAnnotation(ctx context.Context, job string, input model.AnnotationInput) (*model.Annotation, error) {
+	jid, err := strconv.ParseInt(job, 10, 64)
+	if err != nil {
+		log.Warn("Error while parsing job id")
+		return nil, err
+	}
+
+	annotation, err := r.Repo.AddAnnotation(ctx, jid, &input)
+	if err != nil {
+		log.Warn("Error while adding annotation")
+		return nil, err
+	}
+
+	repository.GetAuditRepository().Record(ctx, repository.AuditAnnotationAdd, repository.AuditJobTarget(jid), nil, annotation)
+	return annotation, nil
+}
+
+// DeleteAnnotation is the resolver for the deleteAnnotation field.
+func (r *mutationResolver) DeleteAnnotation(ctx context.Context, id string) (string, error) {
+	aid, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		log.Warn("Error while parsing annotation id")
+		return "", err
+	}
+
+	annotation, err := r.Repo.DeleteAnnotation(ctx, aid)
+	if err != nil {
+		log.Warn("Error while deleting annotation")
+		return "", err
+	}
+
+	repository.GetAuditRepository().Record(ctx, repository.AuditAnnotationDelete, repository.AuditJobTarget(annotation.JobID), annotation, nil)
+	return id, nil
+}
+
+// SaveView is the resolver for the saveView field.
+func (r *mutationResolver) SaveView(ctx context.Context, id *string, input model.SavedViewInput) (*model.SavedView, error) {
+	var vid *int64
+	if id != nil {
+		i, err := strconv.ParseInt(*id, 10, 64)
+		if err != nil {
+			log.Warn("Error while parsing view id")
+			return nil, err
+		}
+		vid = &i
+	}
+
+	view, err := repository.GetViewRepository().SaveView(ctx, vid, &input)
+	if err != nil {
+		log.Warn("Error while saving view")
+		return nil, err
+	}
+
+	repository.GetAuditRepository().Record(ctx, repository.AuditViewSave, repository.AuditViewTarget(view.ID), nil, view)
+	return view, nil
+}
+
+// DeleteView is the resolver for the deleteView field.
+func (r *mutationResolver) DeleteView(ctx context.Context, id string) (string, error) {
+	vid, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		log.Warn("Error while parsing view id")
+		return "", err
+	}
+
+	view, err := repository.GetViewRepository().DeleteView(ctx, vid)
+	if err != nil {
+		log.Warn("Error while deleting view")
+		return "", err
+	}
+
+	repository.GetAuditRepository().Record(ctx, repository.AuditViewDelete, repository.AuditViewTarget(vid), view, nil)
+	return id, nil
+}
+
+// SaveReservation is the resolver for the saveReservation field.
+func (r *mutationResolver) SaveReservation(ctx context.Context, id *string, input model.ReservationInput) (*model.Reservation, error) {
+	user := repository.GetUserFromContext(ctx)
+	if user != nil && !user.HasRole(schema.RoleAdmin) {
+		return nil, errors.New("you need to be an administrator to manage reservations")
+	}
+
+	var rid *int64
+	if id != nil {
+		i, err := strconv.ParseInt(*id, 10, 64)
+		if err != nil {
+			log.Warn("Error while parsing reservation id")
+			return nil, err
+		}
+		rid = &i
+	}
+
+	reservation, err := repository.GetNodeRepository().SaveReservation(ctx, rid, &input)
+	if err != nil {
+		log.Warn("Error while saving reservation")
+		return nil, err
+	}
+
+	repository.GetAuditRepository().Record(ctx, repository.AuditReservationSave, repository.AuditReservationTarget(reservation.ID), nil, reservation)
+	return reservation, nil
+}
+
+// DeleteReservation is the resolver for the deleteReservation field.
+func (r *mutationResolver) DeleteReservation(ctx context.Context, id string) (string, error) {
+	user := repository.GetUserFromContext(ctx)
+	if user != nil && !user.HasRole(schema.RoleAdmin) {
+		return "", errors.New("you need to be an administrator to manage reservations")
+	}
+
+	rid, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		log.Warn("Error while parsing reservation id")
+		return "", err
+	}
+
+	reservation, err := repository.GetNodeRepository().DeleteReservation(rid)
+	if err != nil {
+		log.Warn("Error while deleting reservation")
+		return "", err
+	}
+
+	repository.GetAuditRepository().Record(ctx, repository.AuditReservationDelete, repository.AuditReservationTarget(rid), reservation, nil)
+	return id, nil
+}
+
+// SaveProject is the resolver for the saveProject field.
+func (r *mutationResolver) SaveProject(ctx context.Context, name string, description *string) (*model.Project, error) {
+	user := repository.GetUserFromContext(ctx)
+	if user != nil && !user.HasRole(schema.RoleAdmin) {
+		return nil, errors.New("you need to be an administrator to manage projects")
+	}
+
+	project, err := repository.GetProjectRepository().SaveProject(name, description)
+	if err != nil {
+		log.Warn("Error while saving project")
+		return nil, err
+	}
+
+	repository.GetAuditRepository().Record(ctx, repository.AuditProjectSave, repository.AuditProjectTarget(name), nil, project)
+	return project, nil
+}
+
+// DeleteProject is the resolver for the deleteProject field.
+func (r *mutationResolver) DeleteProject(ctx context.Context, name string) (string, error) {
+	user := repository.GetUserFromContext(ctx)
+	if user != nil && !user.HasRole(schema.RoleAdmin) {
+		return "", errors.New("you need to be an administrator to manage projects")
+	}
+
+	project, err := repository.GetProjectRepository().DeleteProject(name)
+	if err != nil {
+		log.Warn("Error while deleting project")
+		return "", err
+	}
+
+	repository.GetAuditRepository().Record(ctx, repository.AuditProjectDelete, repository.AuditProjectTarget(name), project, nil)
+	return name, nil
+}
+
+// SaveProjectGrant is the resolver for the saveProjectGrant field.
+func (r *mutationResolver) SaveProjectGrant(ctx context.Context, id *string, project string, input model.ProjectGrantInput) (*model.ProjectGrant, error) {
+	user := repository.GetUserFromContext(ctx)
+	if user != nil && !user.HasRole(schema.RoleAdmin) {
+		return nil, errors.New("you need to be an administrator to manage projects")
+	}
+
+	var gid *int64
+	if id != nil {
+		i, err := strconv.ParseInt(*id, 10, 64)
+		if err != nil {
+			log.Warn("Error while parsing grant id")
+			return nil, err
+		}
+		gid = &i
 	}
 
-	return tags, nil
+	grant, err := repository.GetProjectRepository().SaveGrant(gid, project, &input)
+	if err != nil {
+		log.Warn("Error while saving grant")
+		return nil, err
+	}
+
+	repository.GetAuditRepository().Record(ctx, repository.AuditGrantSave, repository.AuditProjectTarget(project), nil, grant)
+	return grant, nil
+}
+
+// DeleteProjectGrant is the resolver for the deleteProjectGrant field.
+func (r *mutationResolver) DeleteProjectGrant(ctx context.Context, id string) (string, error) {
+	user := repository.GetUserFromContext(ctx)
+	if user != nil && !user.HasRole(schema.RoleAdmin) {
+		return "", errors.New("you need to be an administrator to manage projects")
+	}
+
+	gid, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		log.Warn("Error while parsing grant id")
+		return "", err
+	}
+
+	grant, err := repository.GetProjectRepository().DeleteGrant(gid)
+	if err != nil {
+		log.Warn("Error while deleting grant")
+		return "", err
+	}
+
+	repository.GetAuditRepository().Record(ctx, repository.AuditGrantDelete, repository.AuditProjectTarget(grant.Project), grant, nil)
+	return id, nil
 }
 
 // UpdateConfiguration is the resolver for the updateConfiguration field.
 func (r *mutationResolver) UpdateConfiguration(ctx context.Context, name string, value string) (*string, error) {
-	if err := repository.GetUserCfgRepo().UpdateConfig(name, value, repository.GetUserFromContext(ctx)); err != nil {
+	user := repository.GetUserFromContext(ctx)
+	var before interface{}
+	if uiconfig, err := repository.GetUserCfgRepo().GetUIConfig(user); err == nil {
+		before = map[string]interface{}{name: uiconfig[name]}
+	}
+
+	if err := repository.GetUserCfgRepo().UpdateConfig(name, value, user); err != nil {
 		log.Warn("Error while updating user config")
 		return nil, err
 	}
 
+	var after interface{} = value
+	if json.Valid([]byte(value)) {
+		after = json.RawMessage(value)
+	}
+	repository.GetAuditRepository().Record(ctx, repository.AuditConfigUpdate, repository.AuditConfigTarget(user),
+		before, map[string]interface{}{name: after})
+
 	return nil, nil
 }
 
+// Grants is the resolver for the grants field.
+func (r *projectResolver) Grants(ctx context.Context, obj *model.Project) ([]*model.ProjectGrant, error) {
+	return repository.GetProjectRepository().GetGrants(obj.ID)
+}
+
+// Warning is the resolver for the warning field.
+func (r *projectGrantResolver) Warning(ctx context.Context, obj *model.ProjectGrant) (*float64, error) {
+	return repository.GrantWarning(obj, config.Keys.GrantWarningThresholds), nil
+}
+
+// BurnDown is the resolver for the burnDown field.
+func (r *projectGrantResolver) BurnDown(ctx context.Context, obj *model.ProjectGrant, resolution *int) ([]*model.BurnDownPoint, error) {
+	res := int64(24 * 60 * 60)
+	if resolution != nil {
+		res = int64(*resolution)
+	}
+
+	return repository.GetProjectRepository().BurnDown(obj, res)
+}
+
 // Clusters is the resolver for the clusters field.
 func (r *queryResolver) Clusters(ctx context.Context) ([]*schema.Cluster, error) {
 	return archive.Clusters, nil
@@ -136,7 +641,27 @@ func (r *queryResolver) Clusters(ctx context.Context) ([]*schema.Cluster, error)
 
 // Tags is the resolver for the tags field.
 func (r *queryResolver) Tags(ctx context.Context) ([]*schema.Tag, error) {
-	return r.Repo.GetTags(nil)
+	return r.Repo.GetTags(repository.GetUserFromContext(ctx), nil)
+}
+
+// SavedViews is the resolver for the savedViews field.
+func (r *queryResolver) SavedViews(ctx context.Context) ([]*model.SavedView, error) {
+	return repository.GetViewRepository().GetViews(ctx)
+}
+
+// SavedView is the resolver for the savedView field.
+func (r *queryResolver) SavedView(ctx context.Context, id string) (*model.SavedView, error) {
+	vid, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		log.Warn("Error while parsing view id")
+		return nil, err
+	}
+
+	view, err := repository.GetViewRepository().GetView(ctx, vid)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return view, err
 }
 
 // User is the resolver for the user field.
@@ -187,14 +712,14 @@ func (r *queryResolver) Job(ctx context.Context, id string) (*schema.Job, error)
 }
 
 // JobMetrics is the resolver for the jobMetrics field.
-func (r *queryResolver) JobMetrics(ctx context.Context, id string, metrics []string, scopes []schema.MetricScope) ([]*model.JobMetricWithName, error) {
+func (r *queryResolver) JobMetrics(ctx context.Context, id string, metrics []string, scopes []schema.MetricScope, percentiles []int) ([]*model.JobMetricWithName, error) {
 	job, err := r.Query().Job(ctx, id)
 	if err != nil {
 		log.Warn("Error while querying job for metrics")
 		return nil, err
 	}
 
-	data, err := metricdata.LoadData(job, metrics, scopes, ctx)
+	data, err := metricdata.LoadData(job, metrics, scopes, percentiles, ctx)
 	if err != nil {
 		log.Warn("Error while loading job data")
 		return nil, err
@@ -220,7 +745,7 @@ func (r *queryResolver) JobsFootprints(ctx context.Context, filter []*model.JobF
 }
 
 // Jobs is the resolver for the jobs field.
-func (r *queryResolver) Jobs(ctx context.Context, filter []*model.JobFilter, page *model.PageRequest, order *model.OrderByInput) (*model.JobResultList, error) {
+func (r *queryResolver) Jobs(ctx context.Context, filter []*model.JobFilter, page *model.PageRequest, order *model.OrderByInput, cursor *string) (*model.JobResultList, error) {
 	if page == nil {
 		page = &model.PageRequest{
 			ItemsPerPage: 50,
@@ -228,7 +753,18 @@ func (r *queryResolver) Jobs(ctx context.Context, filter []*model.JobFilter, pag
 		}
 	}
 
-	jobs, err := r.Repo.QueryJobs(ctx, filter, page, order)
+	var jobs []*schema.Job
+	var nextCursor *string
+	var err error
+	if cursor != nil {
+		var next string
+		jobs, next, err = r.Repo.QueryJobsCursor(ctx, filter, page.ItemsPerPage, order, *cursor)
+		if next != "" {
+			nextCursor = &next
+		}
+	} else {
+		jobs, err = r.Repo.QueryJobs(ctx, filter, page, order)
+	}
 	if err != nil {
 		log.Warn("Error while querying jobs")
 		return nil, err
@@ -240,7 +776,20 @@ func (r *queryResolver) Jobs(ctx context.Context, filter []*model.JobFilter, pag
 		return nil, err
 	}
 
-	return &model.JobResultList{Items: jobs, Count: &count}, nil
+	return &model.JobResultList{Items: jobs, Count: &count, NextCursor: nextCursor}, nil
+}
+
+// ArrayJob is the resolver for the arrayJob field.
+func (r *queryResolver) ArrayJob(ctx context.Context, arrayJobID int, cluster string) (*model.ArrayJob, error) {
+	a, err := r.Repo.FindArrayJob(ctx, int64(arrayJobID), cluster)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		log.Warn("Error while finding array job")
+		return nil, err
+	}
+
+	return a, nil
 }
 
 // JobsStatistics is the resolver for the jobsStatistics field.
@@ -249,7 +798,8 @@ func (r *queryResolver) JobsStatistics(ctx context.Context, filter []*model.JobF
 	var stats []*model.JobsStatistics
 
 	if requireField(ctx, "totalJobs") || requireField(ctx, "totalWalltime") || requireField(ctx, "totalNodes") || requireField(ctx, "totalCores") ||
-		requireField(ctx, "totalAccs") || requireField(ctx, "totalNodeHours") || requireField(ctx, "totalCoreHours") || requireField(ctx, "totalAccHours") {
+		requireField(ctx, "totalAccs") || requireField(ctx, "totalNodeHours") || requireField(ctx, "totalCoreHours") || requireField(ctx, "totalAccHours") ||
+		requireField(ctx, "totalEnergy") {
 		if groupBy == nil {
 			stats, err = r.Repo.JobsStats(ctx, filter)
 		} else {
@@ -302,6 +852,15 @@ func (r *queryResolver) JobsStatistics(ctx context.Context, filter []*model.JobF
 		}
 	}
 
+	var groups *model.StatisticsGroups
+	if groupBy != nil {
+		groups = &model.StatisticsGroups{Filter: filter, GroupBy: groupBy}
+	}
+	for _, s := range stats {
+		s.Filters = statisticsFilters(filter, groupBy, s.ID)
+		s.Groups = groups
+	}
+
 	return stats, nil
 }
 
@@ -329,11 +888,18 @@ func (r *queryResolver) NodeMetrics(ctx context.Context, cluster string, nodes [
 		return nil, err
 	}
 
+	reservations, err := repository.GetNodeRepository().GetReservations(&cluster, &from, &to)
+	if err != nil {
+		log.Warn("Error while loading reservations")
+		return nil, err
+	}
+
 	nodeMetrics := make([]*model.NodeMetrics, 0, len(data))
 	for hostname, metrics := range data {
 		host := &model.NodeMetrics{
-			Host:    hostname,
-			Metrics: make([]*model.JobMetricWithName, 0, len(metrics)*len(scopes)),
+			Host:         hostname,
+			Metrics:      make([]*model.JobMetricWithName, 0, len(metrics)*len(scopes)),
+			Reservations: repository.ReservationsOfHost(reservations, hostname),
 		}
 		host.SubCluster, _ = archive.GetSubClusterByNode(cluster, hostname)
 
@@ -353,6 +919,106 @@ func (r *queryResolver) NodeMetrics(ctx context.Context, cluster string, nodes [
 	return nodeMetrics, nil
 }
 
+// Nodes is the resolver for the nodes field.
+func (r *queryResolver) Nodes(ctx context.Context, cluster string, subCluster *string) ([]*model.Node, error) {
+	user := repository.GetUserFromContext(ctx)
+	if user != nil && !user.HasAnyRole([]schema.Role{schema.RoleAdmin, schema.RoleSupport}) {
+		return nil, errors.New("you need to be an administrator or support staff for this query")
+	}
+
+	return repository.GetNodeRepository().GetNodes(cluster, subCluster)
+}
+
+// NodeStates is the resolver for the nodeStates field.
+func (r *queryResolver) NodeStates(ctx context.Context, cluster string) ([]*model.NodeStatesCount, error) {
+	user := repository.GetUserFromContext(ctx)
+	if user != nil && !user.HasAnyRole([]schema.Role{schema.RoleAdmin, schema.RoleSupport}) {
+		return nil, errors.New("you need to be an administrator or support staff for this query")
+	}
+
+	return repository.GetNodeRepository().CountNodeStates(cluster)
+}
+
+// NodeStateHistory is the resolver for the nodeStateHistory field.
+func (r *queryResolver) NodeStateHistory(ctx context.Context, cluster string, subCluster *string, hostname *string, from time.Time, to time.Time) ([]*model.NodeStateChange, error) {
+	user := repository.GetUserFromContext(ctx)
+	if user != nil && !user.HasAnyRole([]schema.Role{schema.RoleAdmin, schema.RoleSupport}) {
+		return nil, errors.New("you need to be an administrator or support staff for this query")
+	}
+
+	return repository.GetNodeRepository().GetNodeStateHistory(cluster, subCluster, hostname, from, to)
+}
+
+// Reservations is the resolver for the reservations field.
+func (r *queryResolver) Reservations(ctx context.Context, cluster *string, from *time.Time, to *time.Time) ([]*model.Reservation, error) {
+	return repository.GetNodeRepository().GetReservations(cluster, from, to)
+}
+
+// Utilization is the resolver for the utilization field.
+func (r *queryResolver) Utilization(ctx context.Context, cluster string, from time.Time, to time.Time) ([]*model.SubClusterUtilization, error) {
+	user := repository.GetUserFromContext(ctx)
+	if user != nil && !user.HasAnyRole([]schema.Role{schema.RoleAdmin, schema.RoleSupport}) {
+		return nil, errors.New("you need to be an administrator or support staff for this query")
+	}
+
+	c := archive.GetCluster(cluster)
+	if c == nil {
+		return nil, fmt.Errorf("unknown cluster: %s", cluster)
+	}
+
+	return r.Repo.Utilization(c, from, to)
+}
+
+// Projects is the resolver for the projects field.
+func (r *queryResolver) Projects(ctx context.Context) ([]*model.Project, error) {
+	return repository.GetProjectRepository().GetProjects(ctx)
+}
+
+// Project is the resolver for the project field.
+func (r *queryResolver) Project(ctx context.Context, name string) (*model.Project, error) {
+	project, err := repository.GetProjectRepository().GetProject(ctx, name)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return project, err
+}
+
+// Filter is the resolver for the filter field.
+func (r *savedViewResolver) Filter(ctx context.Context, obj *model.SavedView) (interface{}, error) {
+	return obj.Filter, nil
+}
+
+// Order is the resolver for the order field.
+func (r *savedViewResolver) Order(ctx context.Context, obj *model.SavedView) (interface{}, error) {
+	if obj.Order == nil {
+		return nil, nil
+	}
+	return obj.Order, nil
+}
+
+// Percentiles is the resolver for the percentiles field.
+func (r *statsSeriesResolver) Percentiles(ctx context.Context, obj *schema.StatsSeries) ([]*model.PercentileSeries, error) {
+	if obj.Percentiles == nil {
+		return nil, nil
+	}
+
+	ps := make([]int, 0, len(obj.Percentiles))
+	for p := range obj.Percentiles {
+		ps = append(ps, p)
+	}
+	sort.Ints(ps)
+
+	res := make([]*model.PercentileSeries, 0, len(ps))
+	for _, p := range ps {
+		res = append(res, &model.PercentileSeries{
+			Percentile: p,
+			Data:       obj.Percentiles[p],
+		})
+	}
+
+	return res, nil
+}
+
 // NumberOfNodes is the resolver for the numberOfNodes field.
 func (r *subClusterResolver) NumberOfNodes(ctx context.Context, obj *schema.SubCluster) (int, error) {
 	nodeList, err := archive.ParseNodeList(obj.Nodes)
@@ -362,23 +1028,53 @@ func (r *subClusterResolver) NumberOfNodes(ctx context.Context, obj *schema.SubC
 	return nodeList.NodeCount(), nil
 }
 
+// ArrayJob returns generated.ArrayJobResolver implementation.
+func (r *Resolver) ArrayJob() generated.ArrayJobResolver { return &arrayJobResolver{r} }
+
 // Cluster returns generated.ClusterResolver implementation.
 func (r *Resolver) Cluster() generated.ClusterResolver { return &clusterResolver{r} }
 
 // Job returns generated.JobResolver implementation.
 func (r *Resolver) Job() generated.JobResolver { return &jobResolver{r} }
 
+// JobStep returns generated.JobStepResolver implementation.
+func (r *Resolver) JobStep() generated.JobStepResolver { return &jobStepResolver{r} }
+
+// JobsStatistics returns generated.JobsStatisticsResolver implementation.
+func (r *Resolver) JobsStatistics() generated.JobsStatisticsResolver {
+	return &jobsStatisticsResolver{r}
+}
+
 // Mutation returns generated.MutationResolver implementation.
 func (r *Resolver) Mutation() generated.MutationResolver { return &mutationResolver{r} }
 
+// Project returns generated.ProjectResolver implementation.
+func (r *Resolver) Project() generated.ProjectResolver { return &projectResolver{r} }
+
+// ProjectGrant returns generated.ProjectGrantResolver implementation.
+func (r *Resolver) ProjectGrant() generated.ProjectGrantResolver { return &projectGrantResolver{r} }
+
 // Query returns generated.QueryResolver implementation.
 func (r *Resolver) Query() generated.QueryResolver { return &queryResolver{r} }
 
+// SavedView returns generated.SavedViewResolver implementation.
+func (r *Resolver) SavedView() generated.SavedViewResolver { return &savedViewResolver{r} }
+
+// StatsSeries returns generated.StatsSeriesResolver implementation.
+func (r *Resolver) StatsSeries() generated.StatsSeriesResolver { return &statsSeriesResolver{r} }
+
 // SubCluster returns generated.SubClusterResolver implementation.
 func (r *Resolver) SubCluster() generated.SubClusterResolver { return &subClusterResolver{r} }
 
+type arrayJobResolver struct{ *Resolver }
 type clusterResolver struct{ *Resolver }
 type jobResolver struct{ *Resolver }
+type jobStepResolver struct{ *Resolver }
+type jobsStatisticsResolver struct{ *Resolver }
 type mutationResolver struct{ *Resolver }
+type projectResolver struct{ *Resolver }
+type projectGrantResolver struct{ *Resolver }
 type queryResolver struct{ *Resolver }
+type savedViewResolver struct{ *Resolver }
+type statsSeriesResolver struct{ *Resolver }
 type subClusterResolver struct{ *Resolver }
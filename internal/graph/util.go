@@ -47,7 +47,7 @@ func (r *queryResolver) rooflineHeatmap(
 			continue
 		}
 
-		jobdata, err := metricdata.LoadData(job, []string{"flops_any", "mem_bw"}, []schema.MetricScope{schema.MetricScopeNode}, ctx)
+		jobdata, err := metricdata.LoadData(job, []string{"flops_any", "mem_bw"}, []schema.MetricScope{schema.MetricScopeNode}, nil, ctx)
 		if err != nil {
 			log.Errorf("Error while loading roofline metrics for job %d", job.ID)
 			return nil, err
@@ -176,6 +176,27 @@ func (r *queryResolver) jobsFootprints(ctx context.Context, filter []*model.JobF
 // 	return totalJobCores
 // }
 
+// Returns the filters matching the jobs of the statistics of the group `id`.
+func statisticsFilters(filter []*model.JobFilter, groupBy *model.Aggregate, id string) []*model.JobFilter {
+	if groupBy == nil {
+		return filter
+	}
+
+	group := &model.JobFilter{}
+	switch *groupBy {
+	case model.AggregateUser:
+		group.User = &model.StringInput{Eq: &id}
+	case model.AggregateProject:
+		group.Project = &model.StringInput{Eq: &id}
+	case model.AggregateCluster:
+		group.Cluster = &model.StringInput{Eq: &id}
+	}
+
+	filters := make([]*model.JobFilter, 0, len(filter)+1)
+	filters = append(filters, filter...)
+	return append(filters, group)
+}
+
 func requireField(ctx context.Context, name string) bool {
 	fields := graphql.CollectAllFields(ctx)
 
@@ -187,3 +208,23 @@ func requireField(ctx context.Context, name string) bool {
 
 	return false
 }
+
+// Returns true if the resolved field belongs to the job of the query job(id),
+// false for jobs in lists or nested in other types.
+func isSingleJobField(ctx context.Context) bool {
+	fc := graphql.GetFieldContext(ctx)
+	if fc == nil || fc.Parent == nil || fc.Parent.Field.Field == nil {
+		return false
+	}
+
+	return fc.Parent.Object == "Query" && fc.Parent.Field.Name == "job"
+}
+
+// Returns the footprint value with the given key, nil if the job has none.
+func footprintValue(job *schema.Job, key string) *float64 {
+	value, ok := job.Footprint[key]
+	if !ok {
+		return nil
+	}
+	return &value
+}
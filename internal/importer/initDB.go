@@ -60,13 +60,13 @@ func InitDB() error {
 			StartTimeUnix: jobMeta.StartTime,
 		}
 
-		// TODO: Other metrics...
-		job.LoadAvg = loadJobStat(jobMeta, "cpu_load")
-		job.FlopsAnyAvg = loadJobStat(jobMeta, "flops_any")
-		job.MemUsedMax = loadJobStat(jobMeta, "mem_used")
-		job.MemBwAvg = loadJobStat(jobMeta, "mem_bw")
-		job.NetBwAvg = loadJobStat(jobMeta, "net_bw")
-		job.FileBwAvg = loadJobStat(jobMeta, "file_bw")
+		job.Footprint = repository.JobFootprint(jobMeta.Cluster, jobMeta.Statistics)
+		job.RawFootprint, err = json.Marshal(job.Footprint)
+		if err != nil {
+			log.Errorf("repository initDB(): %v", err)
+			errorOccured++
+			continue
+		}
 
 		job.RawResources, err = json.Marshal(job.Resources)
 		if err != nil {
@@ -96,7 +96,7 @@ func InitDB() error {
 		}
 
 		for _, tag := range job.Tags {
-			tagstr := tag.Name + ":" + tag.Type
+			tagstr := tag.Name + ":" + tag.Type + ":" + string(tag.Scope) + ":" + tag.Owner
 			tagId, ok := tags[tagstr]
 			if !ok {
 				tagId, err = r.TransactionAddTag(t, tag)
@@ -122,7 +122,7 @@ func InitDB() error {
 
 	r.TransactionEnd(t)
 	log.Printf("A total of %d jobs have been registered in %.3f seconds.\n", i, time.Since(starttime).Seconds())
-	return nil
+	return r.RefreshRollups()
 }
 
 // This function also sets the subcluster if necessary!
@@ -150,18 +150,6 @@ func SanityChecks(job *schema.BaseJob) error {
 	return nil
 }
 
-func loadJobStat(job *schema.JobMeta, metric string) float64 {
-	if stats, ok := job.Statistics[metric]; ok {
-		if metric == "mem_used" {
-			return stats.Max
-		} else {
-			return stats.Avg
-		}
-	}
-
-	return 0.0
-}
-
 func checkJobData(d *schema.JobData) error {
 	for _, scopes := range *d {
 		// var newUnit schema.Unit
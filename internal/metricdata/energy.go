@@ -0,0 +1,176 @@
+// Copyright (C) 2022 NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+package metricdata
+
+import (
+	"strconv"
+
+	"github.com/ClusterCockpit/cc-backend/pkg/archive"
+	"github.com/ClusterCockpit/cc-backend/pkg/log"
+	"github.com/ClusterCockpit/cc-backend/pkg/schema"
+	ccunits "github.com/ClusterCockpit/cc-units"
+)
+
+// Power metrics used for energy accounting, per cluster.
+var energyMetrics map[string][]string = map[string][]string{}
+
+// Returns the energy in kWh consumed by the job. The average power of every
+// configured power metric is multiplied by the job duration per host. On
+// shared nodes only the job's share of the power is attributed to it.
+func jobEnergy(job *schema.Job, jobData schema.JobData) float64 {
+	energy := 0.0 // in Ws
+	for _, metric := range energyMetrics[job.Cluster] {
+		data, ok := jobData[metric]
+		if !ok {
+			log.Warnf("energy metric '%s' missing in job data of job %d", metric, job.JobID)
+			continue
+		}
+
+		mc := archive.GetMetricConfig(job.Cluster, metric)
+		if mc == nil {
+			log.Warnf("energy metric '%s' not configured for cluster '%s'", metric, job.Cluster)
+			continue
+		}
+		prefix := ccunits.NewPrefix(mc.Unit.Prefix)
+		if prefix == ccunits.InvalidPrefix {
+			log.Warnf("energy metric '%s' has invalid unit prefix '%s'", metric, mc.Unit.Prefix)
+			continue
+		}
+
+		for _, power := range jobPower(job, mc.Scope, data) {
+			energy += power * float64(prefix) * float64(job.Duration)
+		}
+	}
+
+	return energy / 3600 / 1000
+}
+
+// Returns true if the metric is used for energy accounting on the cluster.
+func isEnergyMetric(cluster string, metric string) bool {
+	for _, m := range energyMetrics[cluster] {
+		if m == metric {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the average power per host caused by the job. Socket and memory
+// domain data at the native scope is split per domain by the hwthreads of the
+// job in it. Node data is split by the job's share of the node. Accelerator,
+// core and hwthread data only covers the job's resources.
+func jobPower(job *schema.Job, scope schema.MetricScope, data map[schema.MetricScope]*schema.JobMetric) map[string]float64 {
+	power := make(map[string]float64)
+	if domainData, ok := data[scope]; ok && (scope == schema.MetricScopeSocket || scope == schema.MetricScopeMemoryDomain) {
+		for _, series := range domainData.Series {
+			if series.Id == nil {
+				continue
+			}
+			power[series.Hostname] += series.Statistics.Avg * domainPowerShare(job, scope, series.Hostname, *series.Id)
+		}
+		return power
+	}
+
+	if nodeData, ok := data[schema.MetricScopeNode]; ok {
+		for _, series := range nodeData.Series {
+			power[series.Hostname] += series.Statistics.Avg * powerShare(job, scope, series.Hostname)
+		}
+		return power
+	}
+
+	jm := coarsestScope(data)
+	if jm == nil {
+		return power
+	}
+
+	for hostname, stats := range jm.NodeStatistics("sum") {
+		power[hostname] = stats.Avg
+	}
+	return power
+}
+
+// Returns the resources of the job on the host and the topology of its
+// subcluster if the power of the host is shared with other jobs, ok is false
+// if the full power is attributed to the job.
+func sharedResource(job *schema.Job, hostname string) (resource *schema.Resource, topo *schema.Topology, ok bool) {
+	if job.Exclusive == 1 {
+		return nil, nil, false
+	}
+
+	for _, r := range job.Resources {
+		if r.Hostname == hostname {
+			resource = r
+			break
+		}
+	}
+	if resource == nil || resource.HWThreads == nil {
+		return nil, nil, false
+	}
+
+	subCluster, err := archive.GetSubCluster(job.Cluster, job.SubCluster)
+	if err != nil {
+		log.Warnf("no topology for job %d, attributing full node power: %s", job.JobID, err.Error())
+		return nil, nil, false
+	}
+
+	return resource, &subCluster.Topology, true
+}
+
+// Returns the fraction of the power of a host measured at node scope that is
+// caused by the job, for a metric with the given native scope. The power of
+// node metrics is split by the allocated hwthreads and accelerators, of
+// accelerator metrics by the allocated accelerators and of all other metrics
+// by the allocated hwthreads.
+func powerShare(job *schema.Job, scope schema.MetricScope, hostname string) float64 {
+	resource, topo, ok := sharedResource(job, hostname)
+	if !ok || len(topo.Node) == 0 {
+		return 1.0
+	}
+
+	share := float64(len(resource.HWThreads)) / float64(len(topo.Node))
+	switch scope {
+	case schema.MetricScopeNode:
+		if len(topo.Accelerators) > 0 {
+			share = (share + float64(len(resource.Accelerators))/float64(len(topo.Accelerators))) / 2
+		}
+	case schema.MetricScopeAccelerator:
+		if len(topo.Accelerators) > 0 {
+			share = float64(len(resource.Accelerators)) / float64(len(topo.Accelerators))
+		}
+	}
+	return share
+}
+
+// Returns the fraction of the power of the socket or memory domain `id` of a
+// host that is caused by the job, the share of its hwthreads allocated to the
+// job.
+func domainPowerShare(job *schema.Job, scope schema.MetricScope, hostname string, id string) float64 {
+	resource, topo, ok := sharedResource(job, hostname)
+	if !ok {
+		return 1.0
+	}
+
+	domains := topo.Socket
+	if scope == schema.MetricScopeMemoryDomain {
+		domains = topo.MemoryDomain
+	}
+	idx, err := strconv.Atoi(id)
+	if err != nil || idx < 0 || idx >= len(domains) || len(domains[idx]) == 0 {
+		log.Warnf("unknown %s '%s' on host %s of job %d, attributing its full power", scope, id, hostname, job.JobID)
+		return 1.0
+	}
+
+	allocated := 0
+	for _, hwthread := range domains[idx] {
+		for _, h := range resource.HWThreads {
+			if h == hwthread {
+				allocated++
+				break
+			}
+		}
+	}
+
+	return float64(allocated) / float64(len(domains[idx]))
+}
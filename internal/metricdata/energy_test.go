@@ -0,0 +1,190 @@
+// Copyright (C) 2022 NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+package metricdata
+
+import (
+	"math"
+	"testing"
+
+	"github.com/ClusterCockpit/cc-backend/pkg/archive"
+	"github.com/ClusterCockpit/cc-backend/pkg/schema"
+)
+
+// Two sockets with four hwthreads each, the "gpu" subcluster has two
+// accelerators in addition.
+func setupEnergyCluster(t *testing.T) {
+	topology := schema.Topology{
+		Node:         []int{0, 1, 2, 3, 4, 5, 6, 7},
+		Socket:       [][]int{{0, 1, 2, 3}, {4, 5, 6, 7}},
+		MemoryDomain: [][]int{{0, 1, 2, 3}, {4, 5, 6, 7}},
+	}
+	gpuTopology := topology
+	gpuTopology.Accelerators = []*schema.Accelerator{{ID: "0"}, {ID: "1"}}
+
+	clusters := archive.Clusters
+	archive.Clusters = []*schema.Cluster{{
+		Name: "energy",
+		MetricConfig: []*schema.MetricConfig{
+			{Name: "node_power", Unit: schema.Unit{Base: "W"}, Scope: schema.MetricScopeNode},
+			{Name: "socket_power", Unit: schema.Unit{Base: "W"}, Scope: schema.MetricScopeSocket},
+			{Name: "acc_power", Unit: schema.Unit{Base: "W", Prefix: "k"}, Scope: schema.MetricScopeAccelerator},
+		},
+		SubClusters: []*schema.SubCluster{
+			{Name: "cpu", Topology: topology},
+			{Name: "gpu", Topology: gpuTopology},
+		},
+	}}
+	energyMetrics["energy"] = []string{"node_power", "socket_power", "acc_power"}
+
+	t.Cleanup(func() {
+		archive.Clusters = clusters
+		delete(energyMetrics, "energy")
+	})
+}
+
+func TestPowerShare(t *testing.T) {
+	setupEnergyCluster(t)
+
+	tests := []struct {
+		name       string
+		subCluster string
+		exclusive  int32
+		hwthreads  []int
+		accs       []string
+		scope      schema.MetricScope
+		want       float64
+	}{
+		{"exclusive", "cpu", 1, []int{0, 1}, nil, schema.MetricScopeNode, 1.0},
+		{"shared node", "cpu", 0, []int{0, 1}, nil, schema.MetricScopeNode, 0.25},
+		{"shared node with accelerators", "gpu", 0, []int{0, 1}, []string{"0"}, schema.MetricScopeNode, 0.375},
+		{"socket metric", "cpu", 0, []int{0, 1}, nil, schema.MetricScopeSocket, 0.25},
+		{"memory domain metric", "cpu", 0, []int{4, 5, 6}, nil, schema.MetricScopeMemoryDomain, 0.375},
+		{"accelerator metric", "gpu", 0, []int{0}, []string{"1"}, schema.MetricScopeAccelerator, 0.5},
+		{"no hwthreads", "cpu", 0, nil, nil, schema.MetricScopeNode, 1.0},
+		{"unknown subcluster", "none", 0, []int{0, 1}, nil, schema.MetricScopeNode, 1.0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := &schema.Job{BaseJob: schema.BaseJob{
+				Cluster:    "energy",
+				SubCluster: tt.subCluster,
+				Exclusive:  tt.exclusive,
+				Resources:  []*schema.Resource{{Hostname: "host1", HWThreads: tt.hwthreads, Accelerators: tt.accs}},
+			}}
+			if got := powerShare(job, tt.scope, "host1"); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("powerShare() = %f, want %f", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDomainPowerShare(t *testing.T) {
+	setupEnergyCluster(t)
+
+	tests := []struct {
+		name      string
+		exclusive int32
+		hwthreads []int
+		scope     schema.MetricScope
+		id        string
+		want      float64
+	}{
+		{"exclusive", 1, []int{0, 1}, schema.MetricScopeSocket, "1", 1.0},
+		{"shared socket", 0, []int{0, 1}, schema.MetricScopeSocket, "0", 0.5},
+		{"other socket", 0, []int{0, 1}, schema.MetricScopeSocket, "1", 0.0},
+		{"two sockets", 0, []int{3, 4}, schema.MetricScopeSocket, "1", 0.25},
+		{"memory domain", 0, []int{4, 5, 6}, schema.MetricScopeMemoryDomain, "1", 0.75},
+		{"unknown socket", 0, []int{0, 1}, schema.MetricScopeSocket, "7", 1.0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := &schema.Job{BaseJob: schema.BaseJob{
+				Cluster:    "energy",
+				SubCluster: "cpu",
+				Exclusive:  tt.exclusive,
+				Resources:  []*schema.Resource{{Hostname: "host1", HWThreads: tt.hwthreads}},
+			}}
+			if got := domainPowerShare(job, tt.scope, "host1", tt.id); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("domainPowerShare() = %f, want %f", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJobEnergy(t *testing.T) {
+	setupEnergyCluster(t)
+
+	nodePower := map[schema.MetricScope]*schema.JobMetric{
+		schema.MetricScopeNode: {Series: []schema.Series{
+			{Hostname: "host1", Statistics: schema.MetricStatistics{Avg: 200}},
+			{Hostname: "host2", Statistics: schema.MetricStatistics{Avg: 300}},
+		}},
+	}
+	accId0, accId1 := "0", "1"
+	accPower := map[schema.MetricScope]*schema.JobMetric{
+		schema.MetricScopeAccelerator: {Series: []schema.Series{
+			{Hostname: "host1", Id: &accId0, Data: []schema.Float{0.1, 0.1}},
+			{Hostname: "host1", Id: &accId1, Data: []schema.Float{0.3, 0.3}},
+		}},
+	}
+
+	socket0, socket1 := "0", "1"
+	socketPower := map[schema.MetricScope]*schema.JobMetric{
+		schema.MetricScopeSocket: {Series: []schema.Series{
+			{Hostname: "host1", Id: &socket0, Statistics: schema.MetricStatistics{Avg: 100}},
+			{Hostname: "host1", Id: &socket1, Statistics: schema.MetricStatistics{Avg: 300}},
+			{Hostname: "host2", Id: &socket0, Statistics: schema.MetricStatistics{Avg: 100}},
+			{Hostname: "host2", Id: &socket1, Statistics: schema.MetricStatistics{Avg: 300}},
+		}},
+		schema.MetricScopeNode: {Series: []schema.Series{
+			{Hostname: "host1", Statistics: schema.MetricStatistics{Avg: 400}},
+			{Hostname: "host2", Statistics: schema.MetricStatistics{Avg: 400}},
+		}},
+	}
+	socketPowerOfNodes := map[schema.MetricScope]*schema.JobMetric{
+		schema.MetricScopeNode: socketPower[schema.MetricScopeNode],
+	}
+
+	exclusive := []*schema.Resource{{Hostname: "host1"}, {Hostname: "host2"}}
+	shared := []*schema.Resource{
+		{Hostname: "host1", HWThreads: []int{0, 1}},
+		{Hostname: "host2", HWThreads: []int{0, 1, 2, 3}},
+	}
+
+	tests := []struct {
+		name      string
+		exclusive int32
+		resources []*schema.Resource
+		data      schema.JobData
+		want      float64 // in kWh
+	}{
+		{"node power", 1, exclusive, schema.JobData{"node_power": nodePower}, 0.5},
+		{"shared node", 0, shared, schema.JobData{"node_power": nodePower}, 0.2},
+		{"accelerator power without node scope", 1, exclusive, schema.JobData{"acc_power": accPower}, 0.4},
+		{"node and accelerator power", 1, exclusive, schema.JobData{"node_power": nodePower, "acc_power": accPower}, 0.9},
+		{"missing metrics", 1, exclusive, schema.JobData{"mem_power": nodePower}, 0.0},
+		// Only socket 0 is used by the job on both hosts
+		{"shared socket", 0, shared, schema.JobData{"socket_power": socketPower}, 0.15},
+		{"socket power at node scope", 0, shared, schema.JobData{"socket_power": socketPowerOfNodes}, 0.3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := &schema.Job{BaseJob: schema.BaseJob{
+				JobID:      1,
+				Cluster:    "energy",
+				SubCluster: "cpu",
+				Exclusive:  tt.exclusive,
+				Resources:  tt.resources,
+			}}
+			job.Duration = 3600
+			if got := jobEnergy(job, tt.data); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("jobEnergy() = %f, want %f", got, tt.want)
+			}
+		})
+	}
+}
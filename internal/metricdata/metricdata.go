@@ -9,6 +9,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"math"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/ClusterCockpit/cc-backend/internal/config"
@@ -35,12 +37,26 @@ type MetricDataRepository interface {
 
 var metricDataRepos map[string]MetricDataRepository = map[string]MetricDataRepository{}
 
+var archiveScopeRules map[string][]*schema.ArchiveScopeRule = map[string][]*schema.ArchiveScopeRule{}
+
 var useArchive bool
 
 func Init(disableArchive bool) error {
 
 	useArchive = !disableArchive
 	for _, cluster := range config.Keys.Clusters {
+		if cluster.ArchiveScopes != nil {
+			for _, rule := range cluster.ArchiveScopes {
+				for _, scope := range rule.Scopes {
+					if !scope.Valid() {
+						return fmt.Errorf("METRICDATA/METRICDATA > invalid archive scope '%s' for cluster %v", scope, cluster.Name)
+					}
+				}
+			}
+			archiveScopeRules[cluster.Name] = cluster.ArchiveScopes
+		}
+		energyMetrics[cluster.Name] = cluster.EnergyMetrics
+
 		if cluster.MetricDataRepository != nil {
 			var kind struct {
 				Kind string `json:"kind"`
@@ -76,12 +92,21 @@ func Init(disableArchive bool) error {
 
 var cache *lrucache.Cache = lrucache.New(128 * 1024 * 1024)
 
-// Fetches the metric data for a job.
+// Fetches the metric data for a job. If percentiles are requested, they are
+// added to every metric that has a statistics series.
 func LoadData(job *schema.Job,
 	metrics []string,
 	scopes []schema.MetricScope,
+	percentiles []int,
 	ctx context.Context) (schema.JobData, error) {
-	data := cache.Get(cacheKey(job, metrics, scopes), func() (_ interface{}, ttl time.Duration, size int) {
+
+	for _, p := range percentiles {
+		if p < 1 || p > 99 {
+			return nil, fmt.Errorf("METRICDATA/METRICDATA > invalid percentile %d, must be between 1 and 99", p)
+		}
+	}
+
+	data := cache.Get(cacheKey(job, metrics, scopes, percentiles), func() (_ interface{}, ttl time.Duration, size int) {
 		var jd schema.JobData
 		var err error
 
@@ -115,7 +140,6 @@ func LoadData(job *schema.Job,
 					return err, 0, 0
 				}
 			}
-			size = jd.Size()
 		} else {
 			jd, err = archive.GetHandle().LoadJobData(job)
 			if err != nil {
@@ -153,7 +177,6 @@ func LoadData(job *schema.Job,
 				}
 				jd = res
 			}
-			size = jd.Size()
 		}
 
 		ttl = 5 * time.Hour
@@ -161,7 +184,8 @@ func LoadData(job *schema.Job,
 			ttl = 2 * time.Minute
 		}
 
-		prepareJobData(job, jd, scopes)
+		prepareJobData(job, jd, scopes, percentiles)
+		size = jd.Size()
 
 		return jd, ttl, size
 	})
@@ -252,31 +276,53 @@ func LoadNodeData(
 func cacheKey(
 	job *schema.Job,
 	metrics []string,
-	scopes []schema.MetricScope) string {
+	scopes []schema.MetricScope,
+	percentiles []int) string {
 
 	// Duration and StartTime do not need to be in the cache key as StartTime is less unique than
 	// job.ID and the TTL of the cache entry makes sure it does not stay there forever.
-	return fmt.Sprintf("%d(%s):[%v],[%v]",
-		job.ID, job.State, metrics, scopes)
+	return fmt.Sprintf("%d(%s):[%v],[%v],[%v]",
+		job.ID, job.State, metrics, scopes, percentiles)
+}
+
+// InvalidateJob removes the cached metric data of the job, for example after
+// its resources were corrected.
+func InvalidateJob(job *schema.Job) {
+	prefix := fmt.Sprintf("%d(", job.ID)
+	keys := make([]string, 0)
+	cache.Keys(func(key string, _ interface{}) {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	})
+
+	for _, key := range keys {
+		cache.Del(key)
+	}
 }
 
 // For /monitoring/job/<job> and some other places, flops_any and mem_bw need
 // to be available at the scope 'node'. If a job has a lot of nodes,
 // statisticsSeries should be available so that a min/mean/max Graph can be
-// used instead of a lot of single lines.
+// used instead of a lot of single lines. Requested percentiles are added to
+// every statistics series, so that median and p10/p90 bands can be plotted
+// instead of the min/max envelope.
 func prepareJobData(
 	job *schema.Job,
 	jobData schema.JobData,
-	scopes []schema.MetricScope) {
+	scopes []schema.MetricScope,
+	percentiles []int) {
 
 	const maxSeriesSize int = 15
 	for _, scopes := range jobData {
 		for _, jm := range scopes {
-			if jm.StatisticsSeries != nil || len(jm.Series) <= maxSeriesSize {
-				continue
+			if jm.StatisticsSeries == nil && len(jm.Series) > maxSeriesSize {
+				jm.AddStatisticsSeries()
 			}
 
-			jm.AddStatisticsSeries()
+			if len(percentiles) != 0 && jm.StatisticsSeries != nil {
+				jm.AddPercentiles(percentiles)
+			}
 		}
 	}
 
@@ -296,55 +342,108 @@ func prepareJobData(
 // Writes a running job to the job-archive
 func ArchiveJob(job *schema.Job, ctx context.Context) (*schema.JobMeta, error) {
 
-	allMetrics := make([]string, 0)
-	metricConfigs := archive.GetCluster(job.Cluster).MetricConfig
-	for _, mc := range metricConfigs {
-		allMetrics = append(allMetrics, mc.Name)
-	}
-
-	// TODO: Talk about this! What resolutions to store data at...
-	scopes := []schema.MetricScope{schema.MetricScopeNode}
-	if job.NumNodes <= 8 {
-		scopes = append(scopes, schema.MetricScopeCore)
+	// Metrics archived at the same scopes are loaded with a single request.
+	metricsByScopes := make(map[string][]string)
+	scopesByKey := make(map[string][]schema.MetricScope)
+	for _, mc := range archive.GetCluster(job.Cluster).MetricConfig {
+		scopes := archiveScopes(job, mc)
+		// Node data of socket and memory domain power also covers the domains
+		// the job does not run on
+		if isEnergyMetric(job.Cluster, mc.Name) && (mc.Scope == schema.MetricScopeSocket || mc.Scope == schema.MetricScopeMemoryDomain) {
+			scopes = appendScope(scopes, mc.Scope)
+		}
+		key := fmt.Sprint(scopes)
+		metricsByScopes[key] = append(metricsByScopes[key], mc.Name)
+		scopesByKey[key] = scopes
 	}
 
-	jobData, err := LoadData(job, allMetrics, scopes, ctx)
-	if err != nil {
-		log.Error("Error wile loading job data for archiving")
-		return nil, err
+	jobData := make(schema.JobData)
+	for key, metrics := range metricsByScopes {
+		data, err := LoadData(job, metrics, scopesByKey[key], nil, ctx)
+		if err != nil && len(scopesByKey[key]) > 1 {
+			// Archive the scopes that can be loaded, node scope is required
+			log.Warnf("Error while loading job data of job %d at scopes %v for archiving, loading scopes separately: %v",
+				job.JobID, scopesByKey[key], err)
+			data, err = loadScopesSeparately(job, metrics, scopesByKey[key], ctx)
+		}
+		if err != nil {
+			log.Error("Error wile loading job data for archiving")
+			return nil, err
+		}
+		jobData = mergeJobData(jobData, data)
 	}
 
 	jobMeta := &schema.JobMeta{
-		BaseJob:    job.BaseJob,
-		StartTime:  job.StartTime.Unix(),
-		Statistics: make(map[string]schema.JobStatistics),
+		BaseJob:               job.BaseJob,
+		StartTime:             job.StartTime.Unix(),
+		Statistics:            make(map[string]schema.JobStatistics),
+		AcceleratorStatistics: make(map[string][]*schema.AcceleratorStatistics),
+		ArchivedScopes:        make(map[string][]schema.MetricScope),
 	}
 
 	for metric, data := range jobData {
-		avg, min, max := 0.0, math.MaxFloat32, -math.MaxFloat32
-		nodeData, ok := data["node"]
-		if !ok {
-			// TODO/FIXME: Calc average for non-node metrics as well!
-			continue
+		mc := archive.GetMetricConfig(job.Cluster, metric)
+
+		archived := make([]schema.MetricScope, 0, len(data))
+		for scope := range data {
+			archived = append(archived, scope)
 		}
+		sort.Slice(archived, func(i, j int) bool { return archived[j].LT(archived[i]) })
+		jobMeta.ArchivedScopes[metric] = archived
+
+		avg, min, max := 0.0, math.MaxFloat32, -math.MaxFloat32
+
+		if nodeData, ok := data[schema.MetricScopeNode]; ok {
+			for _, series := range nodeData.Series {
+				avg += series.Statistics.Avg
+				min = math.Min(min, series.Statistics.Min)
+				max = math.Max(max, series.Statistics.Max)
+			}
+		} else {
+			// Metrics not available at node scope are aggregated
+			// to node level from the coarsest scope available.
+			jm := coarsestScope(data)
+			if jm == nil {
+				continue
+			}
 
-		for _, series := range nodeData.Series {
-			avg += series.Statistics.Avg
-			min = math.Min(min, series.Statistics.Min)
-			max = math.Max(max, series.Statistics.Max)
+			for _, stats := range jm.NodeStatistics(mc.Aggregation) {
+				avg += stats.Avg
+				min = math.Min(min, stats.Min)
+				max = math.Max(max, stats.Max)
+			}
 		}
 
 		jobMeta.Statistics[metric] = schema.JobStatistics{
 			Unit: schema.Unit{
-				Prefix: archive.GetMetricConfig(job.Cluster, metric).Unit.Prefix,
-				Base:   archive.GetMetricConfig(job.Cluster, metric).Unit.Base,
+				Prefix: mc.Unit.Prefix,
+				Base:   mc.Unit.Base,
 			},
 			Avg: avg / float64(job.NumNodes),
 			Min: min,
 			Max: max,
 		}
+
+		if accData, ok := data[schema.MetricScopeAccelerator]; ok {
+			for _, series := range accData.Series {
+				id := ""
+				if series.Id != nil {
+					id = *series.Id
+				}
+
+				jobMeta.AcceleratorStatistics[metric] = append(jobMeta.AcceleratorStatistics[metric], &schema.AcceleratorStatistics{
+					Hostname: series.Hostname,
+					ID:       id,
+					Avg:      series.Statistics.Avg,
+					Min:      series.Statistics.Min,
+					Max:      series.Statistics.Max,
+				})
+			}
+		}
 	}
 
+	jobMeta.Energy = jobEnergy(job, jobData)
+
 	// If the file based archive is disabled,
 	// only return the JobMeta structure as the
 	// statistics in there are needed.
@@ -354,3 +453,101 @@ func ArchiveJob(job *schema.Job, ctx context.Context) (*schema.JobMeta, error) {
 
 	return jobMeta, archive.GetHandle().ImportJob(jobMeta, &jobData)
 }
+
+// Loads every scope with a separate request and skips the scopes other than
+// node scope which can not be loaded.
+func loadScopesSeparately(job *schema.Job, metrics []string, scopes []schema.MetricScope, ctx context.Context) (schema.JobData, error) {
+	jobData := make(schema.JobData)
+	for _, scope := range scopes {
+		data, err := LoadData(job, metrics, []schema.MetricScope{scope}, nil, ctx)
+		if err != nil {
+			if scope == schema.MetricScopeNode {
+				return nil, err
+			}
+			log.Warnf("Scope %s of job %d not archived: %v", scope, job.JobID, err)
+			continue
+		}
+		jobData = mergeJobData(jobData, data)
+	}
+
+	return jobData, nil
+}
+
+// Default rules used for clusters without 'archiveScopes' configuration.
+var defaultArchiveScopes = []*schema.ArchiveScopeRule{
+	{Scopes: []schema.MetricScope{schema.MetricScopeCore}, MaxNodes: 8},
+	{NativeScope: schema.MetricScopeAccelerator, Scopes: []schema.MetricScope{schema.MetricScopeAccelerator}},
+}
+
+// Returns the scopes at which the metric is archived for the job. Node scope
+// is always included, further scopes are added by the matching rules.
+func archiveScopes(job *schema.Job, mc *schema.MetricConfig) []schema.MetricScope {
+	rules, ok := archiveScopeRules[job.Cluster]
+	if !ok {
+		rules = defaultArchiveScopes
+	}
+
+	scopes := []schema.MetricScope{schema.MetricScopeNode}
+	for _, rule := range rules {
+		if rule.MaxNodes > 0 && int(job.NumNodes) > rule.MaxNodes {
+			continue
+		}
+
+		matches := len(rule.Metrics) == 0 && rule.NativeScope == ""
+		if rule.NativeScope != "" && rule.NativeScope == mc.Scope {
+			matches = true
+		}
+		for _, metric := range rule.Metrics {
+			if metric == mc.Name {
+				matches = true
+			}
+		}
+		if !matches {
+			continue
+		}
+
+		for _, scope := range rule.Scopes {
+			scopes = appendScope(scopes, scope)
+		}
+	}
+
+	return scopes
+}
+
+// Appends the scope if it is not in scopes yet.
+func appendScope(scopes []schema.MetricScope, scope schema.MetricScope) []schema.MetricScope {
+	for _, s := range scopes {
+		if s == scope {
+			return scopes
+		}
+	}
+	return append(scopes, scope)
+}
+
+// Returns the job metric at the coarsest scope present in data.
+func coarsestScope(data map[schema.MetricScope]*schema.JobMetric) *schema.JobMetric {
+	var maxScope schema.MetricScope = schema.MetricScopeInvalid
+	for scope := range data {
+		maxScope = maxScope.Max(scope)
+	}
+
+	return data[maxScope]
+}
+
+// Returns a new JobData containing the metrics and scopes of both arguments.
+// The arguments are not modified as they might be shared with the cache.
+func mergeJobData(a, b schema.JobData) schema.JobData {
+	res := make(schema.JobData, len(a)+len(b))
+	for _, jd := range []schema.JobData{a, b} {
+		for metric, scopes := range jd {
+			if _, ok := res[metric]; !ok {
+				res[metric] = make(map[schema.MetricScope]*schema.JobMetric, len(scopes))
+			}
+			for scope, jm := range scopes {
+				res[metric][scope] = jm
+			}
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,168 @@
+// Copyright (C) 2022 NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+package metricdata
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ClusterCockpit/cc-backend/pkg/archive"
+	"github.com/ClusterCockpit/cc-backend/pkg/schema"
+)
+
+func TestArchiveScopes(t *testing.T) {
+	archiveScopeRules["custom"] = []*schema.ArchiveScopeRule{
+		{Metrics: []string{"flops_any"}, Scopes: []schema.MetricScope{schema.MetricScopeSocket, schema.MetricScopeCore}},
+		{Metrics: []string{"flops_any", "mem_bw"}, Scopes: []schema.MetricScope{schema.MetricScopeSocket}, MaxNodes: 2},
+		{NativeScope: schema.MetricScopeHWThread, Scopes: []schema.MetricScope{schema.MetricScopeHWThread}, MaxNodes: 1},
+	}
+	defer delete(archiveScopeRules, "custom")
+
+	flops := &schema.MetricConfig{Name: "flops_any", Scope: schema.MetricScopeHWThread}
+	memBw := &schema.MetricConfig{Name: "mem_bw", Scope: schema.MetricScopeSocket}
+	gpu := &schema.MetricConfig{Name: "acc_utilization", Scope: schema.MetricScopeAccelerator}
+
+	tests := []struct {
+		name     string
+		cluster  string
+		numNodes int32
+		metric   *schema.MetricConfig
+		want     []schema.MetricScope
+	}{
+		{"default small job", "testcluster", 8, flops,
+			[]schema.MetricScope{schema.MetricScopeNode, schema.MetricScopeCore}},
+		{"default large job", "testcluster", 9, flops,
+			[]schema.MetricScope{schema.MetricScopeNode}},
+		{"default accelerator", "testcluster", 2, gpu,
+			[]schema.MetricScope{schema.MetricScopeNode, schema.MetricScopeCore, schema.MetricScopeAccelerator}},
+		{"default large accelerator job", "testcluster", 64, gpu,
+			[]schema.MetricScope{schema.MetricScopeNode, schema.MetricScopeAccelerator}},
+		{"custom duplicate scopes", "custom", 2, flops,
+			[]schema.MetricScope{schema.MetricScopeNode, schema.MetricScopeSocket, schema.MetricScopeCore}},
+		{"custom native scope", "custom", 1, flops,
+			[]schema.MetricScope{schema.MetricScopeNode, schema.MetricScopeSocket, schema.MetricScopeCore, schema.MetricScopeHWThread}},
+		{"custom metric list", "custom", 2, memBw,
+			[]schema.MetricScope{schema.MetricScopeNode, schema.MetricScopeSocket}},
+		{"custom no match", "custom", 4, memBw,
+			[]schema.MetricScope{schema.MetricScopeNode}},
+		{"custom other metric", "custom", 1, gpu,
+			[]schema.MetricScope{schema.MetricScopeNode}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := &schema.Job{BaseJob: schema.BaseJob{Cluster: tt.cluster, NumNodes: tt.numNodes}}
+			if got := archiveScopes(job, tt.metric); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("archiveScopes() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Makes the cluster the only one of the archive, with its metric data loaded
+// by TestLoadDataCallback.
+func setupTestCluster(t *testing.T, cluster *schema.Cluster) {
+	clusters, callback := archive.Clusters, TestLoadDataCallback
+	archive.Clusters = []*schema.Cluster{cluster}
+	metricDataRepos[cluster.Name] = &TestMetricDataRepository{}
+
+	t.Cleanup(func() {
+		archive.Clusters = clusters
+		delete(metricDataRepos, cluster.Name)
+		TestLoadDataCallback = callback
+	})
+}
+
+func TestArchiveJobAggregation(t *testing.T) {
+	setupTestCluster(t, &schema.Cluster{
+		Name: "aggregation",
+		MetricConfig: []*schema.MetricConfig{
+			{Name: "net_bw", Unit: schema.Unit{Base: "B/s"}, Scope: schema.MetricScopeSocket, Aggregation: "sum"},
+			{Name: "cpu_load", Scope: schema.MetricScopeSocket, Aggregation: "avg"},
+		},
+	})
+
+	// Both metrics are only available per socket, net_bw without data points
+	TestLoadDataCallback = func(job *schema.Job, metrics []string, scopes []schema.MetricScope, ctx context.Context) (schema.JobData, error) {
+		id0, id1 := "0", "1"
+		return schema.JobData{
+			"net_bw": {schema.MetricScopeSocket: {Series: []schema.Series{
+				{Hostname: "host1", Id: &id0, Statistics: schema.MetricStatistics{Avg: 10, Min: 5, Max: 20}},
+				{Hostname: "host1", Id: &id1, Statistics: schema.MetricStatistics{Avg: 30, Min: 1, Max: 40}},
+			}}},
+			"cpu_load": {schema.MetricScopeSocket: {Series: []schema.Series{
+				{Hostname: "host1", Id: &id0, Data: []schema.Float{1, 3}},
+				{Hostname: "host1", Id: &id1, Data: []schema.Float{3, 5}},
+			}}},
+		}, nil
+	}
+
+	job := &schema.Job{ID: 1, BaseJob: schema.BaseJob{
+		JobID:     1,
+		Cluster:   "aggregation",
+		NumNodes:  1,
+		State:     schema.JobStateRunning,
+		Resources: []*schema.Resource{{Hostname: "host1"}},
+	}, StartTime: time.Unix(1675957496, 0)}
+
+	jobMeta, err := ArchiveJob(job, context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s := jobMeta.Statistics["net_bw"]; s.Avg != 40 || s.Min != 1 || s.Max != 40 {
+		t.Errorf("wrong net_bw statistics\ngot: %+v \nwant: {Avg:40 Min:1 Max:40}", s)
+	}
+	if s := jobMeta.Statistics["cpu_load"]; s.Avg != 3 || s.Min != 2 || s.Max != 4 {
+		t.Errorf("wrong cpu_load statistics\ngot: %+v \nwant: {Avg:3 Min:2 Max:4}", s)
+	}
+}
+
+func TestArchiveJobScopeFallback(t *testing.T) {
+	setupTestCluster(t, &schema.Cluster{
+		Name:         "fallback",
+		MetricConfig: []*schema.MetricConfig{{Name: "cpu_load", Scope: schema.MetricScopeCore, Aggregation: "avg"}},
+	})
+
+	// Core scope is archived by default for small jobs but not available
+	TestLoadDataCallback = func(job *schema.Job, metrics []string, scopes []schema.MetricScope, ctx context.Context) (schema.JobData, error) {
+		for _, scope := range scopes {
+			if scope != schema.MetricScopeNode {
+				return nil, errors.New("scope not available")
+			}
+		}
+		return schema.JobData{"cpu_load": {schema.MetricScopeNode: {Series: []schema.Series{
+			{Hostname: "host1", Statistics: schema.MetricStatistics{Avg: 2, Min: 1, Max: 3}},
+		}}}}, nil
+	}
+
+	job := &schema.Job{ID: 2, BaseJob: schema.BaseJob{
+		JobID:     2,
+		Cluster:   "fallback",
+		NumNodes:  1,
+		State:     schema.JobStateRunning,
+		Resources: []*schema.Resource{{Hostname: "host1"}},
+	}, StartTime: time.Unix(1675957496, 0)}
+
+	jobMeta, err := ArchiveJob(job, context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(jobMeta.ArchivedScopes["cpu_load"], []schema.MetricScope{schema.MetricScopeNode}) {
+		t.Errorf("wrong archived scopes\ngot: %v \nwant: [node]", jobMeta.ArchivedScopes["cpu_load"])
+	}
+
+	// Without node scope the job can not be archived
+	TestLoadDataCallback = func(job *schema.Job, metrics []string, scopes []schema.MetricScope, ctx context.Context) (schema.JobData, error) {
+		return nil, errors.New("metric store not available")
+	}
+	job.ID, job.JobID = 3, 3
+	if _, err := ArchiveJob(job, context.Background()); err == nil {
+		t.Error("expected error without node scope data")
+	}
+}
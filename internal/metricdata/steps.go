@@ -0,0 +1,82 @@
+// Copyright (C) 2022 NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+package metricdata
+
+import (
+	"math"
+
+	"github.com/ClusterCockpit/cc-backend/pkg/schema"
+)
+
+// StepStatistics returns the statistics of the metrics in the job data
+// restricted to the time range from `from` to `to` (Unix timestamps, `to` is 0
+// for steps still running) and to the hosts of a job step, all hosts if empty.
+// Like the job statistics, the averages of the series are averaged and the
+// extrema of the series are the extrema of the step. Node scope data is
+// preferred, otherwise the coarsest scope available is used.
+func StepStatistics(job *schema.Job, jd schema.JobData, from, to int64, hosts []string) map[string]schema.JobStatistics {
+	selected := make(map[string]bool, len(hosts))
+	for _, host := range hosts {
+		selected[host] = true
+	}
+
+	res := make(map[string]schema.JobStatistics, len(jd))
+	for metric, data := range jd {
+		jm, ok := data[schema.MetricScopeNode]
+		if !ok {
+			jm = coarsestScope(data)
+		}
+		if jm == nil || jm.Timestep <= 0 {
+			continue
+		}
+
+		// Sample i was taken at job.StartTimeUnix + i * timestep
+		first := int((from - job.StartTimeUnix + int64(jm.Timestep) - 1) / int64(jm.Timestep))
+		if first < 0 {
+			first = 0
+		}
+		last := math.MaxInt
+		if to != 0 {
+			last = int((to - job.StartTimeUnix) / int64(jm.Timestep))
+		}
+
+		sum, n := 0.0, 0
+		min, max := math.MaxFloat64, -math.MaxFloat64
+		for _, series := range jm.Series {
+			if len(selected) != 0 && !selected[series.Hostname] {
+				continue
+			}
+
+			ssum, sn := 0.0, 0
+			for i := first; i < len(series.Data) && i <= last; i++ {
+				x := series.Data[i]
+				if x.IsNaN() {
+					continue
+				}
+
+				ssum += float64(x)
+				sn++
+				min = math.Min(min, float64(x))
+				max = math.Max(max, float64(x))
+			}
+			if sn != 0 {
+				sum += ssum / float64(sn)
+				n++
+			}
+		}
+		if n == 0 {
+			continue
+		}
+
+		res[metric] = schema.JobStatistics{
+			Unit: jm.Unit,
+			Avg:  sum / float64(n),
+			Min:  min,
+			Max:  max,
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,210 @@
+// Copyright (C) 2022 NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ClusterCockpit/cc-backend/internal/graph/model"
+	"github.com/ClusterCockpit/cc-backend/pkg/log"
+	"github.com/ClusterCockpit/cc-backend/pkg/schema"
+	sq "github.com/Masterminds/squirrel"
+)
+
+var ErrAnnotationForbidden = errors.New("REPOSITORY/ANNOTATION > not allowed to delete this annotation")
+
+// Returns the condition for the annotations visible to the user. Which jobs
+// the user may see is restricted by SecurityCheck.
+func annotationVisibility(user *schema.User) sq.Sqlizer {
+	own := sq.Eq{"job_annotation.author": user.Username}
+	if user.HasAnyRole([]schema.Role{schema.RoleAdmin, schema.RoleSupport}) {
+		return sq.Or{own, sq.NotEq{"job_annotation.visibility": model.AnnotationVisibilityPrivate}}
+	}
+
+	return sq.Or{
+		own,
+		sq.Eq{"job_annotation.visibility": model.AnnotationVisibilityProject},
+		sq.And{
+			sq.Eq{"job_annotation.visibility": model.AnnotationVisibilitySupport},
+			sq.Eq{"job.user": user.Username},
+		},
+	}
+}
+
+func scanAnnotation(row interface{ Scan(...interface{}) error }) (*model.Annotation, error) {
+	var ts int64
+	var from, to sql.NullInt64
+	a := &model.Annotation{}
+	if err := row.Scan(&a.ID, &a.JobID, &ts, &a.Author, &a.Visibility, &a.Body, &a.Metric, &from, &to); err != nil {
+		return nil, err
+	}
+
+	a.Time = time.Unix(ts, 0)
+	if from.Valid {
+		t := time.Unix(from.Int64, 0)
+		a.From = &t
+	}
+	if to.Valid {
+		t := time.Unix(to.Int64, 0)
+		a.To = &t
+	}
+
+	return a, nil
+}
+
+// Checks that the job with the database id `jobId` exists and is visible to the user in the context.
+func (r *JobRepository) checkJobAccess(ctx context.Context, jobId int64) error {
+	query, err := SecurityCheck(ctx, r.builder.Select("count(*)").From("job").Where("job.id = ?", jobId))
+	if err != nil {
+		return err
+	}
+
+	var count int
+	if err := query.RunWith(r.stmtCache).QueryRow().Scan(&count); err != nil {
+		log.Warn("Error while checking job access")
+		return err
+	}
+	if count == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// GetAnnotations returns the annotations of the job with the database id `jobId`
+// visible to the user in the context, oldest first.
+func (r *JobRepository) GetAnnotations(ctx context.Context, jobId int64) ([]*model.Annotation, error) {
+	user := GetUserFromContext(ctx)
+	if user == nil {
+		return nil, fmt.Errorf("user context is nil")
+	}
+
+	query, err := SecurityCheck(ctx, r.builder.Select("job_annotation.id", "job_annotation.job_id", "job_annotation.time",
+		"job_annotation.author", "job_annotation.visibility", "job_annotation.body", "job_annotation.metric",
+		"job_annotation.anchor_start", "job_annotation.anchor_stop").
+		From("job_annotation").
+		Join("job ON job.id = job_annotation.job_id").
+		Where("job_annotation.job_id = ?", jobId).
+		Where(annotationVisibility(user)).
+		OrderBy("job_annotation.time ASC", "job_annotation.id ASC"))
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := query.RunWith(r.stmtCache).Query()
+	if err != nil {
+		log.Error("Error while running query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	annotations := make([]*model.Annotation, 0)
+	for rows.Next() {
+		a, err := scanAnnotation(rows)
+		if err != nil {
+			log.Warn("Error while scanning rows")
+			return nil, err
+		}
+		annotations = append(annotations, a)
+	}
+
+	return annotations, rows.Err()
+}
+
+// AddAnnotation adds an annotation by the user in the context to the job with
+// the database id `jobId`, which has to be visible to the user.
+func (r *JobRepository) AddAnnotation(ctx context.Context, jobId int64, input *model.AnnotationInput) (*model.Annotation, error) {
+	user := GetUserFromContext(ctx)
+	if user == nil {
+		return nil, fmt.Errorf("user context is nil")
+	}
+
+	if strings.TrimSpace(input.Body) == "" {
+		return nil, errors.New("REPOSITORY/ANNOTATION > body must not be empty")
+	}
+	visibility := model.AnnotationVisibilityProject
+	if input.Visibility != nil {
+		if !input.Visibility.IsValid() {
+			return nil, fmt.Errorf("REPOSITORY/ANNOTATION > invalid visibility '%s'", *input.Visibility)
+		}
+		visibility = *input.Visibility
+	}
+	if input.From != nil && input.To != nil && input.To.Before(*input.From) {
+		return nil, errors.New("REPOSITORY/ANNOTATION > time range ends before it starts")
+	}
+
+	if err := r.checkJobAccess(ctx, jobId); err != nil {
+		return nil, err
+	}
+
+	a := &model.Annotation{
+		JobID:      jobId,
+		Time:       time.Unix(time.Now().Unix(), 0),
+		Author:     user.Username,
+		Visibility: visibility,
+		Body:       input.Body,
+		Metric:     input.Metric,
+		From:       input.From,
+		To:         input.To,
+	}
+
+	var from, to *int64
+	if a.From != nil {
+		ts := a.From.Unix()
+		from = &ts
+	}
+	if a.To != nil {
+		ts := a.To.Unix()
+		to = &ts
+	}
+
+	id, err := insertReturningId(r.DB, r.driver, `INSERT INTO job_annotation
+		(job_id, time, author, visibility, body, metric, anchor_start, anchor_stop) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		jobId, a.Time.Unix(), a.Author, a.Visibility, a.Body, a.Metric, from, to)
+	if err != nil {
+		log.Errorf("Error while inserting annotation for job %d: %v", jobId, err)
+		return nil, err
+	}
+
+	a.ID = id
+	return a, nil
+}
+
+// GetAnnotation returns the annotation with the database id `id` without any permission checks.
+func (r *JobRepository) GetAnnotation(id int64) (*model.Annotation, error) {
+	return scanAnnotation(r.builder.Select("id", "job_id", "time", "author", "visibility", "body", "metric", "anchor_start", "anchor_stop").
+		From("job_annotation").Where("job_annotation.id = ?", id).
+		RunWith(r.stmtCache).QueryRow())
+}
+
+// DeleteAnnotation deletes the annotation with the database id `id`. Only
+// the author and admins may delete annotations.
+func (r *JobRepository) DeleteAnnotation(ctx context.Context, id int64) (*model.Annotation, error) {
+	user := GetUserFromContext(ctx)
+	if user == nil {
+		return nil, fmt.Errorf("user context is nil")
+	}
+
+	a, err := r.GetAnnotation(id)
+	if err != nil {
+		log.Warn("Error while fetching annotation")
+		return nil, err
+	}
+	if a.Author != user.Username && !user.HasRole(schema.RoleAdmin) {
+		return nil, ErrAnnotationForbidden
+	}
+
+	if _, err := r.builder.Delete("job_annotation").Where("job_annotation.id = ?", id).RunWith(r.stmtCache).Exec(); err != nil {
+		log.Errorf("Error while deleting annotation %d: %v", id, err)
+		return nil, err
+	}
+
+	return a, nil
+}
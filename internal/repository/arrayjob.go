@@ -0,0 +1,131 @@
+// Copyright (C) 2022 NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ClusterCockpit/cc-backend/internal/graph/model"
+	"github.com/ClusterCockpit/cc-backend/pkg/log"
+	"github.com/ClusterCockpit/cc-backend/pkg/schema"
+)
+
+// States of array job members counted as failed tasks.
+var FailedJobStates = []schema.JobState{schema.JobStateFailed, schema.JobStateTimeout, schema.JobStateOutOfMemory}
+
+// FindArrayJob returns the summary of the members of the array job
+// `arrayJobId` on `cluster` visible to the user in the context, sql.ErrNoRows
+// if there are none.
+func (r *JobRepository) FindArrayJob(ctx context.Context, arrayJobId int64, cluster string) (*model.ArrayJob, error) {
+	if arrayJobId == 0 {
+		return nil, errors.New("REPOSITORY/ARRAYJOB > 0 is not an array job id")
+	}
+
+	query, err := SecurityCheck(ctx, r.builder.Select("job.job_state", "count(*)", "min(job.start_time)").From("job").
+		Where("job.array_job_id = ?", arrayJobId).
+		Where("job.cluster = ?", cluster).
+		GroupBy("job.job_state").
+		OrderBy("job.job_state"))
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := query.RunWith(r.stmtCache).Query()
+	if err != nil {
+		log.Error("Error while running query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	a := &model.ArrayJob{ArrayJobID: arrayJobId, Cluster: cluster, States: make([]*model.Count, 0)}
+	var first int64
+	for rows.Next() {
+		var state string
+		var count int
+		var start int64
+		if err := rows.Scan(&state, &count, &start); err != nil {
+			log.Warn("Error while scanning rows")
+			return nil, err
+		}
+
+		a.States = append(a.States, &model.Count{Name: state, Count: count})
+		if a.NumTasks == 0 || start < first {
+			first = start
+		}
+		a.NumTasks += count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if a.NumTasks == 0 {
+		return nil, sql.ErrNoRows
+	}
+	a.StartTime = time.Unix(first, 0)
+
+	if a.Footprint, err = r.footprintDistribution(ctx, a.Filter(), cluster); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// Returns the count, minimum, average and maximum of the footprint values of
+// the cluster over the jobs matching the filters. Footprint values missing
+// in all jobs are left out.
+func (r *JobRepository) footprintDistribution(ctx context.Context, filters []*model.JobFilter, cluster string) ([]*model.FootprintDistribution, error) {
+	metrics := FootprintMetrics(cluster)
+	columns := make([]string, 0, 4*len(metrics))
+	for _, fm := range metrics {
+		column, err := footprintColumn(FootprintKey(fm.Metric, fm.Stat))
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, fmt.Sprintf("count(%s)", column), fmt.Sprintf("min(%s)", column),
+			fmt.Sprintf("avg(%s)", column), fmt.Sprintf("max(%s)", column))
+	}
+	if len(columns) == 0 {
+		return []*model.FootprintDistribution{}, nil
+	}
+
+	query, err := SecurityCheck(ctx, r.builder.Select(columns...).From("job"))
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range filters {
+		query = BuildWhereClause(ctx, f, query)
+	}
+
+	counts := make([]int, len(metrics))
+	values := make([]sql.NullFloat64, 3*len(metrics))
+	dest := make([]interface{}, 0, len(columns))
+	for i := range metrics {
+		dest = append(dest, &counts[i], &values[3*i], &values[3*i+1], &values[3*i+2])
+	}
+	if err := query.RunWith(r.stmtCache).QueryRow().Scan(dest...); err != nil {
+		log.Warn("Error while scanning footprint distribution")
+		return nil, err
+	}
+
+	distribution := make([]*model.FootprintDistribution, 0, len(metrics))
+	for i, fm := range metrics {
+		if counts[i] == 0 {
+			continue
+		}
+		distribution = append(distribution, &model.FootprintDistribution{
+			Metric: fm.Metric,
+			Stat:   fm.Stat,
+			Count:  counts[i],
+			Min:    values[3*i].Float64,
+			Avg:    values[3*i+1].Float64,
+			Max:    values[3*i+2].Float64,
+		})
+	}
+
+	return distribution, nil
+}
@@ -0,0 +1,281 @@
+// Copyright (C) 2022 NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ClusterCockpit/cc-backend/internal/graph/model"
+	"github.com/ClusterCockpit/cc-backend/pkg/log"
+	"github.com/ClusterCockpit/cc-backend/pkg/schema"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	auditRepoOnce     sync.Once
+	auditRepoInstance *AuditRepository
+)
+
+// Actions recorded in the audit log.
+const (
+	AuditJobStart          = "job.start"
+	AuditJobStop           = "job.stop"
+	AuditJobUpdate         = "job.update"
+	AuditJobDelete         = "job.delete"
+	AuditJobDeleteBefore   = "job.delete_before"
+	AuditJobRestore        = "job.restore"
+	AuditJobRestoreBefore  = "job.restore_before"
+	AuditJobPurge          = "job.purge"
+	AuditTagAdd            = "tag.add"
+	AuditTagRemove         = "tag.remove"
+	AuditTagCreate         = "tag.create"
+	AuditTagDelete         = "tag.delete"
+	AuditAnnotationAdd     = "annotation.add"
+	AuditAnnotationDelete  = "annotation.delete"
+	AuditViewSave          = "view.save"
+	AuditViewDelete        = "view.delete"
+	AuditReservationSave   = "reservation.save"
+	AuditReservationDelete = "reservation.delete"
+	AuditProjectSave       = "project.save"
+	AuditProjectDelete     = "project.delete"
+	AuditGrantSave         = "grant.save"
+	AuditGrantDelete       = "grant.delete"
+	AuditUserCreate        = "user.create"
+	AuditUserDelete        = "user.delete"
+	AuditUserAddRole       = "user.add_role"
+	AuditUserRemoveRole    = "user.remove_role"
+	AuditUserAddProject    = "user.add_project"
+	AuditUserRemoveProject = "user.remove_project"
+	AuditJWTGenerate       = "jwt.generate"
+	AuditConfigUpdate      = "config.update"
+)
+
+// Actor recorded for operations without a user, like retention services.
+const AuditSystemActor = "system"
+
+type AuditEntry struct {
+	ID         int64   `json:"id" db:"id"`
+	Time       int64   `json:"time" db:"time"`
+	Actor      string  `json:"actor" db:"actor"`
+	AuthSource string  `json:"authSource" db:"auth_source"`
+	Action     string  `json:"action" db:"action"`
+	Target     string  `json:"target" db:"target"`
+	Before     *string `json:"before,omitempty" db:"old_value"` // JSON
+	After      *string `json:"after,omitempty" db:"new_value"`  // JSON
+}
+
+// Job attributes recorded in the audit log.
+type AuditJob struct {
+	JobID     int64           `json:"jobId"`
+	Cluster   string          `json:"cluster"`
+	User      string          `json:"user"`
+	Project   string          `json:"project"`
+	StartTime int64           `json:"startTime"`
+	State     schema.JobState `json:"jobState"`
+	Duration  int32           `json:"duration"`
+}
+
+func NewAuditJob(job *schema.BaseJob, startTime int64) *AuditJob {
+	return &AuditJob{
+		JobID:     job.JobID,
+		Cluster:   job.Cluster,
+		User:      job.User,
+		Project:   job.Project,
+		StartTime: startTime,
+		State:     job.State,
+		Duration:  job.Duration,
+	}
+}
+
+// User attributes recorded in the audit log, the password is left out.
+type AuditUser struct {
+	Username string   `json:"username"`
+	Name     string   `json:"name"`
+	Email    string   `json:"email"`
+	Roles    []string `json:"roles"`
+	Projects []string `json:"projects"`
+}
+
+func NewAuditUser(user *schema.User) *AuditUser {
+	return &AuditUser{
+		Username: user.Username,
+		Name:     user.Name,
+		Email:    user.Email,
+		Roles:    user.Roles,
+		Projects: user.Projects,
+	}
+}
+
+func AuditJobTarget(id int64) string {
+	return fmt.Sprintf("job/%d", id)
+}
+
+func AuditTagTarget(id int64) string {
+	return fmt.Sprintf("tag/%d", id)
+}
+
+func AuditViewTarget(id int64) string {
+	return fmt.Sprintf("view/%d", id)
+}
+
+func AuditReservationTarget(id int64) string {
+	return fmt.Sprintf("reservation/%d", id)
+}
+
+func AuditProjectTarget(name string) string {
+	return "project/" + name
+}
+
+func AuditUserTarget(username string) string {
+	return "user/" + username
+}
+
+// The target of configuration updates, the global defaults if there is no user.
+func AuditConfigTarget(user *schema.User) string {
+	if user == nil {
+		return "config/global"
+	}
+
+	return "config/" + user.Username
+}
+
+type AuditFilter struct {
+	Actor  *string
+	Action *string
+	Target *string
+	From   *int64
+	To     *int64
+}
+
+type AuditRepository struct {
+	DB      *sqlx.DB
+	driver  string
+	builder sq.StatementBuilderType
+}
+
+func GetAuditRepository() *AuditRepository {
+	auditRepoOnce.Do(func() {
+		db := GetConnection()
+
+		auditRepoInstance = &AuditRepository{
+			DB:      db.DB,
+			driver:  db.Driver,
+			builder: db.Builder,
+		}
+	})
+	return auditRepoInstance
+}
+
+var authSourceNames = map[schema.AuthSource]string{
+	schema.AuthViaLocalPassword: "local",
+	schema.AuthViaLDAP:          "ldap",
+	schema.AuthViaToken:         "token",
+}
+
+var authTypeNames = map[schema.AuthType]string{
+	schema.AuthToken:   "token",
+	schema.AuthSession: "session",
+}
+
+func auditValue(v interface{}) (*string, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	s := string(raw)
+	return &s, nil
+}
+
+// Record adds an entry to the audit log. The actor is the user in the context
+// or the system if there is none. Before and after are stored as JSON and may
+// be nil. Failures are only logged, the audited operation already happened.
+func (r *AuditRepository) Record(ctx context.Context, action string, target string, before, after interface{}) {
+	actor, authSource := AuditSystemActor, ""
+	if user := GetUserFromContext(ctx); user != nil {
+		actor = user.Username
+		authSource = fmt.Sprintf("%s/%s", authSourceNames[user.AuthSource], authTypeNames[user.AuthType])
+	}
+
+	oldValue, err := auditValue(before)
+	if err != nil {
+		log.Errorf("Error while encoding audit value for '%s' on '%s': %v", action, target, err)
+		return
+	}
+	newValue, err := auditValue(after)
+	if err != nil {
+		log.Errorf("Error while encoding audit value for '%s' on '%s': %v", action, target, err)
+		return
+	}
+
+	if _, err := r.builder.Insert("audit_log").
+		Columns("time", "actor", "auth_source", "action", "target", "old_value", "new_value").
+		Values(time.Now().Unix(), actor, authSource, action, target, oldValue, newValue).
+		RunWith(r.DB).Exec(); err != nil {
+		log.Errorf("Error while recording audit entry '%s' on '%s' by '%s': %v", action, target, actor, err)
+	}
+}
+
+// Query returns the audit entries matching the filter, newest first.
+func (r *AuditRepository) Query(filter *AuditFilter, page *model.PageRequest) ([]*AuditEntry, error) {
+	query := r.builder.Select("id", "time", "actor", "auth_source", "action", "target", "old_value", "new_value").
+		From("audit_log").OrderBy("time DESC", "id DESC")
+
+	if filter != nil {
+		if filter.Actor != nil {
+			query = query.Where("actor = ?", *filter.Actor)
+		}
+		if filter.Action != nil {
+			query = query.Where("action = ?", *filter.Action)
+		}
+		if filter.Target != nil {
+			query = query.Where("target = ?", *filter.Target)
+		}
+		if filter.From != nil {
+			query = query.Where("time >= ?", *filter.From)
+		}
+		if filter.To != nil {
+			query = query.Where("time <= ?", *filter.To)
+		}
+	}
+
+	if page != nil && page.ItemsPerPage != -1 {
+		limit := uint64(page.ItemsPerPage)
+		query = query.Offset((uint64(page.Page) - 1) * limit).Limit(limit)
+	}
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		log.Warn("Error while converting query to sql")
+		return nil, err
+	}
+
+	entries := make([]*AuditEntry, 0)
+	if err := r.DB.Select(&entries, sql, args...); err != nil {
+		log.Warn("Error while querying audit log")
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// DeleteBefore removes all audit entries older than the timestamp.
+func (r *AuditRepository) DeleteBefore(ts int64) (int64, error) {
+	res, err := r.builder.Delete("audit_log").Where("time < ?", ts).RunWith(r.DB).Exec()
+	if err != nil {
+		log.Errorf("Error while deleting audit entries before %d: %v", ts, err)
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
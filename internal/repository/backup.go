@@ -0,0 +1,404 @@
+// Copyright (C) 2022 NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+package repository
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ClusterCockpit/cc-backend/pkg/log"
+	"github.com/jmoiron/sqlx"
+)
+
+// Number of rows inserted with a single statement when restoring a dump.
+const restoreBatchSize = 500
+
+// First entry of a dump file.
+type dumpHeader struct {
+	Driver  string `json:"driver"`
+	Version uint   `json:"version"`
+	Time    int64  `json:"time"`
+}
+
+// Precedes the rows of a table in a dump file. The rows follow as JSON arrays
+// with one value per column.
+type dumpTable struct {
+	Table   string   `json:"table"`
+	Columns []string `json:"columns"`
+	Rows    int      `json:"rows"`
+}
+
+// Returns the file extension of the snapshots of the database driver.
+func backupExtension(driver string) string {
+	if driver == "sqlite3" {
+		return ".db"
+	}
+	return ".dump.gz"
+}
+
+// Backup writes a consistent snapshot of the connected database to `file`
+// while it is in use. For SQLite the snapshot is a database file, for MySQL a
+// gzipped dump read within a single transaction. The file must not exist.
+func Backup(file string) error {
+	db := GetConnection()
+
+	if _, err := os.Stat(file); err == nil {
+		return fmt.Errorf("REPOSITORY/BACKUP > backup file %s already exists", file)
+	}
+
+	switch db.Driver {
+	case "sqlite3":
+		if _, err := db.DB.Exec(`VACUUM INTO ?`, file); err != nil {
+			log.Errorf("Error while writing backup to %s: %v", file, err)
+			return err
+		}
+		return nil
+	case "mysql":
+		return dumpMySQL(db.DB, file)
+	default:
+		return fmt.Errorf("REPOSITORY/BACKUP > online backups are not supported for %s, use the tools of the database", db.Driver)
+	}
+}
+
+// RotateBackups writes a snapshot of the database to the directory and
+// removes the oldest snapshots so that at most `keep` remain. If `keep` is 0,
+// all snapshots are kept. Returns the file of the new snapshot.
+func RotateBackups(dir string, keep int) (string, error) {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		log.Errorf("Error while creating backup directory %s: %v", dir, err)
+		return "", err
+	}
+
+	ext := backupExtension(GetConnection().Driver)
+	file := filepath.Join(dir, "job-"+time.Now().Format("20060102-150405")+ext)
+	if err := Backup(file); err != nil {
+		return "", err
+	}
+
+	if keep <= 0 {
+		return file, nil
+	}
+
+	snapshots, err := filepath.Glob(filepath.Join(dir, "job-*"+ext))
+	if err != nil {
+		return file, err
+	}
+	// The timestamps in the names sort chronologically
+	sort.Strings(snapshots)
+	for len(snapshots) > keep {
+		if err := os.Remove(snapshots[0]); err != nil {
+			log.Warnf("Error while removing backup %s: %v", snapshots[0], err)
+		}
+		snapshots = snapshots[1:]
+	}
+
+	return file, nil
+}
+
+// Writes all tables except the migration state to a gzipped dump. The tables
+// are read within a single read-only transaction, so that the dump is
+// consistent while jobs are added or modified.
+func dumpMySQL(db *sqlx.DB, file string) (err error) {
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Errorf("Error while creating backup file %s: %v", file, err)
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(file)
+		}
+	}()
+
+	tx, err := db.BeginTxx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var tables []string
+	if err := tx.Select(&tables, `SHOW TABLES`); err != nil {
+		log.Error("Error while listing tables")
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	gz := gzip.NewWriter(w)
+	enc := json.NewEncoder(gz)
+	if err := enc.Encode(dumpHeader{Driver: "mysql", Version: Version, Time: time.Now().Unix()}); err != nil {
+		return err
+	}
+
+	for _, table := range tables {
+		if table == "schema_migrations" {
+			continue
+		}
+		if err := dumpTableRows(tx, enc, table); err != nil {
+			log.Errorf("Error while dumping table %s: %v", table, err)
+			return err
+		}
+	}
+
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func dumpTableRows(tx *sqlx.Tx, enc *json.Encoder, table string) error {
+	var count int
+	if err := tx.Get(&count, "SELECT COUNT(*) FROM `"+table+"`"); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query("SELECT * FROM `" + table + "`")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	if err := enc.Encode(dumpTable{Table: table, Columns: columns, Rows: count}); err != nil {
+		return err
+	}
+
+	values := make([]interface{}, len(columns))
+	ptrs := make([]interface{}, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+
+	n := 0
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return err
+		}
+		for i, v := range values {
+			if b, ok := v.([]byte); ok {
+				values[i] = string(b)
+			}
+		}
+		if err := enc.Encode(values); err != nil {
+			return err
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if n != count {
+		return fmt.Errorf("REPOSITORY/BACKUP > table %s changed during the backup", table)
+	}
+
+	return nil
+}
+
+// Restore replaces the content of the database with a snapshot written by
+// Backup. The server must not be running. The schema version of the snapshot
+// is checked against the version supported by this binary: Newer snapshots are
+// rejected, older SQLite snapshots have to be migrated with -migrate-db
+// afterwards.
+func Restore(driver string, db string, file string) error {
+	switch driver {
+	case "sqlite3":
+		return restoreSQLite(db, file)
+	case "mysql":
+		return restoreMySQL(driver, db, file)
+	default:
+		return fmt.Errorf("REPOSITORY/BACKUP > restoring backups is not supported for %s, use the tools of the database", driver)
+	}
+}
+
+func restoreSQLite(db string, file string) error {
+	if _, err := os.Stat(file); err != nil {
+		return err
+	}
+
+	snapshot, err := sqlx.Open("sqlite3", "file:"+file+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	var version uint
+	var dirty bool
+	err = snapshot.QueryRow(`SELECT version, dirty FROM schema_migrations`).Scan(&version, &dirty)
+	snapshot.Close()
+	if err != nil {
+		log.Errorf("Error while reading schema version of backup %s: %v", file, err)
+		return fmt.Errorf("REPOSITORY/BACKUP > %s is not a database backup: %w", file, err)
+	}
+	if dirty {
+		return fmt.Errorf("REPOSITORY/BACKUP > backup %s has an incomplete migration to version %d", file, version)
+	}
+	if version > Version {
+		return fmt.Errorf("REPOSITORY/BACKUP > backup %s has schema version %d, this binary supports version %d", file, version, Version)
+	}
+
+	// Copy next to the database first, so that the database is replaced atomically
+	tmp := db + ".restore"
+	if err := copyFile(file, tmp); err != nil {
+		os.Remove(tmp)
+		log.Errorf("Error while copying backup %s: %v", file, err)
+		return err
+	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(db + suffix); err != nil && !os.IsNotExist(err) {
+			os.Remove(tmp)
+			return err
+		}
+	}
+	if err := os.Rename(tmp, db); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	if version < Version {
+		log.Warnf("Restored backup has schema version %d, run -migrate-db to migrate it to version %d", version, Version)
+	}
+	return nil
+}
+
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func restoreMySQL(driver string, db string, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		return fmt.Errorf("REPOSITORY/BACKUP > %s is not a database backup: %w", file, err)
+	}
+	dec := json.NewDecoder(gz)
+	dec.UseNumber()
+
+	var header dumpHeader
+	if err := dec.Decode(&header); err != nil || header.Driver == "" {
+		return fmt.Errorf("REPOSITORY/BACKUP > %s is not a database backup", file)
+	}
+	if header.Driver != driver {
+		return fmt.Errorf("REPOSITORY/BACKUP > backup %s was written for %s", file, header.Driver)
+	}
+	if header.Version != Version {
+		return fmt.Errorf("REPOSITORY/BACKUP > backup %s has schema version %d, this binary supports version %d", file, header.Version, Version)
+	}
+
+	// Fails if the database is not migrated to the current version
+	Connect(driver, db)
+	tx, err := GetConnection().DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SET FOREIGN_KEY_CHECKS = 0`); err != nil {
+		return err
+	}
+
+	for {
+		var table dumpTable
+		if err := dec.Decode(&table); err == io.EOF {
+			break
+		} else if err != nil {
+			log.Errorf("Error while reading backup %s: %v", file, err)
+			return err
+		}
+
+		if err := restoreTableRows(tx, dec, &table); err != nil {
+			log.Errorf("Error while restoring table %s: %v", table.Table, err)
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(`SET FOREIGN_KEY_CHECKS = 1`); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func restoreTableRows(tx *sqlx.Tx, dec *json.Decoder, table *dumpTable) error {
+	if _, err := tx.Exec("DELETE FROM `" + table.Table + "`"); err != nil {
+		return err
+	}
+
+	placeholders := "(?" + strings.Repeat(", ?", len(table.Columns)-1) + ")"
+	prefix := "INSERT INTO `" + table.Table + "` (`" + strings.Join(table.Columns, "`, `") + "`) VALUES "
+
+	args := make([]interface{}, 0, restoreBatchSize*len(table.Columns))
+	batch := 0
+	flush := func() error {
+		if batch == 0 {
+			return nil
+		}
+		stmt := prefix + placeholders + strings.Repeat(", "+placeholders, batch-1)
+		if _, err := tx.Exec(stmt, args...); err != nil {
+			return err
+		}
+		args = args[:0]
+		batch = 0
+		return nil
+	}
+
+	for i := 0; i < table.Rows; i++ {
+		var row []interface{}
+		if err := dec.Decode(&row); err != nil {
+			return err
+		}
+		if len(row) != len(table.Columns) {
+			return fmt.Errorf("REPOSITORY/BACKUP > row of table %s has %d values, expected %d", table.Table, len(row), len(table.Columns))
+		}
+		for _, v := range row {
+			if n, ok := v.(json.Number); ok {
+				v = n.String()
+			}
+			args = append(args, v)
+		}
+		batch++
+		if batch == restoreBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return flush()
+}
@@ -0,0 +1,213 @@
+// Copyright (C) 2022 NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+package repository
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ClusterCockpit/cc-backend/internal/graph/model"
+	"github.com/ClusterCockpit/cc-backend/pkg/log"
+	"github.com/ClusterCockpit/cc-backend/pkg/schema"
+)
+
+// ErrInvalidCursor is returned for cursors that cannot be decoded or were
+// issued for a different sorting.
+var ErrInvalidCursor = errors.New("REPOSITORY/CURSOR > invalid cursor")
+
+// Position after the last job of a page: the value of the sort expression and
+// the database id, which breaks ties between jobs with equal values.
+type jobCursor struct {
+	Field string      `json:"f"`
+	Desc  bool        `json:"d"`
+	Value interface{} `json:"v"`
+	ID    int64       `json:"id"`
+}
+
+// Defaults for the nullable sort expressions. Keyset conditions never match
+// NULL and the databases disagree on where NULL values are sorted.
+var nullableColumns = map[string]string{
+	"job.partition":     "''",
+	"job.meta_data":     "''",
+	"job.array_job_id":  "0",
+	"job.num_hwthreads": "0",
+	"job.num_acc":       "0",
+}
+
+func keysetColumn(field string) string {
+	if strings.Contains(field, "job.footprint") {
+		return fmt.Sprintf("COALESCE(%s, 0)", field)
+	}
+	if def, ok := nullableColumns[field]; ok {
+		return fmt.Sprintf("COALESCE(%s, %s)", field, def)
+	}
+
+	return field
+}
+
+func encodeJobCursor(c *jobCursor) (string, error) {
+	raw, err := json.Marshal(c)
+	if err != nil {
+		log.Warn("Error while encoding cursor")
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func decodeJobCursor(cursor string) (*jobCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	c := &jobCursor{}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	// Keep integers exact, large ids and timestamps do not survive a float64
+	if n, ok := c.Value.(json.Number); ok {
+		if i, err := n.Int64(); err == nil {
+			c.Value = i
+		} else if f, err := n.Float64(); err == nil {
+			c.Value = f
+		} else {
+			return nil, ErrInvalidCursor
+		}
+	}
+
+	return c, nil
+}
+
+// Scans the sort value selected after the job columns.
+type cursorScanner struct {
+	rows  *sql.Rows
+	value *interface{}
+}
+
+func (s cursorScanner) Scan(dest ...interface{}) error {
+	return s.rows.Scan(append(dest, s.value)...)
+}
+
+// QueryJobsCursor returns up to `limit` jobs following the position encoded in
+// `cursor`, or the first ones if the cursor is empty, and the cursor for the
+// next page, which is empty after the last page. Unlike the OFFSET used by
+// QueryJobs, deep pages are as fast as the first one and jobs inserted in the
+// meantime do not shift the pages. Without order jobs are sorted by database id.
+func (r *JobRepository) QueryJobsCursor(
+	ctx context.Context,
+	filters []*model.JobFilter,
+	limit int,
+	order *model.OrderByInput,
+	cursor string) ([]*schema.Job, string, error) {
+
+	query, err := SecurityCheck(ctx, r.builder.Select(jobColumns...).From("job"))
+	if err != nil {
+		return nil, "", err
+	}
+
+	field, desc := "job.id", false
+	if order != nil {
+		query, field, err = sortField(filters, query, order)
+		if err != nil {
+			return nil, "", err
+		}
+
+		switch order.Order {
+		case model.SortDirectionEnumAsc:
+		case model.SortDirectionEnumDesc:
+			desc = true
+		default:
+			return nil, "", errors.New("REPOSITORY/CURSOR > invalid sorting order")
+		}
+		field = keysetColumn(field)
+	}
+
+	direction, cmp := "ASC", ">"
+	if desc {
+		direction, cmp = "DESC", "<"
+	}
+
+	if cursor != "" {
+		c, err := decodeJobCursor(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		if c.Field != field || c.Desc != desc {
+			return nil, "", ErrInvalidCursor
+		}
+
+		if field == "job.id" {
+			query = query.Where(fmt.Sprintf("job.id %s ?", cmp), c.ID)
+		} else {
+			query = query.Where(fmt.Sprintf("(%s %s ? OR (%s = ? AND job.id %s ?))", field, cmp, field, cmp),
+				c.Value, c.Value, c.ID)
+		}
+	}
+
+	query = query.Column(field)
+	if field == "job.id" {
+		query = query.OrderBy("job.id " + direction)
+	} else {
+		query = query.OrderBy(field+" "+direction, "job.id "+direction)
+	}
+
+	if limit > 0 {
+		// One more to know whether there is a next page
+		query = query.Limit(uint64(limit) + 1)
+	}
+
+	for _, f := range filters {
+		query = BuildWhereClause(ctx, f, query)
+	}
+
+	rows, err := query.RunWith(r.stmtCache).Query()
+	if err != nil {
+		log.Errorf("Error while running query: %v", err)
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	jobs := make([]*schema.Job, 0, 50)
+	values := make([]interface{}, 0, 50)
+	for rows.Next() {
+		var value interface{}
+		job, err := scanJob(cursorScanner{rows: rows, value: &value})
+		if err != nil {
+			log.Warn("Error while scanning rows (Jobs)")
+			return nil, "", err
+		}
+		if b, ok := value.([]byte); ok {
+			value = string(b)
+		}
+		jobs = append(jobs, job)
+		values = append(values, value)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if limit <= 0 || len(jobs) <= limit {
+		return jobs, "", nil
+	}
+
+	jobs = jobs[:limit]
+	last := jobs[limit-1]
+	next, err := encodeJobCursor(&jobCursor{Field: field, Desc: desc, Value: values[limit-1], ID: last.ID})
+	if err != nil {
+		return nil, "", err
+	}
+
+	return jobs, next, nil
+}
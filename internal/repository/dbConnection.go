@@ -9,9 +9,11 @@ import (
 	"sync"
 	"time"
 
+	"github.com/ClusterCockpit/cc-backend/internal/config"
 	"github.com/ClusterCockpit/cc-backend/pkg/log"
+	sq "github.com/Masterminds/squirrel"
 	"github.com/jmoiron/sqlx"
-	"github.com/mattn/go-sqlite3"
+	_ "github.com/mattn/go-sqlite3"
 	"github.com/qustavo/sqlhooks/v2"
 )
 
@@ -23,6 +25,9 @@ var (
 type DBConnection struct {
 	DB     *sqlx.DB
 	Driver string
+
+	// Query builder using the placeholders of the driver.
+	Builder sq.StatementBuilderType
 }
 
 type DatabaseOptions struct {
@@ -46,38 +51,33 @@ func Connect(driver string, db string) {
 			ConnectionMaxIdleTime: time.Hour,
 		}
 
+		builder := sq.StatementBuilder
 		switch driver {
 		case "sqlite3":
 			// - Set WAL mode (not strictly necessary each time because it's persisted in the database, but good for first run)
 			// - Set busy timeout, so concurrent writers wait on each other instead of erroring immediately
 			// - Enable foreign key checks
 			opts.URL += "?_journal=WAL&_timeout=5000&_fk=true"
-
-			if log.Loglevel() == "debug" {
-				sql.Register("sqlite3WithHooks", sqlhooks.Wrap(&sqlite3.SQLiteDriver{}, &Hooks{}))
-				dbHandle, err = sqlx.Open("sqlite3WithHooks", opts.URL)
-			} else {
-				dbHandle, err = sqlx.Open("sqlite3", opts.URL)
-			}
-			if err != nil {
-				log.Fatal(err)
-			}
 		case "mysql":
 			opts.URL += "?multiStatements=true"
-			dbHandle, err = sqlx.Open("mysql", opts.URL)
-			if err != nil {
-				log.Fatalf("sqlx.Open() error: %v", err)
-			}
+		case "postgres":
+			// PostgreSQL does not understand '?' placeholders
+			builder = builder.PlaceholderFormat(sq.Dollar)
 		default:
 			log.Fatalf("unsupported database driver: %s", driver)
 		}
 
+		dbHandle, err = open(driver, opts.URL)
+		if err != nil {
+			log.Fatalf("sqlx.Open() error: %v", err)
+		}
+
 		dbHandle.SetMaxOpenConns(opts.MaxOpenConnections)
 		dbHandle.SetMaxIdleConns(opts.MaxIdleConnections)
 		dbHandle.SetConnMaxLifetime(opts.ConnectionMaxLifetime)
 		dbHandle.SetConnMaxIdleTime(opts.ConnectionMaxIdleTime)
 
-		dbConnInstance = &DBConnection{DB: dbHandle, Driver: driver}
+		dbConnInstance = &DBConnection{DB: dbHandle, Driver: driver, Builder: builder}
 		err = checkDBVersion(driver, dbHandle.DB)
 		if err != nil {
 			log.Fatal(err)
@@ -85,6 +85,36 @@ func Connect(driver string, db string) {
 	})
 }
 
+// Opens the database. The driver is wrapped with the SQL hooks if statements
+// are logged at debug level or a slow query threshold is configured.
+func open(driver string, url string) (*sqlx.DB, error) {
+	plain, err := sqlx.Open(driver, url)
+	if err != nil {
+		return nil, err
+	}
+
+	hooks := &Hooks{
+		slowThreshold: time.Duration(config.Keys.DBSlowQueryThreshold) * time.Millisecond,
+		driver:        driver,
+	}
+	if log.Loglevel() != "debug" && hooks.slowThreshold == 0 {
+		return plain, nil
+	}
+
+	if hooks.slowThreshold > 0 && config.Keys.DBExplainSlowQueries {
+		// The plans are captured without hooks, as slow plans would be explained again
+		plain.SetMaxOpenConns(1)
+		hooks.explain = plain
+	} else {
+		plain.Close()
+	}
+
+	name := driver + "WithHooks"
+	sql.Register(name, sqlhooks.Wrap(plain.Driver(), hooks))
+	sqlx.BindDriver(name, sqlx.BindType(driver))
+	return sqlx.Open(name, url)
+}
+
 func GetConnection() *DBConnection {
 	if dbConnInstance == nil {
 		log.Fatalf("Database connection not initialized!")
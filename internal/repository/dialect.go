@@ -0,0 +1,107 @@
+// Copyright (C) 2022 NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+package repository
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Columns set when a job is started, in the order used by the insert statements.
+var jobInsertColumns = []string{
+	"job_id", "user", "project", "cluster", "subcluster", "partition", "array_job_id", "num_nodes", "num_hwthreads", "num_acc",
+	"exclusive", "monitoring_status", "smt", "job_state", "start_time", "duration", "walltime", "resources", "meta_data",
+}
+
+// Quotes an identifier that is a reserved word in some of the supported
+// databases, like 'user' or 'partition'.
+func quoteIdent(driver string, ident string) string {
+	if driver == "mysql" {
+		return "`" + ident + "`"
+	}
+
+	return `"` + ident + `"`
+}
+
+// Returns the named statement inserting a job. Archived jobs also come with
+// footprint and energy. On PostgreSQL the statement returns the id of the new
+// row, as the driver does not support LastInsertId.
+func namedJobInsert(driver string, archived bool) string {
+	cols := make([]string, 0, len(jobInsertColumns)+2)
+	vals := make([]string, 0, len(jobInsertColumns)+2)
+	for _, col := range jobInsertColumns {
+		cols = append(cols, quoteIdent(driver, col))
+		vals = append(vals, ":"+col)
+	}
+
+	if archived {
+		cols = append(cols, "footprint", "energy")
+		if driver == "postgres" {
+			vals = append(vals, ":footprint", ":energy")
+		} else {
+			// The footprint is cast to text as JSON functions do not accept blobs.
+			vals = append(vals, "CAST(:footprint AS CHAR)", ":energy")
+		}
+	}
+
+	query := fmt.Sprintf("INSERT INTO job (%s) VALUES (%s)", strings.Join(cols, ", "), strings.Join(vals, ", "))
+	if driver == "postgres" {
+		query += " RETURNING id"
+	}
+
+	return query
+}
+
+// Executes the named insert statement and returns the id of the new row.
+func namedInsert(ext sqlx.Ext, driver string, query string, arg interface{}) (int64, error) {
+	if driver == "postgres" {
+		var id int64
+		rows, err := sqlx.NamedQuery(ext, query, arg)
+		if err != nil {
+			return 0, err
+		}
+		defer rows.Close()
+
+		if !rows.Next() {
+			if err := rows.Err(); err != nil {
+				return 0, err
+			}
+			return 0, fmt.Errorf("REPOSITORY/DIALECT > insert did not return an id")
+		}
+		if err := rows.Scan(&id); err != nil {
+			return 0, err
+		}
+		return id, nil
+	}
+
+	res, err := sqlx.NamedExec(ext, query, arg)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.LastInsertId()
+}
+
+// Executes the insert statement with '?' placeholders and returns the id of
+// the new row.
+func insertReturningId(ext sqlx.Ext, driver string, query string, args ...interface{}) (int64, error) {
+	query = ext.Rebind(query)
+	if driver == "postgres" {
+		var id int64
+		if err := ext.QueryRowx(query+" RETURNING id", args...).Scan(&id); err != nil {
+			return 0, err
+		}
+		return id, nil
+	}
+
+	res, err := ext.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.LastInsertId()
+}
@@ -0,0 +1,141 @@
+// Copyright (C) 2022 NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+package repository
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ClusterCockpit/cc-backend/internal/config"
+	"github.com/ClusterCockpit/cc-backend/pkg/log"
+	"github.com/ClusterCockpit/cc-backend/pkg/schema"
+)
+
+// Footprint used for clusters without 'footprint' configuration.
+var defaultFootprint = []*schema.FootprintMetric{
+	{Metric: "cpu_load", Stat: "avg"},
+	{Metric: "flops_any", Stat: "avg"},
+	{Metric: "mem_bw", Stat: "avg"},
+	{Metric: "mem_used", Stat: "max"},
+	{Metric: "net_bw", Stat: "avg"},
+	{Metric: "file_bw", Stat: "avg"},
+}
+
+// Footprint keys the fixed job table columns were replaced with.
+var legacyFootprintKeys = map[string]string{
+	"load_avg":      "cpu_load_avg",
+	"flops_any_avg": "flops_any_avg",
+	"mem_bw_avg":    "mem_bw_avg",
+	"mem_used_max":  "mem_used_max",
+	"net_bw_avg":    "net_bw_avg",
+	"file_bw_avg":   "file_bw_avg",
+}
+
+var footprintKeyRegex = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+
+// Returns the footprint definition of the cluster.
+func FootprintMetrics(cluster string) []*schema.FootprintMetric {
+	for _, c := range config.Keys.Clusters {
+		if c.Name == cluster && c.Footprint != nil {
+			return c.Footprint
+		}
+	}
+
+	return defaultFootprint
+}
+
+// Returns the key under which the statistic of the metric is stored in the
+// job footprint.
+func FootprintKey(metric, stat string) string {
+	return fmt.Sprintf("%s_%s", metric, stat)
+}
+
+// Returns the footprint key of the metric on the cluster. Metrics not in the
+// footprint of the cluster fall back to the default footprint or the average.
+func footprintKeyOfMetric(cluster, metric string) string {
+	for _, fm := range FootprintMetrics(cluster) {
+		if fm.Metric == metric {
+			return FootprintKey(fm.Metric, fm.Stat)
+		}
+	}
+
+	for _, fm := range defaultFootprint {
+		if fm.Metric == metric {
+			return FootprintKey(fm.Metric, fm.Stat)
+		}
+	}
+
+	return FootprintKey(metric, "avg")
+}
+
+// Returns the SQL expression selecting the footprint value of the metric used
+// for histograms. As clusters may store different statistics of the metric,
+// the key is chosen by the cluster of the job if they disagree.
+func footprintColumnOfMetric(metric string) (string, error) {
+	fallback := footprintKeyOfMetric("", metric)
+	defaultColumn, err := footprintColumn(fallback)
+	if err != nil {
+		return "", err
+	}
+
+	var cases strings.Builder
+	for _, c := range config.Keys.Clusters {
+		key := footprintKeyOfMetric(c.Name, metric)
+		if key == fallback {
+			continue
+		}
+
+		column, err := footprintColumn(key)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&cases, " WHEN '%s' THEN %s", strings.ReplaceAll(c.Name, "'", "''"), column)
+	}
+
+	if cases.Len() == 0 {
+		return defaultColumn, nil
+	}
+
+	return fmt.Sprintf("(CASE job.cluster%s ELSE %s END)", cases.String(), defaultColumn), nil
+}
+
+// Builds the footprint of a job on the cluster from its metric statistics.
+func JobFootprint(cluster string, statistics map[string]schema.JobStatistics) map[string]float64 {
+	footprint := make(map[string]float64)
+	for _, fm := range FootprintMetrics(cluster) {
+		stats, ok := statistics[fm.Metric]
+		if !ok {
+			continue
+		}
+
+		switch fm.Stat {
+		case "avg":
+			footprint[FootprintKey(fm.Metric, fm.Stat)] = stats.Avg
+		case "min":
+			footprint[FootprintKey(fm.Metric, fm.Stat)] = stats.Min
+		case "max":
+			footprint[FootprintKey(fm.Metric, fm.Stat)] = stats.Max
+		default:
+			log.Warnf("unknown footprint statistic '%s' for metric '%s'", fm.Stat, fm.Metric)
+		}
+	}
+
+	return footprint
+}
+
+// Returns the SQL expression selecting the footprint value with the given key.
+// Keys are validated as they can not be passed as query arguments everywhere.
+func footprintColumn(key string) (string, error) {
+	if !footprintKeyRegex.MatchString(key) {
+		return "", fmt.Errorf("REPOSITORY/FOOTPRINT > invalid footprint key '%s'", key)
+	}
+
+	if GetConnection().Driver == "postgres" {
+		return fmt.Sprintf("CAST(job.footprint ->> '%s' AS DOUBLE PRECISION)", key), nil
+	}
+
+	return fmt.Sprintf("json_extract(job.footprint, '$.%s')", key), nil
+}
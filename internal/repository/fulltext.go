@@ -0,0 +1,162 @@
+// Copyright (C) 2022 NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ClusterCockpit/cc-backend/internal/config"
+	"github.com/ClusterCockpit/cc-backend/internal/graph/model"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+)
+
+// The full-text index is kept in the job_fts table: a FTS4 table in sqlite3
+// (FTS5 is not compiled into the sqlite3 driver by default), a FULLTEXT index
+// in mysql and a tsvector column in postgres. It covers the job name, the job
+// script and the metadata keys configured in 'fulltext-metadata-keys'.
+
+// Replaces the full-text index entry of the job with the database id `id`.
+func updateFullText(db sqlx.Ext, driver string, id int64, metaData map[string]string) error {
+	jobName, jobScript := metaData["jobName"], metaData["jobScript"]
+	values := make([]string, 0, len(config.Keys.FullTextMetadataKeys))
+	for _, key := range config.Keys.FullTextMetadataKeys {
+		if val, ok := metaData[key]; ok {
+			values = append(values, val)
+		}
+	}
+	meta := strings.Join(values, "\n")
+
+	var del, ins string
+	switch driver {
+	case "sqlite3":
+		del = `DELETE FROM job_fts WHERE docid = ?`
+		ins = `INSERT INTO job_fts (docid, job_name, job_script, meta_data) VALUES (?, ?, ?, ?)`
+	case "postgres":
+		del = `DELETE FROM job_fts WHERE job_id = ?`
+		ins = `INSERT INTO job_fts (job_id, document) VALUES (?,
+			setweight(to_tsvector('simple', ?), 'A') ||
+			setweight(to_tsvector('simple', ?), 'B') ||
+			setweight(to_tsvector('simple', ?), 'C'))`
+	default:
+		del = `DELETE FROM job_fts WHERE job_id = ?`
+		ins = `INSERT INTO job_fts (job_id, job_name, job_script, meta_data) VALUES (?, ?, ?, ?)`
+	}
+
+	if _, err := db.Exec(db.Rebind(del), id); err != nil {
+		return err
+	}
+	_, err := db.Exec(db.Rebind(ins), id, jobName, jobScript, meta)
+	return err
+}
+
+// Splits a search text into terms. Double quoted parts are kept together as
+// phrases, everything else is split at whitespace.
+func fullTextTerms(text string) []string {
+	terms := make([]string, 0)
+	for i, part := range strings.Split(text, `"`) {
+		if i%2 == 1 {
+			if phrase := strings.Join(strings.Fields(part), " "); phrase != "" {
+				terms = append(terms, phrase)
+			}
+			continue
+		}
+		terms = append(terms, strings.Fields(part)...)
+	}
+
+	return terms
+}
+
+// Returns the full-text query for the terms in the dialect of the driver,
+// to be used with the returned arguments.
+func fullTextQuery(driver string, terms []string) (string, []interface{}) {
+	switch driver {
+	case "sqlite3":
+		// Every term is quoted, so no term is taken as an FTS operator
+		quoted := make([]string, len(terms))
+		for i, term := range terms {
+			quoted[i] = `"` + term + `"`
+		}
+		return "?", []interface{}{strings.Join(quoted, " ")}
+	case "postgres":
+		queries := make([]string, len(terms))
+		args := make([]interface{}, len(terms))
+		for i, term := range terms {
+			queries[i] = "phraseto_tsquery('simple', ?)"
+			args[i] = term
+		}
+		return "(" + strings.Join(queries, " && ") + ")", args
+	default:
+		required := make([]string, len(terms))
+		for i, term := range terms {
+			required[i] = `+"` + term + `"`
+		}
+		return "?", []interface{}{strings.Join(required, " ")}
+	}
+}
+
+// Returns the SQL conditions matching the full-text query and the SQL
+// expression ranking the matches by relevance. In sqlite3, which has no
+// built-in ranking for FTS4, the number of matched terms is used.
+func fullTextExpressions(driver string, query string) (match string, rank string) {
+	switch driver {
+	case "sqlite3":
+		return "job_fts MATCH " + query,
+			"(length(offsets(job_fts)) - length(replace(offsets(job_fts), ' ', '')) + 1) / 4"
+	case "postgres":
+		// ts_rank returns a real, which would not compare equal to the rank in a cursor
+		return "job_fts.document @@ " + query, "CAST(ts_rank(job_fts.document, " + query + ") AS DOUBLE PRECISION)"
+	default:
+		match := "MATCH (job_fts.job_name, job_fts.job_script, job_fts.meta_data) AGAINST (" + query + " IN BOOLEAN MODE)"
+		return match, match
+	}
+}
+
+func fullTextIdColumn(driver string) string {
+	if driver == "sqlite3" {
+		return "job_fts.docid"
+	}
+
+	return "job_fts.job_id"
+}
+
+func buildFullTextCondition(text string, query sq.SelectBuilder) sq.SelectBuilder {
+	terms := fullTextTerms(text)
+	if len(terms) == 0 {
+		return query
+	}
+
+	driver := GetConnection().Driver
+	ftQuery, args := fullTextQuery(driver, terms)
+	match, _ := fullTextExpressions(driver, ftQuery)
+	return query.Where(fmt.Sprintf("job.id IN (SELECT %s FROM job_fts WHERE %s)", fullTextIdColumn(driver), match), args...)
+}
+
+// Joins the relevance of the jobs for the full-text filters to the query and
+// returns the column to sort by.
+func joinFullTextRank(filters []*model.JobFilter, query sq.SelectBuilder) (sq.SelectBuilder, string, error) {
+	terms := make([]string, 0)
+	for _, f := range filters {
+		if f.FullText != nil {
+			terms = append(terms, fullTextTerms(*f.FullText)...)
+		}
+	}
+	if len(terms) == 0 {
+		return query, "", errors.New("REPOSITORY/FULLTEXT > sorting by rank requires a fullText filter")
+	}
+
+	driver := GetConnection().Driver
+	ftQuery, args := fullTextQuery(driver, terms)
+	match, rank := fullTextExpressions(driver, ftQuery)
+	if driver != "sqlite3" {
+		// The query is part of both the rank expression and the match
+		args = append(args, args...)
+	}
+
+	return query.JoinClause(fmt.Sprintf("JOIN (SELECT %s AS job_id, %s AS relevance FROM job_fts WHERE %s) fts_rank ON fts_rank.job_id = job.id",
+		fullTextIdColumn(driver), rank, match), args...), "fts_rank.relevance", nil
+}
@@ -6,23 +6,259 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/ClusterCockpit/cc-backend/pkg/log"
+	"github.com/jmoiron/sqlx"
+)
+
+type hooksContextKey struct{}
+
+// Upper bounds of the latency histogram buckets, the last bucket is unbounded.
+var QueryLatencyBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+// Statements beyond this number are not tracked, so statements built with
+// varying conditions cannot grow the statistics without bounds.
+const maxQueryStats = 1000
+
+type QueryStats struct {
+	Query     string  `json:"query"`     // Normalized statement
+	Count     int64   `json:"count"`     // Number of executions
+	Errors    int64   `json:"errors"`    // Number of failed executions
+	Slow      int64   `json:"slow"`      // Number of executions above the slow query threshold
+	TotalTime float64 `json:"totalTime"` // Sum of latencies in milliseconds
+	MaxTime   float64 `json:"maxTime"`   // Maximum latency in milliseconds
+	Histogram []int64 `json:"histogram"` // Executions per bucket of QueryLatencyBuckets, plus one for slower ones
+}
+
+// Number of slow statements explained at the same time, further ones are
+// not explained.
+const maxExplains = 2
+
+var explainSlots = make(chan struct{}, maxExplains)
+
+var (
+	queryStatsLock sync.Mutex
+	queryStats     = map[string]*QueryStats{}
 )
 
 // Hooks satisfies the sqlhook.Hooks interface
-type Hooks struct{}
+type Hooks struct {
+	// Statements taking longer are logged at warn level, disabled if zero
+	slowThreshold time.Duration
+	// Connection without hooks to capture the plans of slow statements, disabled if nil
+	explain *sqlx.DB
+	driver  string
+}
 
 // Before hook will print the query with it's args and return the context with the timestamp
 func (h *Hooks) Before(ctx context.Context, query string, args ...interface{}) (context.Context, error) {
 	log.Debugf("SQL query %s %q", query, args)
-	return context.WithValue(ctx, "begin", time.Now()), nil
+	return context.WithValue(ctx, hooksContextKey{}, time.Now()), nil
 }
 
 // After hook will get the timestamp registered on the Before hook and print the elapsed time
 func (h *Hooks) After(ctx context.Context, query string, args ...interface{}) (context.Context, error) {
-	begin := ctx.Value("begin").(time.Time)
-	log.Debugf("Took: %s\n", time.Since(begin))
+	elapsed := h.elapsed(ctx)
+	log.Debugf("Took: %s\n", elapsed)
+	h.record(query, elapsed, false, args)
 	return ctx, nil
 }
+
+// OnError hook counts the failed statement, the error is passed on unchanged
+func (h *Hooks) OnError(ctx context.Context, err error, query string, args ...interface{}) error {
+	h.record(query, h.elapsed(ctx), true, args)
+	return err
+}
+
+func (h *Hooks) elapsed(ctx context.Context) time.Duration {
+	begin, ok := ctx.Value(hooksContextKey{}).(time.Time)
+	if !ok {
+		return 0
+	}
+
+	return time.Since(begin)
+}
+
+func (h *Hooks) record(query string, elapsed time.Duration, failed bool, args []interface{}) {
+	slow := h.slowThreshold > 0 && elapsed >= h.slowThreshold
+	if slow {
+		// The arguments can contain user names or job scripts
+		log.Warnf("SQL slow query (%s) from %s: %s", elapsed, queryCaller(), query)
+		log.Debugf("SQL slow query arguments %q", args)
+		if h.explain != nil && isSelect(query) {
+			select {
+			case explainSlots <- struct{}{}:
+				go func() {
+					defer func() { <-explainSlots }()
+					h.explainQuery(query, args)
+				}()
+			default:
+				// Slow queries are frequent under load, do not add to it
+			}
+		}
+	}
+
+	normalized := normalizeQuery(query)
+	queryStatsLock.Lock()
+	defer queryStatsLock.Unlock()
+
+	stats, ok := queryStats[normalized]
+	if !ok {
+		if len(queryStats) >= maxQueryStats {
+			return
+		}
+		stats = &QueryStats{Query: normalized, Histogram: make([]int64, len(QueryLatencyBuckets)+1)}
+		queryStats[normalized] = stats
+	}
+
+	ms := float64(elapsed) / float64(time.Millisecond)
+	stats.Count++
+	stats.TotalTime += ms
+	if ms > stats.MaxTime {
+		stats.MaxTime = ms
+	}
+	if failed {
+		stats.Errors++
+	}
+	if slow {
+		stats.Slow++
+	}
+	bucket := sort.Search(len(QueryLatencyBuckets), func(i int) bool { return elapsed <= QueryLatencyBuckets[i] })
+	stats.Histogram[bucket]++
+}
+
+// Logs the query plan of a slow statement at warn level.
+func (h *Hooks) explainQuery(query string, args []interface{}) {
+	prefix := "EXPLAIN "
+	if h.driver == "sqlite3" {
+		prefix = "EXPLAIN QUERY PLAN "
+	}
+
+	rows, err := h.explain.Query(prefix+query, args...)
+	if err != nil {
+		log.Warnf("Error while explaining slow query: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		log.Warnf("Error while explaining slow query: %v", err)
+		return
+	}
+
+	plan := make([]string, 0)
+	for rows.Next() {
+		values := make([]sql.NullString, len(cols))
+		dest := make([]interface{}, len(cols))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			log.Warnf("Error while explaining slow query: %v", err)
+			return
+		}
+
+		fields := make([]string, 0, len(cols))
+		for _, v := range values {
+			if v.Valid {
+				fields = append(fields, v.String)
+			}
+		}
+		plan = append(plan, strings.Join(fields, " | "))
+	}
+
+	log.Warnf("SQL slow query plan for %s:\n%s", query, strings.Join(plan, "\n"))
+}
+
+var placeholderLists = regexp.MustCompile(`(\?|\$\d+)(\s*,\s*(\?|\$\d+))+`)
+
+// Collapses whitespace and lists of placeholders, like the ones of IN
+// conditions, so executions of the same statement are counted together.
+func normalizeQuery(query string) string {
+	query = strings.Join(strings.Fields(query), " ")
+	return placeholderLists.ReplaceAllString(query, "$1, ...")
+}
+
+func isSelect(query string) bool {
+	query = strings.ToUpper(strings.TrimSpace(query))
+	return strings.HasPrefix(query, "SELECT") || strings.HasPrefix(query, "WITH")
+}
+
+// Packages between the code issuing a statement and the hooks.
+var databaseFrames = []string{
+	"runtime.",
+	"database/sql.",
+	"github.com/qustavo/sqlhooks/",
+	"github.com/jmoiron/sqlx.",
+	"github.com/Masterminds/squirrel.",
+	"github.com/ClusterCockpit/cc-backend/internal/repository.(*Hooks)",
+	"github.com/ClusterCockpit/cc-backend/internal/repository.queryCaller",
+}
+
+// Returns the first function on the stack outside of the database packages.
+func queryCaller() string {
+	pcs := make([]uintptr, 64)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(1, pcs)])
+	for {
+		frame, more := frames.Next()
+		internal := false
+		for _, prefix := range databaseFrames {
+			if strings.HasPrefix(frame.Function, prefix) {
+				internal = true
+				break
+			}
+		}
+		if !internal {
+			return fmt.Sprintf("%s (%s:%d)", frame.Function, frame.File, frame.Line)
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
+
+// GetQueryStats returns the statistics of all statements executed since the
+// start or the last reset, the ones with the highest total latency first.
+// Statistics are only collected if a slow query threshold is configured or
+// the log level is debug.
+func GetQueryStats() []*QueryStats {
+	queryStatsLock.Lock()
+	defer queryStatsLock.Unlock()
+
+	list := make([]*QueryStats, 0, len(queryStats))
+	for _, stats := range queryStats {
+		copied := *stats
+		copied.Histogram = append([]int64(nil), stats.Histogram...)
+		list = append(list, &copied)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].TotalTime > list[j].TotalTime })
+
+	return list
+}
+
+// ResetQueryStats clears the statement statistics, e.g. to compare the
+// latencies before and after adding an index.
+func ResetQueryStats() {
+	queryStatsLock.Lock()
+	defer queryStatsLock.Unlock()
+
+	queryStats = map[string]*QueryStats{}
+}
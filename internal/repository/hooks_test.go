@@ -0,0 +1,55 @@
+// Copyright (C) 2022 NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestQueryStats(t *testing.T) {
+	ResetQueryStats()
+	defer ResetQueryStats()
+
+	h := &Hooks{slowThreshold: time.Nanosecond}
+	for _, query := range []string{
+		"SELECT * FROM job\n\tWHERE job.id IN (?,?)",
+		"SELECT * FROM job WHERE job.id IN (?, ?, ?)",
+	} {
+		ctx, err := h.Before(context.Background(), query, 1, 2)
+		noErr(t, err)
+		_, err = h.After(ctx, query, 1, 2)
+		noErr(t, err)
+	}
+	ctx, _ := h.Before(context.Background(), "DELETE FROM tag")
+	if err := h.OnError(ctx, errors.New("failed"), "DELETE FROM tag"); err == nil {
+		t.Fatal("error not passed on")
+	}
+
+	stats := GetQueryStats()
+	if len(stats) != 2 {
+		t.Fatalf("wrong number of statements\ngot: %d \nwant: 2", len(stats))
+	}
+	for _, s := range stats {
+		var sum int64
+		for _, n := range s.Histogram {
+			sum += n
+		}
+		switch s.Query {
+		case "SELECT * FROM job WHERE job.id IN (?, ...)":
+			if s.Count != 2 || s.Slow != 2 || sum != 2 {
+				t.Errorf("wrong statistics\ngot: %#v", s)
+			}
+		case "DELETE FROM tag":
+			if s.Count != 1 || s.Errors != 1 || sum != 1 {
+				t.Errorf("wrong statistics\ngot: %#v", s)
+			}
+		default:
+			t.Errorf("unexpected statement: %s", s.Query)
+		}
+	}
+}
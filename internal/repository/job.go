@@ -16,6 +16,7 @@ import (
 
 	"github.com/ClusterCockpit/cc-backend/internal/graph/model"
 	"github.com/ClusterCockpit/cc-backend/internal/metricdata"
+	"github.com/ClusterCockpit/cc-backend/pkg/archive"
 	"github.com/ClusterCockpit/cc-backend/pkg/log"
 	"github.com/ClusterCockpit/cc-backend/pkg/lrucache"
 	"github.com/ClusterCockpit/cc-backend/pkg/schema"
@@ -29,8 +30,9 @@ var (
 )
 
 type JobRepository struct {
-	DB     *sqlx.DB
-	driver string
+	DB      *sqlx.DB
+	driver  string
+	builder sq.StatementBuilderType
 
 	stmtCache *sq.StmtCache
 	cache     *lrucache.Cache
@@ -44,8 +46,9 @@ func GetJobRepository() *JobRepository {
 		db := GetConnection()
 
 		jobRepoInstance = &JobRepository{
-			DB:     db.DB,
-			driver: db.Driver,
+			DB:      db.DB,
+			driver:  db.Driver,
+			builder: db.Builder,
 
 			stmtCache:      sq.NewStmtCache(db.DB),
 			cache:          lrucache.New(1024 * 1024),
@@ -60,7 +63,7 @@ func GetJobRepository() *JobRepository {
 var jobColumns []string = []string{
 	"job.id", "job.job_id", "job.user", "job.project", "job.cluster", "job.subcluster", "job.start_time", "job.partition", "job.array_job_id",
 	"job.num_nodes", "job.num_hwthreads", "job.num_acc", "job.exclusive", "job.monitoring_status", "job.smt", "job.job_state",
-	"job.duration", "job.walltime", "job.resources", "job.mem_used_max", "job.flops_any_avg", "job.mem_bw_avg", "job.load_avg", // "job.meta_data",
+	"job.duration", "job.walltime", "job.resources", "job.footprint", "job.energy", // "job.meta_data",
 }
 
 func scanJob(row interface{ Scan(...interface{}) error }) (*schema.Job, error) {
@@ -68,7 +71,7 @@ func scanJob(row interface{ Scan(...interface{}) error }) (*schema.Job, error) {
 	if err := row.Scan(
 		&job.ID, &job.JobID, &job.User, &job.Project, &job.Cluster, &job.SubCluster, &job.StartTimeUnix, &job.Partition, &job.ArrayJobId,
 		&job.NumNodes, &job.NumHWThreads, &job.NumAcc, &job.Exclusive, &job.MonitoringStatus, &job.SMT, &job.State,
-		&job.Duration, &job.Walltime, &job.RawResources, &job.MemUsedMax, &job.FlopsAnyAvg, &job.MemBwAvg, &job.LoadAvg /*&job.RawMetaData*/); err != nil {
+		&job.Duration, &job.Walltime, &job.RawResources, &job.RawFootprint, &job.Energy /*&job.RawMetaData*/); err != nil {
 		log.Warnf("Error while scanning rows (Job): %v", err)
 		return nil, err
 	}
@@ -78,6 +81,14 @@ func scanJob(row interface{ Scan(...interface{}) error }) (*schema.Job, error) {
 		return nil, err
 	}
 
+	if len(job.RawFootprint) != 0 {
+		if err := json.Unmarshal(job.RawFootprint, &job.Footprint); err != nil {
+			log.Warn("Error while unmarhsaling raw footprint json")
+			return nil, err
+		}
+	}
+	job.SetDeprecatedStatistics()
+
 	// if err := json.Unmarshal(job.RawMetaData, &job.MetaData); err != nil {
 	// 	return nil, err
 	// }
@@ -88,6 +99,7 @@ func scanJob(row interface{ Scan(...interface{}) error }) (*schema.Job, error) {
 	}
 
 	job.RawResources = nil
+	job.RawFootprint = nil
 	return job, nil
 }
 
@@ -101,6 +113,10 @@ func (r *JobRepository) Optimize() error {
 		}
 	case "mysql":
 		log.Info("Optimize currently not supported for mysql driver")
+	case "postgres":
+		if _, err = r.DB.Exec(`VACUUM ANALYZE`); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -114,12 +130,27 @@ func (r *JobRepository) Flush() error {
 		if _, err = r.DB.Exec(`DELETE FROM jobtag`); err != nil {
 			return err
 		}
+		if _, err = r.DB.Exec(`DELETE FROM job_annotation`); err != nil {
+			return err
+		}
+		if _, err = r.DB.Exec(`DELETE FROM job_step`); err != nil {
+			return err
+		}
+		if _, err = r.DB.Exec(`DELETE FROM job_node`); err != nil {
+			return err
+		}
 		if _, err = r.DB.Exec(`DELETE FROM tag`); err != nil {
 			return err
 		}
 		if _, err = r.DB.Exec(`DELETE FROM job`); err != nil {
 			return err
 		}
+		if _, err = r.DB.Exec(`DELETE FROM job_rollup`); err != nil {
+			return err
+		}
+		if _, err = r.DB.Exec(`DELETE FROM job_rollup_histogram`); err != nil {
+			return err
+		}
 	case "mysql":
 		if _, err = r.DB.Exec(`SET FOREIGN_KEY_CHECKS = 0`); err != nil {
 			return err
@@ -127,15 +158,37 @@ func (r *JobRepository) Flush() error {
 		if _, err = r.DB.Exec(`TRUNCATE TABLE jobtag`); err != nil {
 			return err
 		}
+		if _, err = r.DB.Exec(`TRUNCATE TABLE job_annotation`); err != nil {
+			return err
+		}
+		if _, err = r.DB.Exec(`TRUNCATE TABLE job_step`); err != nil {
+			return err
+		}
+		if _, err = r.DB.Exec(`TRUNCATE TABLE job_node`); err != nil {
+			return err
+		}
+		if _, err = r.DB.Exec(`TRUNCATE TABLE job_fts`); err != nil {
+			return err
+		}
 		if _, err = r.DB.Exec(`TRUNCATE TABLE tag`); err != nil {
 			return err
 		}
 		if _, err = r.DB.Exec(`TRUNCATE TABLE job`); err != nil {
 			return err
 		}
+		if _, err = r.DB.Exec(`TRUNCATE TABLE job_rollup`); err != nil {
+			return err
+		}
+		if _, err = r.DB.Exec(`TRUNCATE TABLE job_rollup_histogram`); err != nil {
+			return err
+		}
 		if _, err = r.DB.Exec(`SET FOREIGN_KEY_CHECKS = 1`); err != nil {
 			return err
 		}
+	case "postgres":
+		if _, err = r.DB.Exec(`TRUNCATE TABLE jobtag, job_annotation, job_step, job_node, job_fts, tag, job, job_rollup, job_rollup_histogram`); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -160,7 +213,7 @@ func (r *JobRepository) FetchMetadata(job *schema.Job) (map[string]string, error
 		return job.MetaData, nil
 	}
 
-	if err := sq.Select("job.meta_data").From("job").Where("job.id = ?", job.ID).
+	if err := r.builder.Select("job.meta_data").From("job").Where("job.id = ?", job.ID).
 		RunWith(r.stmtCache).QueryRow().Scan(&job.RawMetaData); err != nil {
 		log.Warn("Error while scanning for job metadata")
 		return nil, err
@@ -206,15 +259,187 @@ func (r *JobRepository) UpdateMetadata(job *schema.Job, key, val string) (err er
 		return err
 	}
 
-	if _, err = sq.Update("job").Set("meta_data", job.RawMetaData).Where("job.id = ?", job.ID).RunWith(r.stmtCache).Exec(); err != nil {
+	if _, err = r.builder.Update("job").Set("meta_data", job.RawMetaData).Where("job.id = ?", job.ID).RunWith(r.stmtCache).Exec(); err != nil {
 		log.Warnf("Error while updating metadata for job, DB ID '%v'", job.ID)
 		return err
 	}
 
+	if err = updateFullText(r.DB, r.driver, job.ID, job.MetaData); err != nil {
+		log.Warnf("Error while updating full-text index for job, DB ID '%v'", job.ID)
+		return err
+	}
+
 	r.cache.Put(cachekey, job.MetaData, len(job.RawMetaData), 24*time.Hour)
 	return nil
 }
 
+// JobUpdate holds the fields of a job which may change after its start, for
+// example by `scontrol update`. Fields which are nil are not changed.
+type JobUpdate struct {
+	Walltime   *int64
+	Partition  *string
+	ArrayJobId *int64
+	Resources  []*schema.Resource
+	MetaData   map[string]string
+}
+
+// ErrInvalidJobUpdate is returned by UpdateJob for updates which are rejected
+// before the job is changed.
+var ErrInvalidJobUpdate = errors.New("REPOSITORY/JOB > invalid job update")
+
+// UpdateJob changes the fields of the job, both in the database and in `job`.
+// All fields including the metadata are changed in one transaction. The node
+// allocation index, the rollups and the cached metadata and metric data of the
+// job are updated accordingly and the `meta.json` of archived jobs is kept in
+// sync.
+func (r *JobRepository) UpdateJob(job *schema.Job, upd *JobUpdate) error {
+	if upd.Walltime != nil && *upd.Walltime < 0 {
+		return fmt.Errorf("%w: walltime %d is negative", ErrInvalidJobUpdate, *upd.Walltime)
+	}
+	if upd.Resources != nil {
+		if len(upd.Resources) == 0 {
+			return fmt.Errorf("%w: a job needs at least one resource", ErrInvalidJobUpdate)
+		}
+		for _, res := range upd.Resources {
+			if res == nil || res.Hostname == "" {
+				return fmt.Errorf("%w: resource without hostname", ErrInvalidJobUpdate)
+			}
+		}
+	}
+
+	// The rollup group of the job before the update
+	before := rollupGroup{
+		Day: job.StartTimeUnix - job.StartTimeUnix%rollupDay, Cluster: job.Cluster,
+		Partition: job.Partition, User: job.User, Project: job.Project,
+	}
+
+	query := r.builder.Update("job").Where("job.id = ?", job.ID)
+	changed := false
+	if upd.Walltime != nil {
+		job.Walltime = *upd.Walltime
+		query = query.Set("walltime", job.Walltime)
+		changed = true
+	}
+	if upd.Partition != nil {
+		job.Partition = *upd.Partition
+		query = query.Set(quoteIdent(r.driver, "partition"), job.Partition)
+		changed = true
+	}
+	if upd.ArrayJobId != nil {
+		job.ArrayJobId = *upd.ArrayJobId
+		query = query.Set("array_job_id", job.ArrayJobId)
+		changed = true
+	}
+	if upd.Resources != nil {
+		raw, err := json.Marshal(upd.Resources)
+		if err != nil {
+			log.Warn("Error while marshaling resources")
+			return err
+		}
+
+		job.Resources, job.RawResources = upd.Resources, raw
+		job.NumNodes = int32(len(upd.Resources))
+		var hwthreads, accs int32
+		for _, res := range upd.Resources {
+			hwthreads += int32(len(res.HWThreads))
+			accs += int32(len(res.Accelerators))
+		}
+		// Keep the counts if the resources do not list hwthreads or accelerators
+		if hwthreads > 0 {
+			job.NumHWThreads = hwthreads
+		}
+		if accs > 0 {
+			job.NumAcc = accs
+		}
+		query = query.Set("resources", raw).Set("num_nodes", job.NumNodes).
+			Set("num_hwthreads", job.NumHWThreads).Set("num_acc", job.NumAcc)
+		changed = true
+	}
+	var metaData map[string]string
+	var rawMetaData []byte
+	if len(upd.MetaData) != 0 {
+		if job.MetaData == nil {
+			if _, err := r.FetchMetadata(job); err != nil {
+				log.Warnf("Error while fetching metadata for job, DB ID '%v'", job.ID)
+				return err
+			}
+		}
+		metaData = make(map[string]string, len(job.MetaData)+len(upd.MetaData))
+		for k, v := range job.MetaData {
+			metaData[k] = v
+		}
+		for k, v := range upd.MetaData {
+			metaData[k] = v
+		}
+
+		var err error
+		if rawMetaData, err = json.Marshal(metaData); err != nil {
+			log.Warnf("Error while marshaling metadata for job, DB ID '%v'", job.ID)
+			return err
+		}
+		query = query.Set("meta_data", rawMetaData)
+		changed = true
+	}
+
+	if changed {
+		tx, err := r.DB.Beginx()
+		if err != nil {
+			return err
+		}
+		if _, err := query.RunWith(tx).Exec(); err != nil {
+			tx.Rollback()
+			log.Warnf("Error while updating job, DB ID '%v'", job.ID)
+			return err
+		}
+		if upd.Resources != nil {
+			if _, err := tx.Exec(tx.Rebind(`DELETE FROM job_node WHERE job_id = ?`), job.ID); err != nil {
+				tx.Rollback()
+				return err
+			}
+			if err := insertJobNodes(tx, job.ID, job.Resources); err != nil {
+				tx.Rollback()
+				log.Warn("Error while updating node allocation index")
+				return err
+			}
+		}
+		if metaData != nil {
+			if err := updateFullText(tx, r.driver, job.ID, metaData); err != nil {
+				tx.Rollback()
+				log.Warnf("Error while updating full-text index for job, DB ID '%v'", job.ID)
+				return err
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	if metaData != nil {
+		job.MetaData, job.RawMetaData = metaData, rawMetaData
+		r.cache.Put(fmt.Sprintf("metadata:%d", job.ID), job.MetaData, len(job.RawMetaData), 24*time.Hour)
+	}
+
+	if upd.Partition != nil {
+		r.cache.Del("partitions:" + job.Cluster)
+	}
+	if upd.Resources != nil {
+		metricdata.InvalidateJob(job)
+	}
+	if job.State != schema.JobStateRunning {
+		if err := r.refreshRollups(before.Day, before.Day+rollupDay, &before); err != nil {
+			log.Warnf("Error while refreshing rollups of job, DB ID '%v': %v", job.ID, err)
+		}
+		r.refreshRollupsOfJob(job.ID)
+	}
+
+	if job.MetaData == nil {
+		if _, err := r.FetchMetadata(job); err != nil {
+			return err
+		}
+	}
+	return archive.UpdateJobMeta(job)
+}
+
 // Find executes a SQL query to find a specific batch job.
 // The job is queried using the batch job id, the cluster name,
 // and the start time of the job in UNIX epoch time seconds.
@@ -226,8 +451,8 @@ func (r *JobRepository) Find(
 	startTime *int64) (*schema.Job, error) {
 
 	start := time.Now()
-	q := sq.Select(jobColumns...).From("job").
-		Where("job.job_id = ?", *jobId)
+	q := r.builder.Select(jobColumns...).From("job").
+		Where("job.job_id = ?", *jobId).Where("job.deleted_at IS NULL")
 
 	if cluster != nil {
 		q = q.Where("job.cluster = ?", *cluster)
@@ -251,8 +476,8 @@ func (r *JobRepository) FindAll(
 	startTime *int64) ([]*schema.Job, error) {
 
 	start := time.Now()
-	q := sq.Select(jobColumns...).From("job").
-		Where("job.job_id = ?", *jobId)
+	q := r.builder.Select(jobColumns...).From("job").
+		Where("job.job_id = ?", *jobId).Where("job.deleted_at IS NULL")
 
 	if cluster != nil {
 		q = q.Where("job.cluster = ?", *cluster)
@@ -283,10 +508,11 @@ func (r *JobRepository) FindAll(
 // FindById executes a SQL query to find a specific batch job.
 // The job is queried using the database id.
 // It returns a pointer to a schema.Job data structure and an error variable.
-// To check if no job was found test err == sql.ErrNoRows
+// To check if no job was found test err == sql.ErrNoRows, trashed jobs are
+// not found.
 func (r *JobRepository) FindById(jobId int64) (*schema.Job, error) {
-	q := sq.Select(jobColumns...).
-		From("job").Where("job.id = ?", jobId)
+	q := r.builder.Select(jobColumns...).
+		From("job").Where("job.id = ?", jobId).Where("job.deleted_at IS NULL")
 	return scanJob(q.RunWith(r.stmtCache).QueryRow())
 }
 
@@ -297,7 +523,7 @@ func (r *JobRepository) FindConcurrentJobs(
 		return nil, nil
 	}
 
-	query, qerr := SecurityCheck(ctx, sq.Select("job.id", "job.job_id", "job.start_time").From("job"))
+	query, qerr := SecurityCheck(ctx, r.builder.Select("job.id", "job.job_id", "job.start_time").From("job"))
 	if qerr != nil {
 		return nil, qerr
 	}
@@ -307,7 +533,10 @@ func (r *JobRepository) FindConcurrentJobs(
 	var stopTime int64
 
 	startTime = job.StartTimeUnix
-	hostname := job.Resources[0].Hostname
+	hosts := make([]string, 0, len(job.Resources))
+	for _, res := range job.Resources {
+		hosts = append(hosts, res.Hostname)
+	}
 
 	if job.State == schema.JobStateRunning {
 		stopTime = time.Now().Unix()
@@ -322,11 +551,11 @@ func (r *JobRepository) FindConcurrentJobs(
 
 	queryRunning := query.Where("job.job_state = ?").Where("(job.start_time BETWEEN ? AND ? OR job.start_time < ?)",
 		"running", startTimeTail, stopTimeTail, startTime)
-	queryRunning = queryRunning.Where("job.resources LIKE ?", fmt.Sprint("%", hostname, "%"))
+	queryRunning = queryRunning.Where(jobOnNodes(hosts))
 
 	query = query.Where("job.job_state != ?").Where("((job.start_time BETWEEN ? AND ?) OR (job.start_time + job.duration) BETWEEN ? AND ? OR (job.start_time < ?) AND (job.start_time + job.duration) > ?)",
 		"running", startTimeTail, stopTimeTail, startTimeFront, stopTimeTail, startTime, stopTime)
-	query = query.Where("job.resources LIKE ?", fmt.Sprint("%", hostname, "%"))
+	query = query.Where(jobOnNodes(hosts))
 
 	rows, err := query.RunWith(r.stmtCache).Query()
 	if err != nil {
@@ -401,18 +630,31 @@ func (r *JobRepository) Start(job *schema.JobMeta) (id int64, err error) {
 		return -1, fmt.Errorf("REPOSITORY/JOB > encoding metaData field failed: %w", err)
 	}
 
-	res, err := r.DB.NamedExec(`INSERT INTO job (
-		job_id, user, project, cluster, subcluster, `+"`partition`"+`, array_job_id, num_nodes, num_hwthreads, num_acc,
-		exclusive, monitoring_status, smt, job_state, start_time, duration, walltime, resources, meta_data
-	) VALUES (
-		:job_id, :user, :project, :cluster, :subcluster, :partition, :array_job_id, :num_nodes, :num_hwthreads, :num_acc,
-		:exclusive, :monitoring_status, :smt, :job_state, :start_time, :duration, :walltime, :resources, :meta_data
-	);`, job)
+	// The job is only started together with its node allocations
+	tx, err := r.DB.Beginx()
 	if err != nil {
 		return -1, err
 	}
+	defer tx.Rollback()
+
+	id, err = namedInsert(tx, r.driver, namedJobInsert(r.driver, false), job)
+	if err != nil {
+		return -1, err
+	}
+	if err := insertJobNodes(tx, id, job.Resources); err != nil {
+		log.Warnf("Error while updating node allocation index for job, DB ID '%v': %v", id, err)
+		return -1, err
+	}
+	if err := tx.Commit(); err != nil {
+		return -1, err
+	}
+
+	// The job is started even if it can not be indexed
+	if err := updateFullText(r.DB, r.driver, id, job.MetaData); err != nil {
+		log.Warnf("Error while updating full-text index for job, DB ID '%v': %v", id, err)
+	}
 
-	return res.LastInsertId()
+	return id, nil
 }
 
 // Stop updates the job with the database id jobId using the provided arguments.
@@ -422,41 +664,196 @@ func (r *JobRepository) Stop(
 	state schema.JobState,
 	monitoringStatus int32) (err error) {
 
-	stmt := sq.Update("job").
+	stmt := r.builder.Update("job").
 		Set("job_state", state).
 		Set("duration", duration).
 		Set("monitoring_status", monitoringStatus).
 		Where("job.id = ?", jobId)
 
-	_, err = stmt.RunWith(r.stmtCache).Exec()
+	if _, err = stmt.RunWith(r.stmtCache).Exec(); err != nil {
+		return
+	}
+
+	r.refreshRollupsOfJob(jobId)
 	return
 }
 
+// DeleteJobsBefore moves all jobs started before startTime to the trash.
+// Trashed jobs are hidden and purged after the grace period.
 func (r *JobRepository) DeleteJobsBefore(startTime int64) (int, error) {
-	var cnt int
-	qs := fmt.Sprintf("SELECT count(*) FROM job WHERE job.start_time < %d", startTime)
-	err := r.DB.Get(&cnt, qs) //ignore error as it will also occur in delete statement
-	_, err = r.DB.Exec(`DELETE FROM job WHERE job.start_time < ?`, startTime)
+	res, err := r.builder.Update("job").Set("deleted_at", time.Now().Unix()).
+		Where("job.start_time < ?", startTime).Where("job.deleted_at IS NULL").
+		RunWith(r.DB).Exec()
 	if err != nil {
-		log.Errorf(" DeleteJobsBefore(%d): error %#v", startTime, err)
-	} else {
-		log.Debugf("DeleteJobsBefore(%d): Deleted %d jobs", startTime, cnt)
+		log.Errorf("DeleteJobsBefore(%d): error %#v", startTime, err)
+		return 0, err
 	}
-	return cnt, err
+
+	cnt, err := res.RowsAffected()
+	if err != nil {
+		log.Warn("Error while fetching affected rows after trashing jobs")
+		return 0, err
+	}
+	log.Debugf("DeleteJobsBefore(%d): Trashed %d jobs", startTime, cnt)
+	r.refreshRollupsBefore(startTime)
+	return int(cnt), nil
 }
 
+// DeleteJobById moves the job to the trash.
 func (r *JobRepository) DeleteJobById(id int64) error {
-	_, err := r.DB.Exec(`DELETE FROM job WHERE job.id = ?`, id)
+	res, err := r.builder.Update("job").Set("deleted_at", time.Now().Unix()).
+		Where("job.id = ?", id).Where("job.deleted_at IS NULL").
+		RunWith(r.DB).Exec()
 	if err != nil {
 		log.Errorf("DeleteJobById(%d): error %#v", id, err)
+		return err
+	}
+
+	if cnt, err := res.RowsAffected(); err != nil {
+		return err
+	} else if cnt == 0 {
+		return sql.ErrNoRows
+	}
+	log.Debugf("DeleteJobById(%d): Success", id)
+	r.refreshRollupsOfJob(id)
+	return nil
+}
+
+// RestoreJobsBefore restores all trashed jobs started before startTime.
+func (r *JobRepository) RestoreJobsBefore(startTime int64) (int, error) {
+	res, err := r.builder.Update("job").Set("deleted_at", nil).
+		Where("job.start_time < ?", startTime).Where("job.deleted_at IS NOT NULL").
+		RunWith(r.DB).Exec()
+	if err != nil {
+		log.Errorf("RestoreJobsBefore(%d): error %#v", startTime, err)
+		return 0, err
+	}
+
+	cnt, err := res.RowsAffected()
+	if err != nil {
+		log.Warn("Error while fetching affected rows after restoring jobs")
+		return 0, err
+	}
+	log.Debugf("RestoreJobsBefore(%d): Restored %d jobs", startTime, cnt)
+	r.refreshRollupsBefore(startTime)
+	return int(cnt), nil
+}
+
+// RestoreJobById restores the trashed job. If the job is not in the trash,
+// sql.ErrNoRows is returned.
+func (r *JobRepository) RestoreJobById(id int64) error {
+	res, err := r.builder.Update("job").Set("deleted_at", nil).
+		Where("job.id = ?", id).Where("job.deleted_at IS NOT NULL").
+		RunWith(r.DB).Exec()
+	if err != nil {
+		log.Errorf("RestoreJobById(%d): error %#v", id, err)
+		return err
+	}
+
+	if cnt, err := res.RowsAffected(); err != nil {
+		return err
+	} else if cnt == 0 {
+		return sql.ErrNoRows
+	}
+	log.Debugf("RestoreJobById(%d): Success", id)
+	r.refreshRollupsOfJob(id)
+	return nil
+}
+
+// FindTrashedBefore returns all jobs moved to the trash before deletedBefore.
+func (r *JobRepository) FindTrashedBefore(deletedBefore int64) ([]*schema.Job, error) {
+	rows, err := r.builder.Select(jobColumns...).From("job").
+		Where("job.deleted_at IS NOT NULL").Where("job.deleted_at < ?", deletedBefore).
+		RunWith(r.stmtCache).Query()
+	if err != nil {
+		log.Error("Error while running query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := make([]*schema.Job, 0, 50)
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			log.Warn("Error while scanning rows")
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, nil
+}
+
+// PurgeJobs removes the trashed jobs from the database and returns the ids of
+// the removed jobs. Jobs which have been restored in the meantime are kept.
+// The archive is not touched.
+func (r *JobRepository) PurgeJobs(jobs []*schema.Job) ([]int64, error) {
+	if len(jobs) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]int64, 0, len(jobs))
+	for _, job := range jobs {
+		ids = append(ids, job.ID)
+	}
+
+	tx, err := r.DB.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := r.builder.Select("job.id").From("job").Where(sq.Eq{"job.id": ids}).Where("job.deleted_at IS NOT NULL")
+	if r.driver != "sqlite3" {
+		// Keep the jobs from being restored until they are deleted
+		query = query.Suffix("FOR UPDATE")
+	}
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var purged []int64
+	if err := tx.Select(&purged, sql, args...); err != nil {
+		log.Errorf("PurgeJobs(): error %#v", err)
+		return nil, err
+	}
+	if len(purged) == 0 {
+		return nil, nil
+	}
+
+	if _, err := r.builder.Delete("job").Where(sq.Eq{"job.id": purged}).RunWith(tx).Exec(); err != nil {
+		log.Errorf("PurgeJobs(): error %#v", err)
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	log.Debugf("PurgeJobs(): Purged %d jobs", len(purged))
+	return purged, nil
+}
+
+// PurgeJobsBefore immediately removes all jobs started before startTime from
+// the database. It is used by the retention service, which removes the
+// archived data as well. Trashed jobs are left to the trash purge service, as
+// the retention service does not see them.
+func (r *JobRepository) PurgeJobsBefore(startTime int64) (int, error) {
+	var cnt int
+	qs := fmt.Sprintf("SELECT count(*) FROM job WHERE job.start_time < %d AND job.deleted_at IS NULL", startTime)
+	err := r.DB.Get(&cnt, qs) //ignore error as it will also occur in delete statement
+	_, err = r.DB.Exec(r.DB.Rebind(`DELETE FROM job WHERE job.start_time < ? AND job.deleted_at IS NULL`), startTime)
+	if err != nil {
+		log.Errorf(" PurgeJobsBefore(%d): error %#v", startTime, err)
 	} else {
-		log.Debugf("DeleteJobById(%d): Success", id)
+		log.Debugf("PurgeJobsBefore(%d): Deleted %d jobs", startTime, cnt)
+		r.refreshRollupsBefore(startTime)
 	}
-	return err
+	return cnt, err
 }
 
 func (r *JobRepository) UpdateMonitoringStatus(job int64, monitoringStatus int32) (err error) {
-	stmt := sq.Update("job").
+	stmt := r.builder.Update("job").
 		Set("monitoring_status", monitoringStatus).
 		Where("job.id = ?", job)
 
@@ -464,41 +861,33 @@ func (r *JobRepository) UpdateMonitoringStatus(job int64, monitoringStatus int32
 	return
 }
 
-// Stop updates the job with the database id jobId using the provided arguments.
+// MarkArchived updates the monitoring status of the job with the database id
+// jobId and stores its footprint and energy.
 func (r *JobRepository) MarkArchived(
 	jobId int64,
 	monitoringStatus int32,
-	metricStats map[string]schema.JobStatistics) error {
+	footprint map[string]float64,
+	energy float64) error {
+
+	rawFootprint, err := json.Marshal(footprint)
+	if err != nil {
+		log.Warn("Error while marshaling job footprint")
+		return err
+	}
 
-	stmt := sq.Update("job").
+	stmt := r.builder.Update("job").
 		Set("monitoring_status", monitoringStatus).
+		Set("footprint", string(rawFootprint)).
+		Set("energy", energy).
 		Where("job.id = ?", jobId)
 
-	for metric, stats := range metricStats {
-		switch metric {
-		case "flops_any":
-			stmt = stmt.Set("flops_any_avg", stats.Avg)
-		case "mem_used":
-			stmt = stmt.Set("mem_used_max", stats.Max)
-		case "mem_bw":
-			stmt = stmt.Set("mem_bw_avg", stats.Avg)
-		case "load":
-			stmt = stmt.Set("load_avg", stats.Avg)
-		case "cpu_load":
-			stmt = stmt.Set("load_avg", stats.Avg)
-		case "net_bw":
-			stmt = stmt.Set("net_bw_avg", stats.Avg)
-		case "file_bw":
-			stmt = stmt.Set("file_bw_avg", stats.Avg)
-		default:
-			log.Debugf("MarkArchived() Metric '%v' unknown", metric)
-		}
-	}
-
 	if _, err := stmt.RunWith(r.stmtCache).Exec(); err != nil {
 		log.Warn("Error while marking job as archived")
 		return err
 	}
+
+	// The energy is only known once the job is archived
+	r.refreshRollupsOfJob(jobId)
 	return nil
 }
 
@@ -529,7 +918,8 @@ func (r *JobRepository) archivingWorker() {
 			}
 
 			// Update the jobs database entry one last time:
-			if err := r.MarkArchived(job.ID, schema.MonitoringStatusArchivingSuccessful, jobMeta.Statistics); err != nil {
+			if err := r.MarkArchived(job.ID, schema.MonitoringStatusArchivingSuccessful,
+				JobFootprint(job.Cluster, jobMeta.Statistics), jobMeta.Energy); err != nil {
 				log.Errorf("archiving job (dbid: %d) failed: %s", job.ID, err.Error())
 				continue
 			}
@@ -589,8 +979,9 @@ func (r *JobRepository) FindColumnValue(user *schema.User, searchterm string, ta
 		query = "%" + searchterm + "%"
 	}
 	if user.HasAnyRole([]schema.Role{schema.RoleAdmin, schema.RoleSupport, schema.RoleManager}) {
-		theQuery := sq.Select(table+"."+selectColumn).Distinct().From(table).
-			Where(table+"."+whereColumn+compareStr, query)
+		quotedTable := quoteIdent(r.driver, table)
+		theQuery := r.builder.Select(quotedTable+"."+selectColumn).Distinct().From(quotedTable).
+			Where(quotedTable+"."+whereColumn+compareStr, query)
 
 		// theSql, args, theErr := theQuery.ToSql()
 		// if theErr != nil {
@@ -616,8 +1007,9 @@ func (r *JobRepository) FindColumnValue(user *schema.User, searchterm string, ta
 func (r *JobRepository) FindColumnValues(user *schema.User, query string, table string, selectColumn string, whereColumn string) (results []string, err error) {
 	emptyResult := make([]string, 0)
 	if user.HasAnyRole([]schema.Role{schema.RoleAdmin, schema.RoleSupport, schema.RoleManager}) {
-		rows, err := sq.Select(table+"."+selectColumn).Distinct().From(table).
-			Where(table+"."+whereColumn+" LIKE ?", fmt.Sprint("%", query, "%")).
+		quotedTable := quoteIdent(r.driver, table)
+		rows, err := r.builder.Select(quotedTable+"."+selectColumn).Distinct().From(quotedTable).
+			Where(quotedTable+"."+whereColumn+" LIKE ?", fmt.Sprint("%", query, "%")).
 			RunWith(r.stmtCache).Query()
 		if err != nil && err != sql.ErrNoRows {
 			return emptyResult, err
@@ -647,7 +1039,7 @@ func (r *JobRepository) Partitions(cluster string) ([]string, error) {
 	start := time.Now()
 	partitions := r.cache.Get("partitions:"+cluster, func() (interface{}, time.Duration, int) {
 		parts := []string{}
-		if err = r.DB.Select(&parts, `SELECT DISTINCT job.partition FROM job WHERE job.cluster = ?;`, cluster); err != nil {
+		if err = r.DB.Select(&parts, r.DB.Rebind(`SELECT DISTINCT job.partition FROM job WHERE job.cluster = ?;`), cluster); err != nil {
 			return nil, 0, 1000
 		}
 
@@ -666,29 +1058,25 @@ func (r *JobRepository) AllocatedNodes(cluster string) (map[string]map[string]in
 
 	start := time.Now()
 	subclusters := make(map[string]map[string]int)
-	rows, err := sq.Select("resources", "subcluster").From("job").
+	rows, err := r.builder.Select("job_node.hostname", "job.subcluster", "count(*)").From("job_node").
+		Join("job ON job.id = job_node.job_id").
 		Where("job.job_state = 'running'").
 		Where("job.cluster = ?", cluster).
+		GroupBy("job_node.hostname", "job.subcluster").
 		RunWith(r.stmtCache).Query()
 	if err != nil {
 		log.Error("Error while running query")
 		return nil, err
 	}
 
-	var raw []byte
 	defer rows.Close()
 	for rows.Next() {
-		raw = raw[0:0]
-		var resources []*schema.Resource
-		var subcluster string
-		if err := rows.Scan(&raw, &subcluster); err != nil {
+		var hostname, subcluster string
+		var count int
+		if err := rows.Scan(&hostname, &subcluster, &count); err != nil {
 			log.Warn("Error while scanning rows")
 			return nil, err
 		}
-		if err := json.Unmarshal(raw, &resources); err != nil {
-			log.Warn("Error while unmarshaling raw resources json")
-			return nil, err
-		}
 
 		hosts, ok := subclusters[subcluster]
 		if !ok {
@@ -696,9 +1084,7 @@ func (r *JobRepository) AllocatedNodes(cluster string) (map[string]map[string]in
 			subclusters[subcluster] = hosts
 		}
 
-		for _, resource := range resources {
-			hosts[resource.Hostname] += 1
-		}
+		hosts[hostname] = count
 	}
 
 	log.Debugf("Timer AllocatedNodes %s", time.Since(start))
@@ -708,18 +1094,38 @@ func (r *JobRepository) AllocatedNodes(cluster string) (map[string]map[string]in
 func (r *JobRepository) StopJobsExceedingWalltimeBy(seconds int) error {
 
 	start := time.Now()
-	res, err := sq.Update("job").
+	// The jobs are selected first to refresh their rollups afterwards
+	var ids []int64
+	query, args, err := r.builder.Select("job.id").From("job").
+		Where("job.job_state = 'running'").
+		Where("job.deleted_at IS NULL").
+		Where("job.walltime > 0").
+		Where(fmt.Sprintf("(%d - job.start_time) > (job.walltime + %d)", time.Now().Unix(), seconds)).
+		ToSql()
+	if err != nil {
+		log.Warn("Error while converting query to sql")
+		return err
+	}
+	if err := r.DB.Select(&ids, query, args...); err != nil {
+		log.Warn("Error while selecting jobs exceeding walltime")
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	res, err := r.builder.Update("job").
 		Set("monitoring_status", schema.MonitoringStatusArchivingFailed).
 		Set("duration", 0).
 		Set("job_state", schema.JobStateFailed).
+		Where(sq.Eq{"job.id": ids}).
 		Where("job.job_state = 'running'").
-		Where("job.walltime > 0").
-		Where(fmt.Sprintf("(%d - job.start_time) > (job.walltime + %d)", time.Now().Unix(), seconds)).
 		RunWith(r.DB).Exec()
 	if err != nil {
 		log.Warn("Error while stopping jobs exceeding walltime")
 		return err
 	}
+	r.refreshRollupsOfJobs(ids)
 
 	rowsAffected, err := res.RowsAffected()
 	if err != nil {
@@ -744,13 +1150,15 @@ func (r *JobRepository) FindJobsBetween(startTimeBegin int64, startTimeEnd int64
 
 	if startTimeBegin == 0 {
 		log.Infof("Find jobs before %d", startTimeEnd)
-		query = sq.Select(jobColumns...).From("job").Where(fmt.Sprintf(
+		query = r.builder.Select(jobColumns...).From("job").Where(fmt.Sprintf(
 			"job.start_time < %d", startTimeEnd))
 	} else {
 		log.Infof("Find jobs between %d and %d", startTimeBegin, startTimeEnd)
-		query = sq.Select(jobColumns...).From("job").Where(fmt.Sprintf(
+		query = r.builder.Select(jobColumns...).From("job").Where(fmt.Sprintf(
 			"job.start_time BETWEEN %d AND %d", startTimeBegin, startTimeEnd))
 	}
+	// Trashed jobs are cleaned up by the trash purge service
+	query = query.Where("job.deleted_at IS NULL")
 
 	rows, err := query.RunWith(r.stmtCache).Query()
 	if err != nil {
@@ -773,27 +1181,23 @@ func (r *JobRepository) FindJobsBetween(startTimeBegin int64, startTimeEnd int64
 	return jobs, nil
 }
 
-const NamedJobInsert string = `INSERT INTO job (
-	job_id, user, project, cluster, subcluster, ` + "`partition`" + `, array_job_id, num_nodes, num_hwthreads, num_acc,
-	exclusive, monitoring_status, smt, job_state, start_time, duration, walltime, resources, meta_data,
-	mem_used_max, flops_any_avg, mem_bw_avg, load_avg, net_bw_avg, net_data_vol_total, file_bw_avg, file_data_vol_total
-) VALUES (
-	:job_id, :user, :project, :cluster, :subcluster, :partition, :array_job_id, :num_nodes, :num_hwthreads, :num_acc,
-	:exclusive, :monitoring_status, :smt, :job_state, :start_time, :duration, :walltime, :resources, :meta_data,
-	:mem_used_max, :flops_any_avg, :mem_bw_avg, :load_avg, :net_bw_avg, :net_data_vol_total, :file_bw_avg, :file_data_vol_total
-);`
-
 func (r *JobRepository) InsertJob(job *schema.Job) (int64, error) {
-	res, err := r.DB.NamedExec(NamedJobInsert, job)
+	id, err := namedInsert(r.DB, r.driver, namedJobInsert(r.driver, true), job)
 	if err != nil {
-		log.Warn("Error while NamedJobInsert")
+		log.Warn("Error while inserting job")
 		return 0, err
 	}
-	id, err := res.LastInsertId()
-	if err != nil {
-		log.Warn("Error while getting last insert ID")
+
+	if err := updateFullText(r.DB, r.driver, id, job.MetaData); err != nil {
+		log.Warn("Error while updating full-text index")
+		return 0, err
+	}
+
+	if err := insertJobNodes(r.DB, id, job.Resources); err != nil {
+		log.Warn("Error while updating node allocation index")
 		return 0, err
 	}
 
+	r.refreshRollupsOfJob(id)
 	return id, nil
 }
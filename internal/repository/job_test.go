@@ -5,9 +5,16 @@
 package repository
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
+	"reflect"
+	"sort"
 	"testing"
+	"time"
 
+	"github.com/ClusterCockpit/cc-backend/internal/graph/model"
+	"github.com/ClusterCockpit/cc-backend/pkg/schema"
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -40,6 +47,10 @@ func TestFindById(t *testing.T) {
 	if job.JobID != 398998 {
 		t.Errorf("wrong summary for diagnostic 3\ngot: %d \nwant: 1404396", job.JobID)
 	}
+	// Deprecated statistics are filled from the footprint
+	if job.FlopsAnyAvg != 719.977 || job.MemBwAvg != 184.065 {
+		t.Errorf("wrong deprecated statistics\ngot: %f, %f \nwant: 719.977, 184.065", job.FlopsAnyAvg, job.MemBwAvg)
+	}
 }
 
 func TestGetTags(t *testing.T) {
@@ -53,7 +64,348 @@ func TestGetTags(t *testing.T) {
 	fmt.Printf("TAGS %+v \n", tags)
 	// fmt.Printf("COUNTS %+v \n", counts)
 
-	if counts["bandwidth"] != 0 {
-		t.Errorf("wrong tag count \ngot: %d \nwant: 0", counts["bandwidth"])
+	for _, tag := range tags {
+		if tag.Name == "bandwidth" && counts[tag.ID] != 0 {
+			t.Errorf("wrong tag count \ngot: %d \nwant: 0", counts[tag.ID])
+		}
+	}
+}
+
+func TestScopedTags(t *testing.T) {
+	r := setup(t)
+
+	ids := make(map[string]int64)
+	for name, scope := range map[string]schema.TagScope{
+		"scoped-global":  schema.TagScopeGlobal,
+		"scoped-project": schema.TagScopeProject,
+		"scoped-private": schema.TagScopePrivate,
+	} {
+		owner := map[schema.TagScope]string{schema.TagScopeProject: "scopeproj", schema.TagScopePrivate: "alice"}[scope]
+		id, err := r.CreateTag("test", name, scope, owner)
+		noErr(t, err)
+		defer r.DeleteTag(id)
+		ids[name] = id
+	}
+
+	// A second private tag with the same name but another owner
+	id, err := r.CreateTag("test", "scoped-private", schema.TagScopePrivate, "bob")
+	noErr(t, err)
+	defer r.DeleteTag(id)
+
+	for _, tc := range []struct {
+		user *schema.User
+		want []string
+	}{
+		{&schema.User{Username: "alice", Roles: []string{"user"}}, []string{"scoped-global", "scoped-private"}},
+		{&schema.User{Username: "carol", Roles: []string{"manager"}, Projects: []string{"scopeproj"}}, []string{"scoped-global", "scoped-project"}},
+		{&schema.User{Username: "admin", Roles: []string{"admin"}}, []string{"scoped-global", "scoped-project"}},
+	} {
+		tags, err := r.GetTags(tc.user, nil)
+		noErr(t, err)
+
+		got := make([]string, 0)
+		for _, tag := range tags {
+			if tag.Type == "test" {
+				got = append(got, tag.Name)
+			}
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("wrong tags for %s\ngot: %v \nwant: %v", tc.user.Username, got, tc.want)
+		}
+	}
+
+	if visible, err := r.TagVisible(&schema.User{Username: "bob", Roles: []string{"user"}}, ids["scoped-private"]); err != nil || visible {
+		t.Errorf("private tag of alice visible to bob")
+	}
+	if _, exists := r.TagId("test", "scoped-private", schema.TagScopePrivate, "alice"); !exists {
+		t.Errorf("private tag of alice not found")
+	}
+
+	// Tags with the same name are counted separately
+	id, err = r.CreateTag("test", "scoped-project", schema.TagScopeGlobal, "")
+	noErr(t, err)
+	defer r.DeleteTag(id)
+	jobId := startTestJob(t, r, testJob(9000003, time.Now().Unix(), "f0001"))
+	_, err = r.AddTag(jobId, id)
+	noErr(t, err)
+
+	_, counts, err := r.CountTags(&schema.User{Username: "admin", Roles: []string{"admin"}})
+	noErr(t, err)
+	if counts[id] != 1 || counts[ids["scoped-project"]] != 0 {
+		t.Errorf("wrong tag counts\ngot: %d and %d \nwant: 1 and 0", counts[id], counts[ids["scoped-project"]])
+	}
+
+	// Filtering by a private tag of another user does not reveal its jobs
+	_, err = r.AddTag(jobId, ids["scoped-private"])
+	noErr(t, err)
+	for tag, want := range map[int64]int{id: 1, ids["scoped-private"]: 0} {
+		cnt, err := r.CountJobs(getContext(t), []*model.JobFilter{{Tags: []string{fmt.Sprint(tag)}}})
+		noErr(t, err)
+		if cnt != want {
+			t.Errorf("wrong job count for tag %d\ngot: %d \nwant: %d", tag, cnt, want)
+		}
+	}
+}
+
+func TestAnnotations(t *testing.T) {
+	r := setup(t)
+	job, err := r.FindById(5)
+	noErr(t, err)
+
+	ctxOf := func(username string, role schema.Role) context.Context {
+		user := &schema.User{Username: username, Roles: []string{schema.GetRoleString(role)}}
+		return context.WithValue(context.Background(), ContextUserKey, user)
+	}
+	admin, owner, other := getContext(t), ctxOf(job.User, schema.RoleUser), ctxOf("other", schema.RoleUser)
+
+	ids := make([]int64, 0)
+	for _, tc := range []struct {
+		ctx        context.Context
+		visibility model.AnnotationVisibility
+	}{
+		{admin, model.AnnotationVisibilityPrivate},
+		{admin, model.AnnotationVisibilitySupport},
+		{owner, model.AnnotationVisibilityProject},
+	} {
+		visibility := tc.visibility
+		a, err := r.AddAnnotation(tc.ctx, job.ID, &model.AnnotationInput{Body: "note", Visibility: &visibility})
+		noErr(t, err)
+		ids = append(ids, a.ID)
+	}
+	defer func() {
+		for _, id := range ids {
+			r.DeleteAnnotation(admin, id)
+		}
+	}()
+
+	if _, err := r.AddAnnotation(other, job.ID, &model.AnnotationInput{Body: "note"}); err != sql.ErrNoRows {
+		t.Errorf("annotation added to a job not visible to the user, err: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		ctx  context.Context
+		want int
+	}{
+		{"admin", admin, 3},
+		{"owner", owner, 2},
+		{"other", other, 0},
+	} {
+		annotations, err := r.GetAnnotations(tc.ctx, job.ID)
+		noErr(t, err)
+		if len(annotations) != tc.want {
+			t.Errorf("wrong number of annotations for %s\ngot: %d \nwant: %d", tc.name, len(annotations), tc.want)
+		}
+	}
+
+	if _, err := r.DeleteAnnotation(owner, ids[0]); err != ErrAnnotationForbidden {
+		t.Errorf("annotation of admin deleted by job owner, err: %v", err)
+	}
+}
+
+func TestTrashAndRestore(t *testing.T) {
+	r := setup(t)
+
+	before, err := r.CountJobs(getContext(t), nil)
+	noErr(t, err)
+
+	noErr(t, r.DeleteJobById(5))
+	if _, err := r.FindById(5); err != sql.ErrNoRows {
+		t.Errorf("trashed job found\ngot: %v \nwant: %v", err, sql.ErrNoRows)
+	}
+	if cnt, err := r.CountJobs(getContext(t), nil); err != nil || cnt != before-1 {
+		t.Errorf("wrong job count\ngot: %d \nwant: %d", cnt, before-1)
+	}
+	if err := r.DeleteJobById(5); err != sql.ErrNoRows {
+		t.Errorf("trashed job deleted again\ngot: %v", err)
+	}
+
+	trashed, err := r.FindTrashedBefore(time.Now().Unix() + 1)
+	noErr(t, err)
+	if len(trashed) != 1 || trashed[0].ID != 5 {
+		t.Errorf("wrong trashed jobs\ngot: %d jobs", len(trashed))
+	}
+
+	noErr(t, r.RestoreJobById(5))
+	if _, err := r.FindById(5); err != nil {
+		t.Errorf("restored job not found: %v", err)
+	}
+	if err := r.RestoreJobById(5); err != sql.ErrNoRows {
+		t.Errorf("job restored twice\ngot: %v", err)
+	}
+}
+
+func TestPurgeJobs(t *testing.T) {
+	r := setup(t)
+
+	startTime := time.Now().Unix() - 2*86400
+	trashed := startTestJob(t, r, testJob(9000001, startTime, "f0001"))
+	restored := startTestJob(t, r, testJob(9000002, startTime, "f0001"))
+	noErr(t, r.DeleteJobById(trashed))
+	noErr(t, r.DeleteJobById(restored))
+
+	// Neither compressed, moved nor stopped while in the trash
+	jobs, err := r.FindJobsBetween(0, time.Now().Unix())
+	noErr(t, err)
+	for _, job := range jobs {
+		if job.ID == trashed || job.ID == restored {
+			t.Errorf("trashed job %d found", job.ID)
+		}
+	}
+	noErr(t, r.StopJobsExceedingWalltimeBy(0))
+	var state string
+	noErr(t, r.DB.Get(&state, r.DB.Rebind(`SELECT job_state FROM job WHERE id = ?`), trashed))
+	if state != string(schema.JobStateRunning) {
+		t.Errorf("trashed job stopped\ngot: %s", state)
+	}
+
+	jobs, err = r.FindTrashedBefore(time.Now().Unix() + 1)
+	noErr(t, err)
+	if len(jobs) != 2 {
+		t.Fatalf("wrong trashed jobs\ngot: %d jobs", len(jobs))
+	}
+
+	noErr(t, r.RestoreJobById(restored))
+	ids, err := r.PurgeJobs(jobs)
+	noErr(t, err)
+	if !reflect.DeepEqual(ids, []int64{trashed}) {
+		t.Errorf("wrong purged jobs\ngot: %v \nwant: [%d]", ids, trashed)
+	}
+	if _, err := r.FindById(restored); err != nil {
+		t.Errorf("restored job purged: %v", err)
+	}
+	var count int
+	noErr(t, r.DB.Get(&count, r.DB.Rebind(`SELECT count(*) FROM job WHERE id = ?`), trashed))
+	if count != 0 {
+		t.Errorf("trashed job not purged")
+	}
+}
+
+func TestStopJobsExceedingWalltime(t *testing.T) {
+	r := setup(t)
+	// Runs after the job has been removed
+	t.Cleanup(func() { noErr(t, r.RefreshRollups()) })
+
+	cluster := "fritz"
+	filter := []*model.JobFilter{{Cluster: &model.StringInput{Eq: &cluster}}}
+	before, err := r.JobsStats(getContext(t), filter)
+	noErr(t, err)
+
+	id := startTestJob(t, r, testJob(9000040, time.Now().Unix()-2*86400, "f0001"))
+	noErr(t, r.StopJobsExceedingWalltimeBy(0))
+	job, err := r.FindById(id)
+	noErr(t, err)
+	if job.State != schema.JobStateFailed {
+		t.Errorf("wrong job state\ngot: %s \nwant: %s", job.State, schema.JobStateFailed)
+	}
+
+	// The rollups include the stopped job without a rebuild
+	after, err := r.JobsStats(getContext(t), filter)
+	noErr(t, err)
+	if after[0].TotalJobs != before[0].TotalJobs+1 {
+		t.Errorf("wrong job count\ngot: %d \nwant: %d", after[0].TotalJobs, before[0].TotalJobs+1)
+	}
+}
+
+func TestFindArrayJob(t *testing.T) {
+	r := setup(t)
+
+	for i, flops := range []float64{747.529, 719.977, 1003.895} {
+		job := testJob(9000010+int64(i), 1675957496+int64(i)*60, "f0001")
+		job.ArrayJobId = 398990
+		id := startTestJob(t, r, job)
+
+		state := schema.JobStateCompleted
+		if i == 2 {
+			state = schema.JobStateFailed
+		}
+		noErr(t, r.Stop(id, 60, state, schema.MonitoringStatusArchivingSuccessful))
+		noErr(t, r.MarkArchived(id, schema.MonitoringStatusArchivingSuccessful, map[string]float64{"flops_any_avg": flops}, 0))
+	}
+
+	a, err := r.FindArrayJob(getContext(t), 398990, "fritz")
+	noErr(t, err)
+	if a.NumTasks != 3 || a.StartTime.Unix() != 1675957496 {
+		t.Errorf("wrong array job\ngot: %d tasks, start %d", a.NumTasks, a.StartTime.Unix())
+	}
+	states := map[string]int{}
+	for _, c := range a.States {
+		states[c.Name] = c.Count
+	}
+	if !reflect.DeepEqual(states, map[string]int{"completed": 2, "failed": 1}) {
+		t.Errorf("wrong states\ngot: %v", states)
+	}
+
+	found := false
+	for _, d := range a.Footprint {
+		if d.Metric == "flops_any" {
+			found = true
+			if d.Count != 3 || d.Min != 719.977 || d.Max != 1003.895 {
+				t.Errorf("wrong footprint distribution\ngot: %#v", d)
+			}
+		}
+	}
+	if !found {
+		t.Error("flops_any missing in footprint distribution")
+	}
+
+	if _, err := r.FindArrayJob(getContext(t), 398990, "alex"); err != sql.ErrNoRows {
+		t.Errorf("array job found on the wrong cluster\ngot: %v", err)
+	}
+}
+
+func TestJobNodes(t *testing.T) {
+	r := setup(t)
+
+	var count int
+	noErr(t, r.DB.QueryRow("SELECT count(*) FROM job_node").Scan(&count))
+	if count != 6 {
+		t.Errorf("wrong number of allocated nodes after migration\ngot: %d \nwant: 6", count)
+	}
+
+	// Job 9000020 runs on two nodes and shares t0102 with job 9000021
+	job := testJob(9000020, 1675957496, "t0101")
+	job.NumNodes = 2
+	job.Resources = []*schema.Resource{{Hostname: "t0101", HWThreads: []int{0, 1}}, {Hostname: "t0102"}}
+	id := startTestJob(t, r, job)
+	otherId := startTestJob(t, r, testJob(9000021, 1675957496, "t0102"))
+
+	var hwthreads string
+	noErr(t, r.DB.QueryRow(r.DB.Rebind("SELECT hwthreads FROM job_node WHERE job_id = ? AND hostname = 't0101'"), id).Scan(&hwthreads))
+	if hwthreads != "[0,1]" {
+		t.Errorf("wrong hwthreads\ngot: %s \nwant: [0,1]", hwthreads)
+	}
+
+	allocated, err := r.AllocatedNodes("fritz")
+	noErr(t, err)
+	if !reflect.DeepEqual(allocated, map[string]map[string]int{"main": {"t0101": 1, "t0102": 2}}) {
+		t.Errorf("wrong allocated nodes\ngot: %v", allocated)
+	}
+
+	prefix, host := "t010", "t0102"
+	for _, tc := range []struct {
+		node model.StringInput
+		want int
+	}{
+		{node: model.StringInput{Eq: &prefix}, want: 0},
+		{node: model.StringInput{Eq: &host}, want: 2},
+		{node: model.StringInput{Contains: &prefix}, want: 2},
+	} {
+		jobs, err := r.QueryJobs(getContext(t), []*model.JobFilter{{Node: &tc.node}}, nil, nil)
+		noErr(t, err)
+		if len(jobs) != tc.want {
+			t.Errorf("wrong number of jobs for node filter %#v\ngot: %d \nwant: %d", tc.node, len(jobs), tc.want)
+		}
+	}
+
+	noErr(t, r.Stop(id, 7152, schema.JobStateCompleted, schema.MonitoringStatusArchivingSuccessful))
+	noErr(t, r.Stop(otherId, 1870, schema.JobStateCompleted, schema.MonitoringStatusArchivingSuccessful))
+	found, err := r.FindById(id)
+	noErr(t, err)
+	concurrent, err := r.FindConcurrentJobs(getContext(t), found)
+	noErr(t, err)
+	if *concurrent.Count != 1 || concurrent.Items[0].ID != fmt.Sprint(otherId) {
+		t.Errorf("wrong concurrent jobs\ngot: %d jobs", *concurrent.Count)
 	}
 }
@@ -0,0 +1,75 @@
+// Copyright (C) 2022 NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+package repository
+
+import (
+	"encoding/json"
+
+	"github.com/ClusterCockpit/cc-backend/internal/graph/model"
+	"github.com/ClusterCockpit/cc-backend/pkg/log"
+	"github.com/ClusterCockpit/cc-backend/pkg/schema"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+)
+
+// Adds the nodes allocated to the job with the database id `jobId` to the
+// node allocation index in the job_node table.
+func insertJobNodes(db sqlx.Ext, jobId int64, resources []*schema.Resource) error {
+	seen := make(map[string]bool, len(resources))
+	for _, res := range resources {
+		if seen[res.Hostname] {
+			continue
+		}
+		seen[res.Hostname] = true
+
+		var hwthreads, accelerators *string
+		if res.HWThreads != nil {
+			raw, err := json.Marshal(res.HWThreads)
+			if err != nil {
+				return err
+			}
+			s := string(raw)
+			hwthreads = &s
+		}
+		if res.Accelerators != nil {
+			raw, err := json.Marshal(res.Accelerators)
+			if err != nil {
+				return err
+			}
+			s := string(raw)
+			accelerators = &s
+		}
+
+		if _, err := db.Exec(db.Rebind(`INSERT INTO job_node (job_id, hostname, hwthreads, accelerators) VALUES (?, ?, ?, ?)`),
+			jobId, res.Hostname, hwthreads, accelerators); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Returns the condition for the jobs with an allocated node matching the
+// condition on job_node.hostname.
+func jobNodeCondition(query sq.SelectBuilder) sq.Sqlizer {
+	sql, args, err := query.ToSql()
+	if err != nil {
+		log.Warnf("Error while building node condition: %v", err)
+		return sq.Expr("1=0")
+	}
+
+	return sq.Expr("job.id IN ("+sql+")", args...)
+}
+
+// Returns the condition for the jobs with one of the hosts allocated.
+func jobOnNodes(hosts []string) sq.Sqlizer {
+	return jobNodeCondition(sq.Select("job_node.job_id").From("job_node").Where(sq.Eq{"job_node.hostname": hosts}))
+}
+
+// Returns the condition for the jobs with a hostname of an allocated node
+// matching the string input.
+func jobOnNodesMatching(cond *model.StringInput) sq.Sqlizer {
+	return jobNodeCondition(buildStringCondition("job_node.hostname", cond, sq.Select("job_node.job_id").From("job_node")))
+}
@@ -0,0 +1 @@
+ALTER TABLE job ADD COLUMN energy REAL NOT NULL DEFAULT 0.0;
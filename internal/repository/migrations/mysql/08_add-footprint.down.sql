@@ -0,0 +1,20 @@
+ALTER TABLE job
+    ADD COLUMN mem_used_max REAL NOT NULL DEFAULT 0.0,
+    ADD COLUMN flops_any_avg REAL NOT NULL DEFAULT 0.0,
+    ADD COLUMN mem_bw_avg REAL NOT NULL DEFAULT 0.0,
+    ADD COLUMN load_avg REAL NOT NULL DEFAULT 0.0,
+    ADD COLUMN net_bw_avg REAL NOT NULL DEFAULT 0.0,
+    ADD COLUMN net_data_vol_total REAL NOT NULL DEFAULT 0.0,
+    ADD COLUMN file_bw_avg REAL NOT NULL DEFAULT 0.0,
+    ADD COLUMN file_data_vol_total REAL NOT NULL DEFAULT 0.0;
+
+UPDATE job SET
+    mem_used_max = IFNULL(JSON_EXTRACT(footprint, '$.mem_used_max'), 0.0),
+    flops_any_avg = IFNULL(JSON_EXTRACT(footprint, '$.flops_any_avg'), 0.0),
+    mem_bw_avg = IFNULL(JSON_EXTRACT(footprint, '$.mem_bw_avg'), 0.0),
+    load_avg = IFNULL(JSON_EXTRACT(footprint, '$.cpu_load_avg'), 0.0),
+    net_bw_avg = IFNULL(JSON_EXTRACT(footprint, '$.net_bw_avg'), 0.0),
+    file_bw_avg = IFNULL(JSON_EXTRACT(footprint, '$.file_bw_avg'), 0.0)
+WHERE footprint IS NOT NULL;
+
+ALTER TABLE job DROP COLUMN footprint;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS job_fts (
+    job_id     INTEGER PRIMARY KEY,
+    job_name   TEXT,
+    job_script MEDIUMTEXT,
+    meta_data  TEXT,
+    FULLTEXT (job_name, job_script, meta_data),
+    FOREIGN KEY (job_id) REFERENCES job (id) ON DELETE CASCADE);
+
+INSERT INTO job_fts (job_id, job_name, job_script, meta_data)
+    SELECT id, IFNULL(JSON_UNQUOTE(JSON_EXTRACT(meta_data, '$.jobName')), ''), IFNULL(JSON_UNQUOTE(JSON_EXTRACT(meta_data, '$.jobScript')), ''), ''
+    FROM job WHERE JSON_VALID(meta_data);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS audit_log (
+    id          INTEGER AUTO_INCREMENT PRIMARY KEY,
+    time        BIGINT NOT NULL, -- Unix timestamp
+    actor       VARCHAR(255) NOT NULL,
+    auth_source VARCHAR(255) NOT NULL DEFAULT '',
+    action      VARCHAR(255) NOT NULL,
+    target      VARCHAR(255) NOT NULL,
+    old_value   TEXT, -- JSON
+    new_value   TEXT, -- JSON
+    INDEX audit_log_by_time (time),
+    INDEX audit_log_by_actor (actor, time),
+    INDEX audit_log_by_target (target, time)
+);
@@ -0,0 +1,2 @@
+DROP INDEX jobs_deleted_at ON job;
+ALTER TABLE job DROP COLUMN deleted_at;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS job_rollup_histogram;
+DROP TABLE IF EXISTS job_rollup;
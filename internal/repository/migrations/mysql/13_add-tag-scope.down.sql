@@ -0,0 +1,6 @@
+DELETE FROM tag WHERE tag_scope <> 'global';
+DROP INDEX tags_scope ON tag;
+ALTER TABLE tag DROP INDEX tag_unique;
+ALTER TABLE tag ADD UNIQUE (tag_type, tag_name);
+ALTER TABLE tag DROP COLUMN tag_owner;
+ALTER TABLE tag DROP COLUMN tag_scope;
@@ -0,0 +1,6 @@
+-- An ENUM keeps the unique key below the InnoDB key length limit
+ALTER TABLE tag ADD COLUMN tag_scope ENUM('global', 'project', 'private') NOT NULL DEFAULT 'global';
+ALTER TABLE tag ADD COLUMN tag_owner VARCHAR(255) NOT NULL DEFAULT ''; -- Project of project tags, user of private tags
+ALTER TABLE tag DROP INDEX tag_type;
+ALTER TABLE tag ADD CONSTRAINT tag_unique UNIQUE (tag_type, tag_name, tag_scope, tag_owner);
+CREATE INDEX tags_scope ON tag (tag_scope, tag_owner);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS job_annotation (
+    id           INTEGER AUTO_INCREMENT PRIMARY KEY,
+    job_id       INTEGER NOT NULL,
+    time         BIGINT NOT NULL, -- Unix timestamp
+    author       VARCHAR(255) NOT NULL,
+    visibility   VARCHAR(255) NOT NULL CHECK(visibility IN ('PRIVATE', 'PROJECT', 'SUPPORT')),
+    body         TEXT NOT NULL,
+    metric       VARCHAR(255),    -- Optional metric anchor
+    anchor_start BIGINT,          -- Optional time range anchor, Unix timestamps
+    anchor_stop  BIGINT,
+    INDEX job_annotation_by_job (job_id, time),
+    FOREIGN KEY (job_id) REFERENCES job (id) ON DELETE CASCADE
+);
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS job_step (
+    id         INTEGER AUTO_INCREMENT PRIMARY KEY,
+    job_id     INTEGER NOT NULL,
+    step_id    VARCHAR(255) NOT NULL, -- Scheduler id of the step, e.g. '0' or 'batch'
+    name       VARCHAR(255) NOT NULL DEFAULT '',
+    job_state  VARCHAR(255) NOT NULL CHECK(job_state IN ('running', 'completed', 'failed', 'cancelled',
+                   'stopped', 'timeout', 'preempted', 'out_of_memory')),
+    start_time BIGINT NOT NULL,       -- Unix timestamp
+    stop_time  BIGINT,                -- Unix timestamp, NULL while running
+    exit_code  INTEGER,
+    resources  TEXT NOT NULL,         -- JSON, subset of the job resources
+    UNIQUE (job_id, step_id),
+    FOREIGN KEY (job_id) REFERENCES job (id) ON DELETE CASCADE
+);
@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS node (
+    id           INTEGER AUTO_INCREMENT PRIMARY KEY,
+    hostname     VARCHAR(255) NOT NULL,
+    cluster      VARCHAR(255) NOT NULL,
+    subcluster   VARCHAR(255) NOT NULL,
+    node_state   VARCHAR(255) NOT NULL DEFAULT 'unknown' CHECK(node_state IN ('idle', 'allocated', 'mixed',
+                     'down', 'drain', 'maintenance', 'unknown')),
+    state_reason VARCHAR(255) NOT NULL DEFAULT '',
+    time_stamp   BIGINT NOT NULL DEFAULT 0, -- Unix timestamp of the last state change
+    INDEX node_by_cluster (cluster, subcluster),
+    UNIQUE (hostname, cluster)
+);
+
+CREATE TABLE IF NOT EXISTS node_state_history (
+    id           INTEGER AUTO_INCREMENT PRIMARY KEY,
+    node_id      INTEGER NOT NULL,
+    node_state   VARCHAR(255) NOT NULL CHECK(node_state IN ('idle', 'allocated', 'mixed',
+                     'down', 'drain', 'maintenance', 'unknown')),
+    state_reason VARCHAR(255) NOT NULL DEFAULT '',
+    time_stamp   BIGINT NOT NULL, -- Unix timestamp
+    INDEX node_state_history_by_node (node_id, time_stamp),
+    FOREIGN KEY (node_id) REFERENCES node (id) ON DELETE CASCADE
+);
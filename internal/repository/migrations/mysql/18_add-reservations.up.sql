@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS reservation (
+    id               INTEGER AUTO_INCREMENT PRIMARY KEY,
+    cluster          VARCHAR(255) NOT NULL,
+    nodes            TEXT NOT NULL, -- Node list like 'f[0101-0120],g01'
+    reservation_type VARCHAR(255) NOT NULL CHECK(reservation_type IN ('MAINTENANCE', 'RESERVATION')),
+    description      TEXT NOT NULL,
+    start_time       BIGINT NOT NULL, -- Unix timestamps
+    stop_time        BIGINT NOT NULL,
+    author           VARCHAR(255) NOT NULL,
+    INDEX reservation_by_cluster (cluster, start_time)
+);
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS project (
+    id          INTEGER AUTO_INCREMENT PRIMARY KEY,
+    name        VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL,
+    UNIQUE (name)
+);
+
+CREATE TABLE IF NOT EXISTS project_grant (
+    id            INTEGER AUTO_INCREMENT PRIMARY KEY,
+    project_id    INTEGER NOT NULL,
+    cluster       VARCHAR(255), -- Null if the grant is valid on all clusters
+    resource_type VARCHAR(255) NOT NULL CHECK(resource_type IN ('NODE_HOURS', 'CORE_HOURS', 'ACC_HOURS')),
+    amount        REAL NOT NULL,
+    start_time    BIGINT NOT NULL, -- Period of the grant, Unix timestamps
+    stop_time     BIGINT NOT NULL,
+    INDEX project_grant_by_project (project_id, start_time),
+    FOREIGN KEY (project_id) REFERENCES project (id) ON DELETE CASCADE
+);
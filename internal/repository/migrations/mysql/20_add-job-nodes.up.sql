@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS job_node (
+    job_id       INTEGER NOT NULL,
+    hostname     VARCHAR(255) NOT NULL,
+    hwthreads    TEXT, -- JSON array, null if not given
+    accelerators TEXT, -- JSON array, null if not given
+    PRIMARY KEY (job_id, hostname),
+    INDEX job_node_by_hostname (hostname),
+    FOREIGN KEY (job_id) REFERENCES job (id) ON DELETE CASCADE
+);
+
+INSERT IGNORE INTO job_node (job_id, hostname, hwthreads, accelerators)
+    SELECT job.id, r.hostname, r.hwthreads, r.accelerators
+    FROM job, JSON_TABLE(job.resources, '$[*]' COLUMNS (
+        hostname     VARCHAR(255) PATH '$.hostname',
+        hwthreads    JSON PATH '$.hwthreads',
+        accelerators JSON PATH '$.accelerators')) AS r;
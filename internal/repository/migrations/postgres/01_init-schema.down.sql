@@ -0,0 +1,16 @@
+DROP TABLE IF EXISTS jobtag;
+DROP TABLE IF EXISTS job;
+DROP TABLE IF EXISTS tag;
+DROP TABLE IF EXISTS configuration;
+DROP TABLE IF EXISTS "user";
+DROP TABLE IF EXISTS notifications;
+DROP TABLE IF EXISTS influxdb_configurations;
+DROP TABLE IF EXISTS realtime_logs;
+DROP TABLE IF EXISTS lvm_conf;
+DROP TABLE IF EXISTS machine_conf;
+DROP TABLE IF EXISTS lv_storage_issuer;
+DROP TABLE IF EXISTS logical_volumes;
+DROP TABLE IF EXISTS volume_groups;
+DROP TABLE IF EXISTS physical_volumes;
+DROP TABLE IF EXISTS machines;
+DROP TABLE IF EXISTS file_stash_url;
@@ -0,0 +1,5 @@
+ALTER TABLE job
+    ALTER COLUMN "partition" SET NOT NULL,
+    ALTER COLUMN array_job_id SET NOT NULL,
+    ALTER COLUMN num_hwthreads SET NOT NULL,
+    ALTER COLUMN num_acc SET NOT NULL;
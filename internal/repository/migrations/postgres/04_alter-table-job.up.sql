@@ -0,0 +1,5 @@
+ALTER TABLE job
+    ALTER COLUMN "partition" DROP NOT NULL,
+    ALTER COLUMN array_job_id DROP NOT NULL,
+    ALTER COLUMN num_hwthreads DROP NOT NULL,
+    ALTER COLUMN num_acc DROP NOT NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE tag DROP COLUMN insert_time;
+ALTER TABLE jobtag DROP COLUMN insert_time;
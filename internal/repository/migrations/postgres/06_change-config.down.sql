@@ -0,0 +1 @@
+ALTER TABLE configuration ALTER COLUMN value TYPE VARCHAR(255);
@@ -0,0 +1 @@
+ALTER TABLE job ADD COLUMN energy DOUBLE PRECISION NOT NULL DEFAULT 0.0;
@@ -0,0 +1,20 @@
+ALTER TABLE job
+    ADD COLUMN mem_used_max DOUBLE PRECISION NOT NULL DEFAULT 0.0,
+    ADD COLUMN flops_any_avg DOUBLE PRECISION NOT NULL DEFAULT 0.0,
+    ADD COLUMN mem_bw_avg DOUBLE PRECISION NOT NULL DEFAULT 0.0,
+    ADD COLUMN load_avg DOUBLE PRECISION NOT NULL DEFAULT 0.0,
+    ADD COLUMN net_bw_avg DOUBLE PRECISION NOT NULL DEFAULT 0.0,
+    ADD COLUMN net_data_vol_total DOUBLE PRECISION NOT NULL DEFAULT 0.0,
+    ADD COLUMN file_bw_avg DOUBLE PRECISION NOT NULL DEFAULT 0.0,
+    ADD COLUMN file_data_vol_total DOUBLE PRECISION NOT NULL DEFAULT 0.0;
+
+UPDATE job SET
+    mem_used_max = COALESCE((footprint->>'mem_used_max')::DOUBLE PRECISION, 0.0),
+    flops_any_avg = COALESCE((footprint->>'flops_any_avg')::DOUBLE PRECISION, 0.0),
+    mem_bw_avg = COALESCE((footprint->>'mem_bw_avg')::DOUBLE PRECISION, 0.0),
+    load_avg = COALESCE((footprint->>'cpu_load_avg')::DOUBLE PRECISION, 0.0),
+    net_bw_avg = COALESCE((footprint->>'net_bw_avg')::DOUBLE PRECISION, 0.0),
+    file_bw_avg = COALESCE((footprint->>'file_bw_avg')::DOUBLE PRECISION, 0.0)
+WHERE footprint IS NOT NULL;
+
+ALTER TABLE job DROP COLUMN footprint;
@@ -0,0 +1,19 @@
+ALTER TABLE job ADD COLUMN footprint JSON DEFAULT NULL;
+UPDATE job SET footprint = json_build_object(
+    'cpu_load_avg', load_avg,
+    'flops_any_avg', flops_any_avg,
+    'mem_bw_avg', mem_bw_avg,
+    'mem_used_max', mem_used_max,
+    'net_bw_avg', net_bw_avg,
+    'file_bw_avg', file_bw_avg
+);
+
+ALTER TABLE job
+    DROP COLUMN mem_used_max,
+    DROP COLUMN flops_any_avg,
+    DROP COLUMN mem_bw_avg,
+    DROP COLUMN load_avg,
+    DROP COLUMN net_bw_avg,
+    DROP COLUMN net_data_vol_total,
+    DROP COLUMN file_bw_avg,
+    DROP COLUMN file_data_vol_total;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS job_fts (
+    job_id   INTEGER PRIMARY KEY REFERENCES job (id) ON DELETE CASCADE,
+    document TSVECTOR NOT NULL);
+
+CREATE INDEX IF NOT EXISTS job_fts_document ON job_fts USING GIN (document);
+
+-- Metadata is always written as a JSON object
+INSERT INTO job_fts (job_id, document)
+    SELECT id,
+        setweight(to_tsvector('simple', COALESCE(meta_data::json->>'jobName', '')), 'A') ||
+        setweight(to_tsvector('simple', COALESCE(meta_data::json->>'jobScript', '')), 'B')
+    FROM job WHERE meta_data LIKE '{%}';
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS jobs_deleted_at;
+ALTER TABLE job DROP COLUMN deleted_at;
@@ -0,0 +1,2 @@
+ALTER TABLE job ADD COLUMN deleted_at BIGINT DEFAULT NULL; -- Unix timestamp, NULL if not trashed
+CREATE INDEX jobs_deleted_at ON job (deleted_at);
@@ -0,0 +1,6 @@
+DELETE FROM tag WHERE tag_scope <> 'global';
+DROP INDEX IF EXISTS tags_scope;
+ALTER TABLE tag DROP CONSTRAINT tag_unique;
+ALTER TABLE tag ADD CONSTRAINT tag_tag_type_tag_name_key UNIQUE (tag_type, tag_name);
+ALTER TABLE tag DROP COLUMN tag_owner;
+ALTER TABLE tag DROP COLUMN tag_scope;
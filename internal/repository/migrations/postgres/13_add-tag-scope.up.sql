@@ -0,0 +1,5 @@
+ALTER TABLE tag ADD COLUMN tag_scope VARCHAR(255) NOT NULL DEFAULT 'global' CHECK(tag_scope IN ('global', 'project', 'private'));
+ALTER TABLE tag ADD COLUMN tag_owner VARCHAR(255) NOT NULL DEFAULT ''; -- Project of project tags, user of private tags
+ALTER TABLE tag DROP CONSTRAINT tag_tag_type_tag_name_key;
+ALTER TABLE tag ADD CONSTRAINT tag_unique UNIQUE (tag_type, tag_name, tag_scope, tag_owner);
+CREATE INDEX tags_scope ON tag (tag_scope, tag_owner);
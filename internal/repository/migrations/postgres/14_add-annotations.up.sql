@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS job_annotation (
+    id           SERIAL PRIMARY KEY,
+    job_id       INTEGER NOT NULL,
+    time         BIGINT NOT NULL, -- Unix timestamp
+    author       VARCHAR(255) NOT NULL,
+    visibility   VARCHAR(255) NOT NULL CHECK(visibility IN ('PRIVATE', 'PROJECT', 'SUPPORT')),
+    body         TEXT NOT NULL,
+    metric       VARCHAR(255),    -- Optional metric anchor
+    anchor_start BIGINT,          -- Optional time range anchor, Unix timestamps
+    anchor_stop  BIGINT,
+    FOREIGN KEY (job_id) REFERENCES job (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS job_annotation_by_job ON job_annotation (job_id, time);
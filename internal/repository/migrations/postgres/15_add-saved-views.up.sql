@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS saved_view (
+    id       SERIAL PRIMARY KEY,
+    name     VARCHAR(255) NOT NULL,
+    owner    VARCHAR(255) NOT NULL,
+    scope    VARCHAR(255) NOT NULL DEFAULT 'PRIVATE' CHECK(scope IN ('PRIVATE', 'PROJECT', 'GLOBAL')),
+    project  VARCHAR(255) NOT NULL DEFAULT '', -- Project the view is shared with
+    filter   TEXT NOT NULL, -- JSON
+    ordering TEXT,          -- JSON
+    metrics  TEXT,          -- JSON
+    time     BIGINT NOT NULL -- Unix timestamp of the last change
+);
+
+CREATE INDEX IF NOT EXISTS saved_view_by_owner ON saved_view (owner);
+CREATE INDEX IF NOT EXISTS saved_view_by_scope ON saved_view (scope, project);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS reservation (
+    id               SERIAL PRIMARY KEY,
+    cluster          VARCHAR(255) NOT NULL,
+    nodes            TEXT NOT NULL, -- Node list like 'f[0101-0120],g01'
+    reservation_type VARCHAR(255) NOT NULL CHECK(reservation_type IN ('MAINTENANCE', 'RESERVATION')),
+    description      TEXT NOT NULL,
+    start_time       BIGINT NOT NULL, -- Unix timestamps
+    stop_time        BIGINT NOT NULL,
+    author           VARCHAR(255) NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS reservation_by_cluster ON reservation (cluster, start_time);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS job_node (
+    job_id       INTEGER NOT NULL,
+    hostname     VARCHAR(255) NOT NULL,
+    hwthreads    TEXT, -- JSON array, null if not given
+    accelerators TEXT, -- JSON array, null if not given
+    PRIMARY KEY (job_id, hostname),
+    FOREIGN KEY (job_id) REFERENCES job (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS job_node_by_hostname ON job_node (hostname);
+
+INSERT INTO job_node (job_id, hostname, hwthreads, accelerators)
+    SELECT job.id, r->>'hostname', (r->'hwthreads')::text, (r->'accelerators')::text
+    FROM job, json_array_elements(job.resources::json) AS r
+    ON CONFLICT DO NOTHING;
@@ -0,0 +1,19 @@
+ALTER TABLE job ADD COLUMN mem_used_max REAL NOT NULL DEFAULT 0.0;
+ALTER TABLE job ADD COLUMN flops_any_avg REAL NOT NULL DEFAULT 0.0;
+ALTER TABLE job ADD COLUMN mem_bw_avg REAL NOT NULL DEFAULT 0.0;
+ALTER TABLE job ADD COLUMN load_avg REAL NOT NULL DEFAULT 0.0;
+ALTER TABLE job ADD COLUMN net_bw_avg REAL NOT NULL DEFAULT 0.0;
+ALTER TABLE job ADD COLUMN net_data_vol_total REAL NOT NULL DEFAULT 0.0;
+ALTER TABLE job ADD COLUMN file_bw_avg REAL NOT NULL DEFAULT 0.0;
+ALTER TABLE job ADD COLUMN file_data_vol_total REAL NOT NULL DEFAULT 0.0;
+
+UPDATE job SET
+    mem_used_max = IFNULL(json_extract(footprint, '$.mem_used_max'), 0.0),
+    flops_any_avg = IFNULL(json_extract(footprint, '$.flops_any_avg'), 0.0),
+    mem_bw_avg = IFNULL(json_extract(footprint, '$.mem_bw_avg'), 0.0),
+    load_avg = IFNULL(json_extract(footprint, '$.cpu_load_avg'), 0.0),
+    net_bw_avg = IFNULL(json_extract(footprint, '$.net_bw_avg'), 0.0),
+    file_bw_avg = IFNULL(json_extract(footprint, '$.file_bw_avg'), 0.0)
+WHERE footprint IS NOT NULL;
+
+ALTER TABLE job DROP COLUMN footprint;
@@ -0,0 +1,18 @@
+ALTER TABLE job ADD COLUMN footprint TEXT DEFAULT NULL;
+UPDATE job SET footprint = json_object(
+    'cpu_load_avg', load_avg,
+    'flops_any_avg', flops_any_avg,
+    'mem_bw_avg', mem_bw_avg,
+    'mem_used_max', mem_used_max,
+    'net_bw_avg', net_bw_avg,
+    'file_bw_avg', file_bw_avg
+);
+
+ALTER TABLE job DROP COLUMN mem_used_max;
+ALTER TABLE job DROP COLUMN flops_any_avg;
+ALTER TABLE job DROP COLUMN mem_bw_avg;
+ALTER TABLE job DROP COLUMN load_avg;
+ALTER TABLE job DROP COLUMN net_bw_avg;
+ALTER TABLE job DROP COLUMN net_data_vol_total;
+ALTER TABLE job DROP COLUMN file_bw_avg;
+ALTER TABLE job DROP COLUMN file_data_vol_total;
@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS job_fts_delete;
+DROP TABLE IF EXISTS job_fts;
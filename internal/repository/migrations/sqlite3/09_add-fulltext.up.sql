@@ -0,0 +1,10 @@
+CREATE VIRTUAL TABLE IF NOT EXISTS job_fts USING fts4(job_name, job_script, meta_data);
+
+INSERT INTO job_fts (docid, job_name, job_script, meta_data)
+    SELECT id, IFNULL(json_extract(meta_data, '$.jobName'), ''), IFNULL(json_extract(meta_data, '$.jobScript'), ''), ''
+    FROM job WHERE json_valid(meta_data);
+
+CREATE TRIGGER IF NOT EXISTS job_fts_delete AFTER DELETE ON job
+BEGIN
+    DELETE FROM job_fts WHERE docid = old.id;
+END;
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS audit_log (
+    id          INTEGER PRIMARY KEY,
+    time        BIGINT NOT NULL, -- Unix timestamp
+    actor       VARCHAR(255) NOT NULL,
+    auth_source VARCHAR(255) NOT NULL DEFAULT '',
+    action      VARCHAR(255) NOT NULL,
+    target      VARCHAR(255) NOT NULL,
+    old_value   TEXT, -- JSON
+    new_value   TEXT  -- JSON
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_by_time   ON audit_log (time);
+CREATE INDEX IF NOT EXISTS audit_log_by_actor  ON audit_log (actor, time);
+CREATE INDEX IF NOT EXISTS audit_log_by_target ON audit_log (target, time);
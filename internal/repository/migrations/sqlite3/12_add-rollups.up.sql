@@ -0,0 +1,30 @@
+-- Daily usage of finished jobs, by the UTC day the jobs started
+CREATE TABLE IF NOT EXISTS job_rollup (
+    day          BIGINT NOT NULL, -- Unix timestamp
+    cluster      VARCHAR(255) NOT NULL,
+    partition    VARCHAR(255) NOT NULL,
+    user         VARCHAR(255) NOT NULL,
+    project      VARCHAR(255) NOT NULL,
+    jobs         BIGINT NOT NULL,
+    short_jobs   BIGINT NOT NULL,
+    walltime     BIGINT NOT NULL, -- seconds
+    nodes        BIGINT NOT NULL,
+    node_seconds BIGINT NOT NULL,
+    cores        BIGINT NOT NULL,
+    core_seconds BIGINT NOT NULL,
+    accs         BIGINT NOT NULL,
+    acc_seconds  BIGINT NOT NULL,
+    energy       REAL NOT NULL,
+    PRIMARY KEY (day, cluster, partition, user, project));
+
+-- Histograms of duration (hours), nodes, cores and accelerators
+CREATE TABLE IF NOT EXISTS job_rollup_histogram (
+    day          BIGINT NOT NULL, -- Unix timestamp
+    cluster      VARCHAR(255) NOT NULL,
+    partition    VARCHAR(255) NOT NULL,
+    user         VARCHAR(255) NOT NULL,
+    project      VARCHAR(255) NOT NULL,
+    kind         VARCHAR(16) NOT NULL,
+    value        BIGINT NOT NULL,
+    count        BIGINT NOT NULL,
+    PRIMARY KEY (day, cluster, partition, user, project, kind, value));
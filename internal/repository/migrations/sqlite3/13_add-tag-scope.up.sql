@@ -0,0 +1,30 @@
+-- The unique constraint of the tag table has to include the scope and the
+-- owner, which requires rebuilding the table. The job tags are copied aside,
+-- as dropping the tag table would delete them by cascade.
+CREATE TABLE tag_new (
+id        INTEGER PRIMARY KEY,
+tag_type  VARCHAR(255) NOT NULL,
+tag_name  VARCHAR(255) NOT NULL,
+insert_ts TEXT DEFAULT CURRENT_TIMESTAMP,
+tag_scope VARCHAR(255) NOT NULL DEFAULT 'global' CHECK(tag_scope IN ('global', 'project', 'private')),
+tag_owner VARCHAR(255) NOT NULL DEFAULT '', -- Project of project tags, user of private tags
+UNIQUE (tag_type, tag_name, tag_scope, tag_owner));
+
+INSERT INTO tag_new (id, tag_type, tag_name, insert_ts) SELECT id, tag_type, tag_name, insert_ts FROM tag;
+CREATE TABLE jobtag_old AS SELECT job_id, tag_id, insert_ts FROM jobtag;
+DROP TABLE jobtag;
+DROP TABLE tag;
+ALTER TABLE tag_new RENAME TO tag;
+
+CREATE TABLE jobtag (
+job_id    INTEGER,
+tag_id    INTEGER,
+insert_ts TEXT DEFAULT CURRENT_TIMESTAMP,
+PRIMARY KEY (job_id, tag_id),
+FOREIGN KEY (job_id) REFERENCES job (id) ON DELETE CASCADE,
+FOREIGN KEY (tag_id) REFERENCES tag (id) ON DELETE CASCADE);
+
+INSERT INTO jobtag (job_id, tag_id, insert_ts) SELECT job_id, tag_id, insert_ts FROM jobtag_old;
+DROP TABLE jobtag_old;
+
+CREATE INDEX tags_scope ON tag (tag_scope, tag_owner);
@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS node (
+    id           INTEGER PRIMARY KEY,
+    hostname     VARCHAR(255) NOT NULL,
+    cluster      VARCHAR(255) NOT NULL,
+    subcluster   VARCHAR(255) NOT NULL,
+    node_state   VARCHAR(255) NOT NULL DEFAULT 'unknown' CHECK(node_state IN ('idle', 'allocated', 'mixed',
+                     'down', 'drain', 'maintenance', 'unknown')),
+    state_reason VARCHAR(255) NOT NULL DEFAULT '',
+    time_stamp   BIGINT NOT NULL DEFAULT 0, -- Unix timestamp of the last state change
+    UNIQUE (hostname, cluster)
+);
+
+CREATE INDEX IF NOT EXISTS node_by_cluster ON node (cluster, subcluster);
+
+CREATE TABLE IF NOT EXISTS node_state_history (
+    id           INTEGER PRIMARY KEY,
+    node_id      INTEGER NOT NULL,
+    node_state   VARCHAR(255) NOT NULL CHECK(node_state IN ('idle', 'allocated', 'mixed',
+                     'down', 'drain', 'maintenance', 'unknown')),
+    state_reason VARCHAR(255) NOT NULL DEFAULT '',
+    time_stamp   BIGINT NOT NULL, -- Unix timestamp
+    FOREIGN KEY (node_id) REFERENCES node (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS node_state_history_by_node ON node_state_history (node_id, time_stamp);
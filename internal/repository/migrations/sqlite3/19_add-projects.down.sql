@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS project_grant;
+DROP TABLE IF EXISTS project;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS job_node (
+    job_id       INTEGER NOT NULL,
+    hostname     VARCHAR(255) NOT NULL,
+    hwthreads    TEXT, -- JSON array, null if not given
+    accelerators TEXT, -- JSON array, null if not given
+    PRIMARY KEY (job_id, hostname),
+    FOREIGN KEY (job_id) REFERENCES job (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS job_node_by_hostname ON job_node (hostname);
+
+INSERT OR IGNORE INTO job_node (job_id, hostname, hwthreads, accelerators)
+    SELECT job.id, json_extract(r.value, '$.hostname'), json_extract(r.value, '$.hwthreads'),
+        json_extract(r.value, '$.accelerators')
+    FROM job, json_each(job.resources) AS r;
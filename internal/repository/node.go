@@ -0,0 +1,280 @@
+// Copyright (C) 2022 NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ClusterCockpit/cc-backend/internal/graph/model"
+	"github.com/ClusterCockpit/cc-backend/pkg/archive"
+	"github.com/ClusterCockpit/cc-backend/pkg/log"
+	"github.com/ClusterCockpit/cc-backend/pkg/schema"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	nodeRepoOnce     sync.Once
+	nodeRepoInstance *NodeRepository
+)
+
+type NodeRepository struct {
+	DB      *sqlx.DB
+	driver  string
+	builder sq.StatementBuilderType
+}
+
+func GetNodeRepository() *NodeRepository {
+	nodeRepoOnce.Do(func() {
+		db := GetConnection()
+
+		nodeRepoInstance = &NodeRepository{
+			DB:      db.DB,
+			driver:  db.Driver,
+			builder: db.Builder,
+		}
+	})
+	return nodeRepoInstance
+}
+
+// NodeStateReport is the state of a node as reported by the resource manager.
+type NodeStateReport struct {
+	Hostname string           `json:"hostname" example:"f0101"`
+	State    schema.NodeState `json:"state" example:"idle"`
+	Reason   string           `json:"reason,omitempty" example:"Kernel update"` // Reason for down, drain and maintenance states
+}
+
+// SyncNodes adds the nodes of the subcluster node lists to the registry and
+// moves nodes listed under another subcluster. Nodes no longer listed are
+// kept together with their state history. Subclusters with invalid node lists
+// are skipped.
+func (r *NodeRepository) SyncNodes(clusters []*schema.Cluster) error {
+	for _, cluster := range clusters {
+		known := make(map[string]string)
+		rows, err := r.builder.Select("node.hostname", "node.subcluster").From("node").
+			Where("node.cluster = ?", cluster.Name).RunWith(r.DB).Query()
+		if err != nil {
+			log.Error("Error while running query")
+			return err
+		}
+		for rows.Next() {
+			var hostname, subcluster string
+			if err := rows.Scan(&hostname, &subcluster); err != nil {
+				rows.Close()
+				log.Warn("Error while scanning rows")
+				return err
+			}
+			known[hostname] = subcluster
+		}
+		rows.Close()
+
+		tx, err := r.DB.Beginx()
+		if err != nil {
+			return err
+		}
+		for _, sc := range cluster.SubClusters {
+			if sc.Nodes == "" {
+				continue
+			}
+			nl, err := archive.ParseNodeList(sc.Nodes)
+			if err != nil {
+				log.Errorf("Skipping nodes of subcluster %s/%s with invalid node list: %v", cluster.Name, sc.Name, err)
+				continue
+			}
+
+			for _, hostname := range nl.PrintList() {
+				subcluster, ok := known[hostname]
+				if !ok {
+					_, err = tx.Exec(tx.Rebind(`INSERT INTO node (hostname, cluster, subcluster) VALUES (?, ?, ?)`),
+						hostname, cluster.Name, sc.Name)
+				} else if subcluster != sc.Name {
+					_, err = tx.Exec(tx.Rebind(`UPDATE node SET subcluster = ? WHERE hostname = ? AND cluster = ?`),
+						sc.Name, hostname, cluster.Name)
+				}
+				if err != nil {
+					tx.Rollback()
+					log.Errorf("Error while registering node %s of cluster %s: %v", hostname, cluster.Name, err)
+					return err
+				}
+				known[hostname] = sc.Name
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UpdateNodeStates records the reported states of nodes of the cluster at
+// time `t`. A change of the state or the reason is added to the state history.
+// Nodes missing in the registry are added if they belong to a subcluster.
+func (r *NodeRepository) UpdateNodeStates(cluster string, reports []*NodeStateReport, t time.Time) error {
+	for _, report := range reports {
+		if !report.State.Valid() {
+			return fmt.Errorf("REPOSITORY/NODE > invalid state '%s' of node %s", report.State, report.Hostname)
+		}
+	}
+
+	tx, err := r.DB.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, report := range reports {
+		var id int64
+		var state schema.NodeState
+		var reason string
+		err := tx.QueryRowx(tx.Rebind(`SELECT id, node_state, state_reason FROM node WHERE hostname = ? AND cluster = ?`),
+			report.Hostname, cluster).Scan(&id, &state, &reason)
+		if err == sql.ErrNoRows {
+			subcluster, err := archive.GetSubClusterByNode(cluster, report.Hostname)
+			if err != nil {
+				return fmt.Errorf("REPOSITORY/NODE > unknown node %s: %w", report.Hostname, err)
+			}
+			id, err = insertReturningId(tx, r.driver, `INSERT INTO node (hostname, cluster, subcluster) VALUES (?, ?, ?)`,
+				report.Hostname, cluster, subcluster)
+			if err != nil {
+				log.Errorf("Error while registering node %s of cluster %s: %v", report.Hostname, cluster, err)
+				return err
+			}
+			state = schema.NodeStateUnknown
+		} else if err != nil {
+			log.Warn("Error while scanning node")
+			return err
+		}
+
+		if state == report.State && reason == report.Reason {
+			continue
+		}
+
+		if _, err := tx.Exec(tx.Rebind(`UPDATE node SET node_state = ?, state_reason = ?, time_stamp = ? WHERE id = ?`),
+			report.State, report.Reason, t.Unix(), id); err != nil {
+			log.Errorf("Error while updating state of node %s: %v", report.Hostname, err)
+			return err
+		}
+		if _, err := tx.Exec(tx.Rebind(`INSERT INTO node_state_history (node_id, node_state, state_reason, time_stamp) VALUES (?, ?, ?, ?)`),
+			id, report.State, report.Reason, t.Unix()); err != nil {
+			log.Errorf("Error while adding state history of node %s: %v", report.Hostname, err)
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetNodes returns the nodes of the cluster, optionally restricted to a
+// subcluster, ordered by hostname.
+func (r *NodeRepository) GetNodes(cluster string, subCluster *string) ([]*model.Node, error) {
+	query := r.builder.Select("node.id", "node.hostname", "node.cluster", "node.subcluster", "node.node_state",
+		"node.state_reason", "node.time_stamp").From("node").
+		Where("node.cluster = ?", cluster).
+		OrderBy("node.hostname")
+	if subCluster != nil {
+		query = query.Where("node.subcluster = ?", *subCluster)
+	}
+
+	rows, err := query.RunWith(r.DB).Query()
+	if err != nil {
+		log.Error("Error while running query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	nodes := make([]*model.Node, 0)
+	for rows.Next() {
+		var ts int64
+		n := &model.Node{}
+		if err := rows.Scan(&n.ID, &n.Hostname, &n.Cluster, &n.SubCluster, &n.State, &n.Reason, &ts); err != nil {
+			log.Warn("Error while scanning rows")
+			return nil, err
+		}
+		if ts != 0 {
+			since := time.Unix(ts, 0)
+			n.Since = &since
+		}
+		nodes = append(nodes, n)
+	}
+
+	return nodes, rows.Err()
+}
+
+// CountNodeStates returns the number of nodes per state for every subcluster
+// of the cluster.
+func (r *NodeRepository) CountNodeStates(cluster string) ([]*model.NodeStatesCount, error) {
+	rows, err := r.builder.Select("node.subcluster", "node.node_state", "count(*)").From("node").
+		Where("node.cluster = ?", cluster).
+		GroupBy("node.subcluster", "node.node_state").
+		OrderBy("node.subcluster", "node.node_state").
+		RunWith(r.DB).Query()
+	if err != nil {
+		log.Error("Error while running query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make([]*model.NodeStatesCount, 0)
+	for rows.Next() {
+		var subcluster, state string
+		var count int
+		if err := rows.Scan(&subcluster, &state, &count); err != nil {
+			log.Warn("Error while scanning rows")
+			return nil, err
+		}
+
+		if len(counts) == 0 || counts[len(counts)-1].SubCluster != subcluster {
+			counts = append(counts, &model.NodeStatesCount{SubCluster: subcluster, States: make([]*model.Count, 0)})
+		}
+		c := counts[len(counts)-1]
+		c.States = append(c.States, &model.Count{Name: state, Count: count})
+	}
+
+	return counts, rows.Err()
+}
+
+// GetNodeStateHistory returns the state changes of the nodes of the cluster
+// between `from` and `to`, optionally restricted to a subcluster or a node,
+// oldest first.
+func (r *NodeRepository) GetNodeStateHistory(cluster string, subCluster, hostname *string, from, to time.Time) ([]*model.NodeStateChange, error) {
+	query := r.builder.Select("node.hostname", "node_state_history.node_state", "node_state_history.state_reason",
+		"node_state_history.time_stamp").
+		From("node_state_history").
+		Join("node ON node.id = node_state_history.node_id").
+		Where("node.cluster = ?", cluster).
+		Where("node_state_history.time_stamp BETWEEN ? AND ?", from.Unix(), to.Unix()).
+		OrderBy("node_state_history.time_stamp", "node_state_history.id")
+	if subCluster != nil {
+		query = query.Where("node.subcluster = ?", *subCluster)
+	}
+	if hostname != nil {
+		query = query.Where("node.hostname = ?", *hostname)
+	}
+
+	rows, err := query.RunWith(r.DB).Query()
+	if err != nil {
+		log.Error("Error while running query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := make([]*model.NodeStateChange, 0)
+	for rows.Next() {
+		var ts int64
+		c := &model.NodeStateChange{}
+		if err := rows.Scan(&c.Hostname, &c.State, &c.Reason, &ts); err != nil {
+			log.Warn("Error while scanning rows")
+			return nil, err
+		}
+		c.Time = time.Unix(ts, 0)
+		changes = append(changes, c)
+	}
+
+	return changes, rows.Err()
+}
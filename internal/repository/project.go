@@ -0,0 +1,441 @@
+// Copyright (C) 2022 NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ClusterCockpit/cc-backend/internal/graph/model"
+	"github.com/ClusterCockpit/cc-backend/pkg/log"
+	"github.com/ClusterCockpit/cc-backend/pkg/schema"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	projectRepoOnce     sync.Once
+	projectRepoInstance *ProjectRepository
+)
+
+var ErrProjectForbidden = errors.New("REPOSITORY/PROJECT > not allowed to view this project")
+
+// Maximum number of points of a burn-down series.
+const maxBurnDownPoints = 10000
+
+type ProjectRepository struct {
+	DB      *sqlx.DB
+	driver  string
+	builder sq.StatementBuilderType
+}
+
+func GetProjectRepository() *ProjectRepository {
+	projectRepoOnce.Do(func() {
+		db := GetConnection()
+
+		projectRepoInstance = &ProjectRepository{
+			DB:      db.DB,
+			driver:  db.Driver,
+			builder: db.Builder,
+		}
+	})
+	return projectRepoInstance
+}
+
+// Returns the condition for the projects visible to the user: admins and
+// support staff see all projects, managers the projects they manage.
+func projectVisibility(user *schema.User) (sq.Sqlizer, error) {
+	if user == nil || user.HasAnyRole([]schema.Role{schema.RoleAdmin, schema.RoleSupport}) {
+		return sq.Expr("1=1"), nil
+	}
+	if user.HasRole(schema.RoleManager) {
+		return sq.Eq{"project.name": user.Projects}, nil
+	}
+
+	return nil, ErrProjectForbidden
+}
+
+func (r *ProjectRepository) selectProjects() sq.SelectBuilder {
+	return r.builder.Select("project.id", "project.name", "project.description").From("project")
+}
+
+// GetProjects returns the projects visible to the user in the context ordered by name.
+func (r *ProjectRepository) GetProjects(ctx context.Context) ([]*model.Project, error) {
+	cond, err := projectVisibility(GetUserFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.selectProjects().Where(cond).OrderBy("project.name").RunWith(r.DB).Query()
+	if err != nil {
+		log.Error("Error while running query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	projects := make([]*model.Project, 0)
+	for rows.Next() {
+		p := &model.Project{}
+		if err := rows.Scan(&p.ID, &p.Name, &p.Description); err != nil {
+			log.Warn("Error while scanning rows")
+			return nil, err
+		}
+		projects = append(projects, p)
+	}
+
+	return projects, rows.Err()
+}
+
+// GetProject returns the project `name` if it is visible to the user in the context.
+func (r *ProjectRepository) GetProject(ctx context.Context, name string) (*model.Project, error) {
+	cond, err := projectVisibility(GetUserFromContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	p := &model.Project{}
+	if err := r.selectProjects().Where("project.name = ?", name).Where(cond).
+		RunWith(r.DB).QueryRow().Scan(&p.ID, &p.Name, &p.Description); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// SaveProject creates the project `name` if it does not exist, otherwise the
+// description is updated if given.
+func (r *ProjectRepository) SaveProject(name string, description *string) (*model.Project, error) {
+	if name == "" {
+		return nil, errors.New("REPOSITORY/PROJECT > name must not be empty")
+	}
+
+	p, err := r.GetProject(context.Background(), name)
+	if err == sql.ErrNoRows {
+		p = &model.Project{Name: name}
+		if description != nil {
+			p.Description = *description
+		}
+		p.ID, err = insertReturningId(r.DB, r.driver, `INSERT INTO project (name, description) VALUES (?, ?)`,
+			p.Name, p.Description)
+		if err != nil {
+			log.Errorf("Error while inserting project %s: %v", name, err)
+			return nil, err
+		}
+		return p, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if description != nil {
+		if _, err := r.builder.Update("project").Set("description", *description).
+			Where("project.id = ?", p.ID).RunWith(r.DB).Exec(); err != nil {
+			log.Errorf("Error while updating project %s: %v", name, err)
+			return nil, err
+		}
+		p.Description = *description
+	}
+
+	return p, nil
+}
+
+// DeleteProject deletes the project `name` together with its grants. Jobs of
+// the project are not affected.
+func (r *ProjectRepository) DeleteProject(name string) (*model.Project, error) {
+	p, err := r.GetProject(context.Background(), name)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := r.builder.Delete("project").Where("project.id = ?", p.ID).RunWith(r.DB).Exec(); err != nil {
+		log.Errorf("Error while deleting project %s: %v", name, err)
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func scanGrant(row interface{ Scan(...interface{}) error }) (*model.ProjectGrant, error) {
+	var from, to int64
+	var cluster sql.NullString
+	g := &model.ProjectGrant{}
+	if err := row.Scan(&g.ID, &g.Project, &cluster, &g.Resource, &g.Amount, &from, &to); err != nil {
+		return nil, err
+	}
+
+	if cluster.Valid {
+		g.Cluster = &cluster.String
+	}
+	g.From, g.To = time.Unix(from, 0), time.Unix(to, 0)
+	return g, nil
+}
+
+func (r *ProjectRepository) selectGrants() sq.SelectBuilder {
+	return r.builder.Select("project_grant.id", "project.name", "project_grant.cluster", "project_grant.resource_type",
+		"project_grant.amount", "project_grant.start_time", "project_grant.stop_time").
+		From("project_grant").
+		Join("project ON project.id = project_grant.project_id")
+}
+
+// GetGrants returns the grants of the project with the database id
+// `projectId` with their consumption, ordered by the begin of the period.
+func (r *ProjectRepository) GetGrants(projectId int64) ([]*model.ProjectGrant, error) {
+	rows, err := r.selectGrants().Where("project_grant.project_id = ?", projectId).
+		OrderBy("project_grant.start_time", "project_grant.id").
+		RunWith(r.DB).Query()
+	if err != nil {
+		log.Error("Error while running query")
+		return nil, err
+	}
+
+	grants := make([]*model.ProjectGrant, 0)
+	for rows.Next() {
+		g, err := scanGrant(rows)
+		if err != nil {
+			rows.Close()
+			log.Warn("Error while scanning rows")
+			return nil, err
+		}
+		grants = append(grants, g)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, g := range grants {
+		if g.Consumed, err = r.consumption(g); err != nil {
+			return nil, err
+		}
+	}
+
+	return grants, nil
+}
+
+// GetGrant returns the grant with the database id `id` with its consumption
+// without any permission checks.
+func (r *ProjectRepository) GetGrant(id int64) (*model.ProjectGrant, error) {
+	g, err := scanGrant(r.selectGrants().Where("project_grant.id = ?", id).RunWith(r.DB).QueryRow())
+	if err != nil {
+		return nil, err
+	}
+
+	if g.Consumed, err = r.consumption(g); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// SaveGrant adds a new grant to the project if `id` is nil, otherwise it
+// replaces the grant with the database id `id`.
+func (r *ProjectRepository) SaveGrant(id *int64, project string, input *model.ProjectGrantInput) (*model.ProjectGrant, error) {
+	if !input.Resource.IsValid() {
+		return nil, fmt.Errorf("REPOSITORY/PROJECT > invalid resource '%s'", input.Resource)
+	}
+	if input.Amount < 0 {
+		return nil, errors.New("REPOSITORY/PROJECT > amount must not be negative")
+	}
+	if !input.To.After(input.From) {
+		return nil, errors.New("REPOSITORY/PROJECT > grant period ends before it starts")
+	}
+	if input.Cluster != nil && *input.Cluster == "" {
+		input.Cluster = nil
+	}
+
+	p, err := r.GetProject(context.Background(), project)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &model.ProjectGrant{
+		Project:  p.Name,
+		Cluster:  input.Cluster,
+		Resource: input.Resource,
+		Amount:   input.Amount,
+		From:     time.Unix(input.From.Unix(), 0),
+		To:       time.Unix(input.To.Unix(), 0),
+	}
+
+	if id == nil {
+		g.ID, err = insertReturningId(r.DB, r.driver, `INSERT INTO project_grant
+			(project_id, cluster, resource_type, amount, start_time, stop_time) VALUES (?, ?, ?, ?, ?, ?)`,
+			p.ID, g.Cluster, g.Resource, g.Amount, g.From.Unix(), g.To.Unix())
+		if err != nil {
+			log.Errorf("Error while inserting grant of project %s: %v", project, err)
+			return nil, err
+		}
+	} else {
+		if _, err := r.GetGrant(*id); err != nil {
+			return nil, err
+		}
+		if _, err := r.builder.Update("project_grant").
+			Set("project_id", p.ID).Set("cluster", g.Cluster).Set("resource_type", g.Resource).
+			Set("amount", g.Amount).Set("start_time", g.From.Unix()).Set("stop_time", g.To.Unix()).
+			Where("project_grant.id = ?", *id).RunWith(r.DB).Exec(); err != nil {
+			log.Errorf("Error while updating grant %d: %v", *id, err)
+			return nil, err
+		}
+		g.ID = *id
+	}
+
+	if g.Consumed, err = r.consumption(g); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// DeleteGrant deletes the grant with the database id `id`.
+func (r *ProjectRepository) DeleteGrant(id int64) (*model.ProjectGrant, error) {
+	g, err := r.GetGrant(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := r.builder.Delete("project_grant").Where("project_grant.id = ?", id).RunWith(r.DB).Exec(); err != nil {
+		log.Errorf("Error while deleting grant %d: %v", id, err)
+		return nil, err
+	}
+
+	return g, nil
+}
+
+// Returns the column with the resources of a job counted by the grant.
+func grantResourceColumn(resource model.GrantResource) string {
+	switch resource {
+	case model.GrantResourceCoreHours:
+		return "COALESCE(job.num_hwthreads, 0)"
+	case model.GrantResourceAccHours:
+		return "COALESCE(job.num_acc, 0)"
+	}
+	return "job.num_nodes"
+}
+
+// Returns the expression for the end time of a job, running jobs end now.
+func grantJobEnd(now int64) string {
+	return fmt.Sprintf(`(CASE WHEN job.job_state = 'running' THEN %d ELSE job.start_time + job.duration END)`, now)
+}
+
+// Restricts the query to the jobs of the project running in the grant period.
+func grantJobs(query sq.SelectBuilder, g *model.ProjectGrant, now int64) sq.SelectBuilder {
+	query = query.From("job").
+		Where("job.project = ?", g.Project).
+		Where("job.deleted_at IS NULL").
+		Where("job.start_time < ?", g.To.Unix()).
+		Where(grantJobEnd(now)+" > ?", g.From.Unix())
+	if g.Cluster != nil {
+		query = query.Where("job.cluster = ?", *g.Cluster)
+	}
+
+	return query
+}
+
+// Returns the resource hours of the jobs of the grant. Only the part of a job
+// within the grant period is counted.
+func (r *ProjectRepository) consumption(g *model.ProjectGrant) (float64, error) {
+	now := time.Now().Unix()
+	from, to, end := g.From.Unix(), g.To.Unix(), grantJobEnd(now)
+	seconds := fmt.Sprintf(`SUM(((CASE WHEN %s > %d THEN %d ELSE %s END) - (CASE WHEN job.start_time < %d THEN %d ELSE job.start_time END)) * %s)`,
+		end, to, to, end, from, from, grantResourceColumn(g.Resource))
+
+	var sum sql.NullFloat64
+	if err := grantJobs(r.builder.Select(seconds), g, now).
+		RunWith(r.DB).QueryRow().Scan(&sum); err != nil {
+		log.Warnf("Error while computing consumption of grant %d", g.ID)
+		return 0, err
+	}
+
+	return sum.Float64 / 3600, nil
+}
+
+// BurnDown returns the cumulated consumption of the grant at the end of every
+// interval of `resolution` seconds of the grant period until now. The resource
+// seconds of a job are split across the intervals it overlaps.
+func (r *ProjectRepository) BurnDown(g *model.ProjectGrant, resolution int64) ([]*model.BurnDownPoint, error) {
+	if resolution <= 0 {
+		return nil, errors.New("REPOSITORY/PROJECT > resolution must be positive")
+	}
+	now := time.Now().Unix()
+	from, to := g.From.Unix(), g.To.Unix()
+	if now < to {
+		to = now
+	}
+	if (to-from)/resolution > maxBurnDownPoints {
+		return nil, fmt.Errorf("REPOSITORY/PROJECT > more than %d points, increase the resolution", maxBurnDownPoints)
+	}
+
+	rows, err := grantJobs(r.builder.Select("job.start_time", grantJobEnd(now), grantResourceColumn(g.Resource)), g, now).
+		RunWith(r.DB).Query()
+	if err != nil {
+		log.Error("Error while running query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	consumed := make(map[int64]float64)
+	for rows.Next() {
+		var start, end, resources int64
+		if err := rows.Scan(&start, &end, &resources); err != nil {
+			log.Warn("Error while scanning rows")
+			return nil, err
+		}
+		if start < from {
+			start = from
+		}
+		if end > g.To.Unix() {
+			end = g.To.Unix()
+		}
+		for bucket := start - (start-from)%resolution; bucket < end; bucket += resolution {
+			s, e := bucket, bucket+resolution
+			if s < start {
+				s = start
+			}
+			if e > end {
+				e = end
+			}
+			consumed[bucket] += float64((e-s)*resources) / 3600
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	points := make([]*model.BurnDownPoint, 0)
+	total := 0.0
+	for t := from; t < to; t += resolution {
+		total += consumed[t]
+		end := t + resolution
+		if end > g.To.Unix() {
+			end = g.To.Unix()
+		}
+		points = append(points, &model.BurnDownPoint{
+			Time:      time.Unix(end, 0),
+			Consumed:  total,
+			Remaining: g.Amount - total,
+		})
+	}
+
+	return points, nil
+}
+
+// GrantWarning returns the highest of the thresholds reached by the consumed
+// share of the grant, nil if none is reached.
+func GrantWarning(g *model.ProjectGrant, thresholds []float64) *float64 {
+	if g.Amount <= 0 {
+		return nil
+	}
+
+	var warning *float64
+	share := g.Consumed / g.Amount
+	for i := range thresholds {
+		if share >= thresholds[i] && (warning == nil || thresholds[i] > *warning) {
+			warning = &thresholds[i]
+		}
+	}
+
+	return warning
+}
@@ -24,19 +24,24 @@ func (r *JobRepository) QueryJobs(
 	page *model.PageRequest,
 	order *model.OrderByInput) ([]*schema.Job, error) {
 
-	query, qerr := SecurityCheck(ctx, sq.Select(jobColumns...).From("job"))
+	query, qerr := SecurityCheck(ctx, r.builder.Select(jobColumns...).From("job"))
 	if qerr != nil {
 		return nil, qerr
 	}
 
 	if order != nil {
-		field := toSnakeCase(order.Field)
+		var field string
+		var err error
+		query, field, err = sortField(filters, query, order)
+		if err != nil {
+			return nil, err
+		}
 
 		switch order.Order {
 		case model.SortDirectionEnumAsc:
-			query = query.OrderBy(fmt.Sprintf("job.%s ASC", field))
+			query = query.OrderBy(fmt.Sprintf("%s ASC", field))
 		case model.SortDirectionEnumDesc:
-			query = query.OrderBy(fmt.Sprintf("job.%s DESC", field))
+			query = query.OrderBy(fmt.Sprintf("%s DESC", field))
 		default:
 			return nil, errors.New("REPOSITORY/QUERY > invalid sorting order")
 		}
@@ -48,7 +53,7 @@ func (r *JobRepository) QueryJobs(
 	}
 
 	for _, f := range filters {
-		query = BuildWhereClause(f, query)
+		query = BuildWhereClause(ctx, f, query)
 	}
 
 	rows, err := query.RunWith(r.stmtCache).Query()
@@ -71,17 +76,43 @@ func (r *JobRepository) QueryJobs(
 	return jobs, nil
 }
 
+// Returns the SQL expression to sort by and the query with the full-text
+// relevance joined if sorting by rank.
+func sortField(filters []*model.JobFilter, query sq.SelectBuilder, order *model.OrderByInput) (sq.SelectBuilder, string, error) {
+	if order.Type != nil && *order.Type == model.OrderByTypeRank {
+		return joinFullTextRank(filters, query)
+	}
+
+	field, err := orderByColumn(order)
+	return query, field, err
+}
+
+// Returns the SQL expression to sort by. Footprint keys can be used directly
+// or, for the replaced job table columns, under their old field names.
+func orderByColumn(order *model.OrderByInput) (string, error) {
+	if order.Type != nil && *order.Type == model.OrderByTypeFootprint {
+		return footprintColumn(order.Field)
+	}
+
+	field := toSnakeCase(order.Field)
+	if key, ok := legacyFootprintKeys[field]; ok {
+		return footprintColumn(key)
+	}
+
+	return fmt.Sprintf("job.%s", field), nil
+}
+
 func (r *JobRepository) CountJobs(
 	ctx context.Context,
 	filters []*model.JobFilter) (int, error) {
 
-	query, qerr := SecurityCheck(ctx, sq.Select("count(*)").From("job"))
+	query, qerr := SecurityCheck(ctx, r.builder.Select("count(*)").From("job"))
 	if qerr != nil {
 		return 0, qerr
 	}
 
 	for _, f := range filters {
-		query = BuildWhereClause(f, query)
+		query = BuildWhereClause(ctx, f, query)
 	}
 
 	var count int
@@ -92,7 +123,15 @@ func (r *JobRepository) CountJobs(
 	return count, nil
 }
 
+// SecurityCheck restricts the query to the jobs visible to the user in the
+// context. Trashed jobs are not visible to anyone.
 func SecurityCheck(ctx context.Context, query sq.SelectBuilder) (sq.SelectBuilder, error) {
+	return securityCheck(ctx, query.Where("job.deleted_at IS NULL"), "job")
+}
+
+// Restricts the query to the rows of `table` visible to the user in the
+// context, the table needs a user and a project column.
+func securityCheck(ctx context.Context, query sq.SelectBuilder, table string) (sq.SelectBuilder, error) {
 	user := GetUserFromContext(ctx)
 	if user == nil {
 		var qnil sq.SelectBuilder
@@ -101,26 +140,31 @@ func SecurityCheck(ctx context.Context, query sq.SelectBuilder) (sq.SelectBuilde
 		return query, nil
 	} else if user.HasRole(schema.RoleManager) { // Manager : Add filter for managed projects' jobs only + personal jobs
 		if len(user.Projects) != 0 {
-			return query.Where(sq.Or{sq.Eq{"job.project": user.Projects}, sq.Eq{"job.user": user.Username}}), nil
+			return query.Where(sq.Or{sq.Eq{table + ".project": user.Projects}, sq.Eq{table + ".user": user.Username}}), nil
 		} else {
 			log.Debugf("Manager-User '%s' has no defined projects to lookup! Query only personal jobs ...", user.Username)
-			return query.Where("job.user = ?", user.Username), nil
+			return query.Where(table+".user = ?", user.Username), nil
 		}
 	} else if user.HasRole(schema.RoleUser) { // User : Only personal jobs
-		return query.Where("job.user = ?", user.Username), nil
+		return query.Where(table+".user = ?", user.Username), nil
 	} else {
 		// Shortterm compatibility: Return User-Query if no roles:
-		return query.Where("job.user = ?", user.Username), nil
+		return query.Where(table+".user = ?", user.Username), nil
 		// // On the longterm: Return Error instead of fallback:
 		// var qnil sq.SelectBuilder
 		// return qnil, fmt.Errorf("user '%s' with unknown roles [%#v]", user.Username, user.Roles)
 	}
 }
 
-// Build a sq.SelectBuilder out of a schema.JobFilter.
-func BuildWhereClause(filter *model.JobFilter, query sq.SelectBuilder) sq.SelectBuilder {
+// Build a sq.SelectBuilder out of a schema.JobFilter. Tags not visible to the
+// user in the context match no jobs.
+func BuildWhereClause(ctx context.Context, filter *model.JobFilter, query sq.SelectBuilder) sq.SelectBuilder {
 	if filter.Tags != nil {
-		query = query.Join("jobtag ON jobtag.job_id = job.id").Where(sq.Eq{"jobtag.tag_id": filter.Tags})
+		tags := sq.Select("tag.id").From("tag").Where(sq.Eq{"tag.id": filter.Tags})
+		if cond := tagVisibility(GetUserFromContext(ctx)); cond != nil {
+			tags = tags.Where(cond)
+		}
+		query = query.Join("jobtag ON jobtag.job_id = job.id").Where(sq.Expr("jobtag.tag_id IN (?)", tags))
 	}
 	if filter.JobID != nil {
 		query = buildStringCondition("job.job_id", filter.JobID, query)
@@ -135,7 +179,12 @@ func BuildWhereClause(filter *model.JobFilter, query sq.SelectBuilder) sq.Select
 		query = buildStringCondition("job.project", filter.Project, query)
 	}
 	if filter.JobName != nil {
-		query = buildStringCondition("job.meta_data", filter.JobName, query)
+		// Searches for words of the job name use the full-text index
+		if filter.JobName.Contains != nil {
+			query = buildFullTextCondition(*filter.JobName.Contains, query)
+		} else {
+			query = buildStringCondition("job.meta_data", filter.JobName, query)
+		}
 	}
 	if filter.Cluster != nil {
 		query = buildStringCondition("job.cluster", filter.Cluster, query)
@@ -172,19 +221,31 @@ func BuildWhereClause(filter *model.JobFilter, query sq.SelectBuilder) sq.Select
 		query = buildIntCondition("job.num_hwthreads", filter.NumHWThreads, query)
 	}
 	if filter.Node != nil {
-		query = buildStringCondition("job.resources", filter.Node, query)
+		query = query.Where(jobOnNodesMatching(filter.Node))
 	}
 	if filter.FlopsAnyAvg != nil {
-		query = buildFloatCondition("job.flops_any_avg", filter.FlopsAnyAvg, query)
+		query = buildFootprintCondition("flops_any_avg", filter.FlopsAnyAvg, query)
 	}
 	if filter.MemBwAvg != nil {
-		query = buildFloatCondition("job.mem_bw_avg", filter.MemBwAvg, query)
+		query = buildFootprintCondition("mem_bw_avg", filter.MemBwAvg, query)
 	}
 	if filter.LoadAvg != nil {
-		query = buildFloatCondition("job.load_avg", filter.LoadAvg, query)
+		query = buildFootprintCondition("cpu_load_avg", filter.LoadAvg, query)
 	}
 	if filter.MemUsedMax != nil {
-		query = buildFloatCondition("job.mem_used_max", filter.MemUsedMax, query)
+		query = buildFootprintCondition("mem_used_max", filter.MemUsedMax, query)
+	}
+	for _, f := range filter.Footprint {
+		query = buildFootprintCondition(FootprintKey(f.Metric, f.Stat), f.Range, query)
+	}
+	if filter.Energy != nil {
+		query = buildFloatCondition("job.energy", filter.Energy, query)
+	}
+	if filter.FullText != nil {
+		query = buildFullTextCondition(*filter.FullText, query)
+	}
+	for _, f := range filter.MetaData {
+		query = buildMetaDataCondition(f, query)
 	}
 	return query
 }
@@ -209,6 +270,71 @@ func buildFloatCondition(field string, cond *model.FloatRange, query sq.SelectBu
 	return query.Where(field+" BETWEEN ? AND ?", cond.From, cond.To)
 }
 
+func buildFootprintCondition(key string, cond *model.FloatRange, query sq.SelectBuilder) sq.SelectBuilder {
+	if GetConnection().Driver == "postgres" {
+		return query.Where("CAST(job.footprint ->> ? AS DOUBLE PRECISION) BETWEEN ? AND ?", key, cond.From, cond.To)
+	}
+
+	return query.Where("json_extract(job.footprint, ?) BETWEEN ? AND ?", "$."+key, cond.From, cond.To)
+}
+
+// Metadata keys are inlined into the JSON path, so only these characters are
+// allowed.
+var metaDataKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Metadata values matching this pattern are compared as numbers.
+const numberPattern = `^ *[-+]?[0-9]*[.]?[0-9]+([eE][-+]?[0-9]+)? *$`
+
+// Returns the SQL expression for the value of the metadata key, NULL if the
+// key is not set.
+func metaDataValue(key string) string {
+	switch GetConnection().Driver {
+	case "postgres":
+		return fmt.Sprintf("(CAST(job.meta_data AS JSON) ->> '%s')", key)
+	case "mysql":
+		return fmt.Sprintf(`JSON_UNQUOTE(JSON_EXTRACT(job.meta_data, '$."%s"'))`, key)
+	default:
+		return fmt.Sprintf(`json_extract(job.meta_data, '$."%s"')`, key)
+	}
+}
+
+// Returns the SQL expression for the value of the metadata key as number,
+// NULL if the key is not set or the value is not a number.
+func metaDataNumber(key string) string {
+	value := metaDataValue(key)
+	switch GetConnection().Driver {
+	case "postgres":
+		return fmt.Sprintf("(CASE WHEN %s ~ '%s' THEN CAST(%s AS DOUBLE PRECISION) END)", value, numberPattern, value)
+	case "mysql":
+		return fmt.Sprintf("(CASE WHEN %s REGEXP '%s' THEN %s + 0 END)", value, numberPattern, value)
+	default:
+		// Text is only equal to its numeric cast if it is a number
+		return fmt.Sprintf("(CASE WHEN %s = CAST(%s AS REAL) THEN CAST(%s AS REAL) END)", value, value, value)
+	}
+}
+
+func buildMetaDataCondition(cond *model.MetaDataFilter, query sq.SelectBuilder) sq.SelectBuilder {
+	if !metaDataKeyPattern.MatchString(cond.Key) {
+		log.Warnf("Invalid metadata key '%s' in filter", cond.Key)
+		return query.Where("1=0")
+	}
+
+	if cond.Exists != nil {
+		if *cond.Exists {
+			query = query.Where(metaDataValue(cond.Key) + " IS NOT NULL")
+		} else {
+			query = query.Where(metaDataValue(cond.Key) + " IS NULL")
+		}
+	}
+	if cond.Value != nil {
+		query = buildStringCondition(metaDataValue(cond.Key), cond.Value, query)
+	}
+	if cond.Range != nil {
+		query = buildFloatCondition(metaDataNumber(cond.Key), cond.Range, query)
+	}
+	return query
+}
+
 func buildStringCondition(field string, cond *model.StringInput, query sq.SelectBuilder) sq.SelectBuilder {
 	if cond.Eq != nil {
 		return query.Where(field+" = ?", *cond.Eq)
@@ -6,11 +6,20 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
 
+	"github.com/ClusterCockpit/cc-backend/internal/config"
 	"github.com/ClusterCockpit/cc-backend/internal/graph/model"
 	"github.com/ClusterCockpit/cc-backend/pkg/log"
 	"github.com/ClusterCockpit/cc-backend/pkg/schema"
+	"github.com/jmoiron/sqlx"
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -24,6 +33,261 @@ func TestPragma(t *testing.T) {
 	})
 }
 
+func TestQueryJobsFootprint(t *testing.T) {
+	db := setup(t)
+
+	filter := &model.JobFilter{Footprint: []*model.FootprintFilter{
+		{Metric: "flops_any", Stat: "avg", Range: &model.FloatRange{From: 0, To: 1}},
+	}}
+	footprint := model.OrderByTypeFootprint
+	order := &model.OrderByInput{Field: "mem_bw_avg", Type: &footprint, Order: model.SortDirectionEnumAsc}
+
+	jobs, err := db.QueryJobs(getContext(t), []*model.JobFilter{filter}, nil, order)
+	noErr(t, err)
+
+	if len(jobs) != 2 {
+		t.Fatalf("expected 2 jobs, got %d", len(jobs))
+	}
+	if jobs[0].ID != 2 || jobs[1].ID != 3 {
+		t.Errorf("wrong order\ngot: [%d %d] \nwant: [2 3]", jobs[0].ID, jobs[1].ID)
+	}
+	if jobs[0].Footprint["flops_any_avg"] != 0.06 {
+		t.Errorf("wrong footprint\ngot: %v \nwant: flops_any_avg 0.06", jobs[0].Footprint)
+	}
+}
+
+func TestFootprintColumnOfMetric(t *testing.T) {
+	db := setup(t)
+
+	clusters := config.Keys.Clusters
+	config.Keys.Clusters = []*schema.ClusterConfig{
+		{Name: "alex"},
+		{Name: "fritz", Footprint: []*schema.FootprintMetric{{Metric: "mem_bw", Stat: "max"}}},
+	}
+	defer func() { config.Keys.Clusters = clusters }()
+
+	column, err := footprintColumnOfMetric("flops_any")
+	noErr(t, err)
+	if column != "json_extract(job.footprint, '$.flops_any_avg')" {
+		t.Errorf("wrong column for flops_any: %s", column)
+	}
+
+	column, err = footprintColumnOfMetric("mem_bw")
+	noErr(t, err)
+
+	var values []sql.NullFloat64
+	noErr(t, db.DB.Select(&values, "SELECT "+column+" FROM job ORDER BY job.id"))
+	// The footprints of the fritz jobs have no mem_bw_max
+	want := []sql.NullFloat64{{Float64: 9254.842, Valid: true}, {Float64: 3.12, Valid: true}, {Float64: 27.409, Valid: true}, {}, {}, {}}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("wrong values\ngot: %v \nwant: %v", values, want)
+	}
+}
+
+func TestQueryJobsFullText(t *testing.T) {
+	db := setup(t)
+
+	text := `"ams_pipeline" multithread`
+	filter := &model.JobFilter{FullText: &text}
+	rank := model.OrderByTypeRank
+	order := &model.OrderByInput{Field: "", Type: &rank, Order: model.SortDirectionEnumDesc}
+
+	jobs, err := db.QueryJobs(getContext(t), []*model.JobFilter{filter}, nil, order)
+	noErr(t, err)
+
+	if len(jobs) != 3 {
+		t.Fatalf("expected 3 jobs, got %d", len(jobs))
+	}
+	for _, job := range jobs {
+		if job.ID < 4 {
+			t.Errorf("wrong job\ngot: %d \nwant: ams_pipeline job", job.ID)
+		}
+	}
+
+	_, err = db.QueryJobs(getContext(t), []*model.JobFilter{}, nil, order)
+	if err == nil {
+		t.Error("expected error when sorting by rank without fullText filter")
+	}
+
+	name := "ams_pipeline"
+	count, err := db.CountJobs(getContext(t), []*model.JobFilter{{JobName: &model.StringInput{Contains: &name}}})
+	noErr(t, err)
+	if count != 3 {
+		t.Errorf("wrong number of jobs for job name\ngot: %d \nwant: 3", count)
+	}
+}
+
+func TestQueryJobsMetaData(t *testing.T) {
+	db := setup(t)
+
+	// Three jobs in addition to the six of the fixture
+	for i, numTasks := range []string{"10", "20", "40"} {
+		job := testJob(9000030+int64(i), 1675957496, "f0001")
+		job.MetaData = map[string]string{"jobName": "metatest", "numTasks": numTasks}
+		startTestJob(t, db, job)
+	}
+
+	yes, no := true, false
+	name := "ams_pipeline"
+	for _, tc := range []struct {
+		filter *model.MetaDataFilter
+		want   int
+	}{
+		{&model.MetaDataFilter{Key: "jobName", Value: &model.StringInput{Eq: &name}}, 3},
+		{&model.MetaDataFilter{Key: "jobName", Exists: &yes}, 9},
+		{&model.MetaDataFilter{Key: "qos", Exists: &no}, 9},
+		{&model.MetaDataFilter{Key: "numTasks", Range: &model.FloatRange{From: 15, To: 45}}, 2},
+		{&model.MetaDataFilter{Key: "jobName", Range: &model.FloatRange{From: -1e9, To: 1e9}}, 0},
+		{&model.MetaDataFilter{Key: "jobName') OR ('1", Exists: &yes}, 0},
+	} {
+		filter := &model.JobFilter{MetaData: []*model.MetaDataFilter{tc.filter}}
+		count, err := db.CountJobs(getContext(t), []*model.JobFilter{filter})
+		noErr(t, err)
+		if count != tc.want {
+			t.Errorf("wrong number of jobs for metadata filter on '%s'\ngot: %d \nwant: %d", tc.filter.Key, count, tc.want)
+		}
+	}
+}
+
+func TestQueryJobsCursor(t *testing.T) {
+	db := setup(t)
+
+	footprint := model.OrderByTypeFootprint
+	for _, order := range []*model.OrderByInput{
+		nil,
+		{Field: "startTime", Order: model.SortDirectionEnumDesc},
+		{Field: "partition", Order: model.SortDirectionEnumAsc},
+		{Field: "mem_bw_avg", Type: &footprint, Order: model.SortDirectionEnumDesc},
+	} {
+		all, err := db.QueryJobs(getContext(t), []*model.JobFilter{}, nil, order)
+		noErr(t, err)
+
+		seen := map[int64]bool{}
+		jobs := make([]*schema.Job, 0)
+		cursor := ""
+		for pages := 0; ; pages++ {
+			if pages > len(all) {
+				t.Fatalf("paging by %v does not end", order)
+			}
+			page, next, err := db.QueryJobsCursor(getContext(t), []*model.JobFilter{}, 2, order, cursor)
+			noErr(t, err)
+			for _, job := range page {
+				if seen[job.ID] {
+					t.Errorf("job %d returned twice when paging by %v", job.ID, order)
+				}
+				seen[job.ID] = true
+			}
+			jobs = append(jobs, page...)
+			if next == "" {
+				break
+			}
+			cursor = next
+		}
+
+		if len(jobs) != len(all) {
+			t.Errorf("wrong number of jobs when paging by %v\ngot: %d \nwant: %d", order, len(jobs), len(all))
+		}
+		if order != nil && order.Field == "startTime" {
+			for i := 1; i < len(jobs); i++ {
+				if jobs[i].StartTimeUnix > jobs[i-1].StartTimeUnix {
+					t.Errorf("wrong order\ngot: %d after %d", jobs[i].StartTimeUnix, jobs[i-1].StartTimeUnix)
+				}
+			}
+		}
+	}
+
+	desc := &model.OrderByInput{Field: "startTime", Order: model.SortDirectionEnumDesc}
+	_, next, err := db.QueryJobsCursor(getContext(t), []*model.JobFilter{}, 1, desc, "")
+	noErr(t, err)
+	asc := &model.OrderByInput{Field: "startTime", Order: model.SortDirectionEnumAsc}
+	if _, _, err := db.QueryJobsCursor(getContext(t), []*model.JobFilter{}, 1, asc, next); err != ErrInvalidCursor {
+		t.Errorf("expected invalid cursor for another order\ngot: %v", err)
+	}
+	if _, _, err := db.QueryJobsCursor(getContext(t), []*model.JobFilter{}, 1, desc, "garbage!"); err != ErrInvalidCursor {
+		t.Errorf("expected invalid cursor\ngot: %v", err)
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	setup(t)
+	r := GetAuditRepository()
+	target := AuditJobTarget(1)
+
+	r.Record(getContext(t), AuditTagAdd, target, nil, map[string]int64{"tagId": 1})
+	r.Record(context.Background(), AuditTagRemove, target, map[string]int64{"tagId": 1}, nil)
+
+	entries, err := r.Query(&AuditFilter{Target: &target}, &model.PageRequest{ItemsPerPage: 10, Page: 1})
+	noErr(t, err)
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	if entries[0].Action != AuditTagRemove || entries[0].Actor != AuditSystemActor || entries[0].After != nil {
+		t.Errorf("wrong entry\ngot: %#v", entries[0])
+	}
+	if entries[1].Actor != "demo" || entries[1].AuthSource != "ldap/token" || *entries[1].After != `{"tagId":1}` {
+		t.Errorf("wrong entry\ngot: %#v", entries[1])
+	}
+
+	actor := "demo"
+	entries, err = r.Query(&AuditFilter{Actor: &actor, Target: &target}, nil)
+	noErr(t, err)
+	if len(entries) != 1 {
+		t.Errorf("expected 1 entry, got %d", len(entries))
+	}
+
+	cnt, err := r.DeleteBefore(time.Now().Unix() + 1)
+	noErr(t, err)
+	if cnt < 2 {
+		t.Errorf("expected at least 2 deleted entries, got %d", cnt)
+	}
+}
+
+func TestSavedViews(t *testing.T) {
+	setup(t)
+	r := GetViewRepository()
+
+	ctxOf := func(username string, role schema.Role, projects ...string) context.Context {
+		user := &schema.User{Username: username, Roles: []string{schema.GetRoleString(role)}, Projects: projects}
+		return context.WithValue(context.Background(), ContextUserKey, user)
+	}
+	alice, bob, carol := ctxOf("alice", schema.RoleUser), ctxOf("bob", schema.RoleUser), ctxOf("carol", schema.RoleManager, "viewproj")
+
+	cluster := "fritz"
+	private, project := model.SavedViewScopePrivate, model.SavedViewScopeProject
+	view, err := r.SaveView(carol, nil, &model.SavedViewInput{
+		Name:    "running on fritz",
+		Filter:  []*model.JobFilter{{Cluster: &model.StringInput{Eq: &cluster}, State: []schema.JobState{schema.JobStateRunning}}},
+		Order:   &model.OrderByInput{Field: "startTime", Order: model.SortDirectionEnumDesc},
+		Metrics: []string{"flops_any", "mem_bw"},
+		Scope:   &private,
+	})
+	noErr(t, err)
+	defer r.DeleteView(carol, view.ID)
+
+	if _, err := r.GetView(alice, view.ID); err != sql.ErrNoRows {
+		t.Errorf("private view visible to other user, err: %v", err)
+	}
+
+	if _, err := r.SaveView(carol, &view.ID, &model.SavedViewInput{Name: view.Name, Filter: view.Filter, Scope: &project}); err == nil {
+		t.Errorf("view shared with a project without the project")
+	}
+	projectName := "viewproj"
+	_, err = r.SaveView(carol, &view.ID, &model.SavedViewInput{
+		Name: view.Name, Filter: view.Filter, Order: view.Order, Metrics: view.Metrics, Scope: &project, Project: &projectName,
+	})
+	noErr(t, err)
+
+	stored, err := r.GetView(ctxOf("dave", schema.RoleManager, "viewproj"), view.ID)
+	noErr(t, err)
+	if *stored.Filter[0].Cluster.Eq != cluster || stored.Order.Field != "startTime" || len(stored.Metrics) != 2 {
+		t.Errorf("wrong view\ngot: %#v", stored)
+	}
+
+	if _, err := r.SaveView(bob, &view.ID, &model.SavedViewInput{Name: "stolen", Filter: view.Filter}); err != sql.ErrNoRows && err != ErrViewForbidden {
+		t.Errorf("view changed by other user, err: %v", err)
+	}
+}
+
 func getPragma(db *JobRepository, name string) string {
 	var s string
 	if err := db.DB.QueryRow(`PRAGMA ` + name).Scan(&s); err != nil {
@@ -103,6 +367,274 @@ func BenchmarkDB_CountJobs(b *testing.B) {
 	})
 }
 
+func TestNodeStates(t *testing.T) {
+	setup(t)
+	r := GetNodeRepository()
+	defer r.DB.Exec("DELETE FROM node WHERE cluster = 'nodetest'")
+
+	cluster := &schema.Cluster{Name: "nodetest", SubClusters: []*schema.SubCluster{
+		{Name: "main", Nodes: "n[01-03]"},
+		{Name: "gpu", Nodes: "g01"},
+		{Name: "broken", Nodes: "b[01-"},
+	}}
+	noErr(t, r.SyncNodes([]*schema.Cluster{cluster}))
+	noErr(t, r.SyncNodes([]*schema.Cluster{cluster}))
+
+	nodes, err := r.GetNodes("nodetest", nil)
+	noErr(t, err)
+	if len(nodes) != 4 || nodes[0].Hostname != "g01" || nodes[0].State != schema.NodeStateUnknown || nodes[0].Since != nil {
+		t.Fatalf("wrong nodes\ngot: %d nodes", len(nodes))
+	}
+
+	t1, t2 := time.Unix(1700000000, 0), time.Unix(1700000600, 0)
+	noErr(t, r.UpdateNodeStates("nodetest", []*NodeStateReport{
+		{Hostname: "n01", State: schema.NodeStateAllocated},
+		{Hostname: "n02", State: schema.NodeStateIdle},
+		{Hostname: "g01", State: schema.NodeStateDrain, Reason: "GPU error"},
+	}, t1))
+	noErr(t, r.UpdateNodeStates("nodetest", []*NodeStateReport{
+		{Hostname: "n01", State: schema.NodeStateIdle},
+		{Hostname: "n02", State: schema.NodeStateIdle},
+	}, t2))
+	if err := r.UpdateNodeStates("nodetest", []*NodeStateReport{{Hostname: "n03", State: "busy"}}, t2); err == nil {
+		t.Error("expected error for invalid state")
+	}
+
+	counts, err := r.CountNodeStates("nodetest")
+	noErr(t, err)
+	got := map[string]map[string]int{}
+	for _, c := range counts {
+		got[c.SubCluster] = map[string]int{}
+		for _, s := range c.States {
+			got[c.SubCluster][s.Name] = s.Count
+		}
+	}
+	want := map[string]map[string]int{"gpu": {"drain": 1}, "main": {"idle": 2, "unknown": 1}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong state counts\ngot: %v \nwant: %v", got, want)
+	}
+
+	main := "main"
+	history, err := r.GetNodeStateHistory("nodetest", &main, nil, t1, t2)
+	noErr(t, err)
+	if len(history) != 3 || history[2].Hostname != "n01" || history[2].State != schema.NodeStateIdle || !history[2].Time.Equal(t2) {
+		t.Errorf("wrong state history\ngot: %d changes", len(history))
+	}
+}
+
+func TestReservations(t *testing.T) {
+	db := setup(t)
+	r := GetNodeRepository()
+	defer r.DB.Exec("DELETE FROM reservation WHERE cluster = 'fritz'")
+
+	start := time.Unix(1675957496, 0)
+	description := "Firmware update"
+	maintenance, err := r.SaveReservation(getContext(t), nil, &model.ReservationInput{
+		Cluster: "fritz", Nodes: "f1076", Type: model.ReservationTypeMaintenance, Description: &description,
+		From: start.Add(time.Hour), To: start.Add(3 * time.Hour),
+	})
+	noErr(t, err)
+	reservation, err := r.SaveReservation(getContext(t), nil, &model.ReservationInput{
+		Cluster: "fritz", Nodes: "f[1077-1078]", Type: model.ReservationTypeReservation,
+		From: start.Add(-time.Hour), To: start,
+	})
+	noErr(t, err)
+	if reservation.Author != "demo" {
+		t.Errorf("wrong author\ngot: %s \nwant: demo", reservation.Author)
+	}
+	reservation, err = r.SaveReservation(getContext(t), &reservation.ID, &model.ReservationInput{
+		Cluster: "fritz", Nodes: "f[1077-1078]", Type: model.ReservationTypeReservation,
+		From: start, To: start.Add(time.Hour),
+	})
+	noErr(t, err)
+
+	if _, err := r.SaveReservation(getContext(t), nil, &model.ReservationInput{
+		Cluster: "fritz", Nodes: "f[1077", Type: model.ReservationTypeReservation, From: start, To: start.Add(time.Hour),
+	}); err == nil {
+		t.Error("expected error for invalid node list")
+	}
+
+	to := start.Add(2 * time.Hour)
+	reservations, err := r.GetReservations(nil, &start, &to)
+	noErr(t, err)
+	if len(reservations) != 2 || reservations[0].ID != reservation.ID || !reservations[0].From.Equal(start) {
+		t.Fatalf("wrong reservations\ngot: %d reservations", len(reservations))
+	}
+	if res := ReservationsOfHost(reservations, "f1078"); len(res) != 1 || res[0].ID != reservation.ID {
+		t.Errorf("wrong reservations of host f1078\ngot: %d reservations", len(res))
+	}
+
+	// Overlapping reservations of a node are counted once
+	_, err = r.SaveReservation(getContext(t), nil, &model.ReservationInput{
+		Cluster: "fritz", Nodes: "f1078", Type: model.ReservationTypeReservation,
+		From: start.Add(30 * time.Minute), To: start.Add(time.Hour),
+	})
+	noErr(t, err)
+
+	// Jobs 4, 5 and 6 run on f1075, f1076 and f1077 for 2034, 1870 and 7152 seconds
+	cluster := &schema.Cluster{Name: "fritz", SubClusters: []*schema.SubCluster{{Name: "main", Nodes: "f[1075-1078]"}}}
+	utilization, err := db.Utilization(cluster, start, to)
+	noErr(t, err)
+	u := utilization[0]
+	if u.NodeHours != 8 || u.MaintenanceNodeHours != 1 || u.ReservedNodeHours != 2 {
+		t.Errorf("wrong node hours\ngot: %#v", u)
+	}
+	// f1076 is idle during maintenance and f1078 during the reservation
+	allocated := float64(2034+1870+7152) / 3600
+	if math.Abs(u.AllocatedNodeHours-allocated) > 1e-9 || math.Abs(u.Utilization-allocated/6) > 1e-9 {
+		t.Errorf("wrong utilization\ngot: %#v \nwant: %f allocated node hours, utilization %f", u, allocated, allocated/6)
+	}
+
+	_, err = r.DeleteReservation(maintenance.ID)
+	noErr(t, err)
+	if _, err := r.GetReservation(maintenance.ID); err != sql.ErrNoRows {
+		t.Errorf("reservation not deleted, err: %v", err)
+	}
+}
+
+func TestProjectGrants(t *testing.T) {
+	setup(t)
+	r := GetProjectRepository()
+	jobRepo := GetJobRepository()
+
+	description := "Crystal structures"
+	_, err := r.SaveProject("grantproj", &description)
+	noErr(t, err)
+	t.Cleanup(func() { r.DeleteProject("grantproj") })
+	_, err = r.SaveProject("otherproj", nil)
+	noErr(t, err)
+	t.Cleanup(func() { r.DeleteProject("otherproj") })
+
+	ctxOf := func(role schema.Role, projects ...string) context.Context {
+		user := &schema.User{Username: "pm", Roles: []string{schema.GetRoleString(role)}, Projects: projects}
+		return context.WithValue(context.Background(), ContextUserKey, user)
+	}
+	projects, err := r.GetProjects(ctxOf(schema.RoleManager, "grantproj"))
+	noErr(t, err)
+	if len(projects) != 1 || projects[0].Name != "grantproj" || projects[0].Description != description {
+		t.Fatalf("wrong projects of manager\ngot: %d projects", len(projects))
+	}
+	if _, err := r.GetProject(ctxOf(schema.RoleManager, "grantproj"), "otherproj"); err != sql.ErrNoRows {
+		t.Errorf("project of other manager visible, err: %v", err)
+	}
+	if _, err := r.GetProjects(ctxOf(schema.RoleUser, "grantproj")); err != ErrProjectForbidden {
+		t.Errorf("expected forbidden for user\ngot: %v", err)
+	}
+
+	// Job 9000020 starts 50 seconds before the grant period, job 9000021 ends
+	// after it and job 9000022 runs on another cluster
+	start := time.Unix(1700000000, 0)
+	for _, j := range []struct {
+		jobId    int64
+		start    int64
+		duration int32
+		cluster  string
+	}{
+		{9000020, -50, 150, "fritz"},
+		{9000021, 90, 300, "fritz"},
+		{9000022, 100, 100, "alex"},
+	} {
+		job := testJob(j.jobId, start.Unix()+j.start, "f0101")
+		job.Project, job.Cluster = "grantproj", j.cluster
+		id := startTestJob(t, jobRepo, job)
+		noErr(t, jobRepo.Stop(id, j.duration, schema.JobStateCompleted, schema.MonitoringStatusArchivingSuccessful))
+	}
+	// Job 9000023 has no hardware threads and consumes no core hours
+	job := testJob(9000023, start.Unix()+150, "f0101")
+	job.Project = "grantproj"
+	id := startTestJob(t, jobRepo, job)
+	noErr(t, jobRepo.Stop(id, 50, schema.JobStateCompleted, schema.MonitoringStatusArchivingSuccessful))
+	_, err = jobRepo.DB.Exec(jobRepo.DB.Rebind(`UPDATE job SET num_hwthreads = NULL WHERE id = ?`), id)
+	noErr(t, err)
+
+	cluster := "fritz"
+	grant, err := r.SaveGrant(nil, "grantproj", &model.ProjectGrantInput{
+		Cluster: &cluster, Resource: model.GrantResourceCoreHours, Amount: 7, From: start, To: start.Add(300 * time.Second),
+	})
+	noErr(t, err)
+	// Both jobs on fritz use 72 hardware threads for 100 and 210 seconds of
+	// the grant period
+	if consumed := float64(72*(100+210)) / 3600; math.Abs(grant.Consumed-consumed) > 1e-9 {
+		t.Errorf("wrong consumption\ngot: %f \nwant: %f", grant.Consumed, consumed)
+	}
+	if w := GrantWarning(grant, []float64{0.5, 0.8, 1.0}); w == nil || *w != 0.8 {
+		t.Errorf("wrong warning\ngot: %v \nwant: 0.8", w)
+	}
+
+	points, err := r.BurnDown(grant, 100)
+	noErr(t, err)
+	if len(points) != 3 || !points[0].Time.Equal(start.Add(100*time.Second)) ||
+		math.Abs(points[0].Consumed-float64(72*(100+10))/3600) > 1e-9 ||
+		math.Abs(points[1].Consumed-float64(72*(100+110))/3600) > 1e-9 ||
+		math.Abs(points[2].Consumed-grant.Consumed) > 1e-9 || math.Abs(points[2].Remaining-(7-grant.Consumed)) > 1e-9 {
+		t.Errorf("wrong burn-down\ngot: %d points", len(points))
+	}
+
+	grants, err := r.GetGrants(projects[0].ID)
+	noErr(t, err)
+	if len(grants) != 1 || grants[0].ID != grant.ID || *grants[0].Cluster != "fritz" {
+		t.Errorf("wrong grants\ngot: %d grants", len(grants))
+	}
+
+	_, err = r.DeleteProject("grantproj")
+	noErr(t, err)
+	if _, err := r.GetGrant(grant.ID); err != sql.ErrNoRows {
+		t.Errorf("grant not deleted with project, err: %v", err)
+	}
+}
+
+func TestBackupRestore(t *testing.T) {
+	r := setup(t)
+	dir := t.TempDir()
+
+	var jobs int
+	noErr(t, r.DB.Get(&jobs, `SELECT COUNT(*) FROM job`))
+
+	file := filepath.Join(dir, "snapshot.db")
+	noErr(t, Backup(file))
+	if err := Backup(file); err == nil {
+		t.Error("expected error for existing backup file")
+	}
+
+	// Rotation keeps the newest snapshots only
+	old := []string{"job-20200101-000000.db", "job-20200102-000000.db", "job-20200103-000000.db"}
+	for _, name := range old {
+		noErr(t, os.WriteFile(filepath.Join(dir, name), nil, 0644))
+	}
+	latest, err := RotateBackups(dir, 2)
+	noErr(t, err)
+	snapshots, err := filepath.Glob(filepath.Join(dir, "job-*.db"))
+	noErr(t, err)
+	if want := []string{filepath.Join(dir, old[2]), latest}; !reflect.DeepEqual(snapshots, want) {
+		t.Errorf("wrong snapshots after rotation\ngot: %v \nwant: %v", snapshots, want)
+	}
+
+	target := filepath.Join(dir, "restored.db")
+	noErr(t, os.WriteFile(target+"-wal", []byte("stale"), 0644))
+	noErr(t, Restore("sqlite3", target, file))
+	if _, err := os.Stat(target + "-wal"); !os.IsNotExist(err) {
+		t.Error("expected stale WAL file to be removed")
+	}
+	restored, err := sqlx.Open("sqlite3", target)
+	noErr(t, err)
+	var restoredJobs int
+	noErr(t, restored.Get(&restoredJobs, `SELECT COUNT(*) FROM job`))
+	if restoredJobs != jobs {
+		t.Errorf("wrong number of restored jobs\ngot: %d \nwant: %d", restoredJobs, jobs)
+	}
+
+	// Snapshots of a newer schema are rejected
+	_, err = restored.Exec(`UPDATE schema_migrations SET version = ?`, Version+1)
+	noErr(t, err)
+	restored.Close()
+	if err := Restore("sqlite3", filepath.Join(dir, "other.db"), target); err == nil {
+		t.Error("expected error for backup with newer schema version")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "other.db")); !os.IsNotExist(err) {
+		t.Error("expected rejected backup not to be restored")
+	}
+}
+
 func BenchmarkDB_QueryJobs(b *testing.B) {
 	filter := &model.JobFilter{}
 	filter.State = append(filter.State, "running")
@@ -145,14 +677,77 @@ func getContext(tb testing.TB) context.Context {
 	return context.WithValue(ctx, ContextUserKey, user)
 }
 
+// Copy of testdata/job.db the tests run on, so that they do not modify the
+// fixture.
+var testDB string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "cc-backend-repository")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	// The fixture has an old schema version, so that all migrations are tested
+	testDB = filepath.Join(dir, "job.db")
+	if err := copyFile("testdata/job.db", testDB); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.RemoveAll(dir)
+		os.Exit(1)
+	}
+	log.Init("warn", true)
+	if err := MigrateDB("sqlite3", testDB); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.RemoveAll(dir)
+		os.Exit(1)
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
 func setup(tb testing.TB) *JobRepository {
 	tb.Helper()
 	log.Init("warn", true)
-	dbfile := "testdata/job.db"
-	err := MigrateDB("sqlite3", dbfile)
+	Connect("sqlite3", testDB)
+	r := GetJobRepository()
+	noErr(tb, r.InitRollups())
+	return r
+}
+
+// Returns a running job on the given node of the fritz cluster for tests which
+// modify jobs, so that the jobs of the fixture stay unchanged.
+func testJob(jobId int64, startTime int64, hostname string) *schema.JobMeta {
+	job := &schema.JobMeta{BaseJob: schema.JobDefaults, StartTime: startTime}
+	job.JobID = jobId
+	job.User = "testuser"
+	job.Project = "testproj"
+	job.Cluster = "fritz"
+	job.SubCluster = "main"
+	job.Partition = "singlenode"
+	job.State = schema.JobStateRunning
+	job.Walltime = 3600
+	job.NumNodes = 1
+	job.NumHWThreads = 72
+	job.Resources = []*schema.Resource{{Hostname: hostname}}
+
+	return job
+}
+
+// Starts the job and removes it when the test ends.
+func startTestJob(tb testing.TB, r *JobRepository, job *schema.JobMeta) int64 {
+	tb.Helper()
+
+	id, err := r.Start(job)
 	noErr(tb, err)
-	Connect("sqlite3", dbfile)
-	return GetJobRepository()
+	tb.Cleanup(func() {
+		if _, err := r.DB.Exec(r.DB.Rebind(`DELETE FROM job WHERE id = ?`), id); err != nil {
+			tb.Errorf("removing test job %d failed: %v", id, err)
+		}
+	})
+
+	return id
 }
 
 func noErr(tb testing.TB, err error) {
@@ -0,0 +1,409 @@
+// Copyright (C) 2022 NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ClusterCockpit/cc-backend/internal/graph/model"
+	"github.com/ClusterCockpit/cc-backend/pkg/archive"
+	"github.com/ClusterCockpit/cc-backend/pkg/log"
+	"github.com/ClusterCockpit/cc-backend/pkg/schema"
+	sq "github.com/Masterminds/squirrel"
+)
+
+func scanReservation(row interface{ Scan(...interface{}) error }) (*model.Reservation, error) {
+	var from, to int64
+	res := &model.Reservation{}
+	if err := row.Scan(&res.ID, &res.Cluster, &res.Nodes, &res.Type, &res.Description, &from, &to, &res.Author); err != nil {
+		return nil, err
+	}
+
+	res.From, res.To = time.Unix(from, 0), time.Unix(to, 0)
+	return res, nil
+}
+
+func (r *NodeRepository) selectReservations() sq.SelectBuilder {
+	return r.builder.Select("reservation.id", "reservation.cluster", "reservation.nodes", "reservation.reservation_type",
+		"reservation.description", "reservation.start_time", "reservation.stop_time", "reservation.author").
+		From("reservation")
+}
+
+// GetReservations returns the maintenance windows and reservations overlapping
+// the time range from `from` to `to`, optionally restricted to a cluster,
+// ordered by start time. Missing bounds are open.
+func (r *NodeRepository) GetReservations(cluster *string, from, to *time.Time) ([]*model.Reservation, error) {
+	query := r.selectReservations().OrderBy("reservation.start_time", "reservation.id")
+	if cluster != nil {
+		query = query.Where("reservation.cluster = ?", *cluster)
+	}
+	if from != nil {
+		query = query.Where("reservation.stop_time > ?", from.Unix())
+	}
+	if to != nil {
+		query = query.Where("reservation.start_time < ?", to.Unix())
+	}
+
+	rows, err := query.RunWith(r.DB).Query()
+	if err != nil {
+		log.Error("Error while running query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	reservations := make([]*model.Reservation, 0)
+	for rows.Next() {
+		res, err := scanReservation(rows)
+		if err != nil {
+			log.Warn("Error while scanning rows")
+			return nil, err
+		}
+		reservations = append(reservations, res)
+	}
+
+	return reservations, rows.Err()
+}
+
+// GetReservation returns the reservation with the database id `id`.
+func (r *NodeRepository) GetReservation(id int64) (*model.Reservation, error) {
+	return scanReservation(r.selectReservations().Where("reservation.id = ?", id).RunWith(r.DB).QueryRow())
+}
+
+// SaveReservation creates a new reservation if `id` is nil, otherwise it
+// replaces the reservation with the database id `id`. The user in the context
+// is recorded as author.
+func (r *NodeRepository) SaveReservation(ctx context.Context, id *int64, input *model.ReservationInput) (*model.Reservation, error) {
+	if input.Cluster == "" {
+		return nil, errors.New("REPOSITORY/RESERVATION > cluster must not be empty")
+	}
+	if !input.Type.IsValid() {
+		return nil, fmt.Errorf("REPOSITORY/RESERVATION > invalid type '%s'", input.Type)
+	}
+	if nl, err := archive.ParseNodeList(input.Nodes); err != nil || nl.NodeCount() == 0 {
+		return nil, fmt.Errorf("REPOSITORY/RESERVATION > invalid node list '%s'", input.Nodes)
+	}
+	if !input.To.After(input.From) {
+		return nil, errors.New("REPOSITORY/RESERVATION > time range ends before it starts")
+	}
+
+	res := &model.Reservation{
+		Cluster: input.Cluster,
+		Nodes:   input.Nodes,
+		Type:    input.Type,
+		From:    time.Unix(input.From.Unix(), 0),
+		To:      time.Unix(input.To.Unix(), 0),
+		Author:  AuditSystemActor,
+	}
+	if input.Description != nil {
+		res.Description = *input.Description
+	}
+	if user := GetUserFromContext(ctx); user != nil {
+		res.Author = user.Username
+	}
+
+	if id == nil {
+		newId, err := insertReturningId(r.DB, r.driver, `INSERT INTO reservation
+			(cluster, nodes, reservation_type, description, start_time, stop_time, author) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			res.Cluster, res.Nodes, res.Type, res.Description, res.From.Unix(), res.To.Unix(), res.Author)
+		if err != nil {
+			log.Errorf("Error while inserting reservation: %v", err)
+			return nil, err
+		}
+		res.ID = newId
+		return res, nil
+	}
+
+	if _, err := r.GetReservation(*id); err != nil {
+		return nil, err
+	}
+	if _, err := r.builder.Update("reservation").
+		Set("cluster", res.Cluster).Set("nodes", res.Nodes).Set("reservation_type", res.Type).
+		Set("description", res.Description).Set("start_time", res.From.Unix()).Set("stop_time", res.To.Unix()).
+		Set("author", res.Author).
+		Where("reservation.id = ?", *id).RunWith(r.DB).Exec(); err != nil {
+		log.Errorf("Error while updating reservation %d: %v", *id, err)
+		return nil, err
+	}
+
+	res.ID = *id
+	return res, nil
+}
+
+// DeleteReservation deletes the reservation with the database id `id`.
+func (r *NodeRepository) DeleteReservation(id int64) (*model.Reservation, error) {
+	res, err := r.GetReservation(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := r.builder.Delete("reservation").Where("reservation.id = ?", id).RunWith(r.DB).Exec(); err != nil {
+		log.Errorf("Error while deleting reservation %d: %v", id, err)
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// ReservationsOfHost returns the reservations whose node list contains the host.
+func ReservationsOfHost(reservations []*model.Reservation, hostname string) []*model.Reservation {
+	res := make([]*model.Reservation, 0)
+	for _, r := range reservations {
+		if nl, err := archive.ParseNodeList(r.Nodes); err == nil && nl.Contains(hostname) {
+			res = append(res, r)
+		}
+	}
+
+	return res
+}
+
+// GetJobReservations returns the reservations of the nodes of the job
+// overlapping the job.
+func (r *NodeRepository) GetJobReservations(job *schema.Job) ([]*model.Reservation, error) {
+	from, to := job.StartTime, time.Now()
+	if job.State != schema.JobStateRunning {
+		to = job.StartTime.Add(time.Duration(job.Duration) * time.Second)
+	}
+
+	reservations, err := r.GetReservations(&job.Cluster, &from, &to)
+	if err != nil || len(reservations) == 0 {
+		return reservations, err
+	}
+
+	res := make([]*model.Reservation, 0)
+	for _, reservation := range reservations {
+		nl, err := archive.ParseNodeList(reservation.Nodes)
+		if err != nil {
+			continue
+		}
+		for _, resource := range job.Resources {
+			if nl.Contains(resource.Hostname) {
+				res = append(res, reservation)
+				break
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// Returns the length of the intersection of two time ranges in seconds.
+func overlap(start1, stop1, start2, stop2 int64) int64 {
+	if start2 > start1 {
+		start1 = start2
+	}
+	if stop2 < stop1 {
+		stop1 = stop2
+	}
+	if stop1 < start1 {
+		return 0
+	}
+
+	return stop1 - start1
+}
+
+type timeRange struct{ start, stop int64 }
+
+// Returns the union of the time ranges as disjoint ranges ordered by start.
+func mergeRanges(ranges []timeRange) []timeRange {
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].start < ranges[j].start })
+	merged := make([]timeRange, 0, len(ranges))
+	for _, tr := range ranges {
+		if n := len(merged); n > 0 && tr.start <= merged[n-1].stop {
+			if tr.stop > merged[n-1].stop {
+				merged[n-1].stop = tr.stop
+			}
+			continue
+		}
+		merged = append(merged, tr)
+	}
+
+	return merged
+}
+
+// Returns the total length of the time ranges in seconds.
+func rangesLength(ranges []timeRange) int64 {
+	var length int64
+	for _, tr := range ranges {
+		length += tr.stop - tr.start
+	}
+
+	return length
+}
+
+// Returns the length of the intersection of two unions of time ranges in
+// seconds, both as returned by mergeRanges.
+func rangesOverlap(a, b []timeRange) int64 {
+	var length int64
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		length += overlap(a[i].start, a[i].stop, b[j].start, b[j].stop)
+		if a[i].stop < b[j].stop {
+			i++
+		} else {
+			j++
+		}
+	}
+
+	return length
+}
+
+// Utilization returns the allocated node hours of every subcluster of the
+// cluster between `from` and `to`. Maintenance windows and reservations count
+// as available only as far as the reserved nodes were used by jobs, so that
+// reserved but idle nodes are not counted as wasted. Overlapping reservations
+// of a node and jobs sharing a node are counted once.
+func (r *JobRepository) Utilization(cluster *schema.Cluster, from, to time.Time) ([]*model.SubClusterUtilization, error) {
+	start, stop := from.Unix(), to.Unix()
+	if stop <= start {
+		return nil, errors.New("REPOSITORY/RESERVATION > time range ends before it starts")
+	}
+
+	type subCluster struct {
+		nodes archive.NodeList
+		util  *model.SubClusterUtilization
+		idle  int64 // Unused reserved node seconds
+	}
+	subClusters := make([]*subCluster, 0, len(cluster.SubClusters))
+	bySubCluster := make(map[string]*subCluster, len(cluster.SubClusters))
+	for _, sc := range cluster.SubClusters {
+		s := &subCluster{util: &model.SubClusterUtilization{SubCluster: sc.Name}}
+		if sc.Nodes != "" {
+			nl, err := archive.ParseNodeList(sc.Nodes)
+			if err != nil {
+				return nil, fmt.Errorf("REPOSITORY/RESERVATION > invalid node list of subcluster %s/%s: %w", cluster.Name, sc.Name, err)
+			}
+			s.nodes = nl
+			s.util.NodeHours = float64(nl.NodeCount()) * float64(stop-start) / 3600
+		}
+		subClusters = append(subClusters, s)
+		bySubCluster[sc.Name] = s
+	}
+
+	reservations, err := GetNodeRepository().GetReservations(&cluster.Name, &from, &to)
+	if err != nil {
+		return nil, err
+	}
+	reservedHosts := make(map[string]bool)
+	reservedNodes := make([][]string, len(reservations))
+	for i, res := range reservations {
+		nl, err := archive.ParseNodeList(res.Nodes)
+		if err != nil {
+			log.Warnf("Invalid node list of reservation %d: %v", res.ID, err)
+			continue
+		}
+		reservedNodes[i] = nl.PrintList()
+		for _, host := range reservedNodes[i] {
+			reservedHosts[host] = true
+		}
+	}
+
+	rows, err := r.builder.Select("job.subcluster", "job.start_time", "job.duration", "job.job_state", "job.num_nodes", "job.resources").
+		From("job").
+		Where("job.cluster = ?", cluster.Name).
+		Where("job.deleted_at IS NULL").
+		Where("job.start_time < ?", stop).
+		Where(sq.Or{sq.Eq{"job.job_state": schema.JobStateRunning}, sq.Expr("job.start_time + job.duration > ?", start)}).
+		RunWith(r.stmtCache).Query()
+	if err != nil {
+		log.Error("Error while running query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Time ranges of the jobs on reserved hosts
+	jobsOnHost := make(map[string][]timeRange)
+	now := time.Now().Unix()
+	for rows.Next() {
+		var subcluster string
+		var jobStart, duration, numNodes int64
+		var state schema.JobState
+		var raw []byte
+		if err := rows.Scan(&subcluster, &jobStart, &duration, &state, &numNodes, &raw); err != nil {
+			log.Warn("Error while scanning rows")
+			return nil, err
+		}
+
+		jobStop := jobStart + duration
+		if state == schema.JobStateRunning {
+			jobStop = now
+		}
+		if s, ok := bySubCluster[subcluster]; ok {
+			s.util.AllocatedNodeHours += float64(numNodes*overlap(jobStart, jobStop, start, stop)) / 3600
+		}
+
+		if len(reservedHosts) == 0 {
+			continue
+		}
+		var resources []*schema.Resource
+		if err := json.Unmarshal(raw, &resources); err != nil {
+			log.Warn("Error while unmarshaling raw resources json")
+			return nil, err
+		}
+		for _, res := range resources {
+			if reservedHosts[res.Hostname] {
+				jobsOnHost[res.Hostname] = append(jobsOnHost[res.Hostname], timeRange{jobStart, jobStop})
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Time ranges of the maintenance windows and reservations per host,
+	// clipped to the time range
+	maintenanceOfHost := make(map[string][]timeRange)
+	reservedOfHost := make(map[string][]timeRange)
+	for i, res := range reservations {
+		tr := timeRange{res.From.Unix(), res.To.Unix()}
+		if tr.start < start {
+			tr.start = start
+		}
+		if tr.stop > stop {
+			tr.stop = stop
+		}
+		for _, host := range reservedNodes[i] {
+			if res.Type == model.ReservationTypeMaintenance {
+				maintenanceOfHost[host] = append(maintenanceOfHost[host], tr)
+			} else {
+				reservedOfHost[host] = append(reservedOfHost[host], tr)
+			}
+		}
+	}
+
+	for host := range reservedHosts {
+		var s *subCluster
+		for _, sc := range subClusters {
+			if sc.nodes != nil && sc.nodes.Contains(host) {
+				s = sc
+				break
+			}
+		}
+		if s == nil {
+			continue
+		}
+
+		maintenance, reserved := mergeRanges(maintenanceOfHost[host]), mergeRanges(reservedOfHost[host])
+		s.util.MaintenanceNodeHours += float64(rangesLength(maintenance)) / 3600
+		s.util.ReservedNodeHours += float64(rangesLength(reserved)) / 3600
+
+		// Maintenance windows within reservations are not subtracted twice
+		unavailable := mergeRanges(append(append([]timeRange{}, maintenance...), reserved...))
+		s.idle += rangesLength(unavailable) - rangesOverlap(unavailable, mergeRanges(jobsOnHost[host]))
+	}
+
+	utilization := make([]*model.SubClusterUtilization, 0, len(subClusters))
+	for _, s := range subClusters {
+		if available := s.util.NodeHours - float64(s.idle)/3600; available > 0 {
+			s.util.Utilization = s.util.AllocatedNodeHours / available
+		}
+		utilization = append(utilization, s.util)
+	}
+
+	return utilization, nil
+}
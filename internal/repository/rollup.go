@@ -0,0 +1,406 @@
+// Copyright (C) 2022 NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+package repository
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/ClusterCockpit/cc-backend/internal/config"
+	"github.com/ClusterCockpit/cc-backend/internal/graph/model"
+	"github.com/ClusterCockpit/cc-backend/pkg/log"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+)
+
+// The rollup tables job_rollup and job_rollup_histogram hold the daily usage
+// of finished jobs per cluster, partition, user and project, by the UTC day
+// the jobs started. Statistics queries with filters expressible on these
+// dimensions combine the rollups with the jobs not covered by them: running
+// jobs and jobs started on days only partially covered by the start time
+// filter. The rollups are updated when jobs stop, are archived or deleted
+// and rebuilt by a nightly service.
+
+const rollupDay = 24 * 3600
+
+var rollupHistogramKinds = []string{"duration", "nodes", "cores", "accs"}
+
+// The dimensions of a rollup row.
+type rollupGroup struct {
+	Day       int64  `db:"day"`
+	Cluster   string `db:"cluster"`
+	Partition string `db:"partition"`
+	User      string `db:"user"`
+	Project   string `db:"project"`
+}
+
+func (r *JobRepository) rollupKeyColumns() []string {
+	return []string{"day", "cluster", quoteIdent(r.driver, "partition"), quoteIdent(r.driver, "user"), "project"}
+}
+
+func rollupKeyExpressions() []string {
+	return []string{
+		fmt.Sprintf("job.start_time - job.start_time %% %d", rollupDay),
+		"job.cluster", "COALESCE(job.partition, '')", "job.user", "job.project",
+	}
+}
+
+// Returns the value of the histogram `kind` for finished jobs.
+func (r *JobRepository) rollupHistogramValue(kind string) string {
+	switch kind {
+	case "duration":
+		return fmt.Sprintf("CAST(ROUND(job.duration / 3600) as %s)", r.getCastType())
+	case "nodes":
+		return "job.num_nodes"
+	case "cores":
+		return "COALESCE(job.num_hwthreads, 0)"
+	default:
+		return "COALESCE(job.num_acc, 0)"
+	}
+}
+
+// Recomputes the rollups of the jobs started in [from, to), restricted to the
+// group if it is not nil. The range must be aligned to days.
+func (r *JobRepository) refreshRollups(from, to int64, group *rollupGroup) error {
+	jobCond := sq.And{sq.Expr("job.start_time >= ?", from), sq.Expr("job.start_time < ?", to)}
+	rollupCond := sq.And{sq.Expr("day >= ?", from), sq.Expr("day < ?", to)}
+	if group != nil {
+		jobCond = append(jobCond, sq.Eq{"job.cluster": group.Cluster, "COALESCE(job.partition, '')": group.Partition,
+			"job.user": group.User, "job.project": group.Project})
+		rollupCond = append(rollupCond, sq.Eq{"cluster": group.Cluster, quoteIdent(r.driver, "partition"): group.Partition,
+			quoteIdent(r.driver, "user"): group.User, "project": group.Project})
+	}
+
+	tx, err := r.DB.Beginx()
+	if err != nil {
+		log.Warn("Error while starting rollup transaction")
+		return err
+	}
+	if err := r.insertRollups(tx, jobCond, rollupCond); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *JobRepository) insertRollups(tx *sqlx.Tx, jobCond, rollupCond sq.Sqlizer) error {
+	for _, table := range []string{"job_rollup", "job_rollup_histogram"} {
+		if _, err := r.builder.Delete(table).Where(rollupCond).RunWith(tx).Exec(); err != nil {
+			log.Warnf("Error while deleting from %s", table)
+			return err
+		}
+	}
+
+	castType := r.getCastType()
+	keys := rollupKeyExpressions()
+	finished := r.builder.Select(keys...).From("job").
+		Where("job.job_state != 'running'").Where("job.deleted_at IS NULL").Where(jobCond).
+		GroupBy(keys...)
+
+	stats := finished.Columns("COUNT(job.id)",
+		fmt.Sprintf("SUM(CASE WHEN job.duration < %d THEN 1 ELSE 0 END)", config.Keys.ShortRunningJobsDuration),
+		fmt.Sprintf("SUM(CAST(job.duration as %s))", castType),
+		"SUM(job.num_nodes)",
+		fmt.Sprintf("SUM(CAST(job.duration as %s) * job.num_nodes)", castType),
+		"SUM(COALESCE(job.num_hwthreads, 0))",
+		fmt.Sprintf("SUM(CAST(job.duration as %s) * COALESCE(job.num_hwthreads, 0))", castType),
+		"SUM(COALESCE(job.num_acc, 0))",
+		fmt.Sprintf("SUM(CAST(job.duration as %s) * COALESCE(job.num_acc, 0))", castType),
+		"SUM(job.energy)")
+	if _, err := r.builder.Insert("job_rollup").
+		Columns(append(r.rollupKeyColumns(), "jobs", "short_jobs", "walltime", "nodes", "node_seconds",
+			"cores", "core_seconds", "accs", "acc_seconds", "energy")...).
+		Select(stats).RunWith(tx).Exec(); err != nil {
+		log.Warn("Error while inserting into job_rollup")
+		return err
+	}
+
+	for _, kind := range rollupHistogramKinds {
+		value := r.rollupHistogramValue(kind)
+		histogram := finished.Columns(fmt.Sprintf("'%s'", kind), value, "COUNT(job.id)").GroupBy(value)
+		if _, err := r.builder.Insert("job_rollup_histogram").
+			Columns(append(r.rollupKeyColumns(), "kind", "value", "count")...).
+			Select(histogram).RunWith(tx).Exec(); err != nil {
+			log.Warnf("Error while inserting %s histogram into job_rollup_histogram", kind)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RefreshRollups rebuilds all rollups from the job table.
+func (r *JobRepository) RefreshRollups() error {
+	start := time.Now()
+	if err := r.refreshRollups(0, math.MaxInt64, nil); err != nil {
+		log.Errorf("Error while refreshing rollups: %v", err)
+		return err
+	}
+
+	log.Infof("Timer RefreshRollups %s", time.Since(start))
+	return nil
+}
+
+// InitRollups rebuilds the rollups if they do not cover all finished jobs,
+// e.g. after the migration adding them.
+func (r *JobRepository) InitRollups() error {
+	var rollups, jobs int64
+	if err := r.DB.Get(&rollups, `SELECT COALESCE(SUM(jobs), 0) FROM job_rollup`); err != nil {
+		log.Warn("Error while counting rollup jobs")
+		return err
+	}
+	if err := r.DB.Get(&jobs, `SELECT count(*) FROM job WHERE job.job_state != 'running' AND job.deleted_at IS NULL`); err != nil {
+		log.Warn("Error while counting jobs")
+		return err
+	}
+	if rollups == jobs {
+		return nil
+	}
+
+	log.Infof("Building rollups for %d jobs", jobs)
+	return r.RefreshRollups()
+}
+
+// Recomputes the rollups of all jobs started before startTime.
+func (r *JobRepository) refreshRollupsBefore(startTime int64) {
+	to := startTime - startTime%rollupDay + rollupDay
+	if err := r.refreshRollups(0, to, nil); err != nil {
+		log.Warnf("Error while refreshing rollups before %d: %v", startTime, err)
+	}
+}
+
+// Recomputes the rollup group of the job. Failures are only logged, the
+// nightly rebuild fixes the rollups.
+func (r *JobRepository) refreshRollupsOfJob(id int64) {
+	r.refreshRollupsOfJobs([]int64{id})
+}
+
+// Recomputes the rollup groups of the jobs, every group once. Failures are
+// only logged, the nightly rebuild fixes the rollups.
+func (r *JobRepository) refreshRollupsOfJobs(ids []int64) {
+	if len(ids) == 0 {
+		return
+	}
+
+	var groups []rollupGroup
+	keys := rollupKeyExpressions()
+	query, args, err := r.builder.Select(keys[0]+" AS day", keys[1], keys[2]+" AS "+quoteIdent(r.driver, "partition"),
+		keys[3], keys[4]).Distinct().From("job").Where(sq.Eq{"job.id": ids}).ToSql()
+	if err != nil {
+		log.Warn("Error while converting query to sql")
+		return
+	}
+	if err := r.DB.Select(&groups, query, args...); err != nil {
+		log.Warnf("Error while fetching rollup groups of jobs, DB IDs %v: %v", ids, err)
+		return
+	}
+
+	for i := range groups {
+		if err := r.refreshRollups(groups[i].Day, groups[i].Day+rollupDay, &groups[i]); err != nil {
+			log.Warnf("Error while refreshing rollups of jobs started on day %d: %v", groups[i].Day, err)
+		}
+	}
+}
+
+// Returns the range of start times [from, to) covered by the rollups for the
+// filters or false if the filters are not expressible on the rollups.
+func rollupRange(filters []*model.JobFilter) (int64, int64, bool) {
+	from, to := int64(0), int64(math.MaxInt64)
+	timeFilters := 0
+	for _, f := range filters {
+		expressible := model.JobFilter{
+			User: f.User, Project: f.Project, Cluster: f.Cluster, Partition: f.Partition, StartTime: f.StartTime,
+		}
+		if !reflect.DeepEqual(*f, expressible) {
+			return 0, 0, false
+		}
+
+		if f.StartTime != nil {
+			if timeFilters++; timeFilters > 1 {
+				return 0, 0, false
+			}
+			if f.StartTime.From != nil {
+				ts := f.StartTime.From.Unix()
+				from = (ts + rollupDay - 1) / rollupDay * rollupDay
+			}
+			if f.StartTime.To != nil {
+				// The end of the filter is inclusive
+				ts := f.StartTime.To.Unix() + 1
+				to = ts / rollupDay * rollupDay
+			}
+		}
+	}
+
+	return from, to, from < to
+}
+
+func buildRollupWhereClause(filter *model.JobFilter, table string, query sq.SelectBuilder) sq.SelectBuilder {
+	if filter.User != nil {
+		query = buildStringCondition(table+".user", filter.User, query)
+	}
+	if filter.Project != nil {
+		query = buildStringCondition(table+".project", filter.Project, query)
+	}
+	if filter.Cluster != nil {
+		query = buildStringCondition(table+".cluster", filter.Cluster, query)
+	}
+	if filter.Partition != nil {
+		query = buildStringCondition(table+".partition", filter.Partition, query)
+	}
+
+	return query
+}
+
+// Returns the union of the rollup rows of `table` and the jobs not covered by
+// the rollups, both matching the filters. The columns of the rollups and the
+// jobs are given as pairs.
+func (r *JobRepository) rollupSource(
+	ctx context.Context,
+	filters []*model.JobFilter,
+	from, to int64,
+	table string,
+	columns [][2]string) (sq.SelectBuilder, error) {
+
+	rollupCols, jobCols := make([]string, len(columns)), make([]string, len(columns))
+	for i, c := range columns {
+		rollupCols[i], jobCols[i] = c[0], c[1]
+	}
+
+	rollups, err := securityCheck(ctx, r.builder.Select(rollupCols...).From(table), table)
+	if err != nil {
+		return rollups, err
+	}
+	rollups = rollups.Where(table+".day >= ?", from).Where(table+".day < ?", to)
+
+	jobs, err := SecurityCheck(ctx, sq.Select(jobCols...).From("job"))
+	if err != nil {
+		return jobs, err
+	}
+	jobs = jobs.Where("(job.job_state = 'running' OR job.start_time < ? OR job.start_time >= ?)", from, to)
+
+	for _, f := range filters {
+		rollups = buildRollupWhereClause(f, table, rollups)
+		jobs = BuildWhereClause(ctx, f, jobs)
+	}
+
+	jobsSql, jobsArgs, err := jobs.ToSql()
+	if err != nil {
+		log.Warn("Error while converting query to sql")
+		return jobs, err
+	}
+
+	return rollups.Suffix("UNION ALL "+jobsSql, jobsArgs...), nil
+}
+
+// Builds the statistics query on the rollups, with the same columns as
+// buildStatsQuery. The group column `col` is one of groupBy2column.
+func (r *JobRepository) buildRollupStatsQuery(
+	ctx context.Context,
+	filters []*model.JobFilter,
+	from, to int64,
+	col string) (sq.SelectBuilder, error) {
+
+	castType := r.getCastType()
+	walltime := fmt.Sprintf("(CASE WHEN job.job_state = 'running' THEN %d - job.start_time ELSE job.duration END)", time.Now().Unix())
+	columns := [][2]string{
+		{"job_rollup.jobs", "1"},
+		{"job_rollup.walltime", walltime},
+		{"job_rollup.nodes", "job.num_nodes"},
+		{"job_rollup.node_seconds", walltime + " * job.num_nodes"},
+		{"job_rollup.cores", "job.num_hwthreads"},
+		{"job_rollup.core_seconds", walltime + " * job.num_hwthreads"},
+		{"job_rollup.accs", "job.num_acc"},
+		{"job_rollup.acc_seconds", walltime + " * job.num_acc"},
+		{"job_rollup.energy", "job.energy"},
+	}
+	for i, c := range columns {
+		name := strings.TrimPrefix(c[0], "job_rollup.")
+		columns[i] = [2]string{c[0] + " AS " + name, c[1] + " AS " + name}
+	}
+	if col != "" {
+		columns = append([][2]string{{strings.Replace(col, "job.", "job_rollup.", 1) + " AS grp", col + " AS grp"}}, columns...)
+	}
+
+	source, err := r.rollupSource(ctx, filters, from, to, "job_rollup", columns)
+	if err != nil {
+		return source, err
+	}
+
+	aggregates := []string{
+		fmt.Sprintf("CAST(SUM(src.jobs) as %s) as totalJobs", castType),
+		fmt.Sprintf("CAST(ROUND(SUM(src.walltime) / 3600) as %s) as totalWalltime", castType),
+		fmt.Sprintf("CAST(SUM(src.nodes) as %s) as totalNodes", castType),
+		fmt.Sprintf("CAST(ROUND(SUM(src.node_seconds) / 3600) as %s) as totalNodeHours", castType),
+		fmt.Sprintf("CAST(SUM(src.cores) as %s) as totalCores", castType),
+		fmt.Sprintf("CAST(ROUND(SUM(src.core_seconds) / 3600) as %s) as totalCoreHours", castType),
+		fmt.Sprintf("CAST(SUM(src.accs) as %s) as totalAccs", castType),
+		fmt.Sprintf("CAST(ROUND(SUM(src.acc_seconds) / 3600) as %s) as totalAccHours", castType),
+		"SUM(src.energy) as totalEnergy",
+	}
+	if col != "" {
+		return r.builder.Select(append([]string{"src.grp"}, aggregates...)...).FromSelect(source, "src").GroupBy("src.grp"), nil
+	}
+
+	return r.builder.Select(aggregates...).FromSelect(source, "src"), nil
+}
+
+// Builds the job count query on the rollups, with the same columns as
+// buildCountQuery. Running jobs are not counted with the rollups.
+func (r *JobRepository) buildRollupCountQuery(
+	ctx context.Context,
+	filters []*model.JobFilter,
+	from, to int64,
+	kind string,
+	col string) (sq.SelectBuilder, error) {
+
+	columns := [][2]string{{"job_rollup.jobs AS cnt", "1 AS cnt"}}
+	if kind == "short" {
+		columns = [][2]string{{"job_rollup.short_jobs AS cnt",
+			fmt.Sprintf("CASE WHEN job.duration < %d THEN 1 ELSE 0 END AS cnt", config.Keys.ShortRunningJobsDuration)}}
+	}
+	if col != "" {
+		columns = append([][2]string{{strings.Replace(col, "job.", "job_rollup.", 1) + " AS grp", col + " AS grp"}}, columns...)
+	}
+
+	source, err := r.rollupSource(ctx, filters, from, to, "job_rollup", columns)
+	if err != nil {
+		return source, err
+	}
+
+	count := fmt.Sprintf("CAST(SUM(src.cnt) as %s)", r.getCastType())
+	if col != "" {
+		return r.builder.Select("src.grp", count).FromSelect(source, "src").GroupBy("src.grp"), nil
+	}
+
+	return r.builder.Select(count).FromSelect(source, "src"), nil
+}
+
+// Builds the histogram query on the rollups. The histogram `kind` is one of
+// rollupHistogramKinds, `value` is the value of the histogram for jobs as
+// used by AddHistograms.
+func (r *JobRepository) buildRollupHistogramQuery(
+	ctx context.Context,
+	filters []*model.JobFilter,
+	from, to int64,
+	kind string,
+	value string) (sq.SelectBuilder, error) {
+
+	source, err := r.rollupSource(ctx, filters, from, to, "job_rollup_histogram", [][2]string{
+		{"job_rollup_histogram.value", value},
+		{"job_rollup_histogram.count", "1 AS count"},
+	})
+	if err != nil {
+		return source, err
+	}
+	source = source.Where("job_rollup_histogram.kind = ?", kind)
+
+	return r.builder.Select("src.value", fmt.Sprintf("CAST(SUM(src.count) as %s) AS count", r.getCastType())).
+		FromSelect(source, "src").GroupBy("src.value"), nil
+}
@@ -38,7 +38,18 @@ var sortBy2column = map[model.SortByAggregate]string{
 	model.SortByAggregateTotalacchours:  "totalAccHours",
 }
 
+// Numeric job fields quantiles can be computed of, in addition to footprint
+// keys. The duration of running jobs is computed separately.
+var quantileColumns = map[string]string{
+	"walltime":     "job.walltime",
+	"numNodes":     "job.num_nodes",
+	"numHWThreads": "job.num_hwthreads",
+	"numAcc":       "job.num_acc",
+	"energy":       "job.energy",
+}
+
 func (r *JobRepository) buildCountQuery(
+	ctx context.Context,
 	filter []*model.JobFilter,
 	kind string,
 	col string) sq.SelectBuilder {
@@ -47,10 +58,10 @@ func (r *JobRepository) buildCountQuery(
 
 	if col != "" {
 		// Scan columns: id, cnt
-		query = sq.Select(col, "COUNT(job.id)").From("job").GroupBy(col)
+		query = r.builder.Select(col, "COUNT(job.id)").From("job").GroupBy(col)
 	} else {
 		// Scan columns:  cnt
-		query = sq.Select("COUNT(job.id)").From("job")
+		query = r.builder.Select("COUNT(job.id)").From("job")
 	}
 
 	switch kind {
@@ -61,48 +72,65 @@ func (r *JobRepository) buildCountQuery(
 	}
 
 	for _, f := range filter {
-		query = BuildWhereClause(f, query)
+		query = BuildWhereClause(ctx, f, query)
 	}
 
 	return query
 }
 
+// Returns the job count query, on the rollups if the filters allow it.
+func (r *JobRepository) countQuery(
+	ctx context.Context,
+	filter []*model.JobFilter,
+	kind string,
+	col string) (sq.SelectBuilder, error) {
+
+	if from, to, ok := rollupRange(filter); ok && kind != "running" {
+		return r.buildRollupCountQuery(ctx, filter, from, to, kind, col)
+	}
+
+	return SecurityCheck(ctx, r.buildCountQuery(ctx, filter, kind, col))
+}
+
 func (r *JobRepository) buildStatsQuery(
+	ctx context.Context,
 	filter []*model.JobFilter,
 	col string) sq.SelectBuilder {
 
 	var query sq.SelectBuilder
 	castType := r.getCastType()
 
-	// fmt.Sprintf(`CAST(ROUND((CASE WHEN job.job_state = "running" THEN %d - job.start_time ELSE job.duration END) / 3600) as %s) as value`, time.Now().Unix(), castType)
+	// fmt.Sprintf(`CAST(ROUND((CASE WHEN job.job_state = 'running' THEN %d - job.start_time ELSE job.duration END) / 3600) as %s) as value`, time.Now().Unix(), castType)
 
 	if col != "" {
-		// Scan columns: id, totalJobs, totalWalltime, totalNodes, totalNodeHours, totalCores, totalCoreHours, totalAccs, totalAccHours
-		query = sq.Select(col, "COUNT(job.id) as totalJobs",
-			fmt.Sprintf(`CAST(ROUND(SUM((CASE WHEN job.job_state = "running" THEN %d - job.start_time ELSE job.duration END)) / 3600) as %s) as totalWalltime`, time.Now().Unix(), castType),
+		// Scan columns: id, totalJobs, totalWalltime, totalNodes, totalNodeHours, totalCores, totalCoreHours, totalAccs, totalAccHours, totalEnergy
+		query = r.builder.Select(col, "COUNT(job.id) as totalJobs",
+			fmt.Sprintf(`CAST(ROUND(SUM((CASE WHEN job.job_state = 'running' THEN %d - job.start_time ELSE job.duration END)) / 3600) as %s) as totalWalltime`, time.Now().Unix(), castType),
 			fmt.Sprintf(`CAST(SUM(job.num_nodes) as %s) as totalNodes`, castType),
-			fmt.Sprintf(`CAST(ROUND(SUM((CASE WHEN job.job_state = "running" THEN %d - job.start_time ELSE job.duration END) * job.num_nodes) / 3600) as %s) as totalNodeHours`, time.Now().Unix(), castType),
+			fmt.Sprintf(`CAST(ROUND(SUM((CASE WHEN job.job_state = 'running' THEN %d - job.start_time ELSE job.duration END) * job.num_nodes) / 3600) as %s) as totalNodeHours`, time.Now().Unix(), castType),
 			fmt.Sprintf(`CAST(SUM(job.num_hwthreads) as %s) as totalCores`, castType),
-			fmt.Sprintf(`CAST(ROUND(SUM((CASE WHEN job.job_state = "running" THEN %d - job.start_time ELSE job.duration END) * job.num_hwthreads) / 3600) as %s) as totalCoreHours`, time.Now().Unix(), castType),
+			fmt.Sprintf(`CAST(ROUND(SUM((CASE WHEN job.job_state = 'running' THEN %d - job.start_time ELSE job.duration END) * job.num_hwthreads) / 3600) as %s) as totalCoreHours`, time.Now().Unix(), castType),
 			fmt.Sprintf(`CAST(SUM(job.num_acc) as %s) as totalAccs`, castType),
-			fmt.Sprintf(`CAST(ROUND(SUM((CASE WHEN job.job_state = "running" THEN %d - job.start_time ELSE job.duration END) * job.num_acc) / 3600) as %s) as totalAccHours`, time.Now().Unix(), castType),
+			fmt.Sprintf(`CAST(ROUND(SUM((CASE WHEN job.job_state = 'running' THEN %d - job.start_time ELSE job.duration END) * job.num_acc) / 3600) as %s) as totalAccHours`, time.Now().Unix(), castType),
+			"SUM(job.energy) as totalEnergy",
 		).From("job").GroupBy(col)
 
 	} else {
-		// Scan columns: totalJobs, totalWalltime, totalNodes, totalNodeHours, totalCores, totalCoreHours, totalAccs, totalAccHours
-		query = sq.Select("COUNT(job.id)",
-			fmt.Sprintf(`CAST(ROUND(SUM((CASE WHEN job.job_state = "running" THEN %d - job.start_time ELSE job.duration END)) / 3600) as %s)`, time.Now().Unix(), castType),
+		// Scan columns: totalJobs, totalWalltime, totalNodes, totalNodeHours, totalCores, totalCoreHours, totalAccs, totalAccHours, totalEnergy
+		query = r.builder.Select("COUNT(job.id)",
+			fmt.Sprintf(`CAST(ROUND(SUM((CASE WHEN job.job_state = 'running' THEN %d - job.start_time ELSE job.duration END)) / 3600) as %s)`, time.Now().Unix(), castType),
 			fmt.Sprintf(`CAST(SUM(job.num_nodes) as %s)`, castType),
-			fmt.Sprintf(`CAST(ROUND(SUM((CASE WHEN job.job_state = "running" THEN %d - job.start_time ELSE job.duration END) * job.num_nodes) / 3600) as %s)`, time.Now().Unix(), castType),
+			fmt.Sprintf(`CAST(ROUND(SUM((CASE WHEN job.job_state = 'running' THEN %d - job.start_time ELSE job.duration END) * job.num_nodes) / 3600) as %s)`, time.Now().Unix(), castType),
 			fmt.Sprintf(`CAST(SUM(job.num_hwthreads) as %s)`, castType),
-			fmt.Sprintf(`CAST(ROUND(SUM((CASE WHEN job.job_state = "running" THEN %d - job.start_time ELSE job.duration END) * job.num_hwthreads) / 3600) as %s)`, time.Now().Unix(), castType),
+			fmt.Sprintf(`CAST(ROUND(SUM((CASE WHEN job.job_state = 'running' THEN %d - job.start_time ELSE job.duration END) * job.num_hwthreads) / 3600) as %s)`, time.Now().Unix(), castType),
 			fmt.Sprintf(`CAST(SUM(job.num_acc) as %s)`, castType),
-			fmt.Sprintf(`CAST(ROUND(SUM((CASE WHEN job.job_state = "running" THEN %d - job.start_time ELSE job.duration END) * job.num_acc) / 3600) as %s)`, time.Now().Unix(), castType),
+			fmt.Sprintf(`CAST(ROUND(SUM((CASE WHEN job.job_state = 'running' THEN %d - job.start_time ELSE job.duration END) * job.num_acc) / 3600) as %s)`, time.Now().Unix(), castType),
+			"SUM(job.energy)",
 		).From("job")
 	}
 
 	for _, f := range filter {
-		query = BuildWhereClause(f, query)
+		query = BuildWhereClause(ctx, f, query)
 	}
 
 	return query
@@ -126,6 +154,8 @@ func (r *JobRepository) getCastType() string {
 		castType = "int"
 	case "mysql":
 		castType = "unsigned"
+	case "postgres":
+		castType = "bigint"
 	default:
 		castType = ""
 	}
@@ -142,9 +172,13 @@ func (r *JobRepository) JobsStatsGrouped(
 
 	start := time.Now()
 	col := groupBy2column[*groupBy]
-	query := r.buildStatsQuery(filter, col)
-
-	query, err := SecurityCheck(ctx, query)
+	var query sq.SelectBuilder
+	var err error
+	if from, to, ok := rollupRange(filter); ok {
+		query, err = r.buildRollupStatsQuery(ctx, filter, from, to, col)
+	} else {
+		query, err = SecurityCheck(ctx, r.buildStatsQuery(ctx, filter, col))
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -169,7 +203,8 @@ func (r *JobRepository) JobsStatsGrouped(
 	for rows.Next() {
 		var id sql.NullString
 		var jobs, walltime, nodes, nodeHours, cores, coreHours, accs, accHours sql.NullInt64
-		if err := rows.Scan(&id, &jobs, &walltime, &nodes, &nodeHours, &cores, &coreHours, &accs, &accHours); err != nil {
+		var energy sql.NullFloat64
+		if err := rows.Scan(&id, &jobs, &walltime, &nodes, &nodeHours, &cores, &coreHours, &accs, &accHours, &energy); err != nil {
 			log.Warn("Error while scanning rows")
 			return nil, err
 		}
@@ -218,7 +253,8 @@ func (r *JobRepository) JobsStatsGrouped(
 						TotalCores:     totalCores,
 						TotalCoreHours: totalCoreHours,
 						TotalAccs:      totalAccs,
-						TotalAccHours:  totalAccHours})
+						TotalAccHours:  totalAccHours,
+						TotalEnergy:    energy.Float64})
 			} else {
 				stats = append(stats,
 					&model.JobsStatistics{
@@ -230,7 +266,8 @@ func (r *JobRepository) JobsStatsGrouped(
 						TotalCores:     totalCores,
 						TotalCoreHours: totalCoreHours,
 						TotalAccs:      totalAccs,
-						TotalAccHours:  totalAccHours})
+						TotalAccHours:  totalAccHours,
+						TotalEnergy:    energy.Float64})
 			}
 		}
 	}
@@ -244,8 +281,13 @@ func (r *JobRepository) JobsStats(
 	filter []*model.JobFilter) ([]*model.JobsStatistics, error) {
 
 	start := time.Now()
-	query := r.buildStatsQuery(filter, "")
-	query, err := SecurityCheck(ctx, query)
+	var query sq.SelectBuilder
+	var err error
+	if from, to, ok := rollupRange(filter); ok {
+		query, err = r.buildRollupStatsQuery(ctx, filter, from, to, "")
+	} else {
+		query, err = SecurityCheck(ctx, r.buildStatsQuery(ctx, filter, ""))
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -254,7 +296,8 @@ func (r *JobRepository) JobsStats(
 	stats := make([]*model.JobsStatistics, 0, 1)
 
 	var jobs, walltime, nodes, nodeHours, cores, coreHours, accs, accHours sql.NullInt64
-	if err := row.Scan(&jobs, &walltime, &nodes, &nodeHours, &cores, &coreHours, &accs, &accHours); err != nil {
+	var energy sql.NullFloat64
+	if err := row.Scan(&jobs, &walltime, &nodes, &nodeHours, &cores, &coreHours, &accs, &accHours, &energy); err != nil {
 		log.Warn("Error while scanning rows")
 		return nil, err
 	}
@@ -277,7 +320,8 @@ func (r *JobRepository) JobsStats(
 				TotalWalltime:  int(walltime.Int64),
 				TotalNodeHours: totalNodeHours,
 				TotalCoreHours: totalCoreHours,
-				TotalAccHours:  totalAccHours})
+				TotalAccHours:  totalAccHours,
+				TotalEnergy:    energy.Float64})
 	}
 
 	log.Debugf("Timer JobStats %s", time.Since(start))
@@ -291,8 +335,7 @@ func (r *JobRepository) JobCountGrouped(
 
 	start := time.Now()
 	col := groupBy2column[*groupBy]
-	query := r.buildCountQuery(filter, "", col)
-	query, err := SecurityCheck(ctx, query)
+	query, err := r.countQuery(ctx, filter, "", col)
 	if err != nil {
 		return nil, err
 	}
@@ -332,8 +375,7 @@ func (r *JobRepository) AddJobCountGrouped(
 
 	start := time.Now()
 	col := groupBy2column[*groupBy]
-	query := r.buildCountQuery(filter, kind, col)
-	query, err := SecurityCheck(ctx, query)
+	query, err := r.countQuery(ctx, filter, kind, col)
 	if err != nil {
 		return nil, err
 	}
@@ -379,8 +421,7 @@ func (r *JobRepository) AddJobCount(
 	kind string) ([]*model.JobsStatistics, error) {
 
 	start := time.Now()
-	query := r.buildCountQuery(filter, kind, "")
-	query, err := SecurityCheck(ctx, query)
+	query, err := r.countQuery(ctx, filter, kind, "")
 	if err != nil {
 		return nil, err
 	}
@@ -425,26 +466,26 @@ func (r *JobRepository) AddHistograms(
 
 	castType := r.getCastType()
 	var err error
-	value := fmt.Sprintf(`CAST(ROUND((CASE WHEN job.job_state = "running" THEN %d - job.start_time ELSE job.duration END) / 3600) as %s) as value`, time.Now().Unix(), castType)
-	stat.HistDuration, err = r.jobsStatisticsHistogram(ctx, value, filter)
+	value := fmt.Sprintf(`CAST(ROUND((CASE WHEN job.job_state = 'running' THEN %d - job.start_time ELSE job.duration END) / 3600) as %s) as value`, time.Now().Unix(), castType)
+	stat.HistDuration, err = r.jobsStatisticsHistogram(ctx, "duration", value, filter)
 	if err != nil {
 		log.Warn("Error while loading job statistics histogram: running jobs")
 		return nil, err
 	}
 
-	stat.HistNumNodes, err = r.jobsStatisticsHistogram(ctx, "job.num_nodes as value", filter)
+	stat.HistNumNodes, err = r.jobsStatisticsHistogram(ctx, "nodes", "job.num_nodes as value", filter)
 	if err != nil {
 		log.Warn("Error while loading job statistics histogram: num nodes")
 		return nil, err
 	}
 
-	stat.HistNumCores, err = r.jobsStatisticsHistogram(ctx, "job.num_hwthreads as value", filter)
+	stat.HistNumCores, err = r.jobsStatisticsHistogram(ctx, "cores", "job.num_hwthreads as value", filter)
 	if err != nil {
 		log.Warn("Error while loading job statistics histogram: num hwthreads")
 		return nil, err
 	}
 
-	stat.HistNumAccs, err = r.jobsStatisticsHistogram(ctx, "job.num_acc as value", filter)
+	stat.HistNumAccs, err = r.jobsStatisticsHistogram(ctx, "accs", "job.num_acc as value", filter)
 	if err != nil {
 		log.Warn("Error while loading job statistics histogram: num acc")
 		return nil, err
@@ -487,25 +528,37 @@ func (r *JobRepository) AddMetricHistograms(
 	return stat, nil
 }
 
-// `value` must be the column grouped by, but renamed to "value"
+// `value` must be the column grouped by, but renamed to "value". `kind` is
+// the matching histogram of the rollups.
 func (r *JobRepository) jobsStatisticsHistogram(
 	ctx context.Context,
+	kind string,
 	value string,
 	filters []*model.JobFilter) ([]*model.HistoPoint, error) {
 
 	start := time.Now()
-	query, qerr := SecurityCheck(ctx,
-		sq.Select(value, "COUNT(job.id) AS count").From("job"))
+	var query sq.SelectBuilder
+	if from, to, ok := rollupRange(filters); ok {
+		var qerr error
+		if query, qerr = r.buildRollupHistogramQuery(ctx, filters, from, to, kind, value); qerr != nil {
+			return nil, qerr
+		}
+	} else {
+		var qerr error
+		query, qerr = SecurityCheck(ctx,
+			r.builder.Select(value, "COUNT(job.id) AS count").From("job"))
 
-	if qerr != nil {
-		return nil, qerr
-	}
+		if qerr != nil {
+			return nil, qerr
+		}
 
-	for _, f := range filters {
-		query = BuildWhereClause(f, query)
+		for _, f := range filters {
+			query = BuildWhereClause(ctx, f, query)
+		}
+		query = query.GroupBy("value")
 	}
 
-	rows, err := query.GroupBy("value").RunWith(r.DB).Query()
+	rows, err := query.RunWith(r.DB).Query()
 	if err != nil {
 		log.Error("Error while running query")
 		return nil, err
@@ -530,22 +583,9 @@ func (r *JobRepository) jobsMetricStatisticsHistogram(
 	metric string,
 	filters []*model.JobFilter) (*model.MetricHistoPoints, error) {
 
-	var dbMetric string
-	switch metric {
-	case "cpu_load":
-		dbMetric = "load_avg"
-	case "flops_any":
-		dbMetric = "flops_any_avg"
-	case "mem_bw":
-		dbMetric = "mem_bw_avg"
-	case "mem_used":
-		dbMetric = "mem_used_max"
-	case "net_bw":
-		dbMetric = "net_bw_avg"
-	case "file_bw":
-		dbMetric = "file_bw_avg"
-	default:
-		return nil, fmt.Errorf("%s not implemented", metric)
+	dbMetric, err := footprintColumnOfMetric(metric)
+	if err != nil {
+		return nil, err
 	}
 
 	// Get specific Peak or largest Peak
@@ -598,7 +638,7 @@ func (r *JobRepository) jobsMetricStatisticsHistogram(
 	}
 
 	for _, f := range filters {
-		crossJoinQuery = BuildWhereClause(f, crossJoinQuery)
+		crossJoinQuery = BuildWhereClause(ctx, f, crossJoinQuery)
 	}
 
 	crossJoinQuerySql, crossJoinQueryArgs, sqlerr := crossJoinQuery.ToSql()
@@ -607,16 +647,16 @@ func (r *JobRepository) jobsMetricStatisticsHistogram(
 	}
 
 	bins := 10
-	binQuery := fmt.Sprintf(`CAST( (case when job.%s = value.max then value.max*0.999999999 else job.%s end - value.min) / (value.max - value.min) * %d as INTEGER )`, dbMetric, dbMetric, bins)
+	binQuery := fmt.Sprintf(`CAST( (case when %s = value.max then value.max*0.999999999 else %s end - value.min) / (value.max - value.min) * %d as INTEGER )`, dbMetric, dbMetric, bins)
 
-	mainQuery := sq.Select(
+	mainQuery := r.builder.Select(
 		fmt.Sprintf(`%s + 1 as bin`, binQuery),
-		fmt.Sprintf(`count(job.%s) as count`, dbMetric),
+		fmt.Sprintf(`count(%s) as count`, dbMetric),
 		fmt.Sprintf(`CAST(((value.max / %d) * (%s     )) as INTEGER ) as min`, bins, binQuery),
 		fmt.Sprintf(`CAST(((value.max / %d) * (%s + 1 )) as INTEGER ) as max`, bins, binQuery),
 	).From("job").CrossJoin(
 		fmt.Sprintf(`(%s) as value`, crossJoinQuerySql), crossJoinQueryArgs...,
-	).Where(fmt.Sprintf(`job.%s is not null and job.%s <= %f`, dbMetric, dbMetric, peak))
+	).Where(fmt.Sprintf(`%s is not null and %s <= %f`, dbMetric, dbMetric, peak))
 
 	mainQuery, qerr := SecurityCheck(ctx, mainQuery)
 
@@ -625,7 +665,7 @@ func (r *JobRepository) jobsMetricStatisticsHistogram(
 	}
 
 	for _, f := range filters {
-		mainQuery = BuildWhereClause(f, mainQuery)
+		mainQuery = BuildWhereClause(ctx, f, mainQuery)
 	}
 
 	// Finalize query with Grouping and Ordering
@@ -752,3 +792,128 @@ func (r *JobRepository) runningJobsMetricStatisticsHistogram(
 
 	return data
 }
+
+// JobsQuantiles returns the quantiles `ps` of the field over the jobs matching
+// the filters, nil if no job has a value. The quantile p is the smallest value
+// for which a share of at least p of the jobs has a value not larger. The jobs
+// are ranked by a window function, so that only the quantiles are transferred.
+func (r *JobRepository) JobsQuantiles(
+	ctx context.Context,
+	filter []*model.JobFilter,
+	field string,
+	fieldType *model.OrderByType,
+	ps []float64) ([]*float64, error) {
+
+	quantiles, err := r.jobsQuantiles(ctx, filter, "", field, fieldType, ps)
+	if err != nil {
+		return nil, err
+	}
+
+	if q, ok := quantiles[""]; ok {
+		return q, nil
+	}
+	return make([]*float64, len(ps)), nil
+}
+
+// JobsQuantilesGrouped returns the quantiles of JobsQuantiles for every group
+// of the jobs, computed by a single query. Groups without any value of the
+// field are missing.
+func (r *JobRepository) JobsQuantilesGrouped(
+	ctx context.Context,
+	filter []*model.JobFilter,
+	groupBy *model.Aggregate,
+	field string,
+	fieldType *model.OrderByType,
+	ps []float64) (map[string][]*float64, error) {
+
+	return r.jobsQuantiles(ctx, filter, groupBy2column[*groupBy], field, fieldType, ps)
+}
+
+// Returns the quantiles by the value of the column `col`. If `col` is empty,
+// the quantiles of all jobs are returned for the empty key.
+func (r *JobRepository) jobsQuantiles(
+	ctx context.Context,
+	filter []*model.JobFilter,
+	col string,
+	field string,
+	fieldType *model.OrderByType,
+	ps []float64) (map[string][]*float64, error) {
+
+	start := time.Now()
+	var value string
+	if fieldType != nil && *fieldType == model.OrderByTypeFootprint {
+		var err error
+		if value, err = footprintColumn(field); err != nil {
+			return nil, err
+		}
+	} else if field == "duration" {
+		value = fmt.Sprintf("(CASE WHEN job.job_state = 'running' THEN %d - job.start_time ELSE job.duration END)", time.Now().Unix())
+	} else if column, ok := quantileColumns[field]; ok {
+		value = column
+	} else {
+		return nil, fmt.Errorf("REPOSITORY/STATS > invalid quantile field '%s'", field)
+	}
+
+	group, window := "''", fmt.Sprintf("ORDER BY %s", value)
+	if col != "" {
+		group, window = col, fmt.Sprintf("PARTITION BY %s ORDER BY %s", col, value)
+	}
+	ranked, qerr := SecurityCheck(ctx, r.builder.Select(group+" AS id", value+" AS value",
+		fmt.Sprintf("CUME_DIST() OVER (%s) AS cd", window)).
+		From("job").Where(value+" IS NOT NULL"))
+	if qerr != nil {
+		return nil, qerr
+	}
+	for _, f := range filter {
+		ranked = BuildWhereClause(ctx, f, ranked)
+	}
+
+	if len(ps) == 0 {
+		return map[string][]*float64{}, nil
+	}
+
+	query := r.builder.Select("ranked.id")
+	for _, p := range ps {
+		if p < 0 || p > 1 {
+			return nil, fmt.Errorf("REPOSITORY/STATS > invalid quantile %f", p)
+		}
+		// Tolerate rounding of the cumulative distribution
+		query = query.Column(sq.Expr("MIN(CASE WHEN ranked.cd >= ? THEN ranked.value END)", p-1e-9))
+	}
+
+	rows, err := query.FromSelect(ranked, "ranked").GroupBy("ranked.id").RunWith(r.DB).Query()
+	if err != nil {
+		log.Warn("Error while computing quantiles")
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make(map[string][]*float64)
+	values := make([]sql.NullFloat64, len(ps))
+	for rows.Next() {
+		var id string
+		dest := []interface{}{&id}
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			log.Warn("Error while scanning rows")
+			return nil, err
+		}
+
+		quantiles := make([]*float64, len(ps))
+		for i, v := range values {
+			if v.Valid {
+				q := v.Float64
+				quantiles[i] = &q
+			}
+		}
+		res[id] = quantiles
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	log.Debugf("Timer JobsQuantiles %s", time.Since(start))
+	return res, nil
+}
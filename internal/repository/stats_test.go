@@ -6,14 +6,19 @@ package repository
 
 import (
 	"fmt"
+	"math"
+	"reflect"
+	"sort"
 	"testing"
+	"time"
 
 	"github.com/ClusterCockpit/cc-backend/internal/graph/model"
+	"github.com/ClusterCockpit/cc-backend/pkg/schema"
 )
 
 func TestBuildJobStatsQuery(t *testing.T) {
 	r := setup(t)
-	q := r.buildStatsQuery(nil, "USER")
+	q := r.buildStatsQuery(getContext(t), nil, "USER")
 
 	sql, _, err := q.ToSql()
 	noErr(t, err)
@@ -33,3 +38,105 @@ func TestJobStats(t *testing.T) {
 		t.Fatalf("Want 98, Got %d", stats[0].TotalJobs)
 	}
 }
+
+func TestJobsQuantiles(t *testing.T) {
+	r := setup(t)
+
+	ps := []float64{0, 0.5, 0.9, 1}
+	got, err := r.JobsQuantiles(getContext(t), nil, "duration", nil, ps)
+	noErr(t, err)
+	want := []float64{288, 316, 7152, 7152}
+	for i := range want {
+		if got[i] == nil || *got[i] != want[i] {
+			t.Errorf("wrong duration quantile %v\ngot: %v \nwant: %v", ps[i], got[i], want[i])
+		}
+	}
+
+	project := "k106eb"
+	filter := &model.JobFilter{Project: &model.StringInput{Eq: &project}}
+	got, err = r.JobsQuantiles(getContext(t), []*model.JobFilter{filter}, "duration", nil, []float64{0.5})
+	noErr(t, err)
+	if got[0] == nil || *got[0] != 2034 {
+		t.Errorf("wrong median duration of project %s\ngot: %v \nwant: 2034", project, got[0])
+	}
+
+	groupBy := model.AggregateProject
+	grouped, err := r.JobsQuantilesGrouped(getContext(t), nil, &groupBy, "duration", nil, []float64{0.5, 1})
+	noErr(t, err)
+	for project, want := range map[string][]float64{"caph": {289, 316}, "k106eb": {2034, 7152}} {
+		if q := grouped[project]; len(q) != 2 || q[0] == nil || *q[0] != want[0] || q[1] == nil || *q[1] != want[1] {
+			t.Errorf("wrong duration quantiles of project %s\ngot: %v \nwant: %v", project, q, want)
+		}
+	}
+	if len(grouped) != 2 {
+		t.Errorf("wrong number of groups\ngot: %d \nwant: 2", len(grouped))
+	}
+
+	none := "none"
+	filter = &model.JobFilter{Project: &model.StringInput{Eq: &none}}
+	got, err = r.JobsQuantiles(getContext(t), []*model.JobFilter{filter}, "numNodes", nil, []float64{0.5})
+	noErr(t, err)
+	if got[0] != nil {
+		t.Errorf("expected no quantile without jobs, got %v", *got[0])
+	}
+
+	if _, err := r.JobsQuantiles(getContext(t), nil, "user", nil, ps); err == nil {
+		t.Error("expected error for non-numeric field")
+	}
+	if _, err := r.JobsQuantiles(getContext(t), nil, "duration", nil, []float64{1.5}); err == nil {
+		t.Error("expected error for quantile outside of [0, 1]")
+	}
+}
+
+func TestJobStatsRollups(t *testing.T) {
+	r := setup(t)
+	noErr(t, r.RefreshRollups())
+
+	// Duration filters are not expressible on the rollups
+	all := &model.JobFilter{Duration: &schema.IntRange{From: 0, To: math.MaxInt32}}
+	cluster := "testcluster"
+	// Jobs 2 and 3 start on the partially covered first day, jobs 4 to 6 on the second day
+	from, to := time.Unix(1675876800, 0), time.Unix(1675990000, 0)
+	for _, filter := range []*model.JobFilter{
+		{},
+		{Cluster: &model.StringInput{Neq: &cluster}},
+		{StartTime: &schema.TimeRange{From: &from, To: &to}},
+	} {
+		if _, _, ok := rollupRange([]*model.JobFilter{filter}); !ok {
+			t.Fatalf("filter not expressible on rollups: %#v", filter)
+		}
+
+		want, err := r.JobsStats(getContext(t), []*model.JobFilter{filter, all})
+		noErr(t, err)
+		got, err := r.JobsStats(getContext(t), []*model.JobFilter{filter})
+		noErr(t, err)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("wrong rollup statistics\ngot: %#v \nwant: %#v", got[0], want[0])
+		}
+
+		wantHist, err := r.AddHistograms(getContext(t), []*model.JobFilter{filter, all}, &model.JobsStatistics{})
+		noErr(t, err)
+		gotHist, err := r.AddHistograms(getContext(t), []*model.JobFilter{filter}, &model.JobsStatistics{})
+		noErr(t, err)
+		for _, h := range [][2][]*model.HistoPoint{
+			{gotHist.HistDuration, wantHist.HistDuration}, {gotHist.HistNumNodes, wantHist.HistNumNodes},
+		} {
+			sort.Slice(h[0], func(i, j int) bool { return h[0][i].Value < h[0][j].Value })
+			sort.Slice(h[1], func(i, j int) bool { return h[1][i].Value < h[1][j].Value })
+			if !reflect.DeepEqual(h[0], h[1]) {
+				t.Errorf("wrong rollup histogram\ngot: %v \nwant: %v", h[0], h[1])
+			}
+		}
+	}
+
+	groupBy := model.AggregateUser
+	counts, err := r.JobCountGrouped(getContext(t), nil, &groupBy)
+	noErr(t, err)
+	total := 0
+	for _, c := range counts {
+		total += c.TotalJobs
+	}
+	if total != 6 {
+		t.Errorf("wrong grouped job count\ngot: %d \nwant: 6", total)
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright (C) 2022 NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ClusterCockpit/cc-backend/internal/graph/model"
+	"github.com/ClusterCockpit/cc-backend/pkg/log"
+	"github.com/ClusterCockpit/cc-backend/pkg/schema"
+	sq "github.com/Masterminds/squirrel"
+)
+
+var ErrStepNotRunning = errors.New("REPOSITORY/STEP > step is not running")
+
+func scanStep(row interface{ Scan(...interface{}) error }) (*model.JobStep, error) {
+	var start int64
+	var stop, exitCode sql.NullInt64
+	var resources string
+	s := &model.JobStep{}
+	if err := row.Scan(&s.ID, &s.JobID, &s.StepID, &s.Name, &s.State, &start, &stop, &exitCode, &resources); err != nil {
+		return nil, err
+	}
+
+	s.StartTime = time.Unix(start, 0)
+	if stop.Valid {
+		t := time.Unix(stop.Int64, 0)
+		s.StopTime = &t
+	}
+	if exitCode.Valid {
+		code := int(exitCode.Int64)
+		s.ExitCode = &code
+	}
+	if err := json.Unmarshal([]byte(resources), &s.Resources); err != nil {
+		log.Warnf("Error while unmarshaling resources of step %d", s.ID)
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (r *JobRepository) selectSteps() sq.SelectBuilder {
+	return r.builder.Select("job_step.id", "job_step.job_id", "job_step.step_id", "job_step.name", "job_step.job_state",
+		"job_step.start_time", "job_step.stop_time", "job_step.exit_code", "job_step.resources").From("job_step")
+}
+
+// GetSteps returns the steps of the job with the database id `jobId` in the
+// order they were started.
+func (r *JobRepository) GetSteps(jobId int64) ([]*model.JobStep, error) {
+	rows, err := r.selectSteps().Where("job_step.job_id = ?", jobId).
+		OrderBy("job_step.start_time ASC", "job_step.id ASC").
+		RunWith(r.stmtCache).Query()
+	if err != nil {
+		log.Error("Error while running query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	steps := make([]*model.JobStep, 0)
+	for rows.Next() {
+		s, err := scanStep(rows)
+		if err != nil {
+			log.Warn("Error while scanning rows")
+			return nil, err
+		}
+		steps = append(steps, s)
+	}
+
+	return steps, rows.Err()
+}
+
+// GetStep returns the step `stepId` of the job with the database id `jobId`.
+func (r *JobRepository) GetStep(jobId int64, stepId string) (*model.JobStep, error) {
+	return scanStep(r.selectSteps().Where("job_step.job_id = ?", jobId).Where("job_step.step_id = ?", stepId).
+		RunWith(r.stmtCache).QueryRow())
+}
+
+// StartStep adds the running step to the job. The step id has to be unique
+// within the job and the step has to run on nodes of the job.
+func (r *JobRepository) StartStep(job *schema.Job, step *model.JobStep) (*model.JobStep, error) {
+	if step.StepID == "" {
+		return nil, errors.New("REPOSITORY/STEP > step id must not be empty")
+	}
+	if step.StartTime.Unix() < job.StartTimeUnix {
+		return nil, errors.New("REPOSITORY/STEP > step starts before the job")
+	}
+
+	if len(step.Resources) == 0 {
+		step.Resources = job.Resources
+	}
+	hosts := make(map[string]bool, len(job.Resources))
+	for _, res := range job.Resources {
+		hosts[res.Hostname] = true
+	}
+	for _, res := range step.Resources {
+		if !hosts[res.Hostname] {
+			return nil, fmt.Errorf("REPOSITORY/STEP > host '%s' is not allocated to the job", res.Hostname)
+		}
+	}
+
+	resources, err := json.Marshal(step.Resources)
+	if err != nil {
+		log.Warn("Error while marshaling step resources")
+		return nil, err
+	}
+
+	step.JobID = job.ID
+	step.State = schema.JobStateRunning
+	step.StopTime, step.ExitCode = nil, nil
+	step.ID, err = insertReturningId(r.DB, r.driver, `INSERT INTO job_step
+		(job_id, step_id, name, job_state, start_time, resources) VALUES (?, ?, ?, ?, ?, ?)`,
+		step.JobID, step.StepID, step.Name, step.State, step.StartTime.Unix(), string(resources))
+	if err != nil {
+		log.Errorf("Error while inserting step '%s' of job %d: %v", step.StepID, job.ID, err)
+		return nil, err
+	}
+
+	return step, nil
+}
+
+// StopStep marks the running step `stepId` of the job with the database id
+// `jobId` as stopped at `stopTime` in the final `state`.
+func (r *JobRepository) StopStep(jobId int64, stepId string, stopTime int64, state schema.JobState, exitCode *int) (*model.JobStep, error) {
+	if !state.Valid() || state == schema.JobStateRunning {
+		return nil, fmt.Errorf("REPOSITORY/STEP > invalid final state '%s'", state)
+	}
+
+	s, err := r.GetStep(jobId, stepId)
+	if err != nil {
+		return nil, err
+	}
+	if s.State != schema.JobStateRunning {
+		return nil, ErrStepNotRunning
+	}
+	if stopTime < s.StartTime.Unix() {
+		return nil, errors.New("REPOSITORY/STEP > step stops before it starts")
+	}
+
+	if _, err := r.builder.Update("job_step").
+		Set("job_state", state).Set("stop_time", stopTime).Set("exit_code", exitCode).
+		Where("job_step.id = ?", s.ID).RunWith(r.stmtCache).Exec(); err != nil {
+		log.Errorf("Error while stopping step '%s' of job %d: %v", stepId, jobId, err)
+		return nil, err
+	}
+
+	t := time.Unix(stopTime, 0)
+	s.State, s.StopTime, s.ExitCode = state, &t, exitCode
+	return s, nil
+}
+
+// StopRunningSteps marks the steps of the job with the database id `jobId`
+// still running as stopped at `stopTime` in the final state of the job.
+func (r *JobRepository) StopRunningSteps(jobId int64, stopTime int64, state schema.JobState) error {
+	if _, err := r.builder.Update("job_step").
+		Set("job_state", state).Set("stop_time", stopTime).
+		Where("job_step.job_id = ?", jobId).Where("job_step.job_state = ?", schema.JobStateRunning).
+		RunWith(r.stmtCache).Exec(); err != nil {
+		log.Errorf("Error while stopping steps of job %d: %v", jobId, err)
+		return err
+	}
+
+	return nil
+}
@@ -5,8 +5,7 @@
 package repository
 
 import (
-	"strings"
-
+	"github.com/ClusterCockpit/cc-backend/internal/util"
 	"github.com/ClusterCockpit/cc-backend/pkg/archive"
 	"github.com/ClusterCockpit/cc-backend/pkg/log"
 	"github.com/ClusterCockpit/cc-backend/pkg/schema"
@@ -26,7 +25,7 @@ func (r *JobRepository) AddTag(job int64, tag int64) ([]*schema.Tag, error) {
 		return nil, err
 	}
 
-	tags, err := r.GetTags(&job)
+	tags, err := r.GetTags(nil, &job)
 	if err != nil {
 		log.Warn("Error while getting tags for job")
 		return nil, err
@@ -48,7 +47,7 @@ func (r *JobRepository) RemoveTag(job, tag int64) ([]*schema.Tag, error) {
 		return nil, err
 	}
 
-	tags, err := r.GetTags(&job)
+	tags, err := r.GetTags(nil, &job)
 	if err != nil {
 		log.Warn("Error while getting tags for job")
 		return nil, err
@@ -57,19 +56,146 @@ func (r *JobRepository) RemoveTag(job, tag int64) ([]*schema.Tag, error) {
 	return tags, archive.UpdateTags(j, tags)
 }
 
-// CreateTag creates a new tag with the specified type and name and returns its database id.
-func (r *JobRepository) CreateTag(tagType string, tagName string) (tagId int64, err error) {
-	res, err := r.stmtCache.Exec("INSERT INTO tag (tag_type, tag_name) VALUES ($1, $2)", tagType, tagName)
-	if err != nil {
-		return 0, err
+// CreateTag creates a new tag with the specified type, name and scope and returns its database id.
+// The owner is the project of project tags and the user of private tags, it is ignored for global tags.
+func (r *JobRepository) CreateTag(tagType string, tagName string, scope schema.TagScope, owner string) (tagId int64, err error) {
+	scope, owner = normalizeTagScope(scope, owner)
+	return insertReturningId(r.DB, r.driver, "INSERT INTO tag (tag_type, tag_name, tag_scope, tag_owner) VALUES (?, ?, ?, ?)",
+		tagType, tagName, scope, owner)
+}
+
+func normalizeTagScope(scope schema.TagScope, owner string) (schema.TagScope, string) {
+	if scope == "" || scope == schema.TagScopeGlobal {
+		return schema.TagScopeGlobal, ""
+	}
+
+	return scope, owner
+}
+
+// GetTag returns the tag with the database id `tagId`.
+func (r *JobRepository) GetTag(tagId int64) (*schema.Tag, error) {
+	tag := &schema.Tag{}
+	if err := r.builder.Select("id", "tag_type", "tag_name", "tag_scope", "tag_owner").From("tag").Where("tag.id = ?", tagId).
+		RunWith(r.stmtCache).QueryRow().Scan(&tag.ID, &tag.Type, &tag.Name, &tag.Scope, &tag.Owner); err != nil {
+		return nil, err
+	}
+
+	return tag, nil
+}
+
+// Returns the condition for the tags visible to the user, nil if the user
+// may see all tags. Private tags are only visible to their owner, even for
+// admins. Project tags are visible to admins and support, to the managers of
+// the project and to users with jobs in the project.
+func tagVisibility(user *schema.User) sq.Sqlizer {
+	if user == nil {
+		return nil
+	}
+
+	private := sq.Eq{"tag.tag_scope": schema.TagScopePrivate, "tag.tag_owner": user.Username}
+	if user.HasAnyRole([]schema.Role{schema.RoleAdmin, schema.RoleSupport}) {
+		return sq.Or{sq.NotEq{"tag.tag_scope": schema.TagScopePrivate}, private}
+	}
+
+	return sq.Or{
+		sq.Eq{"tag.tag_scope": schema.TagScopeGlobal},
+		private,
+		sq.And{
+			sq.Eq{"tag.tag_scope": schema.TagScopeProject},
+			sq.Or{
+				sq.Eq{"tag.tag_owner": user.Projects},
+				sq.Expr("tag.tag_owner IN (SELECT job.project FROM job WHERE job.user = ?)", user.Username),
+			},
+		},
+	}
+}
+
+// TagVisible returns true if the tag with the database id `tagId` exists and is visible to the user.
+func (r *JobRepository) TagVisible(user *schema.User, tagId int64) (bool, error) {
+	q := r.builder.Select("count(*)").From("tag").Where("tag.id = ?", tagId)
+	if cond := tagVisibility(user); cond != nil {
+		q = q.Where(cond)
+	}
+
+	var count int
+	if err := q.RunWith(r.stmtCache).QueryRow().Scan(&count); err != nil {
+		log.Warn("Error while checking tag visibility")
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// HasProjectAccess returns true if the user may create and see the project tags of the project:
+// Admins, managers of the project and users with jobs in the project.
+func (r *JobRepository) HasProjectAccess(user *schema.User, project string) (bool, error) {
+	if user.HasRole(schema.RoleAdmin) || util.Contains(user.Projects, project) {
+		return true, nil
+	}
+
+	var count int
+	if err := r.builder.Select("count(*)").From("job").
+		Where("job.user = ?", user.Username).Where("job.project = ?", project).
+		RunWith(r.stmtCache).QueryRow().Scan(&count); err != nil {
+		log.Warn("Error while counting jobs of user in project")
+		return false, err
 	}
 
-	return res.LastInsertId()
+	return count > 0, nil
 }
 
-func (r *JobRepository) CountTags(user *schema.User) (tags []schema.Tag, counts map[string]int, err error) {
+// DeleteTag removes the tag with the database id `tagId` from all jobs and deletes it.
+func (r *JobRepository) DeleteTag(tagId int64) error {
+	jobIds := make([]int64, 0)
+	if err := r.DB.Select(&jobIds, r.DB.Rebind(`SELECT jobtag.job_id FROM jobtag WHERE jobtag.tag_id = ?`), tagId); err != nil {
+		log.Warn("Error while finding jobs with tag")
+		return err
+	}
+
+	if _, err := r.builder.Delete("jobtag").Where("jobtag.tag_id = ?", tagId).RunWith(r.stmtCache).Exec(); err != nil {
+		log.Error("Error while running query")
+		return err
+	}
+	if _, err := r.builder.Delete("tag").Where("tag.id = ?", tagId).RunWith(r.stmtCache).Exec(); err != nil {
+		log.Error("Error while running query")
+		return err
+	}
+
+	for _, jobId := range jobIds {
+		j, err := r.FindById(jobId)
+		if err != nil {
+			log.Warn("Error while finding job by id")
+			return err
+		}
+
+		tags, err := r.GetTags(nil, &jobId)
+		if err != nil {
+			log.Warn("Error while getting tags for job")
+			return err
+		}
+
+		if err := archive.UpdateTags(j, tags); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CountTags returns the tags visible to the user and the number of the user's jobs per tag id.
+func (r *JobRepository) CountTags(user *schema.User) (tags []schema.Tag, counts map[int64]int, err error) {
 	tags = make([]schema.Tag, 0, 100)
-	xrows, err := r.DB.Queryx("SELECT id, tag_type, tag_name FROM tag")
+	visible := tagVisibility(user)
+	tq := r.builder.Select("id", "tag_type", "tag_name", "tag_scope", "tag_owner").From("tag")
+	if visible != nil {
+		tq = tq.Where(visible)
+	}
+	sql, args, err := tq.ToSql()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	xrows, err := r.DB.Queryx(sql, args...)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -82,17 +208,24 @@ func (r *JobRepository) CountTags(user *schema.User) (tags []schema.Tag, counts
 		tags = append(tags, t)
 	}
 
-	q := sq.Select("t.tag_name, count(jt.tag_id)").
-		From("tag t").
-		LeftJoin("jobtag jt ON t.id = jt.tag_id").
-		GroupBy("t.tag_name")
+	q := r.builder.Select("tag.id, count(jt.tag_id)").
+		From("tag").
+		LeftJoin("jobtag jt ON tag.id = jt.tag_id").
+		GroupBy("tag.id")
+	if visible != nil {
+		q = q.Where(visible)
+	}
 
 	if user != nil && user.HasAnyRole([]schema.Role{schema.RoleAdmin, schema.RoleSupport}) { // ADMIN || SUPPORT: Count all jobs
 		log.Debug("CountTags: User Admin or Support -> Count all Jobs for Tags")
 		// Unchanged: Needs to be own case still, due to UserRole/NoRole compatibility handling in else case
 	} else if user != nil && user.HasRole(schema.RoleManager) { // MANAGER: Count own jobs plus project's jobs
-		// Build ("project1", "project2", ...) list of variable length directly in SQL string
-		q = q.Where("jt.job_id IN (SELECT id FROM job WHERE job.user = ? OR job.project IN (\""+strings.Join(user.Projects, "\",\"")+"\"))", user.Username)
+		jobs, args, err := sq.Select("id").From("job").
+			Where(sq.Or{sq.Eq{"job.user": user.Username}, sq.Eq{"job.project": user.Projects}}).ToSql()
+		if err != nil {
+			return nil, nil, err
+		}
+		q = q.Where("jt.job_id IN ("+jobs+")", args...)
 	} else if user != nil { // USER OR NO ROLE (Compatibility): Only count own jobs
 		q = q.Where("jt.job_id IN (SELECT id FROM job WHERE job.user = ?)", user.Username)
 	}
@@ -102,26 +235,26 @@ func (r *JobRepository) CountTags(user *schema.User) (tags []schema.Tag, counts
 		return nil, nil, err
 	}
 
-	counts = make(map[string]int)
+	counts = make(map[int64]int)
 	for rows.Next() {
-		var tagName string
+		var tagId int64
 		var count int
-		if err = rows.Scan(&tagName, &count); err != nil {
+		if err = rows.Scan(&tagId, &count); err != nil {
 			return nil, nil, err
 		}
-		counts[tagName] = count
+		counts[tagId] = count
 	}
 	err = rows.Err()
 
 	return
 }
 
-// AddTagOrCreate adds the tag with the specified type and name to the job with the database id `jobId`.
+// AddTagOrCreate adds the tag with the specified type, name and scope to the job with the database id `jobId`.
 // If such a tag does not yet exist, it is created.
-func (r *JobRepository) AddTagOrCreate(jobId int64, tagType string, tagName string) (tagId int64, err error) {
-	tagId, exists := r.TagId(tagType, tagName)
+func (r *JobRepository) AddTagOrCreate(jobId int64, tagType string, tagName string, scope schema.TagScope, owner string) (tagId int64, err error) {
+	tagId, exists := r.TagId(tagType, tagName, scope, owner)
 	if !exists {
-		tagId, err = r.CreateTag(tagType, tagName)
+		tagId, err = r.CreateTag(tagType, tagName, scope, owner)
 		if err != nil {
 			return 0, err
 		}
@@ -134,11 +267,13 @@ func (r *JobRepository) AddTagOrCreate(jobId int64, tagType string, tagName stri
 	return tagId, nil
 }
 
-// TagId returns the database id of the tag with the specified type and name.
-func (r *JobRepository) TagId(tagType string, tagName string) (tagId int64, exists bool) {
+// TagId returns the database id of the tag with the specified type, name and scope.
+func (r *JobRepository) TagId(tagType string, tagName string, scope schema.TagScope, owner string) (tagId int64, exists bool) {
 	exists = true
-	if err := sq.Select("id").From("tag").
+	scope, owner = normalizeTagScope(scope, owner)
+	if err := r.builder.Select("id").From("tag").
 		Where("tag.tag_type = ?", tagType).Where("tag.tag_name = ?", tagName).
+		Where("tag.tag_scope = ?", scope).Where("tag.tag_owner = ?", owner).
 		RunWith(r.stmtCache).QueryRow().Scan(&tagId); err != nil {
 		exists = false
 	}
@@ -146,11 +281,15 @@ func (r *JobRepository) TagId(tagType string, tagName string) (tagId int64, exis
 }
 
 // GetTags returns a list of all tags if job is nil or of the tags that the job with that database ID has.
-func (r *JobRepository) GetTags(job *int64) ([]*schema.Tag, error) {
-	q := sq.Select("id", "tag_type", "tag_name").From("tag")
+// Only the tags visible to the user are returned, all tags if the user is nil.
+func (r *JobRepository) GetTags(user *schema.User, job *int64) ([]*schema.Tag, error) {
+	q := r.builder.Select("id", "tag_type", "tag_name", "tag_scope", "tag_owner").From("tag")
 	if job != nil {
 		q = q.Join("jobtag ON jobtag.tag_id = tag.id").Where("jobtag.job_id = ?", *job)
 	}
+	if cond := tagVisibility(user); cond != nil {
+		q = q.Where(cond)
+	}
 
 	rows, err := q.RunWith(r.stmtCache).Query()
 	if err != nil {
@@ -161,7 +300,7 @@ func (r *JobRepository) GetTags(job *int64) ([]*schema.Tag, error) {
 	tags := make([]*schema.Tag, 0)
 	for rows.Next() {
 		tag := &schema.Tag{}
-		if err := rows.Scan(&tag.ID, &tag.Type, &tag.Name); err != nil {
+		if err := rows.Scan(&tag.ID, &tag.Type, &tag.Name, &tag.Scope, &tag.Owner); err != nil {
 			log.Warn("Error while scanning rows")
 			return nil, err
 		}
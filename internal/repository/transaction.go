@@ -11,13 +11,14 @@ import (
 )
 
 type Transaction struct {
-	tx   *sqlx.Tx
-	stmt *sqlx.NamedStmt
+	tx     *sqlx.Tx
+	stmt   *sqlx.NamedStmt
+	driver string
 }
 
 func (r *JobRepository) TransactionInit() (*Transaction, error) {
 	var err error
-	t := new(Transaction)
+	t := &Transaction{driver: r.driver}
 	// Inserts are bundled into transactions because in sqlite,
 	// that speeds up inserts A LOT.
 	t.tx, err = r.DB.Beginx()
@@ -26,7 +27,7 @@ func (r *JobRepository) TransactionInit() (*Transaction, error) {
 		return nil, err
 	}
 
-	t.stmt, err = t.tx.PrepareNamed(NamedJobInsert)
+	t.stmt, err = t.tx.PrepareNamed(namedJobInsert(r.driver, true))
 	if err != nil {
 		log.Warn("Error while preparing namedJobInsert")
 		return nil, err
@@ -64,6 +65,15 @@ func (r *JobRepository) TransactionEnd(t *Transaction) error {
 }
 
 func (r *JobRepository) TransactionAdd(t *Transaction, job schema.Job) (int64, error) {
+	if t.driver == "postgres" {
+		var id int64
+		if err := t.stmt.QueryRowx(job).Scan(&id); err != nil {
+			log.Errorf("repository initDB(): %v", err)
+			return 0, err
+		}
+		return id, t.addIndexes(id, job)
+	}
+
 	res, err := t.stmt.Exec(job)
 	if err != nil {
 		log.Errorf("repository initDB(): %v", err)
@@ -76,26 +86,36 @@ func (r *JobRepository) TransactionAdd(t *Transaction, job schema.Job) (int64, e
 		return 0, err
 	}
 
-	return id, nil
+	return id, t.addIndexes(id, job)
+}
+
+func (t *Transaction) addIndexes(id int64, job schema.Job) error {
+	if err := updateFullText(t.tx, t.driver, id, job.MetaData); err != nil {
+		log.Errorf("repository initDB(): %v", err)
+		return err
+	}
+	if err := insertJobNodes(t.tx, id, job.Resources); err != nil {
+		log.Errorf("repository initDB(): %v", err)
+		return err
+	}
+
+	return nil
 }
 
 func (r *JobRepository) TransactionAddTag(t *Transaction, tag *schema.Tag) (int64, error) {
-	res, err := t.tx.Exec(`INSERT INTO tag (tag_name, tag_type) VALUES (?, ?)`, tag.Name, tag.Type)
+	scope, owner := normalizeTagScope(tag.Scope, tag.Owner)
+	tagId, err := insertReturningId(t.tx, t.driver, `INSERT INTO tag (tag_name, tag_type, tag_scope, tag_owner) VALUES (?, ?, ?, ?)`,
+		tag.Name, tag.Type, scope, owner)
 	if err != nil {
 		log.Errorf("Error while inserting tag into tag table: %v (Type %v)", tag.Name, tag.Type)
 		return 0, err
 	}
-	tagId, err := res.LastInsertId()
-	if err != nil {
-		log.Warn("Error while getting last insert ID")
-		return 0, err
-	}
 
 	return tagId, nil
 }
 
 func (r *JobRepository) TransactionSetTag(t *Transaction, jobId int64, tagId int64) error {
-	if _, err := t.tx.Exec(`INSERT INTO jobtag (job_id, tag_id) VALUES (?, ?)`, jobId, tagId); err != nil {
+	if _, err := t.tx.Exec(t.tx.Rebind(`INSERT INTO jobtag (job_id, tag_id) VALUES (?, ?)`), jobId, tagId); err != nil {
 		log.Errorf("Error while inserting jobtag into jobtag table: %v (TagID %v)", jobId, tagId)
 		return err
 	}
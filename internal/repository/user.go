@@ -27,8 +27,9 @@ var (
 )
 
 type UserRepository struct {
-	DB     *sqlx.DB
-	driver string
+	DB      *sqlx.DB
+	driver  string
+	builder sq.StatementBuilderType
 }
 
 func GetUserRepository() *UserRepository {
@@ -36,18 +37,24 @@ func GetUserRepository() *UserRepository {
 		db := GetConnection()
 
 		userRepoInstance = &UserRepository{
-			DB:     db.DB,
-			driver: db.Driver,
+			DB:      db.DB,
+			driver:  db.Driver,
+			builder: db.Builder,
 		}
 	})
 	return userRepoInstance
 }
 
+// The user table name is a reserved word in PostgreSQL and MySQL.
+func (r *UserRepository) table() string {
+	return quoteIdent(r.driver, "user")
+}
+
 func (r *UserRepository) GetUser(username string) (*schema.User, error) {
 	user := &schema.User{Username: username}
 	var hashedPassword, name, rawRoles, email, rawProjects sql.NullString
-	if err := sq.Select("password", "ldap", "name", "roles", "email", "projects").From("user").
-		Where("user.username = ?", username).RunWith(r.DB).
+	if err := r.builder.Select("password", "ldap", "name", "roles", "email", "projects").From(r.table()).
+		Where("username = ?", username).RunWith(r.DB).
 		QueryRow().Scan(&hashedPassword, &user.AuthSource, &name, &rawRoles, &email, &rawProjects); err != nil {
 		log.Warnf("Error while querying user '%v' from database", username)
 		return nil, err
@@ -74,7 +81,7 @@ func (r *UserRepository) GetUser(username string) (*schema.User, error) {
 func (r *UserRepository) GetLdapUsernames() ([]string, error) {
 
 	var users []string
-	rows, err := r.DB.Query(`SELECT username FROM user WHERE user.ldap = 1`)
+	rows, err := r.DB.Query(`SELECT username FROM ` + r.table() + ` WHERE ldap = 1`)
 	if err != nil {
 		log.Warn("Error while querying usernames")
 		return nil, err
@@ -122,7 +129,7 @@ func (r *UserRepository) AddUser(user *schema.User) error {
 		vals = append(vals, int(user.AuthSource))
 	}
 
-	if _, err := sq.Insert("user").Columns(cols...).Values(vals...).RunWith(r.DB).Exec(); err != nil {
+	if _, err := r.builder.Insert(r.table()).Columns(cols...).Values(vals...).RunWith(r.DB).Exec(); err != nil {
 		log.Errorf("Error while inserting new user '%v' into DB", user.Username)
 		return err
 	}
@@ -133,7 +140,7 @@ func (r *UserRepository) AddUser(user *schema.User) error {
 
 func (r *UserRepository) DelUser(username string) error {
 
-	_, err := r.DB.Exec(`DELETE FROM user WHERE user.username = ?`, username)
+	_, err := r.DB.Exec(r.DB.Rebind(`DELETE FROM `+r.table()+` WHERE username = ?`), username)
 	if err != nil {
 		log.Errorf("Error while deleting user '%s' from DB", username)
 		return err
@@ -144,7 +151,7 @@ func (r *UserRepository) DelUser(username string) error {
 
 func (r *UserRepository) ListUsers(specialsOnly bool) ([]*schema.User, error) {
 
-	q := sq.Select("username", "name", "email", "roles", "projects").From("user")
+	q := r.builder.Select("username", "name", "email", "roles", "projects").From(r.table())
 	if specialsOnly {
 		q = q.Where("(roles != '[\"user\"]' AND roles != '[]')")
 	}
@@ -205,7 +212,7 @@ func (r *UserRepository) AddRole(
 	}
 
 	roles, _ := json.Marshal(append(user.Roles, newRole))
-	if _, err := sq.Update("user").Set("roles", roles).Where("user.username = ?", username).RunWith(r.DB).Exec(); err != nil {
+	if _, err := r.builder.Update(r.table()).Set("roles", roles).Where("username = ?", username).RunWith(r.DB).Exec(); err != nil {
 		log.Errorf("Error while adding new role for user '%s'", user.Username)
 		return err
 	}
@@ -241,7 +248,7 @@ func (r *UserRepository) RemoveRole(ctx context.Context, username string, queryr
 	}
 
 	var mroles, _ = json.Marshal(newroles)
-	if _, err := sq.Update("user").Set("roles", mroles).Where("user.username = ?", username).RunWith(r.DB).Exec(); err != nil {
+	if _, err := r.builder.Update(r.table()).Set("roles", mroles).Where("username = ?", username).RunWith(r.DB).Exec(); err != nil {
 		log.Errorf("Error while removing role for user '%s'", user.Username)
 		return err
 	}
@@ -267,7 +274,7 @@ func (r *UserRepository) AddProject(
 	}
 
 	projects, _ := json.Marshal(append(user.Projects, project))
-	if _, err := sq.Update("user").Set("projects", projects).Where("user.username = ?", username).RunWith(r.DB).Exec(); err != nil {
+	if _, err := r.builder.Update(r.table()).Set("projects", projects).Where("username = ?", username).RunWith(r.DB).Exec(); err != nil {
 		return err
 	}
 
@@ -305,7 +312,7 @@ func (r *UserRepository) RemoveProject(ctx context.Context, username string, pro
 		} else {
 			result, _ = json.Marshal(newprojects)
 		}
-		if _, err := sq.Update("user").Set("projects", result).Where("user.username = ?", username).RunWith(r.DB).Exec(); err != nil {
+		if _, err := r.builder.Update(r.table()).Set("projects", result).Where("username = ?", username).RunWith(r.DB).Exec(); err != nil {
 			return err
 		}
 		return nil
@@ -336,7 +343,7 @@ func (r *UserRepository) FetchUserInCtx(ctx context.Context, username string) (*
 
 	user := &model.User{Username: username}
 	var name, email sql.NullString
-	if err := sq.Select("name", "email").From("user").Where("user.username = ?", username).
+	if err := r.builder.Select("name", "email").From(r.table()).Where("username = ?", username).
 		RunWith(r.DB).QueryRow().Scan(&name, &email); err != nil {
 		if err == sql.ErrNoRows {
 			/* This warning will be logged *often* for non-local users, i.e. users mentioned only in job-table or archive, */
@@ -23,6 +23,7 @@ var (
 
 type UserCfgRepo struct {
 	DB         *sqlx.DB
+	driver     string
 	Lookup     *sqlx.Stmt
 	lock       sync.RWMutex
 	uiDefaults map[string]interface{}
@@ -33,13 +34,14 @@ func GetUserCfgRepo() *UserCfgRepo {
 	userCfgRepoOnce.Do(func() {
 		db := GetConnection()
 
-		lookupConfigStmt, err := db.DB.Preparex(`SELECT confkey, value FROM configuration WHERE configuration.username = ?`)
+		lookupConfigStmt, err := db.DB.Preparex(db.DB.Rebind(`SELECT confkey, value FROM configuration WHERE configuration.username = ?`))
 		if err != nil {
 			log.Fatalf("db.DB.Preparex() error: %v", err)
 		}
 
 		userCfgRepoInstance = &UserCfgRepo{
 			DB:         db.DB,
+			driver:     db.Driver,
 			Lookup:     lookupConfigStmt,
 			uiDefaults: config.Keys.UiDefaults,
 			cache:      lrucache.New(1024),
@@ -127,7 +129,13 @@ func (uCfg *UserCfgRepo) UpdateConfig(
 		return nil
 	}
 
-	if _, err := uCfg.DB.Exec(`REPLACE INTO configuration (username, confkey, value) VALUES (?, ?, ?)`, user.Username, key, value); err != nil {
+	replaceStmt := `REPLACE INTO configuration (username, confkey, value) VALUES (?, ?, ?)`
+	if uCfg.driver == "postgres" {
+		replaceStmt = `INSERT INTO configuration (username, confkey, value) VALUES (?, ?, ?)
+			ON CONFLICT (username, confkey) DO UPDATE SET value = EXCLUDED.value`
+	}
+
+	if _, err := uCfg.DB.Exec(uCfg.DB.Rebind(replaceStmt), user.Username, key, value); err != nil {
 		log.Warnf("Error while replacing user config in DB for user '%v'", user.Username)
 		return err
 	}
@@ -0,0 +1,260 @@
+// Copyright (C) 2022 NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ClusterCockpit/cc-backend/internal/graph/model"
+	"github.com/ClusterCockpit/cc-backend/pkg/log"
+	"github.com/ClusterCockpit/cc-backend/pkg/schema"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	viewRepoOnce     sync.Once
+	viewRepoInstance *ViewRepository
+)
+
+var ErrViewForbidden = errors.New("REPOSITORY/VIEW > not allowed to change this view")
+
+type ViewRepository struct {
+	DB      *sqlx.DB
+	driver  string
+	builder sq.StatementBuilderType
+}
+
+func GetViewRepository() *ViewRepository {
+	viewRepoOnce.Do(func() {
+		db := GetConnection()
+
+		viewRepoInstance = &ViewRepository{
+			DB:      db.DB,
+			driver:  db.Driver,
+			builder: db.Builder,
+		}
+	})
+	return viewRepoInstance
+}
+
+// Returns the condition for the views visible to the user: the own ones, the
+// global ones and the ones shared with a project the user has access to.
+// Admins and support staff see the views of all projects.
+func viewVisibility(user *schema.User) sq.Sqlizer {
+	shared := sq.Or{
+		sq.Eq{"saved_view.owner": user.Username},
+		sq.Eq{"saved_view.scope": model.SavedViewScopeGlobal},
+	}
+	if user.HasAnyRole([]schema.Role{schema.RoleAdmin, schema.RoleSupport}) {
+		return append(shared, sq.Eq{"saved_view.scope": model.SavedViewScopeProject})
+	}
+
+	return append(shared, sq.And{
+		sq.Eq{"saved_view.scope": model.SavedViewScopeProject},
+		sq.Or{
+			sq.Eq{"saved_view.project": user.Projects},
+			sq.Expr("saved_view.project IN (SELECT job.project FROM job WHERE job.user = ?)", user.Username),
+		},
+	})
+}
+
+func scanView(row interface{ Scan(...interface{}) error }) (*model.SavedView, error) {
+	var ts int64
+	var filter string
+	var order, metrics sql.NullString
+	v := &model.SavedView{}
+	if err := row.Scan(&v.ID, &v.Name, &v.Owner, &v.Scope, &v.Project, &filter, &order, &metrics, &ts); err != nil {
+		return nil, err
+	}
+
+	v.Time = time.Unix(ts, 0)
+	if err := json.Unmarshal([]byte(filter), &v.Filter); err != nil {
+		log.Warnf("Error while unmarshaling filter of view %d", v.ID)
+		return nil, err
+	}
+	if order.Valid {
+		if err := json.Unmarshal([]byte(order.String), &v.Order); err != nil {
+			log.Warnf("Error while unmarshaling order of view %d", v.ID)
+			return nil, err
+		}
+	}
+	if metrics.Valid {
+		if err := json.Unmarshal([]byte(metrics.String), &v.Metrics); err != nil {
+			log.Warnf("Error while unmarshaling metrics of view %d", v.ID)
+			return nil, err
+		}
+	}
+
+	return v, nil
+}
+
+func (r *ViewRepository) selectViews() sq.SelectBuilder {
+	return r.builder.Select("saved_view.id", "saved_view.name", "saved_view.owner", "saved_view.scope", "saved_view.project",
+		"saved_view.filter", "saved_view.ordering", "saved_view.metrics", "saved_view.time").From("saved_view")
+}
+
+// GetViews returns all views visible to the user in the context, ordered by name.
+func (r *ViewRepository) GetViews(ctx context.Context) ([]*model.SavedView, error) {
+	user := GetUserFromContext(ctx)
+	if user == nil {
+		return nil, fmt.Errorf("user context is nil")
+	}
+
+	rows, err := r.selectViews().Where(viewVisibility(user)).OrderBy("saved_view.name", "saved_view.id").
+		RunWith(r.DB).Query()
+	if err != nil {
+		log.Error("Error while running query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	views := make([]*model.SavedView, 0)
+	for rows.Next() {
+		v, err := scanView(rows)
+		if err != nil {
+			return nil, err
+		}
+		views = append(views, v)
+	}
+
+	return views, rows.Err()
+}
+
+// GetView returns the view with the database id `id` if it is visible to the
+// user in the context, sql.ErrNoRows otherwise.
+func (r *ViewRepository) GetView(ctx context.Context, id int64) (*model.SavedView, error) {
+	user := GetUserFromContext(ctx)
+	if user == nil {
+		return nil, fmt.Errorf("user context is nil")
+	}
+
+	return scanView(r.selectViews().Where("saved_view.id = ?", id).Where(viewVisibility(user)).
+		RunWith(r.DB).QueryRow())
+}
+
+// SaveView creates a view owned by the user in the context if id is nil,
+// otherwise it replaces the view with that database id. Only the owner and
+// admins may change a view. Views can only be shared with projects the
+// owner has access to.
+func (r *ViewRepository) SaveView(ctx context.Context, id *int64, input *model.SavedViewInput) (*model.SavedView, error) {
+	user := GetUserFromContext(ctx)
+	if user == nil {
+		return nil, fmt.Errorf("user context is nil")
+	}
+
+	v := &model.SavedView{
+		Name:    input.Name,
+		Owner:   user.Username,
+		Scope:   model.SavedViewScopePrivate,
+		Filter:  input.Filter,
+		Order:   input.Order,
+		Metrics: input.Metrics,
+		Time:    time.Unix(time.Now().Unix(), 0),
+	}
+	if v.Filter == nil {
+		v.Filter = []*model.JobFilter{}
+	}
+	if input.Scope != nil {
+		if !input.Scope.IsValid() {
+			return nil, fmt.Errorf("REPOSITORY/VIEW > invalid scope '%s'", *input.Scope)
+		}
+		v.Scope = *input.Scope
+	}
+
+	if id != nil {
+		old, err := r.GetView(ctx, *id)
+		if err != nil {
+			return nil, err
+		}
+		if old.Owner != user.Username && !user.HasRole(schema.RoleAdmin) {
+			return nil, ErrViewForbidden
+		}
+		v.ID, v.Owner = old.ID, old.Owner
+	}
+
+	if v.Scope == model.SavedViewScopeProject {
+		if input.Project == nil || *input.Project == "" {
+			return nil, errors.New("REPOSITORY/VIEW > views shared with a project require the project")
+		}
+		ok, err := GetJobRepository().HasProjectAccess(user, *input.Project)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("REPOSITORY/VIEW > not allowed to share views with project '%s'", *input.Project)
+		}
+		v.Project = *input.Project
+	}
+
+	filter, err := json.Marshal(v.Filter)
+	if err != nil {
+		return nil, err
+	}
+	var order, metrics *string
+	if v.Order != nil {
+		raw, err := json.Marshal(v.Order)
+		if err != nil {
+			return nil, err
+		}
+		s := string(raw)
+		order = &s
+	}
+	if v.Metrics != nil {
+		raw, err := json.Marshal(v.Metrics)
+		if err != nil {
+			return nil, err
+		}
+		s := string(raw)
+		metrics = &s
+	}
+
+	if id == nil {
+		v.ID, err = insertReturningId(r.DB, r.driver, `INSERT INTO saved_view
+			(name, owner, scope, project, filter, ordering, metrics, time) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			v.Name, v.Owner, v.Scope, v.Project, string(filter), order, metrics, v.Time.Unix())
+	} else {
+		_, err = r.builder.Update("saved_view").
+			Set("name", v.Name).Set("scope", v.Scope).Set("project", v.Project).
+			Set("filter", string(filter)).Set("ordering", order).Set("metrics", metrics).Set("time", v.Time.Unix()).
+			Where("saved_view.id = ?", v.ID).RunWith(r.DB).Exec()
+	}
+	if err != nil {
+		log.Errorf("Error while saving view '%s' of %s: %v", v.Name, v.Owner, err)
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// DeleteView deletes the view with the database id `id` and returns it.
+// Only the owner and admins may delete a view.
+func (r *ViewRepository) DeleteView(ctx context.Context, id int64) (*model.SavedView, error) {
+	user := GetUserFromContext(ctx)
+	if user == nil {
+		return nil, fmt.Errorf("user context is nil")
+	}
+
+	v, err := r.GetView(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if v.Owner != user.Username && !user.HasRole(schema.RoleAdmin) {
+		return nil, ErrViewForbidden
+	}
+
+	if _, err := r.builder.Delete("saved_view").Where("saved_view.id = ?", id).RunWith(r.DB).Exec(); err != nil {
+		log.Errorf("Error while deleting view %d: %v", id, err)
+		return nil, err
+	}
+
+	return v, nil
+}
@@ -145,7 +145,7 @@ func setupTaglistRoute(i InfoType, r *http.Request) InfoType {
 		tagItem := map[string]interface{}{
 			"id":    tag.ID,
 			"name":  tag.Name,
-			"count": counts[tag.Name],
+			"count": counts[tag.ID],
 		}
 		tagMap[tag.Type] = append(tagMap[tag.Type], tagItem)
 	}
@@ -239,6 +239,12 @@ func buildFilterPresets(query url.Values) map[string]interface{} {
 			filterPresets["arrayJobId"] = num
 		}
 	}
+	for _, key := range []string{"cluster", "partition", "jobName", "node"} {
+		switch match := query.Get(key + "Match"); match {
+		case "eq", "neq", "contains", "startsWith", "endsWith":
+			filterPresets[key+"Match"] = match
+		}
+	}
 	if query.Get("startTime") != "" {
 		parts := strings.Split(query.Get("startTime"), "-")
 		if len(parts) == 2 {
@@ -256,6 +262,116 @@ func buildFilterPresets(query url.Values) map[string]interface{} {
 	return filterPresets
 }
 
+// Returns the saved view given by the 'view' query parameter, nil if there is
+// none or it is not visible to the user.
+func loadView(r *http.Request) *model.SavedView {
+	id := r.URL.Query().Get("view")
+	if id == "" {
+		return nil
+	}
+
+	vid, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		log.Warnf("invalid view id '%s'", id)
+		return nil
+	}
+
+	view, err := repository.GetViewRepository().GetView(r.Context(), vid)
+	if err != nil {
+		log.Warnf("failed to load view %d: %s", vid, err.Error())
+		return nil
+	}
+
+	return view
+}
+
+// Returns the value and the match type of a string filter for the presets.
+func stringPreset(input *model.StringInput) (interface{}, string) {
+	switch {
+	case input.Eq != nil:
+		return *input.Eq, "eq"
+	case input.Neq != nil:
+		return *input.Neq, "neq"
+	case input.Contains != nil:
+		return *input.Contains, "contains"
+	case input.StartsWith != nil:
+		return *input.StartsWith, "startsWith"
+	case input.EndsWith != nil:
+		return *input.EndsWith, "endsWith"
+	case input.In != nil:
+		return input.In, "in"
+	}
+
+	return nil, ""
+}
+
+// Builds the same filter presets as buildFilterPresets from the filters of a
+// saved view, plus the sorting and the metrics of the job list.
+func buildViewPresets(view *model.SavedView) map[string]interface{} {
+	filterPresets := map[string]interface{}{}
+	if view.Order != nil {
+		filterPresets["sorting"] = map[string]string{"field": view.Order.Field, "order": string(view.Order.Order)}
+	}
+	if len(view.Metrics) != 0 {
+		filterPresets["metrics"] = view.Metrics
+	}
+
+	for _, f := range view.Filter {
+		for key, input := range map[string]*model.StringInput{
+			"cluster":   f.Cluster,
+			"partition": f.Partition,
+			"project":   f.Project,
+			"user":      f.User,
+			"jobName":   f.JobName,
+			"jobId":     f.JobID,
+			"node":      f.Node,
+		} {
+			if input == nil {
+				continue
+			}
+			if value, match := stringPreset(input); value != nil {
+				filterPresets[key] = value
+				filterPresets[key+"Match"] = match
+			}
+		}
+
+		if f.State != nil {
+			filterPresets["state"] = f.State
+		}
+		if f.Tags != nil {
+			tags := make([]int, len(f.Tags))
+			for i, tid := range f.Tags {
+				var err error
+				tags[i], err = strconv.Atoi(tid)
+				if err != nil {
+					tags[i] = -1
+				}
+			}
+			filterPresets["tags"] = tags
+		}
+		for key, rng := range map[string]*schema.IntRange{
+			"duration":        f.Duration,
+			"numNodes":        f.NumNodes,
+			"numAccelerators": f.NumAccelerators,
+		} {
+			if rng != nil {
+				filterPresets[key] = map[string]int{"from": rng.From, "to": rng.To}
+			}
+		}
+		if f.ArrayJobID != nil {
+			filterPresets["arrayJobId"] = *f.ArrayJobID
+		}
+		if f.StartTime != nil && f.StartTime.From != nil && f.StartTime.To != nil {
+			filterPresets["startTime"] = map[string]string{
+				"from": f.StartTime.From.Format(time.RFC3339),
+				"to":   f.StartTime.To.Format(time.RFC3339),
+			}
+		}
+	}
+
+	return filterPresets
+}
+
 func SetupRoutes(router *mux.Router, buildInfo web.Build) {
 	userCfgRepo := repository.GetUserCfgRepo()
 	for _, route := range routes {
@@ -289,6 +405,9 @@ func SetupRoutes(router *mux.Router, buildInfo web.Build) {
 
 			if route.Filter {
 				page.FilterPresets = buildFilterPresets(r.URL.Query())
+				if view := loadView(r); view != nil {
+					page.FilterPresets = buildViewPresets(view)
+				}
 			}
 
 			web.RenderTemplate(rw, route.Template, &page)
@@ -125,6 +125,23 @@ func GetStatistics(job *schema.Job) (map[string]schema.JobStatistics, error) {
 	return metaFile.Statistics, nil
 }
 
+// Returns the scopes at which each metric of the job was archived. Jobs
+// archived before the scopes were recorded return nil.
+func GetArchivedScopes(job *schema.Job) (map[string][]schema.MetricScope, error) {
+
+	if !useArchive {
+		return nil, nil
+	}
+
+	metaFile, err := ar.LoadJobMeta(job)
+	if err != nil {
+		log.Warn("Error while loading job metadata from archiveBackend")
+		return nil, err
+	}
+
+	return metaFile.ArchivedScopes, nil
+}
+
 // If the job is archived, find its `meta.json` file and override the tags list
 // in that JSON file. If the job is not archived, nothing is done.
 func UpdateTags(job *schema.Job, tags []*schema.Tag) error {
@@ -149,3 +166,30 @@ func UpdateTags(job *schema.Job, tags []*schema.Tag) error {
 
 	return ar.StoreJobMeta(jobMeta)
 }
+
+// If the job is archived, find its `meta.json` file and override the fields
+// which may be changed after the start of a job with those of `job`. If the
+// job is not archived, nothing is done.
+func UpdateJobMeta(job *schema.Job) error {
+
+	if job.State == schema.JobStateRunning || !useArchive {
+		return nil
+	}
+
+	jobMeta, err := ar.LoadJobMeta(job)
+	if err != nil {
+		log.Warn("Error while loading job metadata from archiveBackend")
+		return err
+	}
+
+	jobMeta.Walltime = job.Walltime
+	jobMeta.Partition = job.Partition
+	jobMeta.ArrayJobId = job.ArrayJobId
+	jobMeta.NumNodes = job.NumNodes
+	jobMeta.NumHWThreads = job.NumHWThreads
+	jobMeta.NumAcc = job.NumAcc
+	jobMeta.Resources = job.Resources
+	jobMeta.MetaData = job.MetaData
+
+	return ar.StoreJobMeta(jobMeta)
+}
@@ -34,6 +34,7 @@ type BaseJob struct {
 	State            JobState          `json:"jobState" db:"job_state" example:"completed" enums:"completed,failed,cancelled,stopped,timeout,out_of_memory"` // Final state of job
 	Duration         int32             `json:"duration" db:"duration" example:"43200" minimum:"1"`                                                           // Duration of job in seconds (Min > 0)
 	Walltime         int64             `json:"walltime,omitempty" db:"walltime" example:"86400" minimum:"1"`                                                 // Requested walltime of job in seconds (Min > 0)
+	Energy           float64           `json:"energy,omitempty" db:"energy" example:"12.5"`                                                                  // Energy consumed by job in kWh
 	Tags             []*Tag            `json:"tags,omitempty"`                                                                                               // List of tags
 	RawResources     []byte            `json:"-" db:"resources"`                                                                                             // Resources used by job [As Bytes]
 	Resources        []*Resource       `json:"resources"`                                                                                                    // Resources used by job
@@ -52,16 +53,25 @@ type Job struct {
 	// The unique identifier of a job in the database
 	ID int64 `json:"id" db:"id"`
 	BaseJob
-	StartTimeUnix    int64     `json:"-" db:"start_time" example:"1649723812"` // Start epoch time stamp in seconds
-	StartTime        time.Time `json:"startTime"`                              // Start time as 'time.Time' data type
-	MemUsedMax       float64   `json:"memUsedMax" db:"mem_used_max"`           // MemUsedMax as Float64
-	FlopsAnyAvg      float64   `json:"flopsAnyAvg" db:"flops_any_avg"`         // FlopsAnyAvg as Float64
-	MemBwAvg         float64   `json:"memBwAvg" db:"mem_bw_avg"`               // MemBwAvg as Float64
-	LoadAvg          float64   `json:"loadAvg" db:"load_avg"`                  // LoadAvg as Float64
-	NetBwAvg         float64   `json:"-" db:"net_bw_avg"`                      // NetBwAvg as Float64
-	NetDataVolTotal  float64   `json:"-" db:"net_data_vol_total"`              // NetDataVolTotal as Float64
-	FileBwAvg        float64   `json:"-" db:"file_bw_avg"`                     // FileBwAvg as Float64
-	FileDataVolTotal float64   `json:"-" db:"file_data_vol_total"`             // FileDataVolTotal as Float64
+	StartTimeUnix int64              `json:"-" db:"start_time" example:"1649723812"` // Start epoch time stamp in seconds
+	StartTime     time.Time          `json:"startTime"`                              // Start time as 'time.Time' data type
+	RawFootprint  []byte             `json:"-" db:"footprint"`                       // Footprint of job [As Bytes]
+	Footprint     map[string]float64 `json:"footprint,omitempty"`                    // Footprint statistics of job, keyed by '<metric>_<stat>'
+	// Deprecated: The statistics below are filled from the footprint for
+	// clients of the REST API and will be removed in the next release.
+	MemUsedMax  float64 `json:"memUsedMax" db:"-"`  // Deprecated: Use footprint 'mem_used_max'
+	FlopsAnyAvg float64 `json:"flopsAnyAvg" db:"-"` // Deprecated: Use footprint 'flops_any_avg'
+	MemBwAvg    float64 `json:"memBwAvg" db:"-"`    // Deprecated: Use footprint 'mem_bw_avg'
+	LoadAvg     float64 `json:"loadAvg" db:"-"`     // Deprecated: Use footprint 'cpu_load_avg'
+}
+
+// SetDeprecatedStatistics fills the statistics replaced by the footprint
+// from the footprint, values missing in it are zero.
+func (j *Job) SetDeprecatedStatistics() {
+	j.MemUsedMax = j.Footprint["mem_used_max"]
+	j.FlopsAnyAvg = j.Footprint["flops_any_avg"]
+	j.MemBwAvg = j.Footprint["mem_bw_avg"]
+	j.LoadAvg = j.Footprint["cpu_load_avg"]
 }
 
 //	JobMeta struct type
@@ -91,8 +101,10 @@ type JobMeta struct {
 	// The unique identifier of a job in the database
 	ID *int64 `json:"id,omitempty"`
 	BaseJob
-	StartTime  int64                    `json:"startTime" db:"start_time" example:"1649723812" minimum:"1"` // Start epoch time stamp in seconds (Min > 0)
-	Statistics map[string]JobStatistics `json:"statistics"`                                                 // Metric statistics of job
+	StartTime             int64                               `json:"startTime" db:"start_time" example:"1649723812" minimum:"1"` // Start epoch time stamp in seconds (Min > 0)
+	Statistics            map[string]JobStatistics            `json:"statistics"`                                                 // Metric statistics of job
+	AcceleratorStatistics map[string][]*AcceleratorStatistics `json:"acceleratorStatistics,omitempty"`                            // Per-accelerator statistics of accelerator metrics
+	ArchivedScopes        map[string][]MetricScope            `json:"archivedScopes,omitempty"`                                   // Scopes at which each metric was archived
 }
 
 const (
@@ -121,12 +133,24 @@ type JobStatistics struct {
 	Max  float64 `json:"max" example:"3000" minimum:"0"` // Job metric maximum
 }
 
+// AcceleratorStatistics model
+// @Description Metric statistics of a single accelerator used by a job.
+type AcceleratorStatistics struct {
+	Hostname string  `json:"hostname" example:"e1101"`      // Name of the host the accelerator is attached to
+	ID       string  `json:"id" example:"00000000:3B:00.0"` // Accelerator device id
+	Avg      float64 `json:"avg" example:"80" minimum:"0"`  // Accelerator metric average
+	Min      float64 `json:"min" example:"40" minimum:"0"`  // Accelerator metric minimum
+	Max      float64 `json:"max" example:"100" minimum:"0"` // Accelerator metric maximum
+}
+
 // Tag model
 // @Description Defines a tag using name and type.
 type Tag struct {
-	ID   int64  `json:"id" db:"id"`                           // The unique DB identifier of a tag
-	Type string `json:"type" db:"tag_type" example:"Debug"`   // Tag Type
-	Name string `json:"name" db:"tag_name" example:"Testjob"` // Tag Name
+	ID    int64    `json:"id" db:"id"`                                       // The unique DB identifier of a tag
+	Type  string   `json:"type" db:"tag_type" example:"Debug"`               // Tag Type
+	Name  string   `json:"name" db:"tag_name" example:"Testjob"`             // Tag Name
+	Scope TagScope `json:"scope,omitempty" db:"tag_scope" example:"global"`  // Tag Scope, global if empty
+	Owner string   `json:"owner,omitempty" db:"tag_owner" example:"abcd100"` // Project of project tags, user of private tags
 }
 
 // Resource model
@@ -138,6 +162,40 @@ type Resource struct {
 	Configuration string   `json:"configuration,omitempty"` // The configuration options of the node
 }
 
+// Global tags are visible to everyone, project tags to the members and
+// managers of the project and private tags only to their owner.
+type TagScope string
+
+const (
+	TagScopeGlobal  TagScope = "global"
+	TagScopeProject TagScope = "project"
+	TagScopePrivate TagScope = "private"
+)
+
+func (e *TagScope) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("SCHEMA/JOB > enums must be strings")
+	}
+
+	*e = TagScope(str)
+	if !e.Valid() {
+		return errors.New("SCHEMA/JOB > invalid tag scope")
+	}
+
+	return nil
+}
+
+func (e TagScope) MarshalGQL(w io.Writer) {
+	fmt.Fprintf(w, "\"%s\"", e)
+}
+
+func (e TagScope) Valid() bool {
+	return e == TagScopeGlobal ||
+		e == TagScopeProject ||
+		e == TagScopePrivate
+}
+
 type JobState string
 
 const (
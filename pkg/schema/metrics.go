@@ -122,6 +122,9 @@ func (jd *JobData) Size() int {
 				n += len(metric.StatisticsSeries.Max)
 				n += len(metric.StatisticsSeries.Mean)
 				n += len(metric.StatisticsSeries.Min)
+				for _, percentiles := range metric.StatisticsSeries.Percentiles {
+					n += len(percentiles)
+				}
 			}
 
 			for _, series := range metric.Series {
@@ -266,12 +269,79 @@ func (jd *JobData) AddNodeScope(metric string) bool {
 	return true
 }
 
+// Aggregates the series of a metric at any scope to node level and returns
+// the resulting statistics per hostname. Values of the same host and timestep
+// are added up if aggregation is "sum" and averaged otherwise. If there is no
+// data at all, the statistics of the individual series are combined instead.
+func (jm *JobMetric) NodeStatistics(aggregation string) map[string]MetricStatistics {
+	hosts := make(map[string][]Series, 32)
+	for _, series := range jm.Series {
+		hosts[series.Hostname] = append(hosts[series.Hostname], series)
+	}
+
+	stats := make(map[string]MetricStatistics, len(hosts))
+	for hostname, series := range hosts {
+		n := 0
+		for _, s := range series {
+			if len(s.Data) > n {
+				n = len(s.Data)
+			}
+		}
+
+		min, sum, max := math.MaxFloat32, 0.0, -math.MaxFloat32
+		points := 0
+		for i := 0; i < n; i++ {
+			x, notnan := 0.0, 0
+			for _, s := range series {
+				if i < len(s.Data) && !s.Data[i].IsNaN() {
+					x += float64(s.Data[i])
+					notnan += 1
+				}
+			}
+
+			if notnan == 0 {
+				continue
+			}
+			if aggregation != "sum" {
+				x /= float64(notnan)
+			}
+
+			points += 1
+			sum += x
+			min = math.Min(min, x)
+			max = math.Max(max, x)
+		}
+
+		if points != 0 {
+			stats[hostname] = MetricStatistics{Avg: sum / float64(points), Min: min, Max: max}
+			continue
+		}
+
+		// The minima and maxima of the series may be reached at different
+		// times, so only their extremes are known for the aggregate.
+		sumAvg := 0.0
+		min, max = math.MaxFloat32, -math.MaxFloat32
+		for _, s := range series {
+			sumAvg += s.Statistics.Avg
+			min = math.Min(min, s.Statistics.Min)
+			max = math.Max(max, s.Statistics.Max)
+		}
+
+		if aggregation != "sum" {
+			sumAvg /= float64(len(series))
+		}
+		stats[hostname] = MetricStatistics{Avg: sumAvg, Min: min, Max: max}
+	}
+
+	return stats
+}
+
 func (jm *JobMetric) AddPercentiles(ps []int) bool {
 	if jm.StatisticsSeries == nil {
 		jm.AddStatisticsSeries()
 	}
 
-	if len(jm.Series) < 3 {
+	if jm.StatisticsSeries == nil || len(jm.Series) < 3 {
 		return false
 	}
 
@@ -290,7 +360,7 @@ func (jm *JobMetric) AddPercentiles(ps []int) bool {
 	for i := 0; i < n; i++ {
 		vals := make([]float64, 0, len(jm.Series))
 		for _, series := range jm.Series {
-			if i < len(series.Data) {
+			if i < len(series.Data) && !series.Data[i].IsNaN() {
 				vals = append(vals, float64(series.Data[i]))
 			}
 		}
@@ -311,6 +381,10 @@ func (jm *JobMetric) AddPercentiles(ps []int) bool {
 		percentiles := make([]Float, n)
 		for i := 0; i < n; i++ {
 			sorted := data[i]
+			if len(sorted) == 0 {
+				percentiles[i] = NaN
+				continue
+			}
 			percentiles[i] = Float(sorted[(len(sorted)*p)/100])
 		}
 
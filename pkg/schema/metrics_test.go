@@ -0,0 +1,71 @@
+// Copyright (C) 2022 NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+package schema
+
+import (
+	"testing"
+)
+
+func TestAddPercentiles(t *testing.T) {
+	jm := JobMetric{}
+	for i := 0; i < 10; i++ {
+		jm.Series = append(jm.Series, Series{
+			Hostname: "host",
+			Data:     []Float{Float(i), Float(10 - i), NaN},
+		})
+	}
+
+	if !jm.AddPercentiles([]int{10, 50, 90}) {
+		t.Fatal("AddPercentiles() returned false, expected true")
+	}
+
+	median := jm.StatisticsSeries.Percentiles[50]
+	if len(median) != 3 {
+		t.Fatalf("expected 3 values for median, got %d", len(median))
+	}
+	if median[0] != 5 || median[1] != 6 {
+		t.Errorf("wrong median\ngot: %v \nwant: [5 6 NaN]", median)
+	}
+	if !median[2].IsNaN() {
+		t.Errorf("expected NaN for timestep without data, got %f", median[2])
+	}
+	if p90 := jm.StatisticsSeries.Percentiles[90]; p90[0] != 9 {
+		t.Errorf("wrong p90\ngot: %v \nwant: 9", p90[0])
+	}
+}
+
+func TestAddPercentilesBelowThreshold(t *testing.T) {
+	jm := JobMetric{Series: []Series{
+		{Hostname: "a", Data: []Float{1, 2}},
+		{Hostname: "b", Data: []Float{1, 2}},
+		{Hostname: "c", Data: []Float{1, 2}},
+	}}
+
+	if jm.AddPercentiles([]int{50}) {
+		t.Fatal("AddPercentiles() returned true, expected false")
+	}
+}
+
+func TestNodeStatistics(t *testing.T) {
+	acc0, acc1 := "0", "1"
+	jm := JobMetric{Series: []Series{
+		{Hostname: "host1", Id: &acc0, Data: []Float{10, 20, NaN}},
+		{Hostname: "host1", Id: &acc1, Data: []Float{30, 40, 70}},
+		{Hostname: "host2", Id: &acc0, Data: []Float{5, 5, 5}},
+	}}
+
+	sum := jm.NodeStatistics("sum")
+	if s := sum["host1"]; s.Min != 40 || s.Max != 70 || s.Avg != 170.0/3 {
+		t.Errorf("wrong sum statistics for host1\ngot: %+v \nwant: {Avg:56.67 Min:40 Max:70}", s)
+	}
+	if s := sum["host2"]; s.Min != 5 || s.Max != 5 || s.Avg != 5 {
+		t.Errorf("wrong sum statistics for host2\ngot: %+v \nwant: {Avg:5 Min:5 Max:5}", s)
+	}
+
+	avg := jm.NodeStatistics("avg")
+	if s := avg["host1"]; s.Min != 20 || s.Max != 70 || s.Avg != 40 {
+		t.Errorf("wrong avg statistics for host1\ngot: %+v \nwant: {Avg:40 Min:20 Max:70}", s)
+	}
+}
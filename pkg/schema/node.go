@@ -0,0 +1,51 @@
+// Copyright (C) 2022 NHR@FAU, University Erlangen-Nuremberg.
+// All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+type NodeState string
+
+const (
+	NodeStateIdle        NodeState = "idle"
+	NodeStateAllocated   NodeState = "allocated"
+	NodeStateMixed       NodeState = "mixed"
+	NodeStateDown        NodeState = "down"
+	NodeStateDrain       NodeState = "drain"
+	NodeStateMaintenance NodeState = "maintenance"
+	NodeStateUnknown     NodeState = "unknown" // No state reported yet
+)
+
+func (e *NodeState) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("SCHEMA/NODE > enums must be strings")
+	}
+
+	*e = NodeState(str)
+	if !e.Valid() {
+		return errors.New("SCHEMA/NODE > invalid node state")
+	}
+
+	return nil
+}
+
+func (e NodeState) MarshalGQL(w io.Writer) {
+	fmt.Fprintf(w, "\"%s\"", e)
+}
+
+func (e NodeState) Valid() bool {
+	return e == NodeStateIdle ||
+		e == NodeStateAllocated ||
+		e == NodeStateMixed ||
+		e == NodeStateDown ||
+		e == NodeStateDrain ||
+		e == NodeStateMaintenance ||
+		e == NodeStateUnknown
+}